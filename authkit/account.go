@@ -0,0 +1,38 @@
+package authkit
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+)
+
+type (
+
+	// AccountStore is an optional interface of UserService, which enables
+	// account export and deletion handlers.
+	AccountStore interface {
+
+		// OAuth2Tokens returns all user's tokens by provider ID.
+		OAuth2Tokens(ctx context.Context, login string) (map[string]*oauth2.Token, UserServiceError)
+
+		// DeleteUser deletes user with all data, kept by the store (tokens,
+		// sessions, second factor, recovery codes). Tokens should be revoked
+		// by caller beforehand.
+		DeleteUser(ctx context.Context, login string) UserServiceError
+	}
+
+	// AccountProfileService is an optional interface of ProfileService,
+	// which enables account export and deletion handlers.
+	AccountProfileService interface {
+
+		// Profile returns stored profile by login.
+		Profile(ctx context.Context, login string) (Profile, error)
+
+		// DeleteProfile deletes user's profile. It returns nil, if profile
+		// doesn't exist.
+		DeleteProfile(ctx context.Context, login string) error
+	}
+)
+
+//go:generate mockery -name AccountStore
+//go:generate mockery -name AccountProfileService
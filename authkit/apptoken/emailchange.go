@@ -0,0 +1,109 @@
+package apptoken
+
+import (
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+const purposeEmailChange = "email-change"
+
+type (
+
+	// EmailChangeToken represents token, sent to the new email address to
+	// confirm email change.
+	EmailChangeToken interface {
+
+		// Login returns user's login.
+		Login() string
+
+		// OldEmail returns user's email at the time of request.
+		OldEmail() string
+
+		// NewEmail returns email address to be confirmed.
+		NewEmail() string
+	}
+
+	emailChangeTokenFields struct {
+		Login    string `json:"login"`
+		Purpose  string `json:"pur"`
+		OldEmail string `json:"oldemail"`
+		NewEmail string `json:"newemail"`
+	}
+
+	emailChangeToken struct {
+		jwt.StandardClaims
+		emailChangeTokenFields
+	}
+)
+
+// NewEmailChangeTokenString creates new jwt token and converts it to signed
+// string. It may be used to create confirmation URL for the new email.
+func NewEmailChangeTokenString(
+	issuer, login, oldEmail, newEmail string,
+	expiration time.Duration,
+	signKey []byte) (string, error) {
+	claims := emailChangeToken{
+		jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(expiration).Unix(),
+			Issuer:    issuer,
+			Audience:  issuer,
+		},
+		emailChangeTokenFields{
+			login,
+			purposeEmailChange,
+			oldEmail,
+			newEmail,
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(signKey)
+}
+
+// ParseEmailChangeToken can parse jwt tokens from strings created by
+// NewEmailChangeTokenString.
+func ParseEmailChangeToken(
+	issuer, token string,
+	signKey []byte) (EmailChangeToken, error) {
+	t, err := jwt.ParseWithClaims(
+		token,
+		&emailChangeToken{},
+		func(token *jwt.Token) (interface{}, error) {
+			return signKey, nil
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid token")
+	}
+	claims, ok := t.Claims.(*emailChangeToken)
+	if !ok || !t.Valid {
+		return nil, errors.WithStack(ErrInvalidToken)
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.WithStack(ErrInvalidToken)
+	}
+	if !claims.VerifyIssuer(issuer, true) {
+		return nil, errors.WithStack(ErrInvalidToken)
+	}
+	if !claims.VerifyAudience(issuer, true) {
+		return nil, errors.WithStack(ErrInvalidToken)
+	}
+	if claims.Purpose != purposeEmailChange ||
+		claims.emailChangeTokenFields.Login == "" ||
+		claims.emailChangeTokenFields.NewEmail == "" {
+		return nil, errors.WithStack(ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+func (t *emailChangeToken) Login() string {
+	return t.emailChangeTokenFields.Login
+}
+
+func (t *emailChangeToken) OldEmail() string {
+	return t.emailChangeTokenFields.OldEmail
+}
+
+func (t *emailChangeToken) NewEmail() string {
+	return t.emailChangeTokenFields.NewEmail
+}
@@ -0,0 +1,49 @@
+package apptoken
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmailChangeToken(t *testing.T) {
+	assert := assert.New(t)
+	key := []byte("some secret")
+
+	s, err := NewEmailChangeTokenString(
+		"some issuer",
+		"some login",
+		"old@email.com",
+		"new@email.com",
+		time.Hour,
+		key)
+	require.NoError(t, err)
+	token, err := ParseEmailChangeToken("some issuer", s, key)
+	require.NoError(t, err)
+	assert.Equal("some login", token.Login())
+	assert.Equal("old@email.com", token.OldEmail())
+	assert.Equal("new@email.com", token.NewEmail())
+
+	_, err = ParseEmailChangeToken("some other issuer", s, key)
+	assert.Equal(ErrInvalidToken, errors.Cause(err))
+
+	// Email confirmation token can't be used to change email.
+	s, err = NewEmailTokenString("some issuer", "some login", "new@email.com", "", time.Hour, key)
+	require.NoError(t, err)
+	_, err = ParseEmailChangeToken("some issuer", s, key)
+	assert.Equal(ErrInvalidToken, errors.Cause(err))
+
+	s, err = NewEmailChangeTokenString(
+		"some issuer",
+		"some login",
+		"old@email.com",
+		"new@email.com",
+		-time.Hour,
+		key)
+	require.NoError(t, err)
+	_, err = ParseEmailChangeToken("some issuer", s, key)
+	assert.Error(err)
+}
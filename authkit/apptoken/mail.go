@@ -7,6 +7,13 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Purposes of email tokens. Purpose is packed into the token, so that token
+// sent to confirm email cannot be used to change password and vice versa.
+const (
+	purposeEmailConfirmation = "email-confirm"
+	purposePasswordChange    = "password-change"
+)
+
 // EmailToken represents token, used to be sent in confirmation email.
 type (
 	EmailToken interface {
@@ -27,6 +34,7 @@ type (
 
 	mailTokenFields struct {
 		Login        string `json:"login"`
+		Purpose      string `json:"pur"`
 		Email        string `json:"email"`
 		PasswordHash string `json:"pwdh"`
 	}
@@ -38,31 +46,67 @@ type (
 )
 
 // NewEmailTokenString creates new jwt token and converts it to signed string.
-// It may be used to create password reset URL for confirmation email.
+// It may be used to create email confirmation URL for confirmation email.
 func NewEmailTokenString(
 	issuer, login, email, passwordHash string,
 	expiration time.Duration,
 	signKey []byte) (string, error) {
+	return newMailTokenString(
+		issuer,
+		mailTokenFields{login, purposeEmailConfirmation, email, passwordHash},
+		expiration,
+		signKey)
+}
+
+// ParseEmailToken can parse jwt tokens from strings created by NewEmailTokenString.
+func ParseEmailToken(
+	issuer, token string,
+	signKey []byte) (EmailToken, error) {
+	return parseMailToken(issuer, token, purposeEmailConfirmation, signKey)
+}
+
+// NewPasswordChangeTokenString creates new jwt token and converts it to
+// signed string. It may be used to create password reset URL for
+// confirmation email.
+func NewPasswordChangeTokenString(
+	issuer, login, email, passwordHash string,
+	expiration time.Duration,
+	signKey []byte) (string, error) {
+	return newMailTokenString(
+		issuer,
+		mailTokenFields{login, purposePasswordChange, email, passwordHash},
+		expiration,
+		signKey)
+}
+
+// ParsePasswordChangeToken can parse jwt tokens from strings created by
+// NewPasswordChangeTokenString.
+func ParsePasswordChangeToken(
+	issuer, token string,
+	signKey []byte) (EmailToken, error) {
+	return parseMailToken(issuer, token, purposePasswordChange, signKey)
+}
+
+func newMailTokenString(
+	issuer string,
+	fields mailTokenFields,
+	expiration time.Duration,
+	signKey []byte) (string, error) {
 	claims := mailToken{
 		jwt.StandardClaims{
 			ExpiresAt: time.Now().Add(expiration).Unix(),
 			Issuer:    issuer,
 			Audience:  issuer,
 		},
-		mailTokenFields{
-			login,
-			email,
-			passwordHash,
-		},
+		fields,
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(signKey)
 }
 
-// ParseEmailToken can parse jwt tokens from strings created by NewEmailTokenString.
-func ParseEmailToken(
-	issuer, token string,
-	signKey []byte) (EmailToken, error) {
+func parseMailToken(
+	issuer, token, purpose string,
+	signKey []byte) (*mailToken, error) {
 	t, err := jwt.ParseWithClaims(
 		token,
 		&mailToken{},
@@ -85,6 +129,9 @@ func ParseEmailToken(
 	if !claims.VerifyAudience(issuer, true) {
 		return nil, errors.WithStack(ErrInvalidToken)
 	}
+	if claims.Purpose != purpose {
+		return nil, errors.WithStack(ErrInvalidToken)
+	}
 	return claims, nil
 }
 
@@ -87,3 +87,48 @@ func TestEmailToken(t *testing.T) {
 		})
 	}
 }
+
+func TestEmailTokenPurpose(t *testing.T) {
+	assert := assert.New(t)
+	key := []byte("some secret")
+
+	s, err := NewPasswordChangeTokenString(
+		"some issuer",
+		"some login",
+		"",
+		"some hash",
+		time.Hour,
+		key)
+	assert.NoError(err)
+	token, err := ParsePasswordChangeToken("some issuer", s, key)
+	assert.NoError(err)
+	assert.Equal("some login", token.Login())
+	assert.Equal("some hash", token.PasswordHash())
+
+	// Tokens of other purposes are rejected.
+	_, err = ParseEmailToken("some issuer", s, key)
+	assert.Equal(ErrInvalidToken, errors.Cause(err))
+
+	s, err = NewEmailTokenString("some issuer", "some login", "a@b.c", "", time.Hour, key)
+	assert.NoError(err)
+	_, err = ParsePasswordChangeToken("some issuer", s, key)
+	assert.Equal(ErrInvalidToken, errors.Cause(err))
+
+	s, err = NewSecondFactorTokenString("some issuer", "some login", time.Hour, key)
+	assert.NoError(err)
+	_, err = ParseEmailToken("some issuer", s, key)
+	assert.Equal(ErrInvalidToken, errors.Cause(err))
+	_, err = ParsePasswordChangeToken("some issuer", s, key)
+	assert.Equal(ErrInvalidToken, errors.Cause(err))
+
+	s, err = NewEmailChangeTokenString(
+		"some issuer",
+		"some login",
+		"old@email.com",
+		"new@email.com",
+		time.Hour,
+		key)
+	assert.NoError(err)
+	_, err = ParseEmailToken("some issuer", s, key)
+	assert.Equal(ErrInvalidToken, errors.Cause(err))
+}
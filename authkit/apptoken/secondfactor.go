@@ -0,0 +1,181 @@
+package apptoken
+
+import (
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// Purposes of tokens, used in two-factor authentication and
+// re-authentication. Purpose is packed into the token, so that token issued
+// for one step cannot be used for another.
+const (
+	purposeSecondFactor     = "2fa"
+	purposeTOTPEnrollment   = "totp-enroll"
+	purposeReauthentication = "reauth"
+)
+
+type (
+
+	// SecondFactorToken represents token, issued after successful password
+	// check for the user, who has second factor enabled. Token should be
+	// returned to the server with the second factor code.
+	SecondFactorToken interface {
+
+		// Login returns user's login.
+		Login() string
+	}
+
+	// TOTPEnrollmentToken represents token, issued at the start of TOTP
+	// enrollment. It keeps new secret until user confirms it with a code.
+	TOTPEnrollmentToken interface {
+
+		// Login returns user's login.
+		Login() string
+
+		// Secret returns new base32-encoded TOTP secret.
+		Secret() string
+	}
+
+	// ReauthenticationToken represents token, issued to the user, who has
+	// just logged in again with already linked external provider. It
+	// confirms identity of the user without password before sensitive
+	// operations.
+	ReauthenticationToken interface {
+
+		// Login returns user's login.
+		Login() string
+	}
+
+	secondFactorTokenFields struct {
+		Login   string `json:"login"`
+		Purpose string `json:"pur"`
+		Secret  string `json:"secret,omitempty"`
+	}
+
+	secondFactorToken struct {
+		jwt.StandardClaims
+		secondFactorTokenFields
+	}
+)
+
+// NewSecondFactorTokenString creates new jwt token and converts it to signed
+// string. It is used to pass login from password check to second factor check.
+func NewSecondFactorTokenString(
+	issuer, login string,
+	expiration time.Duration,
+	signKey []byte) (string, error) {
+	return newSecondFactorTokenString(
+		issuer,
+		secondFactorTokenFields{login, purposeSecondFactor, ""},
+		expiration,
+		signKey)
+}
+
+// ParseSecondFactorToken can parse jwt tokens from strings created by
+// NewSecondFactorTokenString.
+func ParseSecondFactorToken(
+	issuer, token string,
+	signKey []byte) (SecondFactorToken, error) {
+	return parseSecondFactorToken(issuer, token, purposeSecondFactor, signKey)
+}
+
+// NewTOTPEnrollmentTokenString creates new jwt token and converts it to
+// signed string. It is used to pass new TOTP secret to the client and back
+// until the user confirms it.
+func NewTOTPEnrollmentTokenString(
+	issuer, login, secret string,
+	expiration time.Duration,
+	signKey []byte) (string, error) {
+	return newSecondFactorTokenString(
+		issuer,
+		secondFactorTokenFields{login, purposeTOTPEnrollment, secret},
+		expiration,
+		signKey)
+}
+
+// ParseTOTPEnrollmentToken can parse jwt tokens from strings created by
+// NewTOTPEnrollmentTokenString.
+func ParseTOTPEnrollmentToken(
+	issuer, token string,
+	signKey []byte) (TOTPEnrollmentToken, error) {
+	return parseSecondFactorToken(issuer, token, purposeTOTPEnrollment, signKey)
+}
+
+// NewReauthenticationTokenString creates new jwt token and converts it to
+// signed string.
+func NewReauthenticationTokenString(
+	issuer, login string,
+	expiration time.Duration,
+	signKey []byte) (string, error) {
+	return newSecondFactorTokenString(
+		issuer,
+		secondFactorTokenFields{login, purposeReauthentication, ""},
+		expiration,
+		signKey)
+}
+
+// ParseReauthenticationToken can parse jwt tokens from strings created by
+// NewReauthenticationTokenString.
+func ParseReauthenticationToken(
+	issuer, token string,
+	signKey []byte) (ReauthenticationToken, error) {
+	return parseSecondFactorToken(issuer, token, purposeReauthentication, signKey)
+}
+
+func newSecondFactorTokenString(
+	issuer string,
+	fields secondFactorTokenFields,
+	expiration time.Duration,
+	signKey []byte) (string, error) {
+	claims := secondFactorToken{
+		jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(expiration).Unix(),
+			Issuer:    issuer,
+			Audience:  issuer,
+		},
+		fields,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(signKey)
+}
+
+func parseSecondFactorToken(
+	issuer, token, purpose string,
+	signKey []byte) (*secondFactorToken, error) {
+	t, err := jwt.ParseWithClaims(
+		token,
+		&secondFactorToken{},
+		func(token *jwt.Token) (interface{}, error) {
+			return signKey, nil
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid token")
+	}
+	claims, ok := t.Claims.(*secondFactorToken)
+	if !ok || !t.Valid {
+		return nil, errors.WithStack(ErrInvalidToken)
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.WithStack(ErrInvalidToken)
+	}
+	if !claims.VerifyIssuer(issuer, true) {
+		return nil, errors.WithStack(ErrInvalidToken)
+	}
+	if !claims.VerifyAudience(issuer, true) {
+		return nil, errors.WithStack(ErrInvalidToken)
+	}
+	if claims.Purpose != purpose || claims.secondFactorTokenFields.Login == "" {
+		return nil, errors.WithStack(ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+func (t *secondFactorToken) Login() string {
+	return t.secondFactorTokenFields.Login
+}
+
+func (t *secondFactorToken) Secret() string {
+	return t.secondFactorTokenFields.Secret
+}
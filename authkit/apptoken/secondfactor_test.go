@@ -0,0 +1,80 @@
+package apptoken
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecondFactorToken(t *testing.T) {
+	assert := assert.New(t)
+	key := []byte("some secret")
+
+	s, err := NewSecondFactorTokenString("some issuer", "some login", time.Minute, key)
+	require.NoError(t, err)
+	token, err := ParseSecondFactorToken("some issuer", s, key)
+	require.NoError(t, err)
+	assert.Equal("some login", token.Login())
+
+	_, err = ParseSecondFactorToken("some other issuer", s, key)
+	assert.Equal(ErrInvalidToken, errors.Cause(err))
+	_, err = ParseSecondFactorToken("some issuer", s, []byte("other secret"))
+	assert.Error(err)
+
+	// Token issued for another purpose is rejected.
+	_, err = ParseTOTPEnrollmentToken("some issuer", s, key)
+	assert.Equal(ErrInvalidToken, errors.Cause(err))
+
+	s, err = NewSecondFactorTokenString("some issuer", "some login", -time.Minute, key)
+	require.NoError(t, err)
+	_, err = ParseSecondFactorToken("some issuer", s, key)
+	assert.Error(err)
+}
+
+func TestTOTPEnrollmentToken(t *testing.T) {
+	assert := assert.New(t)
+	key := []byte("some secret")
+
+	s, err := NewTOTPEnrollmentTokenString(
+		"some issuer",
+		"some login",
+		"JBSWY3DPEHPK3PXP",
+		time.Minute,
+		key)
+	require.NoError(t, err)
+	token, err := ParseTOTPEnrollmentToken("some issuer", s, key)
+	require.NoError(t, err)
+	assert.Equal("some login", token.Login())
+	assert.Equal("JBSWY3DPEHPK3PXP", token.Secret())
+
+	_, err = ParseSecondFactorToken("some issuer", s, key)
+	assert.Equal(ErrInvalidToken, errors.Cause(err))
+
+	// Other token types are rejected.
+	s, err = NewEmailTokenString("some issuer", "some login", "a@b.c", "", time.Minute, key)
+	require.NoError(t, err)
+	_, err = ParseTOTPEnrollmentToken("some issuer", s, key)
+	assert.Equal(ErrInvalidToken, errors.Cause(err))
+}
+
+func TestReauthenticationToken(t *testing.T) {
+	assert := assert.New(t)
+	key := []byte("some secret")
+
+	s, err := NewReauthenticationTokenString("some issuer", "some login", time.Minute, key)
+	require.NoError(t, err)
+	token, err := ParseReauthenticationToken("some issuer", s, key)
+	require.NoError(t, err)
+	assert.Equal("some login", token.Login())
+
+	// Token issued for another purpose is rejected.
+	_, err = ParseSecondFactorToken("some issuer", s, key)
+	assert.Equal(ErrInvalidToken, errors.Cause(err))
+	s, err = NewSecondFactorTokenString("some issuer", "some login", time.Minute, key)
+	require.NoError(t, err)
+	_, err = ParseReauthenticationToken("some issuer", s, key)
+	assert.Equal(ErrInvalidToken, errors.Cause(err))
+}
@@ -17,11 +17,48 @@ type (
 
 		// User's login if known at state creation (like in case of form-based auth)
 		Login() string
+
+		// Link is true, if OAuth2 flow is initiated by authenticated user
+		// (see Login) to link provider to the account.
+		Link() bool
+
+		// PKCENonce is a nonce, used to derive PKCE code verifier of the
+		// auth request (RFC 7636). It is empty, if PKCE is not used.
+		PKCENonce() string
+
+		// OIDCNonce is a nonce, sent to OpenID Connect provider in the auth
+		// request. It is empty, if provider is not OpenID Connect provider.
+		OIDCNonce() string
+
+		// LinkNonce binds request to link provider (see Link) to the
+		// browser, which initiated it.
+		LinkNonce() string
+	}
+
+	// Nonces are nonces of the auth request, packed into state token.
+	Nonces struct {
+
+		// PKCE is used to derive PKCE code verifier. Nonce is not a secret,
+		// code verifier should be derived from it with a secret, which is
+		// not sent to OAuth2 provider.
+		PKCE string
+
+		// OIDC is sent to OpenID Connect provider and is expected in
+		// id_token.
+		OIDC string
+
+		// Link binds link request to the browser. Nonce should be derived
+		// from a secret, kept in the browser.
+		Link string
 	}
 
 	stateTokenFields struct {
 		Login      string `json:"login"`
 		ProviderID string `json:"pid"`
+		Link       bool   `json:"link,omitempty"`
+		PKCENonce  string `json:"pkce,omitempty"`
+		OIDCNonce  string `json:"nonce,omitempty"`
+		LinkNonce  string `json:"lnk,omitempty"`
 	}
 
 	stateToken struct {
@@ -43,8 +80,8 @@ func NewStateTokenString(
 			Audience:  issuer,
 		},
 		stateTokenFields{
-			"",
-			providerID,
+			Login:      "",
+			ProviderID: providerID,
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -66,15 +103,91 @@ func NewStateWithLoginTokenString(
 			Audience:  issuer,
 		},
 		stateTokenFields{
-			login,
-			providerID,
+			Login:      login,
+			ProviderID: providerID,
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(signKey)
 }
 
-// ParseStateToken can parse jwt tokens from strings created by NewStateTokenString or NewStateWithLoginTokenString.
+// NewLinkStateTokenString creates new jwt token and converts it to signed
+// string. It can be used to create state token for OAuth2 code flow, which
+// links provider to the account of authenticated user with given login.
+// Token is not bound to the browser, use NewLinkStateWithNoncesTokenString
+// with Nonces.Link for that.
+func NewLinkStateTokenString(
+	issuer, providerID, login string,
+	expiration time.Duration,
+	signKey []byte) (string, error) {
+	claims := stateToken{
+		jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(expiration).Unix(),
+			Issuer:    issuer,
+			Audience:  issuer,
+		},
+		stateTokenFields{
+			Login:      login,
+			ProviderID: providerID,
+			Link:       true,
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(signKey)
+}
+
+// NewStateWithNoncesTokenString is similar to NewStateTokenString, but also
+// packs nonces of the auth request into token.
+func NewStateWithNoncesTokenString(
+	issuer, providerID string,
+	nonces Nonces,
+	expiration time.Duration,
+	signKey []byte) (string, error) {
+	claims := stateToken{
+		jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(expiration).Unix(),
+			Issuer:    issuer,
+			Audience:  issuer,
+		},
+		stateTokenFields{
+			ProviderID: providerID,
+			PKCENonce:  nonces.PKCE,
+			OIDCNonce:  nonces.OIDC,
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(signKey)
+}
+
+// NewLinkStateWithNoncesTokenString is similar to NewLinkStateTokenString,
+// but also packs nonces of the auth request into token.
+func NewLinkStateWithNoncesTokenString(
+	issuer, providerID, login string,
+	nonces Nonces,
+	expiration time.Duration,
+	signKey []byte) (string, error) {
+	claims := stateToken{
+		jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(expiration).Unix(),
+			Issuer:    issuer,
+			Audience:  issuer,
+		},
+		stateTokenFields{
+			Login:      login,
+			ProviderID: providerID,
+			Link:       true,
+			PKCENonce:  nonces.PKCE,
+			OIDCNonce:  nonces.OIDC,
+			LinkNonce:  nonces.Link,
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(signKey)
+}
+
+// ParseStateToken can parse jwt tokens from strings created by NewStateTokenString,
+// NewStateWithLoginTokenString, NewLinkStateTokenString or their
+// counterparts with nonces.
 func ParseStateToken(
 	issuer, token string,
 	signKey []byte) (StateToken, error) {
@@ -110,3 +223,19 @@ func (s *stateToken) ProviderID() string {
 func (s *stateToken) Login() string {
 	return s.stateTokenFields.Login
 }
+
+func (s *stateToken) Link() bool {
+	return s.stateTokenFields.Link
+}
+
+func (s *stateToken) PKCENonce() string {
+	return s.stateTokenFields.PKCENonce
+}
+
+func (s *stateToken) OIDCNonce() string {
+	return s.stateTokenFields.OIDCNonce
+}
+
+func (s *stateToken) LinkNonce() string {
+	return s.stateTokenFields.LinkNonce
+}
@@ -98,3 +98,65 @@ func TestStateToken(t *testing.T) {
 		})
 	}
 }
+
+func TestLinkStateToken(t *testing.T) {
+	assert := assert.New(t)
+	key := []byte("some secret")
+
+	s, err := NewLinkStateTokenString("some issuer", "some pid", "xxx", time.Hour, key)
+	assert.NoError(err)
+	token, err := ParseStateToken("some issuer", s, key)
+	assert.NoError(err)
+	if assert.NotNil(token) {
+		assert.Equal("some pid", token.ProviderID())
+		assert.Equal("xxx", token.Login())
+		assert.True(token.Link())
+	}
+
+	s, err = NewStateWithLoginTokenString("some issuer", "some pid", "xxx", time.Hour, key)
+	assert.NoError(err)
+	token, err = ParseStateToken("some issuer", s, key)
+	assert.NoError(err)
+	if assert.NotNil(token) {
+		assert.False(token.Link())
+	}
+}
+
+func TestStateTokenWithNonces(t *testing.T) {
+	assert := assert.New(t)
+	key := []byte("some secret")
+	nonces := Nonces{PKCE: "pkce-nonce", OIDC: "oidc-nonce", Link: "link-nonce"}
+
+	s, err := NewStateWithNoncesTokenString("some issuer", "some pid", nonces, time.Hour, key)
+	assert.NoError(err)
+	token, err := ParseStateToken("some issuer", s, key)
+	assert.NoError(err)
+	if assert.NotNil(token) {
+		assert.Equal("some pid", token.ProviderID())
+		assert.Equal("pkce-nonce", token.PKCENonce())
+		assert.Equal("oidc-nonce", token.OIDCNonce())
+		assert.False(token.Link())
+		assert.Empty(token.LinkNonce())
+	}
+
+	s, err = NewLinkStateWithNoncesTokenString("some issuer", "some pid", "xxx", nonces, time.Hour, key)
+	assert.NoError(err)
+	token, err = ParseStateToken("some issuer", s, key)
+	assert.NoError(err)
+	if assert.NotNil(token) {
+		assert.Equal("xxx", token.Login())
+		assert.Equal("pkce-nonce", token.PKCENonce())
+		assert.Equal("oidc-nonce", token.OIDCNonce())
+		assert.True(token.Link())
+		assert.Equal("link-nonce", token.LinkNonce())
+	}
+
+	s, err = NewStateTokenString("some issuer", "some pid", time.Hour, key)
+	assert.NoError(err)
+	token, err = ParseStateToken("some issuer", s, key)
+	assert.NoError(err)
+	if assert.NotNil(token) {
+		assert.Empty(token.PKCENonce())
+		assert.Empty(token.OIDCNonce())
+	}
+}
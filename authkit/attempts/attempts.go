@@ -0,0 +1,172 @@
+// Package attempts provides authkit.AttemptTracker implementation with
+// exponential backoff and temporary lockout. Failures are counted separately
+// per login and per client IP address. State is kept in a pluggable Store,
+// in-memory Store is used by default.
+package attempts
+
+import (
+	"context"
+	"time"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+type (
+
+	// Policy configures backoff for a single kind of key (login or IP).
+	// First Threshold failures are free. After that every next attempt is
+	// delayed by BaseDelay, doubled with every failure, but not more than
+	// MaxDelay (which effectively is a temporary lockout).
+	// Counter is reset after Window passed since the last failure.
+	// Zero Threshold disables policy.
+	Policy struct {
+		Threshold int
+		BaseDelay time.Duration
+		MaxDelay  time.Duration
+		Window    time.Duration
+	}
+
+	// Config holds configuration parameters for New.
+	Config struct {
+
+		// Login is a policy for failures per login.
+		Login Policy
+
+		// IP is a policy for failures per client IP address. It should be
+		// more permissive than Login, because many users may share
+		// the same address.
+		IP Policy
+
+		// Store keeps failure counters. If nil, then in-memory store is used.
+		Store Store
+	}
+
+	tracker struct {
+		Config
+		now func() time.Time
+	}
+)
+
+// DefaultConfig used by New for zero policies.
+var DefaultConfig = Config{
+	Login: Policy{
+		Threshold: 5,
+		BaseDelay: time.Second,
+		MaxDelay:  15 * time.Minute,
+		Window:    time.Hour,
+	},
+	IP: Policy{
+		Threshold: 50,
+		BaseDelay: time.Second,
+		MaxDelay:  15 * time.Minute,
+		Window:    time.Hour,
+	},
+}
+
+const (
+	loginPrefix = "login:"
+	ipPrefix    = "ip:"
+)
+
+// reserveTimeout is a lease of reservation, made by Check. Attempt, which is
+// neither failed nor succeeded (like the first factor of two-factor login or
+// attempt, interrupted by an error), is not counted after that.
+const reserveTimeout = time.Minute
+
+// New returns new authkit.AttemptTracker. Zero policies in c are replaced
+// with policies from DefaultConfig (use Threshold < 0 to disable policy).
+func New(c Config) authkit.AttemptTracker {
+	if c.Login == (Policy{}) {
+		c.Login = DefaultConfig.Login
+	}
+	if c.IP == (Policy{}) {
+		c.IP = DefaultConfig.IP
+	}
+	if c.Store == nil {
+		c.Store = NewMemoryStore()
+	}
+	return tracker{c, time.Now}
+}
+
+// Check reserves attempt for the login and for the IP address, so that
+// concurrent attempts are counted before they are reported.
+func (t tracker) Check(ctx context.Context, login, ip string) error {
+	now := t.now()
+	keys := t.keys(login, ip)
+	for i, k := range keys {
+		retry, err := t.Store.Reserve(ctx, k.key, now, reserveTimeout, k.policy.delay)
+		if err == nil && retry <= 0 {
+			continue
+		}
+		// Attempt is not made, release reservations made so far (they
+		// would expire anyway, so errors are ignored).
+		for _, k := range keys[:i] {
+			t.Store.Release(ctx, k.key)
+		}
+		if err != nil {
+			return err
+		}
+		return authkit.NewAccountLockedError(retry, nil)
+	}
+	return nil
+}
+
+func (t tracker) Failed(ctx context.Context, login, ip string) error {
+	now := t.now()
+	for _, k := range t.keys(login, ip) {
+		if _, err := t.Store.Add(ctx, k.key, now, k.policy.Window); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Succeeded resets login counter. IP counter is not reset, otherwise attacker
+// could reset it, using own valid account, only reservation is released.
+func (t tracker) Succeeded(ctx context.Context, login, ip string) error {
+	if t.Login.enabled() && login != "" {
+		if err := t.Store.Reset(ctx, loginPrefix+login); err != nil {
+			return err
+		}
+	}
+	if t.IP.enabled() && ip != "" {
+		return t.Store.Release(ctx, ipPrefix+ip)
+	}
+	return nil
+}
+
+type policyKey struct {
+	key    string
+	policy Policy
+}
+
+func (t tracker) keys(login, ip string) []policyKey {
+	keys := make([]policyKey, 0, 2)
+	if t.Login.enabled() && login != "" {
+		keys = append(keys, policyKey{loginPrefix + login, t.Login})
+	}
+	if t.IP.enabled() && ip != "" {
+		keys = append(keys, policyKey{ipPrefix + ip, t.IP})
+	}
+	return keys
+}
+
+func (p Policy) enabled() bool {
+	return p.Threshold > 0
+}
+
+// delay returns delay after the last failure, required by policy.
+func (p Policy) delay(failures int) time.Duration {
+	n := failures - p.Threshold
+	if n < 0 {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := 0; i < n && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
@@ -0,0 +1,191 @@
+package attempts
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestTracker(c Config) (tracker, *testClock) {
+	clock := &testClock{now: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewMemoryStore().(*memoryStore)
+	s.now = clock.Now
+	c.Store = s
+	t := New(c).(tracker)
+	t.now = clock.Now
+	return t, clock
+}
+
+var testPolicy = Policy{
+	Threshold: 3,
+	BaseDelay: time.Second,
+	MaxDelay:  10 * time.Second,
+	Window:    time.Hour,
+}
+
+func TestBackoff(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	tr, clock := newTestTracker(Config{Login: testPolicy, IP: Policy{Threshold: -1}})
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(tr.Check(ctx, "user", "1.1.1.1"))
+		assert.NoError(tr.Failed(ctx, "user", "1.1.1.1"))
+	}
+
+	// Delay doubles with every failure, up to MaxDelay.
+	for _, d := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		err := tr.Check(ctx, "user", "1.1.1.1")
+		assert.True(authkit.IsAccountLocked(err))
+		retry, ok := authkit.RetryAfter(err)
+		assert.True(ok)
+		assert.Equal(d*time.Second, retry)
+
+		// Other logins are not affected.
+		assert.NoError(tr.Check(ctx, "other", "1.1.1.1"))
+
+		clock.Add(retry)
+		assert.NoError(tr.Check(ctx, "user", "1.1.1.1"))
+		assert.NoError(tr.Failed(ctx, "user", "1.1.1.1"))
+	}
+
+	// Success resets counter.
+	clock.Add(10 * time.Second)
+	assert.NoError(tr.Succeeded(ctx, "user", "1.1.1.1"))
+	assert.NoError(tr.Failed(ctx, "user", "1.1.1.1"))
+	assert.NoError(tr.Check(ctx, "user", "1.1.1.1"))
+}
+
+func TestWindow(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	tr, clock := newTestTracker(Config{Login: testPolicy, IP: Policy{Threshold: -1}})
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(tr.Failed(ctx, "user", ""))
+	}
+	assert.True(authkit.IsAccountLocked(tr.Check(ctx, "user", "")))
+
+	clock.Add(time.Hour)
+	assert.NoError(tr.Check(ctx, "user", ""))
+	assert.NoError(tr.Failed(ctx, "user", ""))
+	assert.NoError(tr.Check(ctx, "user", ""))
+}
+
+func TestIPPolicy(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	tr, _ := newTestTracker(Config{Login: Policy{Threshold: -1}, IP: testPolicy})
+
+	// Failures for different logins from the same IP are counted together.
+	assert.NoError(tr.Failed(ctx, "user1", "1.1.1.1"))
+	assert.NoError(tr.Failed(ctx, "user2", "1.1.1.1"))
+	assert.NoError(tr.Failed(ctx, "user3", "1.1.1.1"))
+	assert.True(authkit.IsAccountLocked(tr.Check(ctx, "user4", "1.1.1.1")))
+	assert.NoError(tr.Check(ctx, "user4", "2.2.2.2"))
+
+	// Successful login doesn't reset IP counter.
+	assert.NoError(tr.Succeeded(ctx, "user1", "1.1.1.1"))
+	assert.True(authkit.IsAccountLocked(tr.Check(ctx, "user1", "1.1.1.1")))
+}
+
+func TestConcurrentAttempts(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	tr, clock := newTestTracker(Config{Login: testPolicy, IP: testPolicy})
+
+	// Attempts, which are checked before others are reported, are counted.
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tr.Check(ctx, "user", "1.1.1.1"); err != nil {
+				assert.True(authkit.IsAccountLocked(err))
+				return
+			}
+			mu.Lock()
+			allowed++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(testPolicy.Threshold, allowed)
+
+	// Reported attempts are not counted twice.
+	for i := 0; i < allowed; i++ {
+		assert.NoError(tr.Failed(ctx, "user", "1.1.1.1"))
+	}
+	clock.Add(testPolicy.BaseDelay)
+	assert.NoError(tr.Check(ctx, "user", "1.1.1.1"))
+	assert.NoError(tr.Succeeded(ctx, "user", "1.1.1.1"))
+
+	// Unreported attempts are released after timeout.
+	for i := 0; i < testPolicy.Threshold; i++ {
+		assert.NoError(tr.Check(ctx, "other", "2.2.2.2"))
+	}
+	assert.True(authkit.IsAccountLocked(tr.Check(ctx, "other", "2.2.2.2")))
+	clock.Add(reserveTimeout)
+	assert.NoError(tr.Check(ctx, "other", "2.2.2.2"))
+}
+
+func TestDefaultConfig(t *testing.T) {
+	tr := New(Config{}).(tracker)
+	assert.Equal(t, DefaultConfig.Login, tr.Login)
+	assert.Equal(t, DefaultConfig.IP, tr.IP)
+	assert.NotNil(t, tr.Store)
+}
+
+func TestMemoryStorePurge(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	clock := &testClock{now: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewMemoryStore().(*memoryStore)
+	s.now = clock.Now
+
+	n, err := s.Add(ctx, "a", clock.Now(), time.Second)
+	assert.NoError(err)
+	assert.Equal(1, n)
+	n, err = s.Add(ctx, "a", clock.Now(), time.Second)
+	assert.NoError(err)
+	assert.Equal(2, n)
+
+	// Expired failures are not counted.
+	clock.Add(time.Second)
+	n, err = s.Add(ctx, "a", clock.Now(), time.Second)
+	assert.NoError(err)
+	assert.Equal(1, n)
+
+	clock.Add(time.Second)
+
+	clock.Add(purgeInterval)
+	_, err = s.Add(ctx, "b", clock.Now(), time.Second)
+	assert.NoError(err)
+	assert.Len(s.counters, 1)
+}
@@ -0,0 +1,160 @@
+package attempts
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store keeps failure counters. Implementation should be safe for concurrent
+// use. Application may provide shared implementation (based on Redis, SQL
+// database, etc) to track attempts across several instances of application.
+type Store interface {
+
+	// Reserve atomically checks whether attempt for the key is allowed at
+	// now and, if so, reserves it, so that concurrent attempts can't bypass
+	// delay. Attempt is allowed, if delay(n) has passed since the last
+	// attempt, where n is a sum of failures and reserved attempts. Reserve
+	// returns remaining delay (and doesn't reserve attempt), if it is not
+	// allowed. Reservation is released by Add or Release, or after lease.
+	Reserve(
+		ctx context.Context,
+		key string,
+		now time.Time,
+		lease time.Duration,
+		delay func(n int) time.Duration) (time.Duration, error)
+
+	// Add registers failure, occurred at now, and releases reservation.
+	// Counter expires after ttl since the last failure. Add returns new
+	// value of the counter.
+	Add(ctx context.Context, key string, now time.Time, ttl time.Duration) (int, error)
+
+	// Release releases reservation of successful attempt.
+	Release(ctx context.Context, key string) error
+
+	// Reset removes counter.
+	Reset(ctx context.Context, key string) error
+}
+
+// NewMemoryStore returns new in-memory Store. Expired counters are removed
+// periodically, while store is used.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		counters: make(map[string]*counter),
+		now:      time.Now,
+	}
+}
+
+type (
+	counter struct {
+		failures      int
+		last          time.Time
+		expires       time.Time
+		reserved      int
+		reservedUntil time.Time
+	}
+
+	memoryStore struct {
+		mu        sync.Mutex
+		counters  map[string]*counter
+		lastPurge time.Time
+		now       func() time.Time
+	}
+)
+
+// purgeInterval is a minimal interval between removals of expired counters.
+const purgeInterval = time.Minute
+
+func (s *memoryStore) Reserve(
+	_ context.Context,
+	key string,
+	now time.Time,
+	lease time.Duration,
+	delay func(n int) time.Duration) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	c := s.counter(key, now)
+	// Concurrent attempt may be made a bit earlier than the last one, so
+	// elapsed time is checked only if delay is required.
+	if d := delay(c.failures + c.reserved); d > 0 && d > now.Sub(c.last) {
+		return d - now.Sub(c.last), nil
+	}
+	c.reserved++
+	if now.After(c.last) {
+		c.last = now
+	}
+	c.reservedUntil = now.Add(lease)
+	return 0, nil
+}
+
+func (s *memoryStore) Add(
+	_ context.Context,
+	key string,
+	now time.Time,
+	ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	c := s.counter(key, now)
+	c.release()
+	c.failures++
+	if now.After(c.last) {
+		c.last = now
+	}
+	c.expires = now.Add(ttl)
+	return c.failures, nil
+}
+
+func (s *memoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.counters[key]; ok {
+		c.release()
+	}
+	return nil
+}
+
+func (s *memoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counters, key)
+	return nil
+}
+
+// counter returns counter for the key with expired values cleared.
+// Caller should hold the lock.
+func (s *memoryStore) counter(key string, now time.Time) *counter {
+	c, ok := s.counters[key]
+	if !ok {
+		c = &counter{}
+		s.counters[key] = c
+	}
+	if !now.Before(c.expires) {
+		c.failures = 0
+	}
+	if !now.Before(c.reservedUntil) {
+		c.reserved = 0
+	}
+	return c
+}
+
+func (c *counter) release() {
+	if c.reserved > 0 {
+		c.reserved--
+	}
+}
+
+// purge removes expired counters. Caller should hold the lock.
+func (s *memoryStore) purge() {
+	now := s.now()
+	if now.Sub(s.lastPurge) < purgeInterval {
+		return
+	}
+	s.lastPurge = now
+	for k, c := range s.counters {
+		if !now.Before(c.expires) && !now.Before(c.reservedUntil) {
+			delete(s.counters, k)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package authkit
+
+import (
+	"context"
+	"time"
+)
+
+type (
+
+	// AttemptTracker protects login handlers against brute-force attacks
+	// (password guessing, credential stuffing). Handlers call Check before
+	// authentication and report result of authentication with Failed or
+	// Succeeded.
+	AttemptTracker interface {
+
+		// Check returns AccountLockedError if login attempts for the login
+		// or from the IP address are temporarily blocked. Otherwise it may
+		// count the attempt in advance, until its result is reported, so
+		// that concurrent attempts can't bypass protection.
+		Check(ctx context.Context, login, ip string) error
+
+		// Failed registers failed login attempt.
+		Failed(ctx context.Context, login, ip string) error
+
+		// Succeeded registers successful login attempt.
+		Succeeded(ctx context.Context, login, ip string) error
+	}
+
+	// AccountLockedError indicates that login attempts are temporarily
+	// blocked because of too many failures. It is passed to the
+	// ErrorCustomizer.UserAuthenticationError, so that application could
+	// show the user when to retry.
+	AccountLockedError interface {
+		UserServiceError
+		causer
+		IsAccountLocked() bool
+
+		// RetryAfter returns duration, after which attempt can be repeated.
+		RetryAfter() time.Duration
+	}
+
+	accountLockedError struct {
+		userServiceError
+		retryAfter time.Duration
+	}
+
+	retryAfterer interface {
+		RetryAfter() time.Duration
+	}
+)
+
+// NewAccountLockedError returns new AccountLockedError.
+func NewAccountLockedError(retryAfter time.Duration, cause error) AccountLockedError {
+	return accountLockedError{userServiceError{cause}, retryAfter}
+}
+
+func (accountLockedError) Error() string {
+	return "account temporarily locked"
+}
+
+func (accountLockedError) IsAccountLocked() bool {
+	return true
+}
+
+func (e accountLockedError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// IsAccountLocked checks whether error is or caused by the AccountLockedError.
+func IsAccountLocked(err error) bool {
+	return existsCause(err, func(e error) bool {
+		e1, ok := e.(AccountLockedError)
+		return ok && e1.IsAccountLocked()
+	})
+}
+
+// RetryAfter returns duration, after which request can be repeated, if error
+// is or caused by an error with RetryAfter method (like AccountLockedError).
+func RetryAfter(err error) (time.Duration, bool) {
+	var d time.Duration
+	ok := existsCause(err, func(e error) bool {
+		e1, ok := e.(retryAfterer)
+		if ok {
+			d = e1.RetryAfter()
+		}
+		return ok
+	})
+	return d, ok
+}
+
+//go:generate mockery -name AttemptTracker
@@ -1,6 +1,10 @@
 package authkit
 
-import "golang.org/x/oauth2"
+import (
+	"time"
+
+	"golang.org/x/oauth2"
+)
 
 type (
 
@@ -36,7 +40,8 @@ type (
 		// Used for already authorized users.
 		IssueToken(login string) (*oauth2.Token, error)
 
-		// RevokeAccessToken revokes access token.
+		// RevokeAccessToken revokes access token. It is used to revoke
+		// refresh tokens of the private provider as well.
 		RevokeAccessToken(accessToken string) error
 	}
 
@@ -54,6 +59,26 @@ type (
 			permissionDescriptor interface{}) (subj string, err error)
 	}
 
+	// ExpiringTokenValidator is an optional interface of TokenValidator,
+	// which also reports expiration time of the token. Caching validator
+	// uses it to not keep decision longer than token lives.
+	ExpiringTokenValidator interface {
+
+		// ValidateWithExpiry is similar to Validate, but also returns
+		// expiration time of the token (zero, if unknown).
+		ValidateWithExpiry(
+			accessToken string,
+			permissionDescriptor interface{}) (subj string, expiry time.Time, err error)
+	}
+
+	// TokenInvalidator is implemented by caching TokenValidator. Handlers
+	// use it to forget decisions about revoked token.
+	TokenInvalidator interface {
+
+		// InvalidateToken removes all cached decisions about access token.
+		InvalidateToken(accessToken string)
+	}
+
 	// PermissionMapper used to map method and path of http request to desirable
 	// permission descriptor. Permission descriptor is an interface, passed to
 	// the TokenValidator. For example, in case of Hydra-backed TokenValidator,
@@ -68,3 +93,4 @@ type (
 )
 
 //go:generate mockery -name AuthService
+//go:generate mockery -name TokenValidator
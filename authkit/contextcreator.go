@@ -3,6 +3,7 @@ package authkit
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"golang.org/x/oauth2"
 )
@@ -54,3 +55,37 @@ func (c CustomHTTPClientContextCreator) CreateContext(
 		oauth2.HTTPClient,
 		client)
 }
+
+// ContextHTTPClient returns http.Client, put into ctx with oauth2.HTTPClient
+// key (see CustomHTTPClientContextCreator). It returns http.DefaultClient,
+// if ctx has no client.
+func ContextHTTPClient(ctx context.Context) *http.Client {
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		return c
+	}
+	return http.DefaultClient
+}
+
+// Detach returns context, which keeps values of ctx (like http.Client for
+// OAuth2 calls), but not its deadline and cancellation. It is used for jobs
+// (like sending of confirmation emails or token refresh, shared by several
+// requests), which outlive the request.
+func Detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
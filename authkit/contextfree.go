@@ -0,0 +1,204 @@
+package authkit
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+)
+
+type (
+
+	// ContextFreeUserService is a former (context-free) version of the
+	// UserService interface. It is kept to simplify migration of existing
+	// applications. Use AdaptUserService to convert it into UserService.
+	ContextFreeUserService interface {
+		ContextFreeUserStore
+		ContextFreeConfirmer
+	}
+
+	// ContextFreeUserStore is a former (context-free) version of the
+	// UserStore interface. Use AdaptUserStore to convert it into UserStore.
+	ContextFreeUserStore interface {
+		ContextFreeTokenStore
+		User(login string) (User, UserServiceError)
+		Principal(user User) interface{}
+		Create(login, password string) UserServiceError
+		Authenticate(login, password string) UserServiceError
+		UpdatePassword(login, oldPasswordHash, newPassword string) UserServiceError
+	}
+
+	// ContextFreeTokenStore is a former (context-free) version of the
+	// TokenStore interface. Use AdaptTokenStore to convert it into TokenStore.
+	ContextFreeTokenStore interface {
+		OAuth2Token(login, providerID string) (*oauth2.Token, UserServiceError)
+		OAuth2TokenAndLoginByAccessToken(
+			accessToken, providerID string) (*oauth2.Token, string, UserServiceError)
+		UpdateOAuth2Token(login, providerID string, token *oauth2.Token) UserServiceError
+		RevokeAccessToken(providerID, accessToken string) UserServiceError
+	}
+
+	// ContextFreeConfirmer is a former (context-free) version of the
+	// Confirmer interface. Use AdaptConfirmer to convert it into Confirmer.
+	ContextFreeConfirmer interface {
+		RequestEmailConfirmation(login, email, name string) UserServiceError
+		RequestPasswordChangeConfirmation(login, email, name, passwordHash string) UserServiceError
+	}
+
+	// ContextFreeProfileService is a former (context-free) version of the
+	// ProfileService interface. Use AdaptProfileService to convert it into
+	// ProfileService.
+	ContextFreeProfileService interface {
+		EnsureExists(login, email string) error
+		Save(Profile) error
+		SetEmailConfirmed(login, email string, confirmed bool) error
+		Email(login string) (email, name string, err error)
+		ConfirmedEmail(login string) (email, name string, err error)
+	}
+
+	tokenStoreAdapter struct {
+		s ContextFreeTokenStore
+	}
+
+	userStoreAdapter struct {
+		tokenStoreAdapter
+		s ContextFreeUserStore
+	}
+
+	confirmerAdapter struct {
+		c ContextFreeConfirmer
+	}
+
+	profileServiceAdapter struct {
+		s ContextFreeProfileService
+	}
+)
+
+// AdaptUserService returns UserService, which delegates calls to the
+// context-free implementation. Context arguments are ignored.
+func AdaptUserService(s ContextFreeUserService) UserService {
+	return struct {
+		UserStore
+		Confirmer
+	}{
+		AdaptUserStore(s),
+		AdaptConfirmer(s),
+	}
+}
+
+// AdaptUserStore returns UserStore, which delegates calls to the context-free
+// implementation. Context arguments are ignored.
+func AdaptUserStore(s ContextFreeUserStore) UserStore {
+	return userStoreAdapter{tokenStoreAdapter{s}, s}
+}
+
+// AdaptTokenStore returns TokenStore, which delegates calls to the
+// context-free implementation. Context arguments are ignored.
+func AdaptTokenStore(s ContextFreeTokenStore) TokenStore {
+	return tokenStoreAdapter{s}
+}
+
+// AdaptConfirmer returns Confirmer, which delegates calls to the context-free
+// implementation. Context arguments are ignored.
+func AdaptConfirmer(c ContextFreeConfirmer) Confirmer {
+	return confirmerAdapter{c}
+}
+
+// AdaptProfileService returns ProfileService, which delegates calls to the
+// context-free implementation. Context arguments are ignored.
+func AdaptProfileService(s ContextFreeProfileService) ProfileService {
+	return profileServiceAdapter{s}
+}
+
+func (a tokenStoreAdapter) OAuth2Token(
+	_ context.Context,
+	login, providerID string) (*oauth2.Token, UserServiceError) {
+	return a.s.OAuth2Token(login, providerID)
+}
+
+func (a tokenStoreAdapter) OAuth2TokenAndLoginByAccessToken(
+	_ context.Context,
+	accessToken, providerID string) (*oauth2.Token, string, UserServiceError) {
+	return a.s.OAuth2TokenAndLoginByAccessToken(accessToken, providerID)
+}
+
+func (a tokenStoreAdapter) UpdateOAuth2Token(
+	_ context.Context,
+	login, providerID string,
+	token *oauth2.Token) UserServiceError {
+	return a.s.UpdateOAuth2Token(login, providerID, token)
+}
+
+func (a tokenStoreAdapter) RevokeAccessToken(
+	_ context.Context,
+	providerID, accessToken string) UserServiceError {
+	return a.s.RevokeAccessToken(providerID, accessToken)
+}
+
+func (a userStoreAdapter) User(
+	_ context.Context,
+	login string) (User, UserServiceError) {
+	return a.s.User(login)
+}
+
+func (a userStoreAdapter) Principal(user User) interface{} {
+	return a.s.Principal(user)
+}
+
+func (a userStoreAdapter) Create(
+	_ context.Context,
+	login, password string) UserServiceError {
+	return a.s.Create(login, password)
+}
+
+func (a userStoreAdapter) Authenticate(
+	_ context.Context,
+	login, password string) UserServiceError {
+	return a.s.Authenticate(login, password)
+}
+
+func (a userStoreAdapter) UpdatePassword(
+	_ context.Context,
+	login, oldPasswordHash, newPassword string) UserServiceError {
+	return a.s.UpdatePassword(login, oldPasswordHash, newPassword)
+}
+
+func (a confirmerAdapter) RequestEmailConfirmation(
+	_ context.Context,
+	login, email, name string) UserServiceError {
+	return a.c.RequestEmailConfirmation(login, email, name)
+}
+
+func (a confirmerAdapter) RequestPasswordChangeConfirmation(
+	_ context.Context,
+	login, email, name, passwordHash string) UserServiceError {
+	return a.c.RequestPasswordChangeConfirmation(login, email, name, passwordHash)
+}
+
+func (a profileServiceAdapter) EnsureExists(
+	_ context.Context,
+	login, email string) error {
+	return a.s.EnsureExists(login, email)
+}
+
+func (a profileServiceAdapter) Save(_ context.Context, p Profile) error {
+	return a.s.Save(p)
+}
+
+func (a profileServiceAdapter) SetEmailConfirmed(
+	_ context.Context,
+	login, email string,
+	confirmed bool) error {
+	return a.s.SetEmailConfirmed(login, email, confirmed)
+}
+
+func (a profileServiceAdapter) Email(
+	_ context.Context,
+	login string) (string, string, error) {
+	return a.s.Email(login)
+}
+
+func (a profileServiceAdapter) ConfirmedEmail(
+	_ context.Context,
+	login string) (string, string, error) {
+	return a.s.ConfirmedEmail(login)
+}
@@ -0,0 +1,37 @@
+package authkit
+
+import "context"
+
+type (
+
+	// EmailChanger is an optional interface of ProfileService, which enables
+	// email change handlers.
+	EmailChanger interface {
+
+		// ChangeEmail replaces user's email with new (confirmed) one, if
+		// current email is equal to oldEmail. Otherwise, it returns
+		// UserNotFoundError (email has been changed meanwhile).
+		ChangeEmail(ctx context.Context, login, oldEmail, newEmail string) error
+	}
+
+	// EmailChangeConfirmer is an optional interface of Confirmer, which
+	// enables email change handlers.
+	EmailChangeConfirmer interface {
+
+		// RequestEmailChangeConfirmation requests user to confirm new email
+		// address. Implementation should send to newEmail a link with token,
+		// created by apptoken.NewEmailChangeTokenString.
+		RequestEmailChangeConfirmation(
+			ctx context.Context,
+			login, oldEmail, newEmail, name string) UserServiceError
+
+		// NotifyEmailChanged notifies user via old email address that email
+		// address of the account has been changed.
+		NotifyEmailChanged(
+			ctx context.Context,
+			login, oldEmail, newEmail, name string) UserServiceError
+	}
+)
+
+//go:generate mockery -name EmailChanger
+//go:generate mockery -name EmailChangeConfirmer
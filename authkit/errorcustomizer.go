@@ -7,8 +7,14 @@ package authkit
 // errors. Errors may be any structures, not necessary implement error interface.
 // ErrorCustomizer implementation should hide low-level details (stack trace,
 // technical error details) from the end user.
+// UserAuthenticationError may receive AccountLockedError (see IsAccountLocked
+// and RetryAfter), implementation may use it to tell the user when to retry,
+// or InvalidCodeError (see IsInvalidCode) in case of invalid second factor.
+// LastLoginMethodError receives LastLoginMethodError (see IsLastLoginMethod),
+// when user tries to unlink the last login method.
 type ErrorCustomizer interface {
 	InvalidRequestParameterError(error) interface{}
 	UserCreationError(error) interface{}
 	UserAuthenticationError(error) interface{}
+	LastLoginMethodError(error) interface{}
 }
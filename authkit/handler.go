@@ -13,43 +13,144 @@ type Handler interface {
 	// to NewHandler() func and renders list of URLs to response body.
 	// Web UI could use this request to update its list of providers with
 	// fresh URLs (re-generate state query parameter in them).
-	// Response should not be cached.
+	// URLs contain PKCE code challenge (RFC 7636), unless it is disabled for
+	// the provider, and response sets cookie, required by Callback to
+	// complete PKCE. Response should not be cached.
 	AuthCodeURLs(echo.Context) error
 
+	// LinkAuthCodeURLs responds to authenticated user with auth code URLs
+	// (same as AuthCodeURLs), which link external provider to the user's
+	// account instead of login. Callback saves external token for the
+	// user, so that user can login with any of linked providers later.
+	// Login with already linked provider re-authenticates the user
+	// (Callback sets short-lived cookie, required by DeleteAccount for
+	// user without password).
+	LinkAuthCodeURLs(echo.Context) error
+
+	// LinkedProviders responds to authenticated user with list of external
+	// providers, linked to the account, and tells whether user has password.
+	LinkedProviders(echo.Context) error
+
+	// UnlinkProvider unlinks external provider from the account of
+	// authenticated user. Token, stored for the provider, is deleted (and
+	// revoked at the provider, if SocialProfileService implements
+	// SocialTokenRevoker). It refuses to unlink the last provider of the
+	// user without password (see LastLoginMethodError).
+	UnlinkProvider(echo.Context) error
+
 	// AuthProviders responds with list of OAuth2 providers, configured by the
 	// application. Response could be used by web UI to represent a list of
 	// providers with names and icons. Response could be cached.
 	AuthProviders(echo.Context) error
 
 	// ConsentLogin handles login requests from the consent page.
+	// See Login about second factor.
 	ConsentLogin(echo.Context) error
 
 	// Login handles login requests from the application's login page.
+	// If user has second factor enabled, then, after successful password
+	// check, it responds with 401 and JSON
+	// {"secondFactorRequired": true, "secondFactorToken": "..."}. Client
+	// should repeat request with "secondFactorToken" and "code" fields
+	// instead of credentials.
 	Login(echo.Context) error
 
 	// Logout handles logout requests and revokes access token.
 	Logout(echo.Context) error
 
+	// Sessions responds to authenticated user with list of sessions (one
+	// per login on every device) with device, IP and time of creation and
+	// last use.
+	Sessions(echo.Context) error
+
+	// RevokeSession revokes token of the chosen session of authenticated
+	// user (signs out the device).
+	RevokeSession(echo.Context) error
+
+	// SignOutEverywhere revokes all tokens of authenticated user: tokens
+	// of the private provider (including tokens of all sessions and of the
+	// current request) and tokens of linked external providers. Revoked
+	// tokens are removed from the store. See also signout.Everywhere.
+	SignOutEverywhere(echo.Context) error
+
 	// RestorePassword handles request to restore password
 	// ("forgot password" link in the login form).
 	RestorePassword(echo.Context) error
 
 	// ChangePassword handles request to actually change password from the
-	// confirmation form.
+	// confirmation form. Token should be created by
+	// apptoken.NewPasswordChangeTokenString.
 	ChangePassword(echo.Context) error
 
+	// ChangeOwnPassword handles request of authenticated user to change
+	// password. Request should contain current password, new password is
+	// checked with PasswordValidator.
+	ChangeOwnPassword(echo.Context) error
+
 	// ConfirmEmail handles request to confirm email (which is produced
-	// by the link sent to the user in the confirmation email).
+	// by the link sent to the user in the confirmation email, with token
+	// created by apptoken.NewEmailTokenString).
 	// Response for the user created with template named
 	// "authkit.EmailConfirm.response". This template should be registered
 	// in the echo.Context. I18n can be achieved with custom renderer.
 	ConfirmEmail(echo.Context) error
 
+	// ChangeEmail handles request of authenticated user to change email.
+	// Current email stays active, confirmation is requested for the new
+	// email address.
+	ChangeEmail(echo.Context) error
+
+	// ConfirmEmailChange handles request to confirm new email (which is
+	// produced by the link sent to the user by ChangeEmail). It replaces
+	// user's email and notifies user via old email address. Response is
+	// rendered with the same template as in ConfirmEmail.
+	ConfirmEmailChange(echo.Context) error
+
 	// SendConfirmationEmail handles request to send confirmation email (email
 	// with link to confirm email address). This handler may be used by app to
 	// allow user to repeat confirmation email from web UI.
 	SendConfirmationEmail(echo.Context) error
 
 	// Callback handles OAuth2 code flow callback requests.
+	// For OpenID Connect providers (see OAuth2Provider.IDTokenVerifier) it
+	// verifies id_token before profile is requested.
 	Callback(echo.Context) error
+
+	// EnrollTOTP starts enrollment of TOTP second factor for authenticated
+	// user. It responds with new secret, otpauth URI (to be shown as a QR
+	// code) and token, which should be sent to ConfirmTOTP with a code.
+	EnrollTOTP(echo.Context) error
+
+	// ConfirmTOTP completes enrollment of TOTP second factor, when user
+	// provides valid code for the new secret.
+	ConfirmTOTP(echo.Context) error
+
+	// DisableTOTP disables TOTP second factor for authenticated user, if
+	// user provides valid code.
+	DisableTOTP(echo.Context) error
+
+	// GenerateRecoveryCodes generates new set of single-use recovery codes
+	// for authenticated user (previous codes become invalid) and responds
+	// with them. Codes are not stored in plain text and cannot be shown
+	// again.
+	GenerateRecoveryCodes(echo.Context) error
+
+	// RedeemRecoveryCode handles request with login and recovery code from
+	// the user, who lost second factor or access to email. It disables
+	// second factor and responds with password change token, which should
+	// be used with ChangePassword.
+	RedeemRecoveryCode(echo.Context) error
+
+	// ExportAccount responds to authenticated user with JSON, containing
+	// user's profile, linked providers and metadata of stored tokens
+	// (tokens themselves are not disclosed).
+	ExportAccount(echo.Context) error
+
+	// DeleteAccount deletes account of authenticated user. Request should
+	// contain current password (and TOTP code, if second factor is
+	// enabled). User without password should login again with one of
+	// linked providers via LinkAuthCodeURLs just before the request, or
+	// provide TOTP code, if second factor is enabled. Tokens (access and
+	// refresh), stored for the private provider, are revoked.
+	DeleteAccount(echo.Context) error
 }
@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+	"github.com/letsrock-today/authkit/authkit/signout"
+)
+
+type (
+	accountExport struct {
+		Login     string          `json:"login"`
+		Profile   authkit.Profile `json:"profile"`
+		Providers []string        `json:"providers"`
+		Tokens    []tokenMetadata `json:"tokens"`
+	}
+
+	// tokenMetadata describes stored token without disclosing it.
+	tokenMetadata struct {
+		ProviderID      string     `json:"providerId"`
+		TokenType       string     `json:"tokenType"`
+		Expiry          *time.Time `json:"expiry,omitempty"`
+		HasAccessToken  bool       `json:"hasAccessToken"`
+		HasRefreshToken bool       `json:"hasRefreshToken"`
+	}
+
+	deleteAccountForm struct {
+		Password string `form:"password"`
+		Code     string `form:"code" valid:"numeric~code-format"`
+	}
+)
+
+var errPasswordRequired = errors.New("password-required")
+
+func (h handler) ExportAccount(c echo.Context) error {
+	if h.AccountStore == nil || h.AccountProfileService == nil {
+		return echo.ErrNotFound
+	}
+	ctx := c.Request().Context()
+	login := c.Get(middleware.DefaultContextKey).(authkit.User).Login()
+	e := accountExport{
+		Login:     login,
+		Providers: []string{},
+		Tokens:    []tokenMetadata{},
+	}
+
+	p, err := h.AccountProfileService.Profile(ctx, login)
+	if err != nil && !authkit.IsUserNotFound(err) {
+		return errors.WithStack(err)
+	}
+	e.Profile = p
+
+	tokens, err := h.AccountStore.OAuth2Tokens(ctx, login)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	pids := make([]string, 0, len(tokens))
+	for pid, t := range tokens {
+		if t != nil {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Strings(pids)
+	for _, pid := range pids {
+		t := tokens[pid]
+		if pid != h.PrivateOAuth2Provider.ID {
+			e.Providers = append(e.Providers, pid)
+		}
+		m := tokenMetadata{
+			ProviderID:      pid,
+			TokenType:       t.TokenType,
+			HasAccessToken:  t.AccessToken != "",
+			HasRefreshToken: t.RefreshToken != "",
+		}
+		if !t.Expiry.IsZero() {
+			expiry := t.Expiry.UTC()
+			m.Expiry = &expiry
+		}
+		e.Tokens = append(e.Tokens, m)
+	}
+	return c.JSON(http.StatusOK, e)
+}
+
+func (h handler) DeleteAccount(c echo.Context) error {
+	if h.AccountStore == nil || h.AccountProfileService == nil {
+		return echo.ErrNotFound
+	}
+	var f deleteAccountForm
+	// Re-authenticated user without password and second factor has nothing
+	// to send, and echo rejects binding of empty body.
+	if c.Request().ContentLength != 0 {
+		if err := c.Bind(&f); err != nil {
+			c.Logger().Debugf("%+v", errors.WithStack(err))
+			return c.JSON(
+				http.StatusBadRequest,
+				h.ErrorCustomizer.InvalidRequestParameterError(flatten(err)))
+		}
+	}
+	if _, err := govalidator.ValidateStruct(f); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(err))
+	}
+
+	ctx := c.Request().Context()
+	login := c.Get(middleware.DefaultContextKey).(authkit.User).Login()
+	user, err := h.UserService.User(ctx, login)
+	if err != nil {
+		if authkit.IsUserNotFound(err) {
+			c.Logger().Debugf("%+v", errors.WithStack(err))
+			return c.JSON(
+				http.StatusUnauthorized,
+				h.ErrorCustomizer.UserAuthenticationError(err))
+		}
+		return errors.WithStack(err)
+	}
+	var secret string
+	if h.TOTPStore != nil {
+		if secret, err = h.TOTPStore.TOTPSecret(ctx, login); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if user.PasswordHash() == authkit.NoPasswordHash {
+		// User without password confirms deletion with recent login via
+		// linked provider or with second factor.
+		switch {
+		case h.reauthenticated(c, login):
+		case secret != "":
+			if err := h.verifyCode(c, ctx, login, secret, f.Code, false); err != nil {
+				return h.codeFailed(c, err)
+			}
+		default:
+			err := errors.WithStack(errReauthenticationRequired)
+			c.Logger().Debugf("%+v", err)
+			return c.JSON(
+				http.StatusUnauthorized,
+				h.ErrorCustomizer.UserAuthenticationError(err))
+		}
+	} else {
+		if f.Password == "" {
+			err := errors.WithStack(errPasswordRequired)
+			c.Logger().Debugf("%+v", err)
+			return c.JSON(
+				http.StatusBadRequest,
+				h.ErrorCustomizer.InvalidRequestParameterError(err))
+		}
+		if err := h.authenticate(c, ctx, login, f.Password); err != nil {
+			if authkit.IsUserNotFound(err) || authkit.IsAccountLocked(err) {
+				c.Logger().Debugf("%+v", errors.WithStack(err))
+				return authenticationFailed(
+					c,
+					err,
+					h.ErrorCustomizer.UserAuthenticationError)
+			}
+			return errors.WithStack(err)
+		}
+		if secret == "" {
+			h.attemptSucceeded(c, ctx, login)
+		} else if err := h.verifyCode(c, ctx, login, secret, f.Code, false); err != nil {
+			// verifyCode registers attempt itself.
+			return h.codeFailed(c, err)
+		}
+	}
+
+	if err := h.revokeAllTokens(c, login); err != nil {
+		return err
+	}
+	if err := h.AccountProfileService.DeleteProfile(ctx, login); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := h.AccountStore.DeleteUser(ctx, login); err != nil {
+		if authkit.IsUserNotFound(err) {
+			// Account has been deleted concurrently.
+			c.Logger().Debugf("%+v", errors.WithStack(err))
+			return c.JSON(
+				http.StatusUnauthorized,
+				h.ErrorCustomizer.UserAuthenticationError(err))
+		}
+		return errors.WithStack(err)
+	}
+	h.clearReauthCookie(c)
+	return c.JSON(http.StatusOK, struct{}{})
+}
+
+// revokeAllTokens revokes all user's tokens (access and refresh), stored for
+// the private provider (including tokens of sessions).
+func (h handler) revokeAllTokens(c echo.Context, login string) error {
+	ctx := c.Request().Context()
+	tokens, err := h.AccountStore.OAuth2Tokens(ctx, login)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if t := tokens[h.PrivateOAuth2Provider.ID]; t != nil {
+		if err := signout.RevokePrivateToken(h.signoutConfig(c), t); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(signout.RevokeSessions(
+		ctx,
+		h.signoutConfig(c),
+		login,
+		""))
+}
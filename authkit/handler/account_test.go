@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/apptoken"
+	"github.com/letsrock-today/authkit/authkit/attempts"
+	"github.com/letsrock-today/authkit/authkit/memstore"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+	"github.com/letsrock-today/authkit/authkit/mocks"
+	"github.com/letsrock-today/authkit/authkit/passhash"
+	"github.com/letsrock-today/authkit/authkit/totp"
+)
+
+func newAccountTestHandler(t *testing.T) (handler, authkit.UserService, memstore.ProfileService) {
+	ctx := context.Background()
+	us := memstore.NewUserService(nil, passhash.New(passhash.NewBcrypt(4)))
+	require.NoError(t, us.Create(ctx, "valid@login.ok", "valid_password"))
+	require.NoError(t, us.UpdateOAuth2Token(
+		ctx,
+		"valid@login.ok",
+		"private",
+		&oauth2.Token{AccessToken: "private-access", RefreshToken: "private-refresh"}))
+	expiry := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, us.UpdateOAuth2Token(
+		ctx,
+		"valid@login.ok",
+		"fb",
+		&oauth2.Token{AccessToken: "fb-access", TokenType: "Bearer", Expiry: expiry}))
+	ps := memstore.NewProfileService()
+	require.NoError(t, ps.Save(ctx, &memstore.Profile{
+		Login:         "valid@login.ok",
+		Email:         "valid@login.ok",
+		FormattedName: "Valid User",
+	}))
+
+	as := new(mocks.AuthService)
+	as.On("RevokeAccessToken", "private-access").Return(nil)
+	as.On("RevokeAccessToken", "private-refresh").Return(nil)
+
+	h := handler{Config{
+		ErrorCustomizer:       testErrorCustomizer{},
+		AuthService:           as,
+		UserService:           us,
+		ProfileService:        ps,
+		PrivateOAuth2Provider: authkit.OAuth2Provider{ID: "private"},
+		AttemptTracker:        attempts.New(attempts.Config{}),
+		AccountStore:          us.(authkit.AccountStore),
+		AccountProfileService: ps,
+		OAuth2State: authkit.OAuth2State{
+			TokenIssuer:  "zzz",
+			TokenSignKey: []byte("xxx"),
+		},
+	}}
+	return h, us, ps
+}
+
+func TestExportAccount(t *testing.T) {
+	assert := assert.New(t)
+	h, _, _ := newAccountTestHandler(t)
+
+	rec := testPost(h.ExportAccount, nil, testUser{login: "valid@login.ok"})
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.JSONEq(`{
+		"login": "valid@login.ok",
+		"profile": {
+			"login": "valid@login.ok",
+			"email": "valid@login.ok",
+			"emailconfirmed": false,
+			"formattedname": "Valid User"
+		},
+		"providers": ["fb"],
+		"tokens": [
+			{
+				"providerId": "fb",
+				"tokenType": "Bearer",
+				"expiry": "2017-01-01T00:00:00Z",
+				"hasAccessToken": true,
+				"hasRefreshToken": false
+			},
+			{
+				"providerId": "private",
+				"tokenType": "",
+				"hasAccessToken": true,
+				"hasRefreshToken": true
+			}
+		]
+	}`, rec.Body.String())
+
+	// Disabled without optional interfaces.
+	h.AccountStore = nil
+	rec = testPost(h.ExportAccount, nil, testUser{login: "valid@login.ok"})
+	assert.Equal(http.StatusNotFound, rec.Code)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	h, us, ps := newAccountTestHandler(t)
+	user := testUser{login: "valid@login.ok"}
+
+	rec := testPost(h.DeleteAccount, url.Values{
+		"password": []string{"invalid_password"},
+	}, user)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+	_, err := us.User(ctx, "valid@login.ok")
+	assert.NoError(err)
+
+	// Code is required with second factor enabled.
+	ts := us.(authkit.TOTPStore)
+	h.TOTPStore = ts
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	require.NoError(t, ts.UpdateTOTPSecret(ctx, "valid@login.ok", secret))
+	rec = testPost(h.DeleteAccount, url.Values{
+		"password": []string{"valid_password"},
+	}, user)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+	assert.Equal(`{"Code":"invalid code"}`, rec.Body.String())
+
+	code, err := totp.Code(secret, time.Now())
+	require.NoError(t, err)
+	rec = testPost(h.DeleteAccount, url.Values{
+		"password": []string{"valid_password"},
+		"code":     []string{code},
+	}, user)
+	assert.Equal(http.StatusOK, rec.Code)
+	h.AuthService.(*mocks.AuthService).AssertCalled(t, "RevokeAccessToken", "private-access")
+	h.AuthService.(*mocks.AuthService).AssertCalled(t, "RevokeAccessToken", "private-refresh")
+
+	_, err = us.User(ctx, "valid@login.ok")
+	assert.True(authkit.IsUserNotFound(err))
+	_, _, err = us.OAuth2TokenAndLoginByAccessToken(ctx, "fb-access", "fb")
+	assert.True(authkit.IsUserNotFound(err))
+	_, _, err = ps.Email(ctx, "valid@login.ok")
+	assert.True(authkit.IsUserNotFound(err))
+}
+
+func TestDeleteAccountWithoutPassword(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	h, us, _ := newAccountTestHandler(t)
+	is := us.(authkit.IdentityStore)
+	require.NoError(t, is.CreateWithIdentity(ctx, "fb-identity", "fb", "fb-identity"))
+	user := testUser{login: "fb-identity"}
+
+	deleteAccount := func(params url.Values, reauthLogin string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req, _ := http.NewRequest(echo.POST, "", strings.NewReader(params.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		if reauthLogin != "" {
+			s, err := apptoken.NewReauthenticationTokenString(
+				"zzz",
+				reauthLogin,
+				time.Minute,
+				[]byte("xxx"))
+			require.NoError(t, err)
+			req.AddCookie(&http.Cookie{Name: DefaultReauthCookieName, Value: s})
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(middleware.DefaultContextKey, user)
+		if err := h.DeleteAccount(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+
+	// Password can't be used.
+	rec := deleteAccount(url.Values{"password": []string{authkit.NoPasswordHash}}, "")
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+
+	// Re-authentication token should be issued for the user.
+	rec = deleteAccount(nil, "valid@login.ok")
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+	_, err := us.User(ctx, "fb-identity")
+	assert.NoError(err)
+
+	rec = deleteAccount(nil, "fb-identity")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Header().Get(echo.HeaderSetCookie), DefaultReauthCookieName+"=;")
+	_, err = us.User(ctx, "fb-identity")
+	assert.True(authkit.IsUserNotFound(err))
+}
+
+func TestDeleteAccountWithoutPasswordTOTP(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	h, us, _ := newAccountTestHandler(t)
+	is := us.(authkit.IdentityStore)
+	require.NoError(t, is.CreateWithIdentity(ctx, "fb-identity", "fb", "fb-identity"))
+	user := testUser{login: "fb-identity"}
+
+	ts := us.(authkit.TOTPStore)
+	h.TOTPStore = ts
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	require.NoError(t, ts.UpdateTOTPSecret(ctx, "fb-identity", secret))
+
+	rec := testPost(h.DeleteAccount, nil, user)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+	assert.Equal(`{"Code":"invalid code"}`, rec.Body.String())
+
+	code, err := totp.Code(secret, time.Now())
+	require.NoError(t, err)
+	rec = testPost(h.DeleteAccount, url.Values{"code": []string{code}}, user)
+	assert.Equal(http.StatusOK, rec.Code)
+	_, err = us.User(ctx, "fb-identity")
+	assert.True(authkit.IsUserNotFound(err))
+}
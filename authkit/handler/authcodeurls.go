@@ -3,10 +3,14 @@ package handler
 import (
 	"net/http"
 
+	"golang.org/x/oauth2"
+
 	"github.com/labstack/echo"
 	"github.com/pkg/errors"
 
+	"github.com/letsrock-today/authkit/authkit"
 	"github.com/letsrock-today/authkit/authkit/apptoken"
+	"github.com/letsrock-today/authkit/authkit/middleware"
 )
 
 type (
@@ -21,20 +25,109 @@ type (
 )
 
 func (h handler) AuthCodeURLs(c echo.Context) error {
+	key, err := h.providersPKCEKey(c)
+	if err != nil {
+		return err
+	}
+	reply := authCodeURLsReply{}
+	for _, p := range h.OAuth2Providers {
+		s := h.OAuth2State
+		u, err := h.authCodeURL(p, key, func(n apptoken.Nonces) (string, error) {
+			return apptoken.NewStateWithNoncesTokenString(
+				s.TokenIssuer,
+				p.ID,
+				n,
+				s.Expiration,
+				s.TokenSignKey)
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		reply.URLs = append(reply.URLs, authCodeURL{p.ID, u})
+	}
+	return c.JSON(http.StatusOK, reply)
+}
+
+func (h handler) LinkAuthCodeURLs(c echo.Context) error {
+	if h.IdentityStore == nil {
+		return echo.ErrNotFound
+	}
+	login := c.Get(middleware.DefaultContextKey).(authkit.User).Login()
+	key, err := h.providersPKCEKey(c)
+	if err != nil {
+		return err
+	}
+	linkNonce, err := h.linkNonce(c)
+	if err != nil {
+		return err
+	}
 	reply := authCodeURLsReply{}
 	for _, p := range h.OAuth2Providers {
 		s := h.OAuth2State
-		state, err := apptoken.NewStateTokenString(
-			s.TokenIssuer,
-			p.ID,
-			s.Expiration,
-			s.TokenSignKey)
+		u, err := h.authCodeURL(p, key, func(n apptoken.Nonces) (string, error) {
+			n.Link = linkNonce
+			return apptoken.NewLinkStateWithNoncesTokenString(
+				s.TokenIssuer,
+				p.ID,
+				login,
+				n,
+				s.Expiration,
+				s.TokenSignKey)
+		})
 		if err != nil {
 			return errors.WithStack(err)
 		}
-		reply.URLs = append(reply.URLs, authCodeURL{
-			p.ID,
-			p.OAuth2Config.AuthCodeURL(state)})
+		reply.URLs = append(reply.URLs, authCodeURL{p.ID, u})
 	}
 	return c.JSON(http.StatusOK, reply)
 }
+
+// providersPKCEKey returns PKCE key of the request (see pkceKey) or nil,
+// if PKCE is disabled for all providers. Key is obtained once per request,
+// so that auth code URLs of all providers are bound to the same cookie.
+func (h handler) providersPKCEKey(c echo.Context) ([]byte, error) {
+	for _, p := range h.OAuth2Providers {
+		if !p.DisablePKCE {
+			return h.pkceKey(c)
+		}
+	}
+	return nil, nil
+}
+
+// authCodeURL returns auth code URL of the provider with state, created by
+// newState. Nonces for PKCE (unless it is disabled for the provider) and for
+// OpenID Connect (if provider has IDTokenVerifier) are generated and passed
+// to newState, corresponding parameters are added to the URL. PKCE challenge
+// is derived from the nonce and the key (see pkceKey).
+func (h handler) authCodeURL(
+	p authkit.OAuth2Provider,
+	key []byte,
+	newState func(apptoken.Nonces) (string, error)) (string, error) {
+	var (
+		nonces apptoken.Nonces
+		opts   []oauth2.AuthCodeOption
+		err    error
+	)
+	if !p.DisablePKCE {
+		nonces.PKCE, err = randomString(nonceLen)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		opts = append(
+			opts,
+			oauth2.SetAuthURLParam("code_challenge", pkceChallenge(key, nonces.PKCE)),
+			oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+	}
+	if p.IDTokenVerifier != nil {
+		nonces.OIDC, err = randomString(nonceLen)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", nonces.OIDC))
+	}
+	state, err := newState(nonces)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return p.OAuth2Config.AuthCodeURL(state, opts...), nil
+}
@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
@@ -10,7 +13,11 @@ import (
 
 	"github.com/labstack/echo"
 	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/apptoken"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+	"github.com/letsrock-today/authkit/authkit/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAuthCodeURLs(t *testing.T) {
@@ -63,3 +70,61 @@ func TestAuthCodeURLs(t *testing.T) {
 	assert.Equal(http.StatusOK, rec.Code)
 	assert.Regexp(`\{"urls":\[.*"id":"bbb","url":"https://bbb.bb/auth.*\]\}`, string(rec.Body.Bytes()))
 }
+
+func TestLinkAuthCodeURLs(t *testing.T) {
+	assert := assert.New(t)
+	e := echo.New()
+
+	h := handler{Config{
+		OAuth2State: authkit.OAuth2State{
+			TokenIssuer:  "zzz",
+			TokenSignKey: []byte("xxx"),
+			Expiration:   1 * time.Hour,
+		},
+		OAuth2Providers: []authkit.OAuth2Provider{
+			{
+				ID: "aaa",
+				OAuth2Config: &oauth2.Config{
+					ClientID: "aaa-id",
+					Endpoint: oauth2.Endpoint{
+						AuthURL: "https://aaa.aa/auth",
+					},
+				},
+				DisablePKCE: true,
+			},
+		},
+	}}
+
+	// Linking is disabled without IdentityStore.
+	rec := httptest.NewRecorder()
+	c := e.NewContext(new(http.Request), rec)
+	c.Set(middleware.DefaultContextKey, testUser{login: "valid@login.ok"})
+	assert.Equal(echo.ErrNotFound, h.LinkAuthCodeURLs(c))
+
+	h.IdentityStore = new(mocks.IdentityStore)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(new(http.Request), rec)
+	c.Set(middleware.DefaultContextKey, testUser{login: "valid@login.ok"})
+	assert.NoError(h.LinkAuthCodeURLs(c))
+	assert.Equal(http.StatusOK, rec.Code)
+
+	var reply authCodeURLsReply
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reply))
+	require.Len(t, reply.URLs, 1)
+	assert.Equal("aaa", reply.URLs[0].ID)
+	u, err := url.Parse(reply.URLs[0].URL)
+	require.NoError(t, err)
+	state, err := apptoken.ParseStateToken("zzz", u.Query().Get("state"), []byte("xxx"))
+	require.NoError(t, err)
+	assert.Equal("aaa", state.ProviderID())
+	assert.Equal("valid@login.ok", state.Login())
+	assert.True(state.Link())
+
+	// Link state is bound to the browser even without PKCE.
+	cookies := (&http.Response{Header: rec.Header()}).Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(DefaultLinkCookieName, cookies[0].Name)
+	key, err := base64.RawURLEncoding.DecodeString(cookies[0].Value)
+	require.NoError(t, err)
+	assert.Equal(linkNonceFromKey(key), state.LinkNonce())
+}
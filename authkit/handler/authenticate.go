@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+// authenticate checks user's credentials with brute-force protection.
+// Successful attempt is not reported to AttemptTracker here, because second
+// factor may be required yet (see attemptSucceeded).
+func (h handler) authenticate(
+	c echo.Context,
+	ctx context.Context,
+	login, password string) authkit.UserServiceError {
+	if err := h.AttemptTracker.Check(ctx, login, c.RealIP()); err != nil {
+		return err
+	}
+	err := h.UserService.Authenticate(ctx, login, password)
+	if authkit.IsUserNotFound(err) {
+		h.attemptFailed(c, ctx, login)
+	}
+	return err
+}
+
+// attemptSucceeded reports successful authentication to AttemptTracker.
+func (h handler) attemptSucceeded(c echo.Context, ctx context.Context, login string) {
+	if err := h.AttemptTracker.Succeeded(ctx, login, c.RealIP()); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+	}
+}
+
+// attemptFailed reports failed authentication to AttemptTracker.
+func (h handler) attemptFailed(c echo.Context, ctx context.Context, login string) {
+	if err := h.AttemptTracker.Failed(ctx, login, c.RealIP()); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+	}
+}
+
+// authenticationFailed renders error response for failed authentication
+// (or user creation). Errors with RetryAfter method (like
+// authkit.AccountLockedError or authkit.RateLimitError) are rendered with 429
+// status code and Retry-After header.
+func authenticationFailed(
+	c echo.Context,
+	err error,
+	customizedError func(error) interface{}) error {
+	status := http.StatusUnauthorized
+	if d, ok := authkit.RetryAfter(err); ok {
+		setRetryAfter(c, d)
+		status = http.StatusTooManyRequests
+	}
+	return c.JSON(status, customizedError(err))
+}
+
+// setRetryAfter sets Retry-After header in seconds (rounded up).
+func setRetryAfter(c echo.Context, d time.Duration) {
+	s := int64((d + time.Second - 1) / time.Second)
+	if s < 1 {
+		s = 1
+	}
+	c.Response().Header().Set("Retry-After", strconv.FormatInt(s, 10))
+}
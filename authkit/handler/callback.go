@@ -56,7 +56,10 @@ func (h handler) Callback(c echo.Context) error {
 		return errors.WithStack(err)
 	}
 
-	var oauth2cfg authkit.OAuth2Config
+	var (
+		oauth2cfg authkit.OAuth2Config
+		provider  *authkit.OAuth2Provider
+	)
 	privateProvider := h.PrivateOAuth2Provider
 	privPID := privateProvider.ID
 	ctx := h.ContextCreator.CreateContext(privPID)
@@ -64,15 +67,19 @@ func (h handler) Callback(c echo.Context) error {
 	if state.ProviderID() == privPID {
 		oauth2cfg = privateProvider.PrivateOAuth2Config
 	} else {
-		p := oauth2ProviderByID(h.OAuth2Providers, state.ProviderID())
-		if p == nil {
+		provider = oauth2ProviderByID(h.OAuth2Providers, state.ProviderID())
+		if provider == nil {
 			err := fmt.Errorf("Unknown provider: %s", state.ProviderID())
 			return errors.WithStack(err)
 		}
-		oauth2cfg = p.OAuth2Config
+		oauth2cfg = provider.OAuth2Config
 	}
 
-	token, err := oauth2cfg.Exchange(ctx, cr.Code)
+	exchangeCtx, err := h.pkceExchangeContext(c, ctx, state.PKCENonce())
+	if err != nil {
+		return err
+	}
+	token, err := oauth2cfg.Exchange(exchangeCtx, cr.Code)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -94,14 +101,21 @@ func (h handler) Callback(c echo.Context) error {
 		return errors.WithStack(err)
 	}
 	client := oauth2cfg.Client(ctx, token)
-	p, err := pa.SocialProfile(client)
+	p, err := socialProfile(pa, provider, state, client, token)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	login := p.GetLogin()
+	if state.Link() {
+		return h.linkProvider(c, state, p.GetLogin(), token)
+	}
+	pid := state.ProviderID()
+	login, linked, err := h.loginByIdentity(c, pid, p.GetLogin())
+	if err != nil {
+		return err
+	}
 
 	// Check that internal user exists for external user.
-	user, err := h.UserService.User(login)
+	user, err := h.UserService.User(c.Request().Context(), login)
 	if err != nil {
 		if !authkit.IsUserNotFound(err) {
 			return errors.WithStack(err)
@@ -112,15 +126,31 @@ func (h handler) Callback(c echo.Context) error {
 
 	if freshUser {
 		// If internal user doesn't exist:
-		err := h.createInternalUser(c, login, p)
+		err := h.createInternalUser(c, login, pid, p)
 		if err != nil {
 			return err
 		}
+		linked = h.IdentityStore != nil
+	}
+
+	if !linked && h.IdentityStore != nil {
+		// Link identity to the user (created now or before identities
+		// were tracked), so that account could be found by identity.
+		if err := h.IdentityStore.LinkIdentity(
+			c.Request().Context(),
+			login,
+			pid,
+			p.GetLogin()); err != nil {
+			return errors.WithStack(err)
+		}
 	}
 
 	// Save external provider's token in the users DB.
-	pid := state.ProviderID()
-	if err := h.UserService.UpdateOAuth2Token(login, pid, token); err != nil {
+	if err := h.UserService.UpdateOAuth2Token(
+		c.Request().Context(),
+		login,
+		pid,
+		token); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -144,9 +174,8 @@ func (h handler) handlePrivateProvider(
 	if state.Login() == "" {
 		return errors.WithStack(errors.New("invalid state, empty login"))
 	}
-	pid := h.PrivateOAuth2Provider.ID
-	if err := h.UserService.UpdateOAuth2Token(state.Login(), pid, token); err != nil {
-		return errors.WithStack(err)
+	if err := h.savePrivateToken(c, state.Login(), token); err != nil {
+		return err
 	}
 	// our trusted provider, just return access token to client
 	cookie := createCookie(
@@ -156,28 +185,141 @@ func (h handler) handlePrivateProvider(
 	return c.Redirect(http.StatusFound, "/")
 }
 
-func (h handler) createInternalUser(
+// socialProfile returns profile of the user of external provider. In case
+// of OpenID Connect provider, id_token is verified first, and its claims
+// are used to obtain profile, if SocialProfileService supports it.
+func socialProfile(
+	pa authkit.SocialProfileService,
+	provider *authkit.OAuth2Provider,
+	state apptoken.StateToken,
+	client *http.Client,
+	token *oauth2.Token) (authkit.Profile, error) {
+	if provider.IDTokenVerifier == nil {
+		return pa.SocialProfile(client)
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, errors.WithStack(errors.New("id_token is missing"))
+	}
+	claims, err := provider.IDTokenVerifier.VerifyIDToken(
+		rawIDToken,
+		state.OIDCNonce())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if ps, ok := pa.(authkit.IDTokenProfileService); ok {
+		return ps.SocialProfileFromIDToken(client, claims)
+	}
+	return pa.SocialProfile(client)
+}
+
+// loginByIdentity returns login of the account, linked to the external
+// identity. If identity is not linked (or linking is disabled), then identity
+// is used as a login.
+func (h handler) loginByIdentity(
 	c echo.Context,
-	login string,
-	p authkit.Profile) error {
-	// - Create internal user.
-	pass, err := makeRandomPassword() // create long random password
+	pid, identity string) (login string, linked bool, err error) {
+	if h.IdentityStore == nil {
+		return identity, false, nil
+	}
+	login, err = h.IdentityStore.LoginByIdentity(c.Request().Context(), pid, identity)
 	if err != nil {
+		if authkit.IsUserNotFound(err) {
+			return identity, false, nil
+		}
+		return "", false, errors.WithStack(err)
+	}
+	return login, true, nil
+}
+
+// linkProvider links external identity to the account of the user, who
+// initiated OAuth2 flow, and saves external token for the user.
+func (h handler) linkProvider(
+	c echo.Context,
+	state apptoken.StateToken,
+	identity string,
+	token *oauth2.Token) error {
+	if h.IdentityStore == nil || state.Login() == "" {
+		return errors.WithStack(errors.New("invalid state, linking is disabled"))
+	}
+	if err := h.checkLinkNonce(c, state); err != nil {
+		return err
+	}
+	ctx := c.Request().Context()
+	// Login with already linked provider re-authenticates the user.
+	// Newly linked identity doesn't, because it may belong to whoever
+	// obtained user's token.
+	reauth := false
+	login, err := h.IdentityStore.LoginByIdentity(ctx, state.ProviderID(), identity)
+	if err == nil {
+		reauth = login == state.Login()
+	} else if !authkit.IsUserNotFound(err) {
+		return errors.WithStack(err)
+	}
+	if err := h.IdentityStore.LinkIdentity(
+		ctx,
+		state.Login(),
+		state.ProviderID(),
+		identity); err != nil {
+		if authkit.IsDuplicateUser(err) {
+			// Identity belongs to another account.
+			c.Logger().Debugf("%+v", errors.WithStack(err))
+			return c.JSON(
+				http.StatusConflict,
+				h.ErrorCustomizer.UserCreationError(err))
+		}
 		return errors.WithStack(err)
 	}
-	if err := h.UserService.Create(login, pass); err != nil {
+	if err := h.UserService.UpdateOAuth2Token(
+		ctx,
+		state.Login(),
+		state.ProviderID(),
+		token); err != nil {
+		return errors.WithStack(err)
+	}
+	if reauth {
+		if err := h.setReauthCookie(c, state.Login()); err != nil {
+			return err
+		}
+	}
+	// User is already logged in, private token is not changed.
+	return c.Redirect(http.StatusFound, "/")
+}
+
+func (h handler) createInternalUser(
+	c echo.Context,
+	login, pid string,
+	p authkit.Profile) error {
+	ctx := c.Request().Context()
+	// - Create internal user.
+	if h.IdentityStore != nil {
+		// User without password, linked to the identity (user may set
+		// password later with RestorePassword).
+		if err := h.IdentityStore.CreateWithIdentity(
+			ctx,
+			login,
+			pid,
+			p.GetLogin()); err != nil {
+			return errors.WithStack(err)
+		}
+	} else {
+		pass, err := makeRandomPassword() // create long random password
 		if err != nil {
 			return errors.WithStack(err)
 		}
+		if err := h.UserService.Create(ctx, login, pass); err != nil {
+			return errors.WithStack(err)
+		}
 	}
 	// - Save user's profile from external provider to our profile db.
-	if err := h.ProfileService.Save(p); err != nil {
+	if err := h.ProfileService.Save(ctx, p); err != nil {
 		return errors.WithStack(err)
 	}
 	// - Send email confirmation request.
 	if p.GetEmail() != "" {
 		go func() {
 			if err := h.UserService.RequestEmailConfirmation(
+				authkit.Detach(ctx),
 				login,
 				p.GetEmail(),
 				p.GetFormattedName()); err != nil {
@@ -193,12 +335,22 @@ func (h handler) issuePrivateProvidersToken(
 	c echo.Context,
 	login string,
 	freshUser bool) (*oauth2.Token, error) {
+	if h.SessionStore != nil {
+		// Every login gets its own token.
+		privToken, err := h.AuthService.IssueToken(login)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return privToken, h.savePrivateToken(c, login, privToken)
+	}
+
 	// Check if we have one in DB first.
+	ctx := c.Request().Context()
 	privPID := h.PrivateOAuth2Provider.ID
 	var privToken *oauth2.Token
 	if !freshUser {
 		var err error
-		privToken, err = h.UserService.OAuth2Token(login, privPID)
+		privToken, err = h.UserService.OAuth2Token(ctx, login, privPID)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -210,7 +362,7 @@ func (h handler) issuePrivateProvidersToken(
 		if err != nil {
 			return err
 		}
-		return h.UserService.UpdateOAuth2Token(login, privPID, privToken)
+		return h.UserService.UpdateOAuth2Token(ctx, login, privPID, privToken)
 	}
 
 	if privToken == nil {
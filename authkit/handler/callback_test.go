@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"context"
+	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -12,9 +14,13 @@ import (
 	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/apptoken"
+	"github.com/letsrock-today/authkit/authkit/memstore"
 	"github.com/letsrock-today/authkit/authkit/mocks"
+	"github.com/letsrock-today/authkit/authkit/passhash"
 )
 
 func TestCallback(t *testing.T) {
@@ -25,37 +31,45 @@ func TestCallback(t *testing.T) {
 	us := new(mocks.UserService)
 	us.On(
 		"UpdateOAuth2Token",
+		mock.Anything,
 		"valid@login.ok",
 		"private-id",
 		inttoken).Return(nil)
 	us.On(
 		"UpdateOAuth2Token",
+		mock.Anything,
 		"new.valid@login.ok",
 		"private-id",
 		inttoken).Return(nil)
 	us.On(
 		"UpdateOAuth2Token",
+		mock.Anything,
 		"valid@login.ok",
 		"external-id",
 		exttoken).Return(nil)
 	us.On(
 		"UpdateOAuth2Token",
+		mock.Anything,
 		"new.valid@login.ok",
 		"external-id-new",
 		exttoken).Return(nil)
 	us.On(
 		"OAuth2Token",
+		mock.Anything,
 		"valid@login.ok",
 		"private-id").Return(inttoken, nil)
 	us.On(
 		"User",
+		mock.Anything,
 		"valid@login.ok").Return(testUser{login: "valid@email.ok"}, nil)
 	us.On(
 		"User",
+		mock.Anything,
 		"new.valid@login.ok").Return(nil, authkit.NewUserNotFoundError(nil))
 
 	us.On(
 		"Create",
+		mock.Anything,
 		"new.valid@login.ok",
 		mock.Anything).Return(nil)
 
@@ -108,6 +122,7 @@ func TestCallback(t *testing.T) {
 	ps := new(mocks.ProfileService)
 	ps.On(
 		"Save",
+		mock.Anything,
 		mock.Anything).Return(nil)
 
 	h := handler{
@@ -224,3 +239,159 @@ func TestCallback(t *testing.T) {
 		})
 	}
 }
+
+func TestCallbackLink(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	exttoken := &oauth2.Token{AccessToken: "ext-access-token"}
+	inttoken := &oauth2.Token{AccessToken: "xxx-access-token"}
+
+	us := memstore.NewUserService(nil, passhash.New(passhash.NewBcrypt(4)))
+	is := us.(authkit.IdentityStore)
+	require.NoError(t, us.Create(ctx, "other@login.ok", "valid_password"))
+
+	extCfg := new(mocks.OAuth2Config)
+	extCfg.On(
+		"Exchange",
+		mock.Anything,
+		"valid_code").Return(exttoken, nil)
+	extCfg.On(
+		"Client",
+		mock.Anything,
+		mock.Anything).Return(http.DefaultClient, nil)
+
+	sps := new(mocks.SocialProfileServices)
+	for _, pid := range []string{"google", "fb"} {
+		sp := new(mocks.SocialProfileService)
+		sp.On(
+			"SocialProfile",
+			mock.Anything).Return(&testProfile{login: pid + "-identity"}, nil)
+		sps.On("SocialProfileService", pid).Return(sp, nil)
+	}
+
+	as := new(mocks.AuthService)
+	as.On("IssueToken", mock.Anything).Return(inttoken, nil)
+
+	h := handler{
+		Config{
+			ErrorCustomizer:       testErrorCustomizer{},
+			AuthService:           as,
+			UserService:           us,
+			ProfileService:        memstore.NewProfileService(),
+			SocialProfileServices: sps,
+			IdentityStore:         is,
+			OAuth2State: authkit.OAuth2State{
+				TokenIssuer:  "zzz",
+				TokenSignKey: []byte("xxx"),
+				Expiration:   1 * time.Hour,
+			},
+			PrivateOAuth2Provider: authkit.OAuth2Provider{ID: "private-id"},
+			OAuth2Providers: []authkit.OAuth2Provider{
+				{ID: "google", OAuth2Config: extCfg},
+				{ID: "fb", OAuth2Config: extCfg},
+			},
+			AuthCookieName: "xxx-auth-cookie",
+			ContextCreator: authkit.DefaultContextCreator{},
+		},
+	}
+
+	linkKey := []byte("some link key")
+	linkCookie := &http.Cookie{
+		Name:  DefaultLinkCookieName,
+		Value: base64.RawURLEncoding.EncodeToString(linkKey),
+	}
+	callbackWithCookie := func(state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		e := echo.New()
+		params := url.Values{
+			"state": []string{state},
+			"code":  []string{"valid_code"},
+		}
+		req, err := http.NewRequest(echo.GET, "/callback?"+params.Encode(), nil)
+		require.NoError(t, err)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if err := h.Callback(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+	callback := func(state string) *httptest.ResponseRecorder {
+		return callbackWithCookie(state, linkCookie)
+	}
+	linkState := func(pid, login string) string {
+		s, err := apptoken.NewLinkStateWithNoncesTokenString(
+			"zzz",
+			pid,
+			login,
+			apptoken.Nonces{Link: linkNonceFromKey(linkKey)},
+			time.Hour,
+			[]byte("xxx"))
+		require.NoError(t, err)
+		return s
+	}
+
+	// Login with google creates new user, linked to google identity.
+	rec := callback(testNewStateTokenString(t, h.Config, "google", "")[0])
+	assert.Equal(http.StatusFound, rec.Code)
+	assert.Equal("xxx-auth-cookie=xxx-access-token; Secure", rec.Header().Get(echo.HeaderSetCookie))
+	login, err := is.LoginByIdentity(ctx, "google", "google-identity")
+	assert.NoError(err)
+	assert.Equal("google-identity", login)
+
+	// Link state is accepted only in the browser, which created it.
+	rec = callbackWithCookie(linkState("fb", "google-identity"), nil)
+	assert.Equal(http.StatusInternalServerError, rec.Code)
+	rec = callbackWithCookie(linkState("fb", "google-identity"), &http.Cookie{
+		Name:  DefaultLinkCookieName,
+		Value: base64.RawURLEncoding.EncodeToString([]byte("other link key")),
+	})
+	assert.Equal(http.StatusInternalServerError, rec.Code)
+	s, err := apptoken.NewLinkStateTokenString("zzz", "fb", "google-identity", time.Hour, []byte("xxx"))
+	require.NoError(t, err)
+	rec = callback(s)
+	assert.Equal(http.StatusInternalServerError, rec.Code)
+	_, err = is.LoginByIdentity(ctx, "fb", "fb-identity")
+	assert.True(authkit.IsUserNotFound(err))
+
+	// Authenticated user links facebook.
+	rec = callback(linkState("fb", "google-identity"))
+	assert.Equal(http.StatusFound, rec.Code)
+	assert.Empty(rec.Header().Get(echo.HeaderSetCookie))
+	login, err = is.LoginByIdentity(ctx, "fb", "fb-identity")
+	assert.NoError(err)
+	assert.Equal("google-identity", login)
+	token, err := us.OAuth2Token(ctx, "google-identity", "fb")
+	assert.NoError(err)
+	if assert.NotNil(token) {
+		assert.Equal("ext-access-token", token.AccessToken)
+	}
+
+	// Login with already linked provider re-authenticates the user.
+	rec = callback(linkState("google", "google-identity"))
+	assert.Equal(http.StatusFound, rec.Code)
+	cookie := rec.Header().Get(echo.HeaderSetCookie)
+	assert.Contains(cookie, DefaultReauthCookieName+"=")
+	assert.NotContains(cookie, "xxx-auth-cookie")
+
+	// Login with facebook finds the same user.
+	rec = callback(testNewStateTokenString(t, h.Config, "fb", "")[0])
+	assert.Equal(http.StatusFound, rec.Code)
+	assert.Equal("xxx-auth-cookie=xxx-access-token; Secure", rec.Header().Get(echo.HeaderSetCookie))
+	_, err = us.User(ctx, "fb-identity")
+	assert.True(authkit.IsUserNotFound(err))
+
+	// Identity can't be linked to another user.
+	rec = callback(linkState("fb", "other@login.ok"))
+	assert.Equal(http.StatusConflict, rec.Code)
+	token, err = us.OAuth2Token(ctx, "other@login.ok", "fb")
+	assert.NoError(err)
+	assert.Nil(token)
+
+	// Linking is disabled without IdentityStore.
+	h.IdentityStore = nil
+	rec = callback(linkState("google", "other@login.ok"))
+	assert.Equal(http.StatusInternalServerError, rec.Code)
+}
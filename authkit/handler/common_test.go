@@ -42,11 +42,26 @@ func (testErrorCustomizer) UserCreationError(e error) interface{} {
 	}
 }
 
-func (testErrorCustomizer) UserAuthenticationError(error) interface{} {
+func (testErrorCustomizer) UserAuthenticationError(e error) interface{} {
+	msg := "user auth err"
+	switch {
+	case authkit.IsAccountLocked(e):
+		msg = "locked"
+	case authkit.IsInvalidCode(e):
+		msg = "invalid code"
+	}
 	return struct {
 		Code string
 	}{
-		"user auth err",
+		msg,
+	}
+}
+
+func (testErrorCustomizer) LastLoginMethodError(error) interface{} {
+	return struct {
+		Code string
+	}{
+		"last login method",
 	}
 }
 
@@ -158,6 +173,26 @@ func testNewEmailTokenString(
 	return []string{s}
 }
 
+func testNewPasswordChangeTokenString(
+	t *testing.T,
+	config Config,
+	login, email, passwordHash string,
+	expired ...bool) []string {
+	exp := 1 * time.Hour
+	if len(expired) > 0 && expired[0] {
+		exp = -1 * time.Hour
+	}
+	s, err := apptoken.NewPasswordChangeTokenString(
+		config.OAuth2State.TokenIssuer,
+		login,
+		email,
+		passwordHash,
+		exp,
+		config.OAuth2State.TokenSignKey)
+	assert.NoError(t, err)
+	return []string{s}
+}
+
 func testNewStateTokenString(
 	t *testing.T,
 	config Config,
@@ -46,7 +46,11 @@ func (h handler) ConfirmEmail(c echo.Context) error {
 		return errors.WithStack(err)
 	}
 
-	if err := h.ProfileService.SetEmailConfirmed(t.Login(), t.Email(), true); err != nil {
+	if err := h.ProfileService.SetEmailConfirmed(
+		c.Request().Context(),
+		t.Login(),
+		t.Email(),
+		true); err != nil {
 		if authkit.IsUserNotFound(err) {
 			c.Logger().Debugf("%+v", errors.WithStack(err))
 			return c.Render(
@@ -61,8 +65,9 @@ func (h handler) ConfirmEmail(c echo.Context) error {
 }
 
 func (h handler) SendConfirmationEmail(c echo.Context) error {
+	ctx := c.Request().Context()
 	u := c.Get(middleware.DefaultContextKey).(authkit.User)
-	email, name, err := h.ProfileService.Email(u.Login())
+	email, name, err := h.ProfileService.Email(ctx, u.Login())
 	if err != nil {
 		c.Logger().Debugf("%+v", errors.WithStack(err))
 		return c.Render(
@@ -70,7 +75,24 @@ func (h handler) SendConfirmationEmail(c echo.Context) error {
 			authkit.ConfirmEmailTemplateName,
 			h.ErrorCustomizer.UserAuthenticationError(err))
 	}
+	if err := h.RateLimiter.Allow(
+		ctx,
+		authkit.RateLimitConfirmationEmail,
+		u.Login(),
+		email,
+		c.RealIP()); err != nil {
+		if d, ok := authkit.RetryAfter(err); ok {
+			c.Logger().Debugf("%+v", errors.WithStack(err))
+			setRetryAfter(c, d)
+			return c.Render(
+				http.StatusTooManyRequests,
+				authkit.ConfirmEmailTemplateName,
+				h.ErrorCustomizer.UserAuthenticationError(err))
+		}
+		return errors.WithStack(err)
+	}
 	if err := h.UserService.RequestEmailConfirmation(
+		ctx,
 		u.Login(),
 		email,
 		name); err != nil {
@@ -11,32 +11,39 @@ import (
 
 	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 
 	"github.com/letsrock-today/authkit/authkit"
 	"github.com/letsrock-today/authkit/authkit/middleware"
 	"github.com/letsrock-today/authkit/authkit/mocks"
+	"github.com/letsrock-today/authkit/authkit/ratelimit"
 )
 
 func TestConfirmEmail(t *testing.T) {
 	us := new(mocks.UserService)
 	us.On(
 		"User",
+		mock.Anything,
 		"valid@login.ok").Return(testUser{}, nil)
 	us.On(
 		"User",
+		mock.Anything,
 		"invalid@login.ok").Return(nil, authkit.NewUserNotFoundError(nil))
 
 	ps := new(mocks.ProfileService)
 	ps.On(
 		"EnsureExists",
+		mock.Anything,
 		"valid@login.ok").Return(nil)
 	ps.On(
 		"SetEmailConfirmed",
+		mock.Anything,
 		"valid@login.ok",
 		"valid@login.ok",
 		true).Return(nil)
 	ps.On(
 		"SetEmailConfirmed",
+		mock.Anything,
 		"invalid@login.ok",
 		"invalid@login.ok",
 		true).Return(authkit.NewUserNotFoundError(nil))
@@ -92,6 +99,15 @@ func TestConfirmEmail(t *testing.T) {
 			expStatusCode: http.StatusUnauthorized,
 			expBody:       `Error: user auth err`,
 		},
+		{
+			name: "password change token",
+			params: url.Values{
+				"token": testNewPasswordChangeTokenString(
+					t, h.Config, "valid@login.ok", "", "some_hash"),
+			},
+			expStatusCode: http.StatusInternalServerError,
+			expBody:       http.StatusText(http.StatusInternalServerError),
+		},
 		{
 			name: "everything OK",
 			params: url.Values{
@@ -129,10 +145,12 @@ func TestSendConfirmationEmail(t *testing.T) {
 	ps := new(mocks.ProfileService)
 	ps.On(
 		"Email",
+		mock.Anything,
 		"valid-login").Return("valid@login.ok", "Kate", nil)
 	us := new(mocks.UserService)
 	us.On(
 		"RequestEmailConfirmation",
+		mock.Anything,
 		"valid-login",
 		"valid@login.ok",
 		"Kate").Return(nil)
@@ -140,16 +158,32 @@ func TestSendConfirmationEmail(t *testing.T) {
 		ErrorCustomizer: testErrorCustomizer{},
 		UserService:     us,
 		ProfileService:  ps,
+		RateLimiter: ratelimit.New(ratelimit.Config{
+			Login: ratelimit.Limit{Requests: 1, Interval: time.Minute},
+		}),
 	}}
 	e := echo.New()
+	e.Renderer = testTemplateRenderer
+	assert := assert.New(t)
+
 	req := new(http.Request)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.Set(middleware.DefaultContextKey, testUser{login: "valid-login"})
 	err := h.SendConfirmationEmail(c)
-	assert := assert.New(t)
 	assert.NoError(err)
 	assert.Equal(http.StatusOK, rec.Code)
+
+	// Repeated request is rejected.
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.Set(middleware.DefaultContextKey, testUser{login: "valid-login"})
+	err = h.SendConfirmationEmail(c)
+	assert.NoError(err)
+	assert.Equal(http.StatusTooManyRequests, rec.Code)
+	assert.Equal("60", rec.Header().Get("Retry-After"))
+	assert.Equal("Error: user auth err", rec.Body.String())
+	us.AssertNumberOfCalls(t, "RequestEmailConfirmation", 1)
 }
 
 type testTemplate struct {
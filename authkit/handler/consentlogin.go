@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/asaskevich/govalidator"
@@ -31,6 +32,10 @@ func (h handler) ConsentLogin(c echo.Context) error {
 			h.ErrorCustomizer.InvalidRequestParameterError(flatten(err)))
 	}
 
+	if lf.P.SecondFactorToken != "" {
+		return h.consentLoginSecondFactor(c, lf)
+	}
+
 	if _, err := govalidator.ValidateStruct(lf); err != nil {
 		c.Logger().Debugf("%+v", errors.WithStack(err))
 		return c.JSON(
@@ -50,7 +55,7 @@ func (h handler) ConsentLogin(c echo.Context) error {
 	}
 
 	var (
-		action          func(login, password string) authkit.UserServiceError
+		action          func(ctx context.Context, login, password string) authkit.UserServiceError
 		errorCustomizer func(error) interface{}
 	)
 
@@ -60,13 +65,59 @@ func (h handler) ConsentLogin(c echo.Context) error {
 		action = h.UserService.Create
 		errorCustomizer = h.ErrorCustomizer.UserCreationError
 	} else {
-		action = h.UserService.Authenticate
+		action = func(ctx context.Context, login, password string) authkit.UserServiceError {
+			return h.authenticate(c, ctx, login, password)
+		}
 		errorCustomizer = h.ErrorCustomizer.UserAuthenticationError
 	}
 
-	if err := action(lf.P.Login, lf.P.Password); err != nil {
+	ctx := c.Request().Context()
+	if err := action(ctx, lf.P.Login, lf.P.Password); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return authenticationFailed(c, err, errorCustomizer)
+	}
+
+	if !signup {
+		if done, err := h.requireSecondFactor(c, ctx, lf.P.Login); done {
+			return err
+		}
+		h.attemptSucceeded(c, ctx, lf.P.Login)
+	}
+
+	reply := consentLoginReply{
+		Consent: signedTokenString,
+	}
+	return c.JSON(http.StatusOK, reply)
+}
+
+// consentLoginSecondFactor completes ConsentLogin with second factor code.
+func (h handler) consentLoginSecondFactor(c echo.Context, lf consentLoginForm) error {
+	cf := struct {
+		Challenge string   `valid:"required"`
+		Scopes    []string `valid:"required,stringlength(1|500)"`
+	}{lf.Challenge, lf.Scopes}
+	if _, err := govalidator.ValidateStruct(cf); err != nil {
 		c.Logger().Debugf("%+v", errors.WithStack(err))
-		return c.JSON(http.StatusUnauthorized, errorCustomizer(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(flatten(err)))
+	}
+
+	ctx := c.Request().Context()
+	login, err := h.checkSecondFactor(c, ctx, lf.P.SecondFactorToken, lf.P.Code)
+	if login == "" {
+		return err
+	}
+
+	signedTokenString, err := h.AuthService.GenerateConsentToken(
+		login,
+		lf.Scopes,
+		lf.Challenge)
+	if err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusUnauthorized,
+			h.ErrorCustomizer.UserAuthenticationError(err))
 	}
 
 	reply := consentLoginReply{
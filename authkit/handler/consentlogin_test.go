@@ -5,13 +5,17 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 
 	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/attempts"
 	"github.com/letsrock-today/authkit/authkit/mocks"
 )
 
@@ -46,27 +50,33 @@ func TestConsentLogin(t *testing.T) {
 	us := new(mocks.UserService)
 	us.On(
 		"Authenticate",
+		mock.Anything,
 		"valid@login.ok",
 		"invalid_password").Return(authkit.NewUserNotFoundError(nil))
 	us.On(
 		"Authenticate",
+		mock.Anything,
 		"valid@login.ok",
 		"valid_password").Return(nil)
 	us.On(
 		"Create",
+		mock.Anything,
 		"new.valid@login.ok",
 		"valid_password").Return(nil)
 	us.On(
 		"Create",
+		mock.Anything,
 		"broken.valid@login.ok",
 		"valid_password").Return(nil)
 	us.On(
 		"Create",
+		mock.Anything,
 		"old.valid@login.ok",
 		"valid_password").Return(authkit.NewDuplicateUserError(nil))
 
 	h := handler{Config{
 		ErrorCustomizer: testErrorCustomizer{},
+		AttemptTracker:  attempts.New(attempts.Config{}),
 		AuthService:     as,
 		UserService:     us,
 	}}
@@ -191,3 +201,51 @@ func TestConsentLogin(t *testing.T) {
 		}
 	}
 }
+
+func TestConsentLoginLockout(t *testing.T) {
+	assert := assert.New(t)
+
+	as := new(mocks.AuthService)
+	as.On(
+		"GenerateConsentToken",
+		"valid@login.ok",
+		[]string{"valid_scope"},
+		"valid_challenge").Return("valid_token", nil)
+
+	at := new(mocks.AttemptTracker)
+	at.On(
+		"Check",
+		mock.Anything,
+		"valid@login.ok",
+		mock.Anything).Return(authkit.NewAccountLockedError(90*time.Second, nil))
+
+	us := new(mocks.UserService)
+
+	h := handler{Config{
+		ErrorCustomizer: testErrorCustomizer{},
+		AuthService:     as,
+		UserService:     us,
+		AttemptTracker:  at,
+	}}
+
+	params := url.Values{
+		"action":    []string{"login"},
+		"challenge": []string{"valid_challenge"},
+		"login":     []string{"valid@login.ok"},
+		"password":  []string{"valid_password"},
+		"scopes":    []string{"valid_scope"},
+	}
+	e := echo.New()
+	req, err := http.NewRequest(echo.POST, "", strings.NewReader(params.Encode()))
+	assert.NoError(err)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+
+	assert.NoError(h.ConsentLogin(ctx))
+	assert.Equal(http.StatusTooManyRequests, rec.Code)
+	assert.Equal("90", rec.Header().Get("Retry-After"))
+	assert.Equal(`{"Code":"locked"}`, rec.Body.String())
+	us.AssertNotCalled(t, "Authenticate", mock.Anything, mock.Anything, mock.Anything)
+	at.AssertNotCalled(t, "Failed", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/asaskevich/govalidator"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/apptoken"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+)
+
+type changeEmailForm struct {
+	Email string `form:"email" valid:"required~email-required,email~email-format"`
+}
+
+func (h handler) ChangeEmail(c echo.Context) error {
+	if h.EmailChanger == nil || h.EmailChangeConfirmer == nil {
+		return echo.ErrNotFound
+	}
+	var f changeEmailForm
+	if err := c.Bind(&f); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(flatten(err)))
+	}
+	if _, err := govalidator.ValidateStruct(f); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(err))
+	}
+
+	ctx := c.Request().Context()
+	login := c.Get(middleware.DefaultContextKey).(authkit.User).Login()
+	email, name, err := h.ProfileService.Email(ctx, login)
+	if err != nil {
+		if authkit.IsUserNotFound(err) {
+			c.Logger().Debugf("%+v", errors.WithStack(err))
+			return c.JSON(
+				http.StatusUnauthorized,
+				h.ErrorCustomizer.UserAuthenticationError(err))
+		}
+		return errors.WithStack(err)
+	}
+
+	if err := h.RateLimiter.Allow(
+		ctx,
+		authkit.RateLimitEmailChange,
+		login,
+		f.Email,
+		c.RealIP()); err != nil {
+		if authkit.IsRateLimited(err) {
+			c.Logger().Debugf("%+v", errors.WithStack(err))
+			return authenticationFailed(
+				c,
+				err,
+				h.ErrorCustomizer.UserAuthenticationError)
+		}
+		return errors.WithStack(err)
+	}
+
+	// Current email stays active until the new one is confirmed.
+	if err := h.EmailChangeConfirmer.RequestEmailChangeConfirmation(
+		ctx,
+		login,
+		email,
+		f.Email,
+		name); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.JSON(http.StatusOK, struct{}{})
+}
+
+func (h handler) ConfirmEmailChange(c echo.Context) error {
+	if h.EmailChanger == nil || h.EmailChangeConfirmer == nil {
+		return echo.ErrNotFound
+	}
+	var r confirmationRequest
+	if err := c.Bind(&r); err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := govalidator.ValidateStruct(r); err != nil {
+		return errors.WithStack(err)
+	}
+
+	s := h.OAuth2State
+	t, err := apptoken.ParseEmailChangeToken(
+		s.TokenIssuer,
+		r.Token[0],
+		s.TokenSignKey)
+	if err != nil {
+		if err, ok := errors.Cause(err).(*jwt.ValidationError); ok {
+			if err.Errors&jwt.ValidationErrorExpired == jwt.ValidationErrorExpired {
+				c.Logger().Debugf("%+v", errors.WithStack(err))
+				return c.Render(
+					http.StatusUnauthorized,
+					authkit.ConfirmEmailTemplateName,
+					h.ErrorCustomizer.UserAuthenticationError(err))
+			}
+		}
+		return errors.WithStack(err)
+	}
+
+	ctx := c.Request().Context()
+	if err := h.EmailChanger.ChangeEmail(
+		ctx,
+		t.Login(),
+		t.OldEmail(),
+		t.NewEmail()); err != nil {
+		if authkit.IsUserNotFound(err) {
+			c.Logger().Debugf("%+v", errors.WithStack(err))
+			return c.Render(
+				http.StatusUnauthorized,
+				authkit.ConfirmEmailTemplateName,
+				h.ErrorCustomizer.UserAuthenticationError(err))
+		}
+		return errors.WithStack(err)
+	}
+
+	if t.OldEmail() != "" {
+		_, name, err := h.ProfileService.Email(ctx, t.Login())
+		if err == nil {
+			err = h.EmailChangeConfirmer.NotifyEmailChanged(
+				ctx,
+				t.Login(),
+				t.OldEmail(),
+				t.NewEmail(),
+				name)
+		}
+		if err != nil {
+			// Email is already changed, failed notification is not
+			// reported to the user.
+			c.Logger().Debugf("%+v", errors.WithStack(err))
+		}
+	}
+
+	return c.Render(http.StatusOK, authkit.ConfirmEmailTemplateName, nil)
+}
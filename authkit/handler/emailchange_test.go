@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/apptoken"
+	"github.com/letsrock-today/authkit/authkit/memstore"
+	"github.com/letsrock-today/authkit/authkit/ratelimit"
+)
+
+func TestChangeEmail(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	ps := memstore.NewProfileService()
+	require.NoError(t, ps.EnsureExists(ctx, "valid-login", "old@email.com"))
+	require.NoError(t, ps.SetEmailConfirmed(ctx, "valid-login", "old@email.com", true))
+	cf := memstore.NewConfirmer()
+
+	h := handler{Config{
+		ErrorCustomizer:      testErrorCustomizer{},
+		ProfileService:       ps,
+		EmailChanger:         ps,
+		EmailChangeConfirmer: cf,
+		RateLimiter:          ratelimit.New(ratelimit.Config{}),
+		OAuth2State: authkit.OAuth2State{
+			TokenIssuer:  "zzz",
+			TokenSignKey: []byte("xxx"),
+			Expiration:   time.Hour,
+		},
+	}}
+
+	rec := testPost(h.ChangeEmail, url.Values{
+		"email": []string{"not an email"},
+	}, testUser{login: "valid-login"})
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = testPost(h.ChangeEmail, url.Values{
+		"email": []string{"new@email.com"},
+	}, testUser{login: "valid-login"})
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal([]memstore.Confirmation{{
+		Login:       "valid-login",
+		Email:       "new@email.com",
+		OldEmail:    "old@email.com",
+		EmailChange: true,
+	}}, cf.Confirmations())
+
+	// Old email stays active until confirmation.
+	email, _, err := ps.ConfirmedEmail(ctx, "valid-login")
+	assert.NoError(err)
+	assert.Equal("old@email.com", email)
+
+	confirm := func(token string) *httptest.ResponseRecorder {
+		e := echo.New()
+		e.Renderer = testTemplateRenderer
+		req, err := http.NewRequest(echo.GET, "/?token="+url.QueryEscape(token), nil)
+		require.NoError(t, err)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if err := h.ConfirmEmailChange(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+
+	token, err := apptoken.NewEmailChangeTokenString(
+		"zzz",
+		"valid-login",
+		"old@email.com",
+		"new@email.com",
+		time.Hour,
+		[]byte("xxx"))
+	require.NoError(t, err)
+	rec = confirm(token)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("OK", rec.Body.String())
+	email, _, err = ps.ConfirmedEmail(ctx, "valid-login")
+	assert.NoError(err)
+	assert.Equal("new@email.com", email)
+
+	// Old address is notified.
+	confirmations := cf.Confirmations()
+	assert.Len(confirmations, 2)
+	assert.Equal(memstore.Confirmation{
+		Login:        "valid-login",
+		Email:        "new@email.com",
+		OldEmail:     "old@email.com",
+		EmailChanged: true,
+	}, confirmations[1])
+
+	// Token can't be used twice.
+	rec = confirm(token)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+
+	// Email confirmation token is not accepted.
+	token, err = apptoken.NewEmailTokenString(
+		"zzz",
+		"valid-login",
+		"other@email.com",
+		"",
+		time.Hour,
+		[]byte("xxx"))
+	require.NoError(t, err)
+	rec = confirm(token)
+	assert.Equal(http.StatusInternalServerError, rec.Code)
+	email, _, err = ps.Email(ctx, "valid-login")
+	assert.NoError(err)
+	assert.Equal("new@email.com", email)
+}
+
+func TestChangeEmailDisabled(t *testing.T) {
+	h := handler{Config{ErrorCustomizer: testErrorCustomizer{}}}
+	user := testUser{login: "valid-login"}
+	assert.Equal(t, http.StatusNotFound, testPost(h.ChangeEmail, nil, user).Code)
+	assert.Equal(t, http.StatusNotFound, testPost(h.ConfirmEmailChange, nil, nil).Code)
+}
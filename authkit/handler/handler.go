@@ -5,6 +5,8 @@ import (
 
 	"github.com/asaskevich/govalidator"
 	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/attempts"
+	"github.com/letsrock-today/authkit/authkit/ratelimit"
 )
 
 // Config holds configuration parmeters for handler.NewHandler().
@@ -27,6 +29,22 @@ type Config struct {
 	// the client.
 	AuthCookieName string
 
+	// PKCECookieName is a name of cookie, which binds PKCE code verifiers
+	// of auth requests (see AuthCodeURLs) to the browser. Default is
+	// DefaultPKCECookieName. PKCE may be disabled per provider with
+	// authkit.OAuth2Provider.DisablePKCE.
+	PKCECookieName string
+
+	// LinkCookieName is a name of cookie, which binds requests to link
+	// provider to the account (see LinkAuthCodeURLs) to the browser of the
+	// user. Default is DefaultLinkCookieName.
+	LinkCookieName string
+
+	// ReauthCookieName is a name of cookie, which keeps re-authentication
+	// token of the user, who logged in again with already linked provider
+	// (see DeleteAccount). Default is DefaultReauthCookieName.
+	ReauthCookieName string
+
 	// ModTime is a configuration modification time. It is used to
 	// cache list of providers on client (with "If-Modified_Since" header).
 	ModTime time.Time
@@ -39,6 +57,83 @@ type Config struct {
 	ContextCreator        authkit.ContextCreator
 	PasswordValidator     govalidator.Validator
 	LoginValidator        govalidator.Validator
+
+	// AttemptTracker protects Login and ConsentLogin handlers against
+	// brute-force attacks. If nil, then attempts.New(attempts.Config{})
+	// is used.
+	AttemptTracker authkit.AttemptTracker
+
+	// RateLimiter limits requests to RestorePassword, SendConfirmationEmail
+	// and ChangeEmail handlers, which send emails. If nil, then
+	// ratelimit.New(ratelimit.Config{}) is used.
+	RateLimiter authkit.RateLimiter
+
+	// TOTPStore enables TOTP second factor in Login and ConsentLogin
+	// handlers and TOTP enrollment handlers. If nil, and UserService
+	// implements authkit.TOTPStore, then UserService is used. Otherwise,
+	// second factor is disabled.
+	TOTPStore authkit.TOTPStore
+
+	// TOTPIssuer is shown by authenticator apps next to the user's login.
+	// If empty, then OAuth2State.TokenIssuer is used.
+	TOTPIssuer string
+
+	// RecoveryCodeStore enables recovery code handlers. If nil, and
+	// UserService implements authkit.RecoveryCodeStore, then UserService is
+	// used. Otherwise, recovery codes are disabled.
+	RecoveryCodeStore authkit.RecoveryCodeStore
+
+	// EmailChanger and EmailChangeConfirmer enable email change handlers.
+	// If nil, ProfileService and UserService are used respectively, if they
+	// implement these interfaces. Otherwise, email change is disabled.
+	EmailChanger         authkit.EmailChanger
+	EmailChangeConfirmer authkit.EmailChangeConfirmer
+
+	// AccountStore and AccountProfileService enable account export and
+	// deletion handlers. If nil, UserService and ProfileService are used
+	// respectively, if they implement these interfaces. Otherwise, account
+	// handlers are disabled.
+	AccountStore          authkit.AccountStore
+	AccountProfileService authkit.AccountProfileService
+
+	// IdentityStore enables linking of several external providers to the
+	// same account (see LinkAuthCodeURLs). Callback uses it to find account
+	// by external identity. If nil, and UserService implements
+	// authkit.IdentityStore, then UserService is used. Otherwise, linking
+	// is disabled and Callback uses external identity as a login.
+	IdentityStore authkit.IdentityStore
+
+	// SessionStore enables sessions: every login (on every device) gets
+	// its own token of the private provider, user may list sessions and
+	// revoke them. If nil, and UserService implements authkit.SessionStore,
+	// then UserService is used. Otherwise, single private provider's token
+	// per user is kept in the UserService.
+	SessionStore authkit.SessionStore
+
+	// TokenInvalidator removes decisions of caching TokenValidator (see
+	// validatorcache), used by the middleware, about tokens, revoked by
+	// handlers (Logout, RevokeSession, etc). If nil, and AuthService
+	// implements authkit.TokenInvalidator, then AuthService is used.
+	// Otherwise, revoked tokens may be accepted, until cached decisions
+	// expire.
+	TokenInvalidator authkit.TokenInvalidator
+
+	// RevokeTokensOnPasswordChange tells ChangeOwnPassword to revoke user's
+	// token, stored for the private provider, if it is not the token of the
+	// current request (that is, token issued to another client of the user).
+	RevokeTokensOnPasswordChange bool
+
+	// SignOutEverywhereOnPasswordChange tells ChangePassword (password
+	// change by the token from the email or from the recovery code) to
+	// revoke all user's tokens, like SignOutEverywhere does. It requires
+	// AccountStore.
+	SignOutEverywhereOnPasswordChange bool
+
+	// SecondFactorExpiration is a lifespan of tokens, issued to complete
+	// second factor check or enrollment, of password change tokens,
+	// issued for recovery codes, and of re-authentication tokens. Default
+	// is 5 minutes.
+	SecondFactorExpiration time.Duration
 }
 
 func (c Config) Valid() bool {
@@ -53,6 +148,15 @@ func (c Config) Valid() bool {
 // All arguments except ContextCreator and Validator must be provided.
 // If ContextCreator is nil, then DefaultContextCreator is used.
 // If Validator is nil, then default password validator is used.
+// If AttemptTracker or RateLimiter is nil, then in-memory implementation with
+// default configuration is used.
+// If TOTPStore, RecoveryCodeStore, EmailChangeConfirmer, AccountStore,
+// IdentityStore or SessionStore is nil, then UserService is used, if it
+// implements corresponding interface.
+// Same for EmailChanger, AccountProfileService and ProfileService, and for
+// TokenInvalidator and AuthService.
+// SignOutEverywhereOnPasswordChange requires AccountStore, NewHandler panics
+// without it.
 func NewHandler(c Config) authkit.Handler {
 	if !c.Valid() {
 		panic("invalid argument")
@@ -68,6 +172,42 @@ func NewHandler(c Config) authkit.Handler {
 		c.LoginValidator = govalidator.Validator(emailOrLoginValidator)
 	}
 	govalidator.TagMap["login"] = c.LoginValidator
+	if c.AttemptTracker == nil {
+		c.AttemptTracker = attempts.New(attempts.Config{})
+	}
+	if c.RateLimiter == nil {
+		c.RateLimiter = ratelimit.New(ratelimit.Config{})
+	}
+	if c.TOTPStore == nil {
+		c.TOTPStore, _ = c.UserService.(authkit.TOTPStore)
+	}
+	if c.RecoveryCodeStore == nil {
+		c.RecoveryCodeStore, _ = c.UserService.(authkit.RecoveryCodeStore)
+	}
+	if c.EmailChanger == nil {
+		c.EmailChanger, _ = c.ProfileService.(authkit.EmailChanger)
+	}
+	if c.EmailChangeConfirmer == nil {
+		c.EmailChangeConfirmer, _ = c.UserService.(authkit.EmailChangeConfirmer)
+	}
+	if c.AccountStore == nil {
+		c.AccountStore, _ = c.UserService.(authkit.AccountStore)
+	}
+	if c.SignOutEverywhereOnPasswordChange && c.AccountStore == nil {
+		panic("SignOutEverywhereOnPasswordChange requires AccountStore")
+	}
+	if c.AccountProfileService == nil {
+		c.AccountProfileService, _ = c.ProfileService.(authkit.AccountProfileService)
+	}
+	if c.IdentityStore == nil {
+		c.IdentityStore, _ = c.UserService.(authkit.IdentityStore)
+	}
+	if c.SessionStore == nil {
+		c.SessionStore, _ = c.UserService.(authkit.SessionStore)
+	}
+	if c.TokenInvalidator == nil {
+		c.TokenInvalidator, _ = c.AuthService.(authkit.TokenInvalidator)
+	}
 	return handler{c}
 }
 
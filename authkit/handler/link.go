@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit/apptoken"
+)
+
+// DefaultLinkCookieName is a default name of cookie, which binds requests to
+// link provider to the browser.
+const DefaultLinkCookieName = "authkit-link"
+
+var errLinkNotBound = errors.New("invalid state, link request is not bound to the browser")
+
+// Link state carries the user's login, so it should not be accepted from
+// another browser, otherwise an attacker could make the victim link the
+// victim's identity to the attacker's account. Link nonce in the state is
+// derived from the random key, kept in the browser's cookie, regardless of
+// whether PKCE is used.
+
+// linkNonce returns link nonce for the browser (see cookieKey).
+func (h handler) linkNonce(c echo.Context) (string, error) {
+	key, err := h.cookieKey(c, h.linkCookieName())
+	if err != nil {
+		return "", err
+	}
+	return linkNonceFromKey(key), nil
+}
+
+// checkLinkNonce checks that link state has been created in the browser,
+// which sent the request.
+func (h handler) checkLinkNonce(c echo.Context, state apptoken.StateToken) error {
+	cookie, err := c.Cookie(h.linkCookieName())
+	if err != nil {
+		return errors.Wrap(errLinkNotBound, "link cookie not found")
+	}
+	key, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return errors.Wrap(errLinkNotBound, err.Error())
+	}
+	nonce := state.LinkNonce()
+	if nonce == "" || subtle.ConstantTimeCompare(
+		[]byte(nonce),
+		[]byte(linkNonceFromKey(key))) != 1 {
+		return errors.WithStack(errLinkNotBound)
+	}
+	return nil
+}
+
+func (h handler) linkCookieName() string {
+	if h.LinkCookieName == "" {
+		return DefaultLinkCookieName
+	}
+	return h.LinkCookieName
+}
+
+// linkNonceFromKey derives nonce from the key, so that state, which is sent
+// to the provider, doesn't reveal the key.
+func linkNonceFromKey(key []byte) string {
+	sum := sha256.Sum256(key)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
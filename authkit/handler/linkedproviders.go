@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+	"github.com/letsrock-today/authkit/authkit/signout"
+)
+
+type (
+	linkedProvidersReply struct {
+		Providers   []oauth2Provider `json:"providers"`
+		HasPassword bool             `json:"hasPassword"`
+	}
+
+	unlinkProviderForm struct {
+		Provider string `form:"provider" valid:"required~provider-required"`
+	}
+)
+
+var errProviderNotLinked = errors.New("provider is not linked to the account")
+
+func (h handler) LinkedProviders(c echo.Context) error {
+	if h.IdentityStore == nil {
+		return echo.ErrNotFound
+	}
+	ctx := c.Request().Context()
+	login := c.Get(middleware.DefaultContextKey).(authkit.User).Login()
+	user, err := h.UserService.User(ctx, login)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	identities, err := h.IdentityStore.Identities(ctx, login)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	pids := make([]string, 0, len(identities))
+	for pid := range identities {
+		pids = append(pids, pid)
+	}
+	sort.Strings(pids)
+	reply := linkedProvidersReply{
+		Providers:   []oauth2Provider{},
+		HasPassword: user.PasswordHash() != authkit.NoPasswordHash,
+	}
+	for _, pid := range pids {
+		p := oauth2Provider{ID: pid}
+		// Provider may be removed from configuration after linking.
+		if pp := oauth2ProviderByID(h.OAuth2Providers, pid); pp != nil {
+			p.Name = pp.Name
+			p.IconURL = pp.IconURL
+		}
+		reply.Providers = append(reply.Providers, p)
+	}
+	return c.JSON(http.StatusOK, reply)
+}
+
+func (h handler) UnlinkProvider(c echo.Context) error {
+	if h.IdentityStore == nil {
+		return echo.ErrNotFound
+	}
+	var f unlinkProviderForm
+	if err := c.Bind(&f); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(flatten(err)))
+	}
+	if _, err := govalidator.ValidateStruct(f); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(err))
+	}
+
+	ctx := c.Request().Context()
+	login := c.Get(middleware.DefaultContextKey).(authkit.User).Login()
+	identities, err := h.IdentityStore.Identities(ctx, login)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, ok := identities[f.Provider]; !ok {
+		err := errors.WithStack(errProviderNotLinked)
+		c.Logger().Debugf("%+v", err)
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(err))
+	}
+
+	token, err := h.UserService.OAuth2Token(ctx, login, f.Provider)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := h.IdentityStore.UnlinkIdentity(ctx, login, f.Provider); err != nil {
+		if authkit.IsLastLoginMethod(err) {
+			// User would not be able to login without this provider.
+			c.Logger().Debugf("%+v", errors.WithStack(err))
+			return c.JSON(
+				http.StatusConflict,
+				h.ErrorCustomizer.LastLoginMethodError(err))
+		}
+		return errors.WithStack(err)
+	}
+	if token == nil {
+		return c.JSON(http.StatusOK, struct{}{})
+	}
+	if err := h.UserService.UpdateOAuth2Token(
+		ctx,
+		login,
+		f.Provider,
+		nil); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := signout.RevokeSocialToken(
+		h.signoutConfig(c),
+		f.Provider,
+		token); err != nil {
+		// Provider is unlinked anyway, token will expire eventually.
+		c.Logger().Debugf("%+v", err)
+	}
+	return c.JSON(http.StatusOK, struct{}{})
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"golang.org/x/oauth2"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/memstore"
+	"github.com/letsrock-today/authkit/authkit/mocks"
+	"github.com/letsrock-today/authkit/authkit/passhash"
+)
+
+type testRevokingSocialProfileService struct {
+	*mocks.SocialProfileService
+	*mocks.SocialTokenRevoker
+}
+
+func TestLinkedProviders(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	us := memstore.NewUserService(nil, passhash.New(passhash.NewBcrypt(4)))
+	is := us.(authkit.IdentityStore)
+	require.NoError(t, is.CreateWithIdentity(ctx, "valid@login.ok", "google", "google-identity"))
+	require.NoError(t, is.LinkIdentity(ctx, "valid@login.ok", "fb", "fb-identity"))
+
+	h := handler{Config{
+		ErrorCustomizer: testErrorCustomizer{},
+		UserService:     us,
+		IdentityStore:   is,
+		OAuth2Providers: []authkit.OAuth2Provider{
+			{ID: "google", Name: "Google", IconURL: "google.png"},
+		},
+	}}
+	user := testUser{login: "valid@login.ok"}
+
+	rec := testPost(h.LinkedProviders, nil, user)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.JSONEq(`{
+		"providers": [
+			{"id": "fb", "name": "", "iconUrl": ""},
+			{"id": "google", "name": "Google", "iconUrl": "google.png"}
+		],
+		"hasPassword": false
+	}`, rec.Body.String())
+
+	h.IdentityStore = nil
+	rec = testPost(h.LinkedProviders, nil, user)
+	assert.Equal(http.StatusNotFound, rec.Code)
+}
+
+func TestUnlinkProvider(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	us := memstore.NewUserService(nil, passhash.New(passhash.NewBcrypt(4)))
+	is := us.(authkit.IdentityStore)
+	require.NoError(t, is.CreateWithIdentity(ctx, "valid@login.ok", "google", "google-identity"))
+	fbtoken := &oauth2.Token{AccessToken: "fb-access", RefreshToken: "fb-refresh"}
+	require.NoError(t, us.UpdateOAuth2Token(ctx, "valid@login.ok", "fb", fbtoken))
+
+	cfg := new(mocks.OAuth2Config)
+	cfg.On("Client", mock.Anything, fbtoken).Return(http.DefaultClient)
+	revoker := new(mocks.SocialTokenRevoker)
+	revoker.On("RevokeToken", http.DefaultClient, fbtoken).Return(nil)
+	sps := new(mocks.SocialProfileServices)
+	sps.On("SocialProfileService", "fb").Return(
+		testRevokingSocialProfileService{
+			new(mocks.SocialProfileService),
+			revoker,
+		},
+		nil)
+
+	h := handler{Config{
+		ErrorCustomizer:       testErrorCustomizer{},
+		UserService:           us,
+		SocialProfileServices: sps,
+		IdentityStore:         is,
+		ContextCreator:        authkit.DefaultContextCreator{},
+		OAuth2Providers: []authkit.OAuth2Provider{
+			{ID: "google"},
+			{ID: "fb", OAuth2Config: cfg},
+		},
+	}}
+	user := testUser{login: "valid@login.ok"}
+	unlinkRec := func(pid string) *httptest.ResponseRecorder {
+		return testPost(h.UnlinkProvider, url.Values{
+			"provider": []string{pid},
+		}, user)
+	}
+	unlink := func(pid string) int {
+		return unlinkRec(pid).Code
+	}
+
+	assert.Equal(http.StatusBadRequest, unlink(""))
+	assert.Equal(http.StatusBadRequest, unlink("fb"), "not linked yet")
+
+	// Single provider of the user without password.
+	rec := unlinkRec("google")
+	assert.Equal(http.StatusConflict, rec.Code)
+	assert.Equal(`{"Code":"last login method"}`, rec.Body.String())
+	_, err := is.LoginByIdentity(ctx, "google", "google-identity")
+	assert.NoError(err)
+
+	require.NoError(t, is.LinkIdentity(ctx, "valid@login.ok", "fb", "fb-identity"))
+	assert.Equal(http.StatusOK, unlink("fb"))
+	revoker.AssertCalled(t, "RevokeToken", http.DefaultClient, fbtoken)
+	_, err = is.LoginByIdentity(ctx, "fb", "fb-identity")
+	assert.True(authkit.IsUserNotFound(err))
+	token, err := us.OAuth2Token(ctx, "valid@login.ok", "fb")
+	assert.NoError(err)
+	assert.Nil(token)
+
+	// User with password may unlink all providers.
+	u, err := us.User(ctx, "valid@login.ok")
+	require.NoError(t, err)
+	require.NoError(t, us.UpdatePassword(ctx, "valid@login.ok", u.PasswordHash(), "valid_password"))
+	assert.Equal(http.StatusOK, unlink("google"))
+	identities, err := is.Identities(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Empty(identities)
+
+	h.IdentityStore = nil
+	assert.Equal(http.StatusNotFound, unlink("google"))
+}
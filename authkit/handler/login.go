@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 	"net/url"
 	"strings"
@@ -21,6 +22,11 @@ type (
 		Action   string `form:"action" valid:"required,matches(login|signup)"`
 		Login    string `form:"login" valid:"required~login-required,login~login-format"`
 		Password string `form:"password" valid:"required~password-required,password~password-format"`
+
+		// SecondFactorToken and Code are sent instead of credentials, when
+		// second factor is required.
+		SecondFactorToken string `form:"secondFactorToken"`
+		Code              string `form:"code"`
 	}
 
 	loginReply struct {
@@ -38,6 +44,15 @@ func (h handler) Login(c echo.Context) error {
 			h.ErrorCustomizer.InvalidRequestParameterError(flatten(err)))
 	}
 
+	if lf.SecondFactorToken != "" {
+		ctx := c.Request().Context()
+		login, err := h.checkSecondFactor(c, ctx, lf.SecondFactorToken, lf.Code)
+		if login == "" {
+			return err
+		}
+		return h.loginSucceeded(c, ctx, login, "")
+	}
+
 	if _, err := govalidator.ValidateStruct(lf); err != nil {
 		c.Logger().Debugf("%+v", errors.WithStack(err))
 		return c.JSON(
@@ -46,7 +61,8 @@ func (h handler) Login(c echo.Context) error {
 	}
 
 	var (
-		action          func(login, password string) authkit.UserServiceError
+		ctx             = c.Request().Context()
+		action          func(ctx context.Context, login, password string) authkit.UserServiceError
 		customizedError func(error) interface{}
 		email           = ""
 	)
@@ -54,15 +70,15 @@ func (h handler) Login(c echo.Context) error {
 	signup := lf.Action == "signup"
 
 	if signup {
-		action = func(login, password string) authkit.UserServiceError {
-			if err := h.UserService.Create(login, password); err != nil {
+		action = func(ctx context.Context, login, password string) authkit.UserServiceError {
+			if err := h.UserService.Create(ctx, login, password); err != nil {
 				return err
 			}
 			// Create empty profile for new user.
 			if govalidator.IsEmail(login) {
 				email = login
 			}
-			if err := h.ProfileService.EnsureExists(login, email); err != nil {
+			if err := h.ProfileService.EnsureExists(ctx, login, email); err != nil {
 				return err
 			}
 			return nil
@@ -70,19 +86,37 @@ func (h handler) Login(c echo.Context) error {
 
 		customizedError = h.ErrorCustomizer.UserCreationError
 	} else {
-		action = h.UserService.Authenticate
+		action = func(ctx context.Context, login, password string) authkit.UserServiceError {
+			return h.authenticate(c, ctx, login, password)
+		}
 		customizedError = h.ErrorCustomizer.UserAuthenticationError
 	}
 
-	if err := action(lf.Login, lf.Password); err != nil {
+	if err := action(ctx, lf.Login, lf.Password); err != nil {
 		c.Logger().Debugf("%+v", errors.WithStack(err))
-		return c.JSON(http.StatusUnauthorized, customizedError(err))
+		return authenticationFailed(c, err, customizedError)
 	}
 
+	if !signup {
+		if done, err := h.requireSecondFactor(c, ctx, lf.Login); done {
+			return err
+		}
+		h.attemptSucceeded(c, ctx, lf.Login)
+	}
+
+	return h.loginSucceeded(c, ctx, lf.Login, email)
+}
+
+// loginSucceeded responds with URL to obtain token from private provider.
+// If email is not empty, then confirmation email is sent to it.
+func (h handler) loginSucceeded(
+	c echo.Context,
+	ctx context.Context,
+	login, email string) error {
 	pp := h.PrivateOAuth2Provider
 	cfg := pp.OAuth2Config.(*oauth2.Config)
 	t, err := h.AuthService.GenerateConsentTokenPriv(
-		lf.Login,
+		login,
 		cfg.Scopes,
 		cfg.ClientID)
 	if err != nil {
@@ -92,7 +126,8 @@ func (h handler) Login(c echo.Context) error {
 	if email != "" {
 		go func() {
 			if err := h.UserService.RequestEmailConfirmation(
-				lf.Login,
+				authkit.Detach(ctx),
+				login,
 				email,
 				""); err != nil {
 				c.Logger().Debugf("%+v", errors.WithStack(err))
@@ -104,7 +139,7 @@ func (h handler) Login(c echo.Context) error {
 	state, err := apptoken.NewStateWithLoginTokenString(
 		s.TokenIssuer,
 		pp.ID,
-		lf.Login,
+		login,
 		s.Expiration,
 		s.TokenSignKey)
 	if err != nil {
@@ -5,15 +5,20 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/oauth2"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 
 	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/attempts"
 	"github.com/letsrock-today/authkit/authkit/mocks"
 )
 
@@ -39,26 +44,32 @@ func TestLogin(t *testing.T) {
 	us := new(mocks.UserService)
 	us.On(
 		"Authenticate",
+		mock.Anything,
 		"valid@login.ok",
 		"invalid_password").Return(authkit.NewUserNotFoundError(nil))
 	us.On(
 		"Authenticate",
+		mock.Anything,
 		"valid@login.ok",
 		"valid_password").Return(nil)
 	us.On(
 		"Create",
+		mock.Anything,
 		"new.valid@login.ok",
 		"valid_password").Return(nil)
 	us.On(
 		"Create",
+		mock.Anything,
 		"broken.valid@login.ok",
 		"valid_password").Return(nil)
 	us.On(
 		"Create",
+		mock.Anything,
 		"old.valid@login.ok",
 		"valid_password").Return(authkit.NewDuplicateUserError(nil))
 	us.On(
 		"RequestEmailConfirmation",
+		mock.Anything,
 		"new.valid@login.ok",
 		"new.valid@login.ok",
 		"").Return(nil)
@@ -66,11 +77,13 @@ func TestLogin(t *testing.T) {
 	ps := new(mocks.ProfileService)
 	ps.On(
 		"EnsureExists",
+		mock.Anything,
 		"new.valid@login.ok",
 		"new.valid@login.ok").Return(nil)
 
 	h := handler{Config{
 		ErrorCustomizer: testErrorCustomizer{},
+		AttemptTracker:  attempts.New(attempts.Config{}),
 		AuthService:     as,
 		UserService:     us,
 		ProfileService:  ps,
@@ -85,6 +98,7 @@ func TestLogin(t *testing.T) {
 
 	h2 := handler{Config{
 		ErrorCustomizer: testErrorCustomizer{},
+		AttemptTracker:  attempts.New(attempts.Config{}),
 		AuthService:     as,
 		UserService:     us,
 		PrivateOAuth2Provider: authkit.OAuth2Provider{
@@ -218,6 +232,91 @@ func TestLogin(t *testing.T) {
 	}
 }
 
+func TestLoginLockout(t *testing.T) {
+	assert := assert.New(t)
+
+	as := new(mocks.AuthService)
+	as.On(
+		"GenerateConsentTokenPriv",
+		"valid@login.ok",
+		[]string{"some_scope"},
+		"some_client_id").Return("valid_token", nil)
+
+	us := new(mocks.UserService)
+	us.On(
+		"Authenticate",
+		mock.Anything,
+		"valid@login.ok",
+		"invalid_password").Return(authkit.NewUserNotFoundError(nil))
+	us.On(
+		"Authenticate",
+		mock.Anything,
+		"valid@login.ok",
+		"valid_password").Return(nil)
+
+	h := handler{Config{
+		ErrorCustomizer: testErrorCustomizer{},
+		AuthService:     as,
+		UserService:     us,
+		AttemptTracker: attempts.New(attempts.Config{
+			Login: attempts.Policy{
+				Threshold: 2,
+				BaseDelay: time.Minute,
+				MaxDelay:  time.Hour,
+				Window:    time.Hour,
+			},
+		}),
+		PrivateOAuth2Provider: authkit.OAuth2Provider{
+			ID: "some_id",
+			OAuth2Config: &oauth2.Config{
+				ClientID: "some_client_id",
+				Scopes:   []string{"some_scope"},
+			},
+		},
+	}}
+
+	govalidator.TagMap["password"] = govalidator.Validator(func(p string) bool {
+		// simplified password validator for test
+		return len(p) > 3
+	})
+
+	login := func(password string) *httptest.ResponseRecorder {
+		e := echo.New()
+		params := url.Values{
+			"action":   []string{"login"},
+			"login":    []string{"valid@login.ok"},
+			"password": []string{password},
+		}
+		req, err := http.NewRequest(
+			echo.POST,
+			"",
+			strings.NewReader(params.Encode()))
+		assert.NoError(err)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(req, rec)
+		if err := h.Login(ctx); err != nil {
+			e.HTTPErrorHandler(err, ctx)
+		}
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		rec := login("invalid_password")
+		assert.Equal(http.StatusUnauthorized, rec.Code)
+		assert.Equal(`{"Code":"user auth err"}`, rec.Body.String())
+	}
+
+	// Even valid password is not checked while account is locked.
+	rec := login("valid_password")
+	assert.Equal(http.StatusTooManyRequests, rec.Code)
+	assert.Equal(`{"Code":"locked"}`, rec.Body.String())
+	retry, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	assert.NoError(err)
+	assert.True(retry > 0 && retry <= 60, "unexpected Retry-After: %d", retry)
+	us.AssertNumberOfCalls(t, "Authenticate", 2)
+}
+
 func TestSimpleLoginValidator(t *testing.T) {
 	assert := assert.New(t)
 	v := SimpleLoginValidator
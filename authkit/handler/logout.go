@@ -4,31 +4,56 @@ import (
 	"net/http"
 	"strings"
 
+	"golang.org/x/oauth2"
+
 	"github.com/labstack/echo"
 	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/signout"
 )
 
 func (h handler) Logout(c echo.Context) error {
-	// Get access token from header.
 	req := c.Request()
-	auth := req.Header.Get("Authorization")
-	split := strings.SplitN(auth, " ", 2)
-	if len(split) != 2 || !strings.EqualFold(split[0], "bearer") {
-		return errors.WithStack(errors.New("invalid header fromat"))
-	}
-	token := strings.TrimSpace(split[1])
-	if token == "" {
-		return errors.WithStack(errors.New("invalid auth token"))
+	token, err := bearerToken(req)
+	if err != nil {
+		return err
 	}
 
-	if err := h.AuthService.RevokeAccessToken(token); err != nil {
+	if err := signout.RevokePrivateToken(
+		h.signoutConfig(c),
+		&oauth2.Token{AccessToken: token}); err != nil {
 		return errors.WithStack(err)
 	}
 	if err := h.UserService.RevokeAccessToken(
+		req.Context(),
 		h.PrivateOAuth2Provider.ID,
 		token); err != nil {
 		return errors.WithStack(err)
 	}
+	if h.SessionStore != nil {
+		s, _, err := h.SessionStore.SessionByAccessToken(req.Context(), token)
+		if err == nil {
+			err = h.SessionStore.DeleteSession(req.Context(), s.Login, s.ID)
+		}
+		if err != nil && !authkit.IsUserNotFound(err) {
+			return errors.WithStack(err)
+		}
+	}
 
 	return c.JSON(http.StatusOK, struct{}{})
 }
+
+// bearerToken returns access token from the Authorization header.
+func bearerToken(req *http.Request) (string, error) {
+	auth := req.Header.Get("Authorization")
+	split := strings.SplitN(auth, " ", 2)
+	if len(split) != 2 || !strings.EqualFold(split[0], "bearer") {
+		return "", errors.WithStack(errors.New("invalid header fromat"))
+	}
+	token := strings.TrimSpace(split[1])
+	if token == "" {
+		return "", errors.WithStack(errors.New("invalid auth token"))
+	}
+	return token, nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 
 	"github.com/letsrock-today/authkit/authkit"
 	"github.com/letsrock-today/authkit/authkit/mocks"
@@ -22,6 +23,7 @@ func TestLogout(t *testing.T) {
 	us := new(mocks.UserService)
 	us.On(
 		"RevokeAccessToken",
+		mock.Anything,
 		"some_provider_id",
 		"xxx-access-token").Return(nil)
 
@@ -32,9 +34,11 @@ func TestLogout(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
+	ti := &testTokenInvalidator{}
 	h := handler{Config{
-		AuthService: as,
-		UserService: us,
+		AuthService:      as,
+		UserService:      us,
+		TokenInvalidator: ti,
 		PrivateOAuth2Provider: authkit.OAuth2Provider{
 			ID: "some_provider_id",
 		},
@@ -43,4 +47,13 @@ func TestLogout(t *testing.T) {
 	err = h.Logout(c)
 	assert.NoError(err)
 	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal([]string{"xxx-access-token"}, ti.invalidated)
+}
+
+type testTokenInvalidator struct {
+	invalidated []string
+}
+
+func (i *testTokenInvalidator) InvalidateToken(accessToken string) {
+	i.invalidated = append(i.invalidated, accessToken)
 }
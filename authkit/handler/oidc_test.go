@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/apptoken"
+)
+
+type testIDTokenVerifier struct{}
+
+func (testIDTokenVerifier) VerifyIDToken(
+	rawIDToken, nonce string) (authkit.IDTokenClaims, error) {
+	if rawIDToken != "id-token" || nonce != "nonce" {
+		return nil, errors.New("invalid id_token")
+	}
+	return authkit.IDTokenClaims{"sub": "12345"}, nil
+}
+
+type testSocialProfileService struct{}
+
+func (testSocialProfileService) SocialProfile(*http.Client) (authkit.Profile, error) {
+	return &testProfile{login: "from-api"}, nil
+}
+
+type testIDTokenProfileService struct {
+	testSocialProfileService
+}
+
+func (testIDTokenProfileService) SocialProfileFromIDToken(
+	_ *http.Client,
+	claims authkit.IDTokenClaims) (authkit.Profile, error) {
+	return &testProfile{login: "from-id-token-" + claims.String("sub")}, nil
+}
+
+func TestAuthCodeURLsOIDCNonce(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h := handler{Config{
+		OAuth2State: authkit.OAuth2State{
+			TokenIssuer:  "zzz",
+			TokenSignKey: []byte("xxx"),
+			Expiration:   1 * time.Hour,
+		},
+		OAuth2Providers: []authkit.OAuth2Provider{
+			{
+				ID: "aaa",
+				OAuth2Config: &oauth2.Config{
+					Endpoint: oauth2.Endpoint{AuthURL: "https://aaa.aa/auth"},
+				},
+				IDTokenVerifier: testIDTokenVerifier{},
+			},
+			{
+				ID: "bbb",
+				OAuth2Config: &oauth2.Config{
+					Endpoint: oauth2.Endpoint{AuthURL: "https://bbb.bb/auth"},
+				},
+			},
+		},
+	}}
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	require.NoError(h.AuthCodeURLs(
+		e.NewContext(httptest.NewRequest(echo.GET, "/", nil), rec)))
+	var reply authCodeURLsReply
+	require.NoError(json.Unmarshal(rec.Body.Bytes(), &reply))
+	require.Len(reply.URLs, 2)
+
+	u, err := url.Parse(reply.URLs[0].URL)
+	require.NoError(err)
+	nonce := u.Query().Get("nonce")
+	assert.NotEmpty(nonce)
+	state, err := apptoken.ParseStateToken("zzz", u.Query().Get("state"), []byte("xxx"))
+	require.NoError(err)
+	assert.Equal(nonce, state.OIDCNonce())
+
+	u, err = url.Parse(reply.URLs[1].URL)
+	require.NoError(err)
+	assert.Empty(u.Query().Get("nonce"))
+	state, err = apptoken.ParseStateToken("zzz", u.Query().Get("state"), []byte("xxx"))
+	require.NoError(err)
+	assert.Empty(state.OIDCNonce())
+}
+
+func TestSocialProfileOIDC(t *testing.T) {
+	newState := func(nonce string) apptoken.StateToken {
+		s, err := apptoken.NewStateWithNoncesTokenString(
+			"zzz",
+			"aaa",
+			apptoken.Nonces{OIDC: nonce},
+			time.Hour,
+			[]byte("xxx"))
+		require.NoError(t, err)
+		state, err := apptoken.ParseStateToken("zzz", s, []byte("xxx"))
+		require.NoError(t, err)
+		return state
+	}
+	withIDToken := func(idToken string) *oauth2.Token {
+		return (&oauth2.Token{AccessToken: "access-token"}).WithExtra(
+			map[string]interface{}{"id_token": idToken})
+	}
+	oidcProvider := &authkit.OAuth2Provider{
+		ID:              "aaa",
+		IDTokenVerifier: testIDTokenVerifier{},
+	}
+
+	cases := []struct {
+		name     string
+		pa       authkit.SocialProfileService
+		provider *authkit.OAuth2Provider
+		nonce    string
+		token    *oauth2.Token
+		login    string
+	}{
+		{
+			name:     "not OIDC provider",
+			pa:       testIDTokenProfileService{},
+			provider: &authkit.OAuth2Provider{ID: "aaa"},
+			token:    &oauth2.Token{AccessToken: "access-token"},
+			login:    "from-api",
+		},
+		{
+			name:     "claims used",
+			pa:       testIDTokenProfileService{},
+			provider: oidcProvider,
+			nonce:    "nonce",
+			token:    withIDToken("id-token"),
+			login:    "from-id-token-12345",
+		},
+		{
+			name:     "claims not supported by service",
+			pa:       testSocialProfileService{},
+			provider: oidcProvider,
+			nonce:    "nonce",
+			token:    withIDToken("id-token"),
+			login:    "from-api",
+		},
+		{
+			name:     "no id_token",
+			pa:       testIDTokenProfileService{},
+			provider: oidcProvider,
+			nonce:    "nonce",
+			token:    &oauth2.Token{AccessToken: "access-token"},
+		},
+		{
+			name:     "wrong nonce",
+			pa:       testIDTokenProfileService{},
+			provider: oidcProvider,
+			nonce:    "other",
+			token:    withIDToken("id-token"),
+		},
+		{
+			name:     "invalid id_token",
+			pa:       testIDTokenProfileService{},
+			provider: oidcProvider,
+			nonce:    "nonce",
+			token:    withIDToken("forged"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+			p, err := socialProfile(
+				c.pa,
+				c.provider,
+				newState(c.nonce),
+				http.DefaultClient,
+				c.token)
+			if c.login == "" {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(c.login, p.GetLogin())
+		})
+	}
+}
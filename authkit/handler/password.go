@@ -11,6 +11,8 @@ import (
 
 	"github.com/letsrock-today/authkit/authkit"
 	"github.com/letsrock-today/authkit/authkit/apptoken"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+	"github.com/letsrock-today/authkit/authkit/signout"
 )
 
 type (
@@ -22,6 +24,11 @@ type (
 		Password string `form:"password1" valid:"required~password-required,password~password-format"`
 		Token    string `form:"token" valid:"required"`
 	}
+
+	changeOwnPasswordForm struct {
+		OldPassword string `form:"oldPassword" valid:"required~password-required"`
+		Password    string `form:"password1" valid:"required~password-required,password~password-format"`
+	}
 )
 
 var errEmailInvalid = errors.New("email is invalid or not registered in the app")
@@ -41,7 +48,26 @@ func (h handler) RestorePassword(c echo.Context) error {
 			h.ErrorCustomizer.InvalidRequestParameterError(err))
 	}
 
-	user, err := h.UserService.User(rp.Login)
+	// Limits for login and IP are applied before any lookup, so that
+	// endpoint couldn't be used to enumerate accounts.
+	ctx := c.Request().Context()
+	if err := h.RateLimiter.Allow(
+		ctx,
+		authkit.RateLimitRestorePassword,
+		rp.Login,
+		"",
+		c.RealIP()); err != nil {
+		if authkit.IsRateLimited(err) {
+			c.Logger().Debugf("%+v", errors.WithStack(err))
+			return authenticationFailed(
+				c,
+				err,
+				h.ErrorCustomizer.UserAuthenticationError)
+		}
+		return errors.WithStack(err)
+	}
+
+	user, err := h.UserService.User(ctx, rp.Login)
 	if err != nil {
 		if authkit.IsUserNotFound(err) {
 			c.Logger().Debugf("%+v", errors.WithStack(err))
@@ -52,7 +78,7 @@ func (h handler) RestorePassword(c echo.Context) error {
 		return errors.WithStack(err)
 	}
 
-	email, name, err := h.ProfileService.ConfirmedEmail(rp.Login)
+	email, name, err := h.ProfileService.ConfirmedEmail(ctx, rp.Login)
 	if err != nil {
 		if authkit.IsUserNotFound(err) {
 			c.Logger().Debugf("%+v", errors.WithStack(err))
@@ -63,7 +89,24 @@ func (h handler) RestorePassword(c echo.Context) error {
 		return errors.WithStack(err)
 	}
 
+	if err := h.RateLimiter.Allow(
+		ctx,
+		authkit.RateLimitRestorePassword,
+		"",
+		email,
+		""); err != nil {
+		if authkit.IsRateLimited(err) {
+			c.Logger().Debugf("%+v", errors.WithStack(err))
+			return authenticationFailed(
+				c,
+				err,
+				h.ErrorCustomizer.UserAuthenticationError)
+		}
+		return errors.WithStack(err)
+	}
+
 	if err := h.UserService.RequestPasswordChangeConfirmation(
+		ctx,
 		rp.Login,
 		email,
 		name,
@@ -89,7 +132,7 @@ func (h handler) ChangePassword(c echo.Context) error {
 	}
 
 	s := h.OAuth2State
-	t, err := apptoken.ParseEmailToken(
+	t, err := apptoken.ParsePasswordChangeToken(
 		s.TokenIssuer,
 		cp.Token,
 		s.TokenSignKey)
@@ -104,6 +147,7 @@ func (h handler) ChangePassword(c echo.Context) error {
 	}
 
 	if err = h.UserService.UpdatePassword(
+		c.Request().Context(),
 		t.Login(),
 		t.PasswordHash(),
 		cp.Password); err != nil {
@@ -115,9 +159,102 @@ func (h handler) ChangePassword(c echo.Context) error {
 		}
 		return errors.WithStack(err)
 	}
+
+	if h.SignOutEverywhereOnPasswordChange {
+		if err := h.signOutEverywhere(c, t.Login()); err != nil {
+			return err
+		}
+	}
 	return c.JSON(http.StatusOK, struct{}{})
 }
 
+func (h handler) ChangeOwnPassword(c echo.Context) error {
+	var cp changeOwnPasswordForm
+	if err := c.Bind(&cp); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(flatten(err)))
+	}
+	if _, err := govalidator.ValidateStruct(cp); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(err))
+	}
+
+	ctx := c.Request().Context()
+	login := c.Get(middleware.DefaultContextKey).(authkit.User).Login()
+	if err := h.authenticate(c, ctx, login, cp.OldPassword); err != nil {
+		if authkit.IsUserNotFound(err) || authkit.IsAccountLocked(err) {
+			c.Logger().Debugf("%+v", errors.WithStack(err))
+			return authenticationFailed(
+				c,
+				err,
+				h.ErrorCustomizer.UserAuthenticationError)
+		}
+		return errors.WithStack(err)
+	}
+	h.attemptSucceeded(c, ctx, login)
+
+	user, err := h.UserService.User(ctx, login)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := h.UserService.UpdatePassword(
+		ctx,
+		login,
+		user.PasswordHash(),
+		cp.Password); err != nil {
+		if authkit.IsUserNotFound(err) {
+			// Password has been changed concurrently.
+			c.Logger().Debugf("%+v", errors.WithStack(err))
+			return c.JSON(
+				http.StatusUnauthorized,
+				h.ErrorCustomizer.UserAuthenticationError(err))
+		}
+		return errors.WithStack(err)
+	}
+
+	if h.RevokeTokensOnPasswordChange {
+		if err := h.revokeOtherTokens(c, login); err != nil {
+			return err
+		}
+	}
+	return c.JSON(http.StatusOK, struct{}{})
+}
+
+// revokeOtherTokens revokes private provider's tokens, stored for the user
+// (including tokens of sessions), unless it is the token of the current
+// request.
+func (h handler) revokeOtherTokens(c echo.Context, login string) error {
+	req := c.Request()
+	current, err := bearerToken(req)
+	if err != nil {
+		return err
+	}
+	ctx := req.Context()
+	if err := signout.RevokeSessions(
+		ctx,
+		h.signoutConfig(c),
+		login,
+		current); err != nil {
+		return errors.WithStack(err)
+	}
+	pid := h.PrivateOAuth2Provider.ID
+	t, err := h.UserService.OAuth2Token(ctx, login, pid)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if t == nil || t.AccessToken == current {
+		return nil
+	}
+	if err := signout.RevokePrivateToken(h.signoutConfig(c), t); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(h.UserService.UpdateOAuth2Token(ctx, login, pid, nil))
+}
+
 func defaultPasswordValidator(p string) bool {
 	l := len(p)
 	if l < 5 || l > 50 {
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+// DefaultPKCECookieName is a default name of cookie, which binds PKCE code
+// verifiers to the browser.
+const DefaultPKCECookieName = "authkit-pkce"
+
+const (
+	pkceKeyLen = 32
+	nonceLen   = 32
+)
+
+// PKCE code verifier is not stored anywhere. It is derived from the nonce,
+// packed into the state token, and from the random key, kept in the
+// browser's cookie. State is sent to the provider in the URL, so it cannot
+// contain verifier itself. Cookie binds auth request to the browser, so
+// that code, intercepted by an attacker, cannot be exchanged via Callback
+// in another browser.
+
+// pkceKey returns key from the cookie or creates new one (see cookieKey).
+func (h handler) pkceKey(c echo.Context) ([]byte, error) {
+	return h.cookieKey(c, h.pkceCookieName())
+}
+
+// cookieKey returns random key from the cookie with given name or creates
+// new one. Cookie is (re)set with expiration of the state token.
+func (h handler) cookieKey(c echo.Context, name string) ([]byte, error) {
+	var key []byte
+	if cookie, err := c.Cookie(name); err == nil {
+		key, _ = base64.RawURLEncoding.DecodeString(cookie.Value)
+	}
+	if len(key) != pkceKeyLen {
+		key = make([]byte, pkceKeyLen)
+		if _, err := rand.Read(key); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     name,
+		Value:    base64.RawURLEncoding.EncodeToString(key),
+		Path:     "/",
+		MaxAge:   int(h.OAuth2State.Expiration.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+	})
+	return key, nil
+}
+
+// pkceExchangeContext returns context, which adds code verifier to the code
+// exchange request. It returns ctx, if PKCE is not used.
+func (h handler) pkceExchangeContext(
+	c echo.Context,
+	ctx context.Context,
+	nonce string) (context.Context, error) {
+	if nonce == "" {
+		return ctx, nil
+	}
+	cookie, err := c.Cookie(h.pkceCookieName())
+	if err != nil {
+		return nil, errors.Wrap(err, "PKCE cookie not found")
+	}
+	key, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	client := authkit.ContextHTTPClient(ctx)
+	t := client.Transport
+	if t == nil {
+		t = http.DefaultTransport
+	}
+	pc := *client
+	pc.Transport = pkceTransport{t, pkceVerifier(key, nonce)}
+	return context.WithValue(ctx, oauth2.HTTPClient, &pc), nil
+}
+
+func (h handler) pkceCookieName() string {
+	if h.PKCECookieName == "" {
+		return DefaultPKCECookieName
+	}
+	return h.PKCECookieName
+}
+
+// pkceChallenge returns S256 code challenge for the code verifier, derived
+// from the key and nonce.
+func pkceChallenge(key []byte, nonce string) string {
+	sum := sha256.Sum256([]byte(pkceVerifier(key, nonce)))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// pkceVerifier returns code verifier, derived from the key and nonce.
+func pkceVerifier(key []byte, nonce string) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(nonce))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// pkceTransport adds code_verifier parameter to the token request with
+// authorization_code grant. OAuth2Config.Exchange doesn't accept extra
+// parameters, so it is the only way to pass verifier through any
+// implementation of OAuth2Config.
+type pkceTransport struct {
+	base     http.RoundTripper
+	verifier string
+}
+
+func (t pkceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodPost ||
+		req.Body == nil ||
+		!strings.HasPrefix(
+			req.Header.Get("Content-Type"),
+			"application/x-www-form-urlencoded") {
+		return t.base.RoundTrip(req)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil || form.Get("grant_type") != "authorization_code" {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return t.base.RoundTrip(req)
+	}
+	form.Set("code_verifier", t.verifier)
+	body = []byte(form.Encode())
+	// RoundTripper should not modify request.
+	r := new(http.Request)
+	*r = *req
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return t.base.RoundTrip(r)
+}
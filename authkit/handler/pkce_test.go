@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/apptoken"
+)
+
+func TestPKCE(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var verifier string
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal("authorization_code", r.PostFormValue("grant_type"))
+			verifier = r.PostFormValue("code_verifier")
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{
+				"access_token": "xxx-access-token",
+				"token_type":   "bearer",
+			})
+		}))
+	defer srv.Close()
+
+	newConfig := func(id string) *oauth2.Config {
+		return &oauth2.Config{
+			ClientID:     id + "-id",
+			ClientSecret: id + "-secret",
+			Endpoint: oauth2.Endpoint{
+				TokenURL: srv.URL + "/token",
+				AuthURL:  "https://" + id + ".aa/auth",
+			},
+		}
+	}
+	h := handler{Config{
+		OAuth2State: authkit.OAuth2State{
+			TokenIssuer:  "zzz",
+			TokenSignKey: []byte("xxx"),
+			Expiration:   1 * time.Hour,
+		},
+		OAuth2Providers: []authkit.OAuth2Provider{
+			{
+				ID:           "aaa",
+				OAuth2Config: newConfig("aaa"),
+			},
+			{
+				ID:           "bbb",
+				OAuth2Config: newConfig("bbb"),
+				DisablePKCE:  true,
+			},
+		},
+	}}
+
+	e := echo.New()
+	req := httptest.NewRequest(echo.GET, "/", nil)
+	rec := httptest.NewRecorder()
+	require.NoError(h.AuthCodeURLs(e.NewContext(req, rec)))
+
+	var reply authCodeURLsReply
+	require.NoError(json.Unmarshal(rec.Body.Bytes(), &reply))
+	require.Len(reply.URLs, 2)
+	u, err := url.Parse(reply.URLs[0].URL)
+	require.NoError(err)
+	q := u.Query()
+	challenge := q.Get("code_challenge")
+	assert.NotEmpty(challenge)
+	assert.Equal("S256", q.Get("code_challenge_method"))
+	u, err = url.Parse(reply.URLs[1].URL)
+	require.NoError(err)
+	assert.Empty(u.Query().Get("code_challenge"))
+	cookie := rec.Header().Get(echo.HeaderSetCookie)
+	assert.Contains(cookie, DefaultPKCECookieName+"=")
+	assert.Contains(cookie, "HttpOnly")
+
+	state, err := apptoken.ParseStateToken("zzz", q.Get("state"), []byte("xxx"))
+	require.NoError(err)
+	assert.NotEmpty(state.PKCENonce())
+
+	// Callback in the same browser sends verifier, which matches challenge.
+	req = httptest.NewRequest(echo.GET, "/callback", nil)
+	req.Header.Set("Cookie", cookie)
+	c := e.NewContext(req, httptest.NewRecorder())
+	ctx, err := h.pkceExchangeContext(c, context.Background(), state.PKCENonce())
+	require.NoError(err)
+	token, err := newConfig("aaa").Exchange(ctx, "code")
+	require.NoError(err)
+	assert.Equal("xxx-access-token", token.AccessToken)
+	sum := sha256.Sum256([]byte(verifier))
+	assert.Equal(challenge, base64.RawURLEncoding.EncodeToString(sum[:]))
+
+	// Callback in another browser fails.
+	req = httptest.NewRequest(echo.GET, "/callback", nil)
+	c = e.NewContext(req, httptest.NewRecorder())
+	_, err = h.pkceExchangeContext(c, context.Background(), state.PKCENonce())
+	assert.Error(err)
+
+	// No PKCE in the state.
+	ctx, err = h.pkceExchangeContext(c, context.Background(), "")
+	assert.NoError(err)
+	assert.Equal(context.Background(), ctx)
+}
+
+func TestPKCEMultipleProviders(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var verifier string
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			verifier = r.PostFormValue("code_verifier")
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{
+				"access_token": "xxx-access-token",
+				"token_type":   "bearer",
+			})
+		}))
+	defer srv.Close()
+
+	newConfig := func(id string) *oauth2.Config {
+		return &oauth2.Config{
+			ClientID:     id + "-id",
+			ClientSecret: id + "-secret",
+			Endpoint: oauth2.Endpoint{
+				TokenURL: srv.URL + "/token",
+				AuthURL:  "https://" + id + ".aa/auth",
+			},
+		}
+	}
+	h := handler{Config{
+		OAuth2State: authkit.OAuth2State{
+			TokenIssuer:  "zzz",
+			TokenSignKey: []byte("xxx"),
+			Expiration:   1 * time.Hour,
+		},
+		OAuth2Providers: []authkit.OAuth2Provider{
+			{ID: "aaa", OAuth2Config: newConfig("aaa")},
+			{ID: "bbb", OAuth2Config: newConfig("bbb")},
+		},
+	}}
+
+	// Browser has no cookie yet.
+	e := echo.New()
+	req := httptest.NewRequest(echo.GET, "/", nil)
+	rec := httptest.NewRecorder()
+	require.NoError(h.AuthCodeURLs(e.NewContext(req, rec)))
+	cookies := rec.Header()[echo.HeaderSetCookie]
+	require.Len(cookies, 1, "single PKCE key expected")
+
+	var reply authCodeURLsReply
+	require.NoError(json.Unmarshal(rec.Body.Bytes(), &reply))
+	require.Len(reply.URLs, 2)
+	u, err := url.Parse(reply.URLs[0].URL)
+	require.NoError(err)
+	q := u.Query()
+	state, err := apptoken.ParseStateToken("zzz", q.Get("state"), []byte("xxx"))
+	require.NoError(err)
+
+	// Code of the first provider is exchanged with verifier, which matches
+	// its challenge.
+	req = httptest.NewRequest(echo.GET, "/callback", nil)
+	req.Header.Set("Cookie", cookies[0])
+	c := e.NewContext(req, httptest.NewRecorder())
+	ctx, err := h.pkceExchangeContext(c, context.Background(), state.PKCENonce())
+	require.NoError(err)
+	_, err = newConfig("aaa").Exchange(ctx, "code")
+	require.NoError(err)
+	sum := sha256.Sum256([]byte(verifier))
+	assert.Equal(q.Get("code_challenge"), base64.RawURLEncoding.EncodeToString(sum[:]))
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit/apptoken"
+)
+
+// DefaultReauthCookieName is a default name of cookie, which keeps
+// re-authentication token of the user.
+const DefaultReauthCookieName = "authkit-reauth"
+
+var errReauthenticationRequired = errors.New("re-authentication required")
+
+// User without password cannot confirm sensitive operations (like account
+// deletion) with password. Instead, user logs in again with one of already
+// linked providers via LinkAuthCodeURLs. Callback sets cookie with
+// short-lived re-authentication token then.
+
+// setReauthCookie sets cookie with re-authentication token for the login.
+func (h handler) setReauthCookie(c echo.Context, login string) error {
+	s := h.OAuth2State
+	t, err := apptoken.NewReauthenticationTokenString(
+		s.TokenIssuer,
+		login,
+		h.secondFactorExpiration(),
+		s.TokenSignKey)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     h.reauthCookieName(),
+		Value:    t,
+		Path:     "/",
+		MaxAge:   int(h.secondFactorExpiration().Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+	})
+	return nil
+}
+
+// reauthenticated checks that request has valid re-authentication token
+// for the login.
+func (h handler) reauthenticated(c echo.Context, login string) bool {
+	cookie, err := c.Cookie(h.reauthCookieName())
+	if err != nil {
+		return false
+	}
+	s := h.OAuth2State
+	t, err := apptoken.ParseReauthenticationToken(
+		s.TokenIssuer,
+		cookie.Value,
+		s.TokenSignKey)
+	if err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return false
+	}
+	return t.Login() == login
+}
+
+// clearReauthCookie removes re-authentication token from the browser.
+func (h handler) clearReauthCookie(c echo.Context) {
+	c.SetCookie(&http.Cookie{
+		Name:     h.reauthCookieName(),
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+	})
+}
+
+func (h handler) reauthCookieName() string {
+	if h.ReauthCookieName == "" {
+		return DefaultReauthCookieName
+	}
+	return h.ReauthCookieName
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/apptoken"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+	"github.com/letsrock-today/authkit/authkit/recoverycode"
+)
+
+type (
+	recoveryCodesReply struct {
+		Codes []string `json:"codes"`
+	}
+
+	redeemRecoveryCodeForm struct {
+		Login string `form:"login" valid:"required~login-required,login~login-format"`
+		Code  string `form:"code" valid:"required~code-required"`
+	}
+
+	redeemRecoveryCodeReply struct {
+		Token string `json:"token"`
+	}
+)
+
+func (h handler) GenerateRecoveryCodes(c echo.Context) error {
+	if h.RecoveryCodeStore == nil {
+		return echo.ErrNotFound
+	}
+	login := c.Get(middleware.DefaultContextKey).(authkit.User).Login()
+	codes, err := recoverycode.Generate(recoverycode.DefaultCount)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := h.RecoveryCodeStore.UpdateRecoveryCodes(
+		c.Request().Context(),
+		login,
+		recoverycode.HashAll(codes)); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.JSON(http.StatusOK, recoveryCodesReply{codes})
+}
+
+func (h handler) RedeemRecoveryCode(c echo.Context) error {
+	if h.RecoveryCodeStore == nil {
+		return echo.ErrNotFound
+	}
+	var f redeemRecoveryCodeForm
+	if err := c.Bind(&f); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(flatten(err)))
+	}
+	if _, err := govalidator.ValidateStruct(f); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(err))
+	}
+
+	ctx := c.Request().Context()
+	if err := h.AttemptTracker.Check(ctx, f.Login, c.RealIP()); err != nil {
+		return h.codeFailed(c, err)
+	}
+	user, err := h.UserService.User(ctx, f.Login)
+	if err != nil {
+		if authkit.IsUserNotFound(err) {
+			h.attemptFailed(c, ctx, f.Login)
+		}
+		return h.codeFailed(c, err)
+	}
+	ok, err := h.RecoveryCodeStore.UseRecoveryCode(
+		ctx,
+		f.Login,
+		recoverycode.Hash(f.Code))
+	if err != nil {
+		return h.codeFailed(c, err)
+	}
+	if !ok {
+		h.attemptFailed(c, ctx, f.Login)
+		return h.codeFailed(c, errors.WithStack(authkit.NewInvalidCodeError(nil)))
+	}
+	h.attemptSucceeded(c, ctx, f.Login)
+
+	// User is expected to lose second factor, so it is disabled and may be
+	// enrolled again after login.
+	if h.TOTPStore != nil {
+		if err := h.TOTPStore.UpdateTOTPSecret(ctx, f.Login, ""); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	// Token is the same as one sent by RequestPasswordChangeConfirmation,
+	// it should be used with ChangePassword.
+	s := h.OAuth2State
+	t, err := apptoken.NewPasswordChangeTokenString(
+		s.TokenIssuer,
+		f.Login,
+		"",
+		user.PasswordHash(),
+		h.secondFactorExpiration(),
+		s.TokenSignKey)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return c.JSON(http.StatusOK, redeemRecoveryCodeReply{t})
+}
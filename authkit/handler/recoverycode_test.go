@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/attempts"
+	"github.com/letsrock-today/authkit/authkit/memstore"
+	"github.com/letsrock-today/authkit/authkit/passhash"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	us := memstore.NewUserService(nil, passhash.New(passhash.NewBcrypt(4)))
+	require.NoError(t, us.Create(ctx, "valid@login.ok", "valid_password"))
+	ts := us.(authkit.TOTPStore)
+	require.NoError(t, ts.UpdateTOTPSecret(ctx, "valid@login.ok", "JBSWY3DPEHPK3PXP"))
+
+	h := handler{Config{
+		ErrorCustomizer:   testErrorCustomizer{},
+		AttemptTracker:    attempts.New(attempts.Config{}),
+		UserService:       us,
+		TOTPStore:         ts,
+		RecoveryCodeStore: us.(authkit.RecoveryCodeStore),
+		OAuth2State: authkit.OAuth2State{
+			TokenIssuer:  "some_issuer",
+			TokenSignKey: []byte("some_key"),
+			Expiration:   time.Hour,
+		},
+	}}
+
+	govalidator.TagMap["password"] = govalidator.Validator(func(p string) bool {
+		// simplified password validator for test
+		return len(p) > 3
+	})
+
+	rec := testPost(h.GenerateRecoveryCodes, nil, testUser{login: "valid@login.ok"})
+	assert.Equal(http.StatusOK, rec.Code)
+	var codes recoveryCodesReply
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &codes))
+	require.Len(t, codes.Codes, 10)
+
+	redeem := func(login, code string) *httptest.ResponseRecorder {
+		return testPost(h.RedeemRecoveryCode, url.Values{
+			"login": []string{login},
+			"code":  []string{code},
+		}, nil)
+	}
+
+	rec = redeem("valid@login.ok", "aaaaa-aaaaa")
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+	assert.Equal(`{"Code":"invalid code"}`, rec.Body.String())
+
+	rec = redeem("unknown@login.ok", codes.Codes[0])
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+	assert.Equal(`{"Code":"user auth err"}`, rec.Body.String())
+
+	// Code is accepted regardless of case.
+	rec = redeem("valid@login.ok", strings.ToUpper(codes.Codes[0]))
+	assert.Equal(http.StatusOK, rec.Code)
+	var reply redeemRecoveryCodeReply
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reply))
+	assert.NotEmpty(reply.Token)
+
+	// Second factor is disabled.
+	secret, err := ts.TOTPSecret(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Empty(secret)
+
+	// Code is single-use.
+	rec = redeem("valid@login.ok", codes.Codes[0])
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+
+	// Token can be used to change password.
+	rec = testPost(h.ChangePassword, url.Values{
+		"password1": []string{"new_password"},
+		"token":     []string{reply.Token},
+	}, nil)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.NoError(us.Authenticate(ctx, "valid@login.ok", "new_password"))
+
+	// Regenerated codes replace old ones.
+	rec = testPost(h.GenerateRecoveryCodes, nil, testUser{login: "valid@login.ok"})
+	assert.Equal(http.StatusOK, rec.Code)
+	rec = redeem("valid@login.ok", codes.Codes[1])
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+}
+
+func TestRecoveryCodesDisabled(t *testing.T) {
+	h := handler{Config{ErrorCustomizer: testErrorCustomizer{}}}
+	user := testUser{login: "valid@login.ok"}
+	assert.Equal(t, http.StatusNotFound, testPost(h.GenerateRecoveryCodes, nil, user).Code)
+	assert.Equal(t, http.StatusNotFound, testPost(h.RedeemRecoveryCode, nil, nil).Code)
+}
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+	"github.com/letsrock-today/authkit/authkit/signout"
+)
+
+type (
+	sessionsReply struct {
+		Sessions []sessionInfo `json:"sessions"`
+	}
+
+	sessionInfo struct {
+		ID       string    `json:"id"`
+		Device   string    `json:"device"`
+		IP       string    `json:"ip"`
+		Created  time.Time `json:"created"`
+		LastUsed time.Time `json:"lastUsed"`
+
+		// Current is true for the session of the request.
+		Current bool `json:"current"`
+	}
+
+	revokeSessionForm struct {
+		Session string `form:"session" valid:"required~session-required"`
+	}
+)
+
+var errSessionNotFound = errors.New("session not found")
+
+func (h handler) Sessions(c echo.Context) error {
+	if h.SessionStore == nil {
+		return echo.ErrNotFound
+	}
+	ctx := c.Request().Context()
+	login := c.Get(middleware.DefaultContextKey).(authkit.User).Login()
+	sessions, err := h.SessionStore.Sessions(ctx, login)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	current := h.currentSessionID(c)
+	reply := sessionsReply{Sessions: []sessionInfo{}}
+	for _, s := range sessions {
+		reply.Sessions = append(reply.Sessions, sessionInfo{
+			ID:       s.ID,
+			Device:   s.Device,
+			IP:       s.IP,
+			Created:  s.Created.UTC(),
+			LastUsed: s.LastUsed.UTC(),
+			Current:  s.ID == current,
+		})
+	}
+	return c.JSON(http.StatusOK, reply)
+}
+
+func (h handler) RevokeSession(c echo.Context) error {
+	if h.SessionStore == nil {
+		return echo.ErrNotFound
+	}
+	var f revokeSessionForm
+	if err := c.Bind(&f); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(flatten(err)))
+	}
+	if _, err := govalidator.ValidateStruct(f); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(err))
+	}
+
+	ctx := c.Request().Context()
+	login := c.Get(middleware.DefaultContextKey).(authkit.User).Login()
+	t, err := h.SessionStore.SessionToken(ctx, login, f.Session)
+	if err != nil {
+		if authkit.IsUserNotFound(err) {
+			err := errors.WithStack(errSessionNotFound)
+			c.Logger().Debugf("%+v", err)
+			return c.JSON(
+				http.StatusBadRequest,
+				h.ErrorCustomizer.InvalidRequestParameterError(err))
+		}
+		return errors.WithStack(err)
+	}
+	if err := signout.RevokePrivateToken(h.signoutConfig(c), t); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := h.SessionStore.DeleteSession(ctx, login, f.Session); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.JSON(http.StatusOK, struct{}{})
+}
+
+// savePrivateToken saves token of the private provider, issued to the
+// client of the request, as a new session (if sessions are enabled) or as
+// the single token of the user.
+func (h handler) savePrivateToken(
+	c echo.Context,
+	login string,
+	token *oauth2.Token) error {
+	ctx := c.Request().Context()
+	if h.SessionStore == nil {
+		return errors.WithStack(h.UserService.UpdateOAuth2Token(
+			ctx,
+			login,
+			h.PrivateOAuth2Provider.ID,
+			token))
+	}
+	id, err := newSessionID()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	now := time.Now()
+	return errors.WithStack(h.SessionStore.CreateSession(
+		ctx,
+		authkit.Session{
+			ID:       id,
+			Login:    login,
+			Device:   c.Request().UserAgent(),
+			IP:       c.RealIP(),
+			Created:  now,
+			LastUsed: now,
+		},
+		token))
+}
+
+// currentSessionID returns ID of the session of the request or empty string,
+// if session is not found.
+func (h handler) currentSessionID(c echo.Context) string {
+	token, err := bearerToken(c.Request())
+	if err != nil {
+		return ""
+	}
+	s, _, err := h.SessionStore.SessionByAccessToken(c.Request().Context(), token)
+	if err != nil {
+		return ""
+	}
+	return s.ID
+}
+
+func newSessionID() (string, error) {
+	const idLen = 16
+	b := make([]byte, idLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
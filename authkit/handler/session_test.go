@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/memstore"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+	"github.com/letsrock-today/authkit/authkit/mocks"
+	"github.com/letsrock-today/authkit/authkit/passhash"
+)
+
+// testSessionRequest performs request with access token and user agent.
+func testSessionRequest(
+	h echo.HandlerFunc,
+	params url.Values,
+	accessToken, device string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req, _ := http.NewRequest(echo.POST, "", strings.NewReader(params.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+accessToken)
+	req.Header.Set("User-Agent", device)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set(middleware.DefaultContextKey, testUser{login: "valid@login.ok"})
+	if err := h(c); err != nil {
+		e.HTTPErrorHandler(err, c)
+	}
+	return rec
+}
+
+func TestSessions(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	us := memstore.NewUserService(nil, passhash.New(passhash.NewBcrypt(4)))
+	require.NoError(t, us.Create(ctx, "valid@login.ok", "valid_password"))
+	ss := us.(authkit.SessionStore)
+
+	as := new(mocks.AuthService)
+	as.On("RevokeAccessToken", "access-1").Return(nil)
+	as.On("RevokeAccessToken", "access-2").Return(nil)
+	h := handler{Config{
+		ErrorCustomizer:       testErrorCustomizer{},
+		AuthService:           as,
+		UserService:           us,
+		SessionStore:          ss,
+		PrivateOAuth2Provider: authkit.OAuth2Provider{ID: "private"},
+	}}
+
+	// Every login gets its own session.
+	for _, l := range []struct{ device, accessToken string }{
+		{"phone", "access-1"},
+		{"laptop", "access-2"},
+	} {
+		token := &oauth2.Token{AccessToken: l.accessToken}
+		rec := testSessionRequest(func(c echo.Context) error {
+			return h.savePrivateToken(c, "valid@login.ok", token)
+		}, nil, "", l.device)
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+	token, err := us.OAuth2Token(ctx, "valid@login.ok", "private")
+	assert.NoError(err)
+	assert.Nil(token, "token should be kept in session only")
+
+	rec := testSessionRequest(h.Sessions, nil, "access-2", "laptop")
+	assert.Equal(http.StatusOK, rec.Code)
+	var reply sessionsReply
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reply))
+	require.Len(t, reply.Sessions, 2)
+	assert.Equal("phone", reply.Sessions[0].Device)
+	assert.False(reply.Sessions[0].Current)
+	assert.Equal("laptop", reply.Sessions[1].Device)
+	assert.True(reply.Sessions[1].Current)
+	assert.NotEmpty(reply.Sessions[0].ID)
+	assert.NotEqual(reply.Sessions[0].ID, reply.Sessions[1].ID)
+
+	// Sign out phone from laptop.
+	rec = testSessionRequest(h.RevokeSession, url.Values{
+		"session": []string{reply.Sessions[0].ID},
+	}, "access-2", "laptop")
+	assert.Equal(http.StatusOK, rec.Code)
+	as.AssertCalled(t, "RevokeAccessToken", "access-1")
+	_, _, err = ss.SessionByAccessToken(ctx, "access-1")
+	assert.True(authkit.IsUserNotFound(err))
+
+	rec = testSessionRequest(h.RevokeSession, url.Values{
+		"session": []string{reply.Sessions[0].ID},
+	}, "access-2", "laptop")
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	rec = testSessionRequest(h.RevokeSession, nil, "access-2", "laptop")
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	// Logout ends current session.
+	rec = testSessionRequest(h.Logout, nil, "access-2", "laptop")
+	assert.Equal(http.StatusOK, rec.Code)
+	sessions, err := ss.Sessions(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Empty(sessions)
+
+	h.SessionStore = nil
+	rec = testSessionRequest(h.Sessions, nil, "access-2", "laptop")
+	assert.Equal(http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+	"github.com/letsrock-today/authkit/authkit/signout"
+)
+
+func (h handler) SignOutEverywhere(c echo.Context) error {
+	if h.AccountStore == nil {
+		return echo.ErrNotFound
+	}
+	login := c.Get(middleware.DefaultContextKey).(authkit.User).Login()
+	if err := h.signOutEverywhere(c, login); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, struct{}{})
+}
+
+// signOutEverywhere revokes all user's tokens (see signout.Everywhere).
+func (h handler) signOutEverywhere(c echo.Context, login string) error {
+	return errors.WithStack(signout.Everywhere(
+		c.Request().Context(),
+		h.signoutConfig(c),
+		login))
+}
+
+// signoutConfig returns configuration for functions of the signout package,
+// which implement token revocation for the handler.
+func (h handler) signoutConfig(c echo.Context) signout.Config {
+	return signout.Config{
+		PrivateProviderID:     h.PrivateOAuth2Provider.ID,
+		AuthService:           h.AuthService,
+		TokenInvalidator:      h.TokenInvalidator,
+		TokenStore:            h.UserService,
+		AccountStore:          h.AccountStore,
+		SessionStore:          h.SessionStore,
+		OAuth2Providers:       h.OAuth2Providers,
+		SocialProfileServices: h.SocialProfileServices,
+		ContextCreator:        h.ContextCreator,
+		SocialRevokeFailed: func(pid string, err error) {
+			c.Logger().Debugf("%+v", err)
+		},
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/memstore"
+	"github.com/letsrock-today/authkit/authkit/mocks"
+	"github.com/letsrock-today/authkit/authkit/passhash"
+)
+
+func TestSignOutEverywhere(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	us := memstore.NewUserService(nil, passhash.New(passhash.NewBcrypt(4)))
+	require.NoError(t, us.Create(ctx, "valid@login.ok", "valid_password"))
+	require.NoError(t, us.Create(ctx, "other@login.ok", "valid_password"))
+	ss := us.(authkit.SessionStore)
+	require.NoError(t, us.UpdateOAuth2Token(
+		ctx,
+		"valid@login.ok",
+		"private",
+		&oauth2.Token{AccessToken: "access-0", RefreshToken: "refresh-0"}))
+	require.NoError(t, ss.CreateSession(
+		ctx,
+		authkit.Session{ID: "session-1", Login: "valid@login.ok", Created: time.Now()},
+		&oauth2.Token{AccessToken: "access-1"}))
+	require.NoError(t, ss.CreateSession(
+		ctx,
+		authkit.Session{ID: "session-2", Login: "other@login.ok", Created: time.Now()},
+		&oauth2.Token{AccessToken: "access-2"}))
+	fbtoken := &oauth2.Token{AccessToken: "fb-access"}
+	require.NoError(t, us.UpdateOAuth2Token(ctx, "valid@login.ok", "fb", fbtoken))
+
+	as := new(mocks.AuthService)
+	as.On("RevokeAccessToken", "access-0").Return(nil)
+	as.On("RevokeAccessToken", "refresh-0").Return(nil)
+	as.On("RevokeAccessToken", "access-1").Return(nil)
+	cfg := new(mocks.OAuth2Config)
+	cfg.On("Client", mock.Anything, fbtoken).Return(http.DefaultClient)
+	revoker := new(mocks.SocialTokenRevoker)
+	revoker.On("RevokeToken", http.DefaultClient, fbtoken).Return(
+		errors.New("revocation is not supported"))
+	sps := new(mocks.SocialProfileServices)
+	sps.On("SocialProfileService", "fb").Return(
+		testRevokingSocialProfileService{
+			new(mocks.SocialProfileService),
+			revoker,
+		},
+		nil)
+
+	h := handler{Config{
+		ErrorCustomizer:       testErrorCustomizer{},
+		AuthService:           as,
+		UserService:           us,
+		AccountStore:          us.(authkit.AccountStore),
+		SessionStore:          ss,
+		SocialProfileServices: sps,
+		ContextCreator:        authkit.DefaultContextCreator{},
+		PrivateOAuth2Provider: authkit.OAuth2Provider{ID: "private"},
+		OAuth2Providers: []authkit.OAuth2Provider{
+			{ID: "fb", OAuth2Config: cfg},
+		},
+	}}
+	user := testUser{login: "valid@login.ok"}
+
+	// Failure to revoke external token doesn't fail request.
+	rec := testPost(h.SignOutEverywhere, nil, user)
+	assert.Equal(http.StatusOK, rec.Code)
+	as.AssertExpectations(t)
+	revoker.AssertExpectations(t)
+	tokens, err := us.(authkit.AccountStore).OAuth2Tokens(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Empty(tokens)
+	sessions, err := ss.Sessions(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Empty(sessions)
+
+	// Sessions of other users are kept.
+	_, _, err = ss.SessionByAccessToken(ctx, "access-2")
+	assert.NoError(err)
+
+	h.AccountStore = nil
+	rec = testPost(h.SignOutEverywhere, nil, user)
+	assert.Equal(http.StatusNotFound, rec.Code)
+}
+
+func TestNewHandlerSignOutEverywhereOnPasswordChange(t *testing.T) {
+	// NewHandler registers validators, restore them for other tests.
+	password, login := govalidator.TagMap["password"], govalidator.TagMap["login"]
+	defer func() {
+		govalidator.TagMap["password"] = password
+		govalidator.TagMap["login"] = login
+	}()
+
+	c := Config{
+		ErrorCustomizer:                   testErrorCustomizer{},
+		AuthService:                       new(mocks.AuthService),
+		UserService:                       new(mocks.UserService),
+		ProfileService:                    new(mocks.ProfileService),
+		SocialProfileServices:             new(mocks.SocialProfileServices),
+		SignOutEverywhereOnPasswordChange: true,
+	}
+	assert.Panics(t, func() { NewHandler(c) })
+
+	c.AccountStore = new(mocks.AccountStore)
+	assert.NotPanics(t, func() { NewHandler(c) })
+}
@@ -0,0 +1,304 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/apptoken"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+	"github.com/letsrock-today/authkit/authkit/totp"
+)
+
+// defaultSecondFactorExpiration is used when Config.SecondFactorExpiration
+// is not set.
+const defaultSecondFactorExpiration = 5 * time.Minute
+
+type (
+	secondFactorForm struct {
+		Token string `form:"secondFactorToken" valid:"required"`
+		Code  string `form:"code" valid:"required~code-required,numeric~code-format"`
+	}
+
+	secondFactorReply struct {
+		SecondFactorRequired bool   `json:"secondFactorRequired"`
+		SecondFactorToken    string `json:"secondFactorToken"`
+	}
+
+	enrollTOTPReply struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+		Token  string `json:"token"`
+	}
+
+	confirmTOTPForm struct {
+		Token string `form:"token" valid:"required"`
+		Code  string `form:"code" valid:"required~code-required,numeric~code-format"`
+	}
+
+	disableTOTPForm struct {
+		Code string `form:"code" valid:"required~code-required,numeric~code-format"`
+	}
+)
+
+var errSecondFactorEnabled = errors.New("second factor is already enabled")
+
+// requireSecondFactor checks whether user has second factor enabled and, if
+// so, responds with a token to be returned with the code. It returns true,
+// if response has been rendered.
+func (h handler) requireSecondFactor(
+	c echo.Context,
+	ctx context.Context,
+	login string) (bool, error) {
+	if h.TOTPStore == nil {
+		return false, nil
+	}
+	secret, err := h.TOTPStore.TOTPSecret(ctx, login)
+	if err != nil {
+		return true, errors.WithStack(err)
+	}
+	if secret == "" {
+		return false, nil
+	}
+	s := h.OAuth2State
+	t, err := apptoken.NewSecondFactorTokenString(
+		s.TokenIssuer,
+		login,
+		h.secondFactorExpiration(),
+		s.TokenSignKey)
+	if err != nil {
+		return true, errors.WithStack(err)
+	}
+	return true, c.JSON(
+		http.StatusUnauthorized,
+		secondFactorReply{
+			SecondFactorRequired: true,
+			SecondFactorToken:    t,
+		})
+}
+
+// checkSecondFactor verifies code for the token, issued by
+// requireSecondFactor. It returns login of the user, or empty login, if
+// verification failed and response has been rendered.
+func (h handler) checkSecondFactor(
+	c echo.Context,
+	ctx context.Context,
+	token, code string) (string, error) {
+	sf := secondFactorForm{token, code}
+	if _, err := govalidator.ValidateStruct(sf); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return "", c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(err))
+	}
+	s := h.OAuth2State
+	t, err := apptoken.ParseSecondFactorToken(
+		s.TokenIssuer,
+		sf.Token,
+		s.TokenSignKey)
+	if err != nil || h.TOTPStore == nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return "", c.JSON(
+			http.StatusUnauthorized,
+			h.ErrorCustomizer.UserAuthenticationError(apptoken.ErrInvalidToken))
+	}
+	login := t.Login()
+	secret, err := h.TOTPStore.TOTPSecret(ctx, login)
+	if err != nil {
+		return "", h.codeFailed(c, err)
+	}
+	if err := h.verifyCode(c, ctx, login, secret, sf.Code, false); err != nil {
+		return "", h.codeFailed(c, err)
+	}
+	return login, nil
+}
+
+// verifyCode checks TOTP code with brute-force and replay protection.
+// If enroll is true, then secret is saved for the user before code is
+// marked as used.
+func (h handler) verifyCode(
+	c echo.Context,
+	ctx context.Context,
+	login, secret, code string,
+	enroll bool) authkit.UserServiceError {
+	if err := h.AttemptTracker.Check(ctx, login, c.RealIP()); err != nil {
+		return err
+	}
+	if secret == "" {
+		// Second factor has been disabled meanwhile.
+		return errors.WithStack(authkit.NewInvalidCodeError(nil))
+	}
+	counter, ok, err := totp.Validate(secret, code, time.Now())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if ok && enroll {
+		if err := h.TOTPStore.UpdateTOTPSecret(ctx, login, secret); err != nil {
+			return err
+		}
+	}
+	if ok {
+		if ok, err = h.TOTPStore.UseTOTPCounter(ctx, login, counter); err != nil {
+			return err
+		}
+	}
+	if !ok {
+		h.attemptFailed(c, ctx, login)
+		return errors.WithStack(authkit.NewInvalidCodeError(nil))
+	}
+	h.attemptSucceeded(c, ctx, login)
+	return nil
+}
+
+// codeFailed renders error response for failed code verification.
+func (h handler) codeFailed(c echo.Context, err error) error {
+	if authkit.IsInvalidCode(err) ||
+		authkit.IsAccountLocked(err) ||
+		authkit.IsUserNotFound(err) {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return authenticationFailed(c, err, h.ErrorCustomizer.UserAuthenticationError)
+	}
+	return errors.WithStack(err)
+}
+
+func (h handler) EnrollTOTP(c echo.Context) error {
+	if h.TOTPStore == nil {
+		return echo.ErrNotFound
+	}
+	ctx := c.Request().Context()
+	login := c.Get(middleware.DefaultContextKey).(authkit.User).Login()
+	secret, err := h.TOTPStore.TOTPSecret(ctx, login)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if secret != "" {
+		return c.JSON(
+			http.StatusConflict,
+			h.ErrorCustomizer.InvalidRequestParameterError(errSecondFactorEnabled))
+	}
+	secret, err = totp.GenerateSecret()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	s := h.OAuth2State
+	t, err := apptoken.NewTOTPEnrollmentTokenString(
+		s.TokenIssuer,
+		login,
+		secret,
+		h.secondFactorExpiration(),
+		s.TokenSignKey)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return c.JSON(
+		http.StatusOK,
+		enrollTOTPReply{
+			Secret: secret,
+			URI:    totp.ProvisioningURI(h.totpIssuer(), login, secret),
+			Token:  t,
+		})
+}
+
+func (h handler) ConfirmTOTP(c echo.Context) error {
+	if h.TOTPStore == nil {
+		return echo.ErrNotFound
+	}
+	var f confirmTOTPForm
+	if err := c.Bind(&f); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(flatten(err)))
+	}
+	if _, err := govalidator.ValidateStruct(f); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(err))
+	}
+	ctx := c.Request().Context()
+	login := c.Get(middleware.DefaultContextKey).(authkit.User).Login()
+	s := h.OAuth2State
+	t, err := apptoken.ParseTOTPEnrollmentToken(
+		s.TokenIssuer,
+		f.Token,
+		s.TokenSignKey)
+	if err == nil && t.Login() != login {
+		err = errors.WithStack(apptoken.ErrInvalidToken)
+	}
+	if err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusUnauthorized,
+			h.ErrorCustomizer.UserAuthenticationError(apptoken.ErrInvalidToken))
+	}
+	// Enabled secret can only be replaced after DisableTOTP, which
+	// requires code for it.
+	secret, err := h.TOTPStore.TOTPSecret(ctx, login)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if secret != "" {
+		return c.JSON(
+			http.StatusConflict,
+			h.ErrorCustomizer.InvalidRequestParameterError(errSecondFactorEnabled))
+	}
+	if err := h.verifyCode(c, ctx, login, t.Secret(), f.Code, true); err != nil {
+		return h.codeFailed(c, err)
+	}
+	return c.String(http.StatusOK, "")
+}
+
+func (h handler) DisableTOTP(c echo.Context) error {
+	if h.TOTPStore == nil {
+		return echo.ErrNotFound
+	}
+	var f disableTOTPForm
+	if err := c.Bind(&f); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(flatten(err)))
+	}
+	if _, err := govalidator.ValidateStruct(f); err != nil {
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+		return c.JSON(
+			http.StatusBadRequest,
+			h.ErrorCustomizer.InvalidRequestParameterError(err))
+	}
+	ctx := c.Request().Context()
+	login := c.Get(middleware.DefaultContextKey).(authkit.User).Login()
+	secret, err := h.TOTPStore.TOTPSecret(ctx, login)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if secret == "" {
+		return c.String(http.StatusOK, "")
+	}
+	if err := h.verifyCode(c, ctx, login, secret, f.Code, false); err != nil {
+		return h.codeFailed(c, err)
+	}
+	if err := h.TOTPStore.UpdateTOTPSecret(ctx, login, ""); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.String(http.StatusOK, "")
+}
+
+func (h handler) secondFactorExpiration() time.Duration {
+	if h.SecondFactorExpiration == 0 {
+		return defaultSecondFactorExpiration
+	}
+	return h.SecondFactorExpiration
+}
+
+func (h handler) totpIssuer() string {
+	if h.TOTPIssuer == "" {
+		return h.OAuth2State.TokenIssuer
+	}
+	return h.TOTPIssuer
+}
@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/attempts"
+	"github.com/letsrock-today/authkit/authkit/memstore"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+	"github.com/letsrock-today/authkit/authkit/mocks"
+	"github.com/letsrock-today/authkit/authkit/passhash"
+	"github.com/letsrock-today/authkit/authkit/totp"
+)
+
+func testPost(
+	h echo.HandlerFunc,
+	params url.Values,
+	user authkit.User) *httptest.ResponseRecorder {
+	e := echo.New()
+	req, _ := http.NewRequest(echo.POST, "", strings.NewReader(params.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if user != nil {
+		c.Set(middleware.DefaultContextKey, user)
+	}
+	if err := h(c); err != nil {
+		e.HTTPErrorHandler(err, c)
+	}
+	return rec
+}
+
+func newTOTPTestHandler(t *testing.T) (handler, authkit.TOTPStore, string) {
+	store := memstore.NewUserStore(passhash.New(passhash.NewBcrypt(4)))
+	ctx := context.Background()
+	require.NoError(t, store.Create(ctx, "valid@login.ok", "valid_password"))
+	require.NoError(t, store.Create(ctx, "other@login.ok", "valid_password"))
+	ts := store.(authkit.TOTPStore)
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	require.NoError(t, ts.UpdateTOTPSecret(ctx, "valid@login.ok", secret))
+
+	as := new(mocks.AuthService)
+	as.On(
+		"GenerateConsentTokenPriv",
+		"valid@login.ok",
+		[]string{"some_scope"},
+		"some_client_id").Return("valid_token", nil)
+	as.On(
+		"GenerateConsentTokenPriv",
+		"other@login.ok",
+		[]string{"some_scope"},
+		"some_client_id").Return("other_token", nil)
+	as.On(
+		"GenerateConsentToken",
+		"valid@login.ok",
+		[]string{"valid_scope"},
+		"valid_challenge").Return("valid_consent", nil)
+
+	us := new(mocks.UserService)
+	for _, login := range []string{"valid@login.ok", "other@login.ok"} {
+		us.On(
+			"Authenticate",
+			mock.Anything,
+			login,
+			"invalid_password").Return(authkit.NewUserNotFoundError(nil))
+		us.On(
+			"Authenticate",
+			mock.Anything,
+			login,
+			"valid_password").Return(nil)
+	}
+
+	govalidator.TagMap["password"] = govalidator.Validator(func(p string) bool {
+		// simplified password validator for test
+		return len(p) > 3
+	})
+
+	return handler{Config{
+		ErrorCustomizer: testErrorCustomizer{},
+		AttemptTracker:  attempts.New(attempts.Config{}),
+		AuthService:     as,
+		UserService:     us,
+		TOTPStore:       ts,
+		OAuth2State: authkit.OAuth2State{
+			TokenIssuer:  "some_issuer",
+			TokenSignKey: []byte("some_key"),
+			Expiration:   time.Hour,
+		},
+		PrivateOAuth2Provider: authkit.OAuth2Provider{
+			ID: "some_id",
+			OAuth2Config: &oauth2.Config{
+				ClientID: "some_client_id",
+				Scopes:   []string{"some_scope"},
+			},
+		},
+	}}, ts, secret
+}
+
+func TestLoginSecondFactor(t *testing.T) {
+	assert := assert.New(t)
+	h, _, secret := newTOTPTestHandler(t)
+
+	credentials := url.Values{
+		"action":   []string{"login"},
+		"login":    []string{"valid@login.ok"},
+		"password": []string{"valid_password"},
+	}
+
+	// User without second factor is logged in with password.
+	rec := testPost(h.Login, url.Values{
+		"action":   []string{"login"},
+		"login":    []string{"other@login.ok"},
+		"password": []string{"valid_password"},
+	}, nil)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Regexp(`\{"redirUrl":".*consent=other_token.*"\}`, rec.Body.String())
+
+	// Invalid password is rejected as usual.
+	rec = testPost(h.Login, url.Values{
+		"action":   []string{"login"},
+		"login":    []string{"valid@login.ok"},
+		"password": []string{"invalid_password"},
+	}, nil)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+	assert.Equal(`{"Code":"user auth err"}`, rec.Body.String())
+
+	rec = testPost(h.Login, credentials, nil)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+	var reply secondFactorReply
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reply))
+	assert.True(reply.SecondFactorRequired)
+	assert.NotEmpty(reply.SecondFactorToken)
+
+	step2 := func(token, code string) *httptest.ResponseRecorder {
+		return testPost(h.Login, url.Values{
+			"secondFactorToken": []string{token},
+			"code":              []string{code},
+		}, nil)
+	}
+
+	rec = step2(reply.SecondFactorToken, "abcdef")
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = step2("invalid_token", "123456")
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+	assert.Equal(`{"Code":"user auth err"}`, rec.Body.String())
+
+	code, err := totp.Code(secret, time.Now())
+	require.NoError(t, err)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	rec = step2(reply.SecondFactorToken, wrong)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+	assert.Equal(`{"Code":"invalid code"}`, rec.Body.String())
+
+	rec = step2(reply.SecondFactorToken, code)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Regexp(`\{"redirUrl":".*consent=valid_token.*"\}`, rec.Body.String())
+
+	// Code can't be used twice.
+	rec = step2(reply.SecondFactorToken, code)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+	assert.Equal(`{"Code":"invalid code"}`, rec.Body.String())
+}
+
+func TestConsentLoginSecondFactor(t *testing.T) {
+	assert := assert.New(t)
+	h, _, secret := newTOTPTestHandler(t)
+
+	rec := testPost(h.ConsentLogin, url.Values{
+		"action":    []string{"login"},
+		"login":     []string{"valid@login.ok"},
+		"password":  []string{"valid_password"},
+		"challenge": []string{"valid_challenge"},
+		"scopes":    []string{"valid_scope"},
+	}, nil)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+	var reply secondFactorReply
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reply))
+	assert.True(reply.SecondFactorRequired)
+
+	code, err := totp.Code(secret, time.Now())
+	require.NoError(t, err)
+
+	rec = testPost(h.ConsentLogin, url.Values{
+		"secondFactorToken": []string{reply.SecondFactorToken},
+		"code":              []string{code},
+		"challenge":         []string{"valid_challenge"},
+		"scopes":            []string{"valid_scope"},
+	}, nil)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal(`{"consent":"valid_consent"}`, rec.Body.String())
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	assert := assert.New(t)
+	h, ts, _ := newTOTPTestHandler(t)
+	ctx := context.Background()
+	user := testUser{login: "other@login.ok"}
+
+	// User with enabled second factor can't enroll again.
+	rec := testPost(h.EnrollTOTP, nil, testUser{login: "valid@login.ok"})
+	assert.Equal(http.StatusConflict, rec.Code)
+
+	rec = testPost(h.EnrollTOTP, nil, user)
+	assert.Equal(http.StatusOK, rec.Code)
+	var reply enrollTOTPReply
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reply))
+	assert.NotEmpty(reply.Secret)
+	assert.Contains(reply.URI, "otpauth://totp/some_issuer:other@login.ok?")
+	assert.Contains(reply.URI, "secret="+reply.Secret)
+
+	// Another enrollment, left unconfirmed.
+	rec = testPost(h.EnrollTOTP, nil, user)
+	assert.Equal(http.StatusOK, rec.Code)
+	var pending enrollTOTPReply
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pending))
+
+	// Second factor is not enabled until confirmed.
+	secret, err := ts.TOTPSecret(ctx, "other@login.ok")
+	assert.NoError(err)
+	assert.Empty(secret)
+
+	code, err := totp.Code(reply.Secret, time.Now())
+	require.NoError(t, err)
+
+	// Token is bound to the user.
+	rec = testPost(h.ConfirmTOTP, url.Values{
+		"token": []string{reply.Token},
+		"code":  []string{code},
+	}, testUser{login: "valid@login.ok"})
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+
+	rec = testPost(h.ConfirmTOTP, url.Values{
+		"token": []string{reply.Token},
+		"code":  []string{code},
+	}, user)
+	assert.Equal(http.StatusOK, rec.Code)
+	secret, err = ts.TOTPSecret(ctx, "other@login.ok")
+	assert.NoError(err)
+	assert.Equal(reply.Secret, secret)
+
+	// Enabled secret can't be replaced with unexpired enrollment token.
+	pendingCode, err := totp.Code(pending.Secret, time.Now())
+	require.NoError(t, err)
+	rec = testPost(h.ConfirmTOTP, url.Values{
+		"token": []string{pending.Token},
+		"code":  []string{pendingCode},
+	}, user)
+	assert.Equal(http.StatusConflict, rec.Code)
+	secret, err = ts.TOTPSecret(ctx, "other@login.ok")
+	assert.NoError(err)
+	assert.Equal(reply.Secret, secret)
+
+	// Code used for confirmation can't be used to disable.
+	rec = testPost(h.DisableTOTP, url.Values{"code": []string{code}}, user)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+	assert.Equal(`{"Code":"invalid code"}`, rec.Body.String())
+
+	code, err = totp.Code(reply.Secret, time.Now().Add(totp.Period))
+	require.NoError(t, err)
+	rec = testPost(h.DisableTOTP, url.Values{"code": []string{code}}, user)
+	assert.Equal(http.StatusOK, rec.Code)
+	secret, err = ts.TOTPSecret(ctx, "other@login.ok")
+	assert.NoError(err)
+	assert.Empty(secret)
+}
+
+func TestTOTPDisabled(t *testing.T) {
+	h := handler{Config{ErrorCustomizer: testErrorCustomizer{}}}
+	user := testUser{login: "valid@login.ok"}
+	assert.Equal(t, http.StatusNotFound, testPost(h.EnrollTOTP, nil, user).Code)
+	assert.Equal(t, http.StatusNotFound, testPost(h.ConfirmTOTP, nil, user).Code)
+	assert.Equal(t, http.StatusNotFound, testPost(h.DisableTOTP, nil, user).Code)
+}
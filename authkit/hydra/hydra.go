@@ -210,9 +210,17 @@ func (h hydra) IssueToken(login string) (*oauth2.Token, error) {
 func (h hydra) Validate(
 	accessToken string,
 	permissionDescriptor interface{}) (string, error) {
+	subj, _, err := h.ValidateWithExpiry(accessToken, permissionDescriptor)
+	return subj, err
+}
+
+// ValidateWithExpiry implements authkit.ExpiringTokenValidator.
+func (h hydra) ValidateWithExpiry(
+	accessToken string,
+	permissionDescriptor interface{}) (string, time.Time, error) {
 	p, ok := permissionDescriptor.(*middleware.DefaultPermission)
 	if !ok {
-		return "", errors.WithStack(errors.New("invalid permission object"))
+		return "", time.Time{}, errors.WithStack(errors.New("invalid permission object"))
 	}
 	conf := h.ClientCredentials
 	ctx := h.ContextCreator.CreateContext(h.ProviderIDTrustedContext)
@@ -234,13 +242,18 @@ func (h hydra) Validate(
 			Scopes:   p.Scopes,
 		}))
 	if err != nil {
-		return "", errors.WithStack(err)
+		return "", time.Time{}, errors.WithStack(err)
 	}
 
 	if !*r.Payload.Allowed {
-		return "", errors.WithStack(errors.New("Hydra denied access"))
+		return "", time.Time{}, errors.WithStack(errors.New("Hydra denied access"))
+	}
+	// Expiration time is informational, token is valid anyway.
+	var exp time.Time
+	if r.Payload.Exp != nil {
+		exp, _ = time.Parse(time.RFC3339, *r.Payload.Exp)
 	}
-	return *r.Payload.Sub, nil
+	return *r.Payload.Sub, exp, nil
 }
 
 func (h hydra) RevokeAccessToken(accessToken string) error {
@@ -152,6 +152,34 @@ func TestValidate(t *testing.T) {
 	assert.Equal("valid@login.ok", subj)
 }
 
+func TestValidateWithExpiry(t *testing.T) {
+	defer gock.Off()
+
+	assert := assert.New(t)
+
+	testPrepareKeysResponder(t, 0)
+
+	gock.New("http://foo.com").
+		Post("/warden/token/allowed").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"allowed": true,
+			"sub":     "valid@login.ok",
+			"exp":     "2017-01-02T15:04:05Z",
+		})
+
+	var h authkit.ExpiringTokenValidator = testCreateHydra()
+
+	subj, exp, err := h.ValidateWithExpiry("access-token", &middleware.DefaultPermission{
+		Resource: "some-resource",
+		Action:   "some-action",
+		Scopes:   []string{"some.scope"},
+	})
+	assert.NoError(err)
+	assert.Equal("valid@login.ok", subj)
+	assert.True(time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC).Equal(exp))
+}
+
 func TestRevokeAccessToken(t *testing.T) {
 	defer gock.Off()
 
@@ -0,0 +1,95 @@
+package authkit
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// NoPasswordHash is a password hash of users, created without password
+// (see IdentityStore.CreateWithIdentity). It doesn't match any password.
+const NoPasswordHash = "!"
+
+type (
+
+	// IdentityStore maps identities of users at external OAuth2 providers to
+	// internal logins, so that several providers can be linked to the same
+	// account. External identity is a login, returned by SocialProfileService
+	// (Profile.GetLogin). UserService implementation may implement this
+	// interface to enable provider linking in handlers.
+	IdentityStore interface {
+
+		// LoginByIdentity returns login, linked to the external identity.
+		// It returns UserNotFoundError, if identity is not linked.
+		LoginByIdentity(ctx context.Context, providerID, identity string) (string, UserServiceError)
+
+		// LinkIdentity links external identity to the login. User may have
+		// single identity per provider. It returns DuplicateUserError, if
+		// identity is linked to another login or user already has another
+		// identity of this provider. Repeated linking is not an error.
+		LinkIdentity(ctx context.Context, login, providerID, identity string) UserServiceError
+
+		// CreateWithIdentity creates new user without password and links
+		// external identity to it. It returns DuplicateUserError, if user
+		// already exists or identity is linked to another login.
+		// PasswordHash of user without password is NoPasswordHash,
+		// Authenticate should return UserNotFoundError for such user.
+		// Password can be set with UpdatePassword.
+		CreateWithIdentity(ctx context.Context, login, providerID, identity string) UserServiceError
+
+		// Identities returns user's external identities by provider ID.
+		Identities(ctx context.Context, login string) (map[string]string, UserServiceError)
+
+		// UnlinkIdentity removes link between user and identity of the
+		// provider. It returns nil, if user doesn't have such identity.
+		// It returns LastLoginMethodError, if user has no password and
+		// identity is the last one. The check should be atomic with
+		// removal (concurrent calls may not leave user without
+		// identities).
+		UnlinkIdentity(ctx context.Context, login, providerID string) UserServiceError
+	}
+
+	// SocialTokenRevoker is an optional interface of SocialProfileService,
+	// which revokes user's token at the provider, when provider is unlinked
+	// from the account.
+	SocialTokenRevoker interface {
+		RevokeToken(client *http.Client, token *oauth2.Token) error
+	}
+
+	// LastLoginMethodError indicates that request is rejected, because it
+	// would leave user without a way to login (like removal of the last
+	// linked provider of the user without password).
+	LastLoginMethodError interface {
+		UserServiceError
+		causer
+		IsLastLoginMethod() bool
+	}
+
+	lastLoginMethodError struct{ userServiceError }
+)
+
+// NewLastLoginMethodError returns new LastLoginMethodError.
+func NewLastLoginMethodError(cause error) LastLoginMethodError {
+	return lastLoginMethodError{userServiceError{cause}}
+}
+
+func (lastLoginMethodError) Error() string {
+	return "last login method"
+}
+
+func (lastLoginMethodError) IsLastLoginMethod() bool {
+	return true
+}
+
+// IsLastLoginMethod checks whether error is or caused by the
+// LastLoginMethodError.
+func IsLastLoginMethod(err error) bool {
+	return existsCause(err, func(e error) bool {
+		e1, ok := e.(LastLoginMethodError)
+		return ok && e1.IsLastLoginMethod()
+	})
+}
+
+//go:generate mockery -name IdentityStore
+//go:generate mockery -name SocialTokenRevoker
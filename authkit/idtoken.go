@@ -0,0 +1,39 @@
+package authkit
+
+import "net/http"
+
+type (
+
+	// IDTokenClaims are claims of verified OpenID Connect id_token.
+	IDTokenClaims map[string]interface{}
+
+	// IDTokenVerifier verifies OpenID Connect id_token, returned by the
+	// provider along with access token (see oidc package for
+	// implementation). OAuth2Provider with IDTokenVerifier is treated as
+	// OpenID Connect provider.
+	IDTokenVerifier interface {
+
+		// VerifyIDToken verifies signature, issuer, audience and expiration
+		// time of the token, and checks that token contains expected nonce.
+		VerifyIDToken(rawIDToken, nonce string) (IDTokenClaims, error)
+	}
+
+	// IDTokenProfileService is an optional interface of
+	// SocialProfileService of OpenID Connect provider. It maps claims of
+	// verified id_token to the profile, so that extra request to the
+	// provider (like userinfo endpoint) may be skipped. If
+	// SocialProfileService doesn't implement it, then SocialProfile is used.
+	IDTokenProfileService interface {
+		SocialProfileFromIDToken(client *http.Client, claims IDTokenClaims) (Profile, error)
+	}
+)
+
+// String returns string claim, or empty string, if claim is absent or is
+// not a string.
+func (c IDTokenClaims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+//go:generate mockery -name IDTokenVerifier
+//go:generate mockery -name IDTokenProfileService
@@ -0,0 +1,176 @@
+// Package introspection provides authkit.TokenValidator, which validates
+// access tokens via OAuth2 Token Introspection endpoint (RFC 7662) of the
+// authorization server. Unlike Hydra-backed validator, it doesn't depend
+// on vendor-specific API and may be used with any compliant authorization
+// server.
+//
+// Validator checks active flag, expiration time and scopes of
+// middleware.DefaultPermission. Resource and action of the permission are
+// not defined by RFC 7662 and are ignored.
+package introspection
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/jwtclaims"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+)
+
+// Config is a configuration of the Validator.
+type Config struct {
+
+	// URL of the introspection endpoint. Required.
+	URL string
+
+	// ClientID and ClientSecret are credentials of the resource server,
+	// used to authenticate to the introspection endpoint (HTTP Basic).
+	// Required.
+	ClientID     string
+	ClientSecret string
+
+	// Audience expected in "aud" of the response. Optional. If empty,
+	// audience is not checked.
+	Audience string
+
+	// ContextCreator and ProviderID used to obtain context (and
+	// http.Client) for requests to the introspection endpoint. Optional.
+	// If ContextCreator is nil, then authkit.DefaultContextCreator is used.
+	ContextCreator authkit.ContextCreator
+	ProviderID     string
+}
+
+// Response is a response of the introspection endpoint.
+type Response struct {
+	Active    bool        `json:"active"`
+	Scope     string      `json:"scope,omitempty"`
+	ClientID  string      `json:"client_id,omitempty"`
+	Username  string      `json:"username,omitempty"`
+	TokenType string      `json:"token_type,omitempty"`
+	Exp       int64       `json:"exp,omitempty"`
+	Iat       int64       `json:"iat,omitempty"`
+	Nbf       int64       `json:"nbf,omitempty"`
+	Sub       string      `json:"sub,omitempty"`
+	Aud       interface{} `json:"aud,omitempty"`
+	Iss       string      `json:"iss,omitempty"`
+}
+
+// Validator is an authkit.TokenValidator, which uses introspection
+// endpoint. It also implements authkit.ExpiringTokenValidator.
+type Validator struct {
+	c Config
+
+	// for use by tests
+	now func() time.Time
+}
+
+// New returns new Validator.
+func New(c Config) *Validator {
+	if c.URL == "" || c.ClientID == "" {
+		panic("invalid argument")
+	}
+	if c.ContextCreator == nil {
+		c.ContextCreator = authkit.DefaultContextCreator{}
+	}
+	return &Validator{
+		c:   c,
+		now: time.Now,
+	}
+}
+
+// Validate validates access token and returns its subject.
+// Permission descriptor should be *middleware.DefaultPermission.
+func (v *Validator) Validate(
+	accessToken string,
+	permissionDescriptor interface{}) (string, error) {
+	subj, _, err := v.ValidateWithExpiry(accessToken, permissionDescriptor)
+	return subj, err
+}
+
+// ValidateWithExpiry validates access token and returns its subject and
+// expiration time (zero, if not reported by the server).
+func (v *Validator) ValidateWithExpiry(
+	accessToken string,
+	permissionDescriptor interface{}) (string, time.Time, error) {
+	p, ok := permissionDescriptor.(*middleware.DefaultPermission)
+	if !ok {
+		return "", time.Time{}, errors.WithStack(errors.New("invalid permission object"))
+	}
+	r, err := v.Introspect(accessToken)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if !r.Active {
+		return "", time.Time{}, errors.WithStack(errors.New("token is not active"))
+	}
+	var exp time.Time
+	if r.Exp != 0 {
+		exp = time.Unix(r.Exp, 0)
+		// Server should not report expired token as active, but clocks
+		// may differ.
+		if !v.now().Before(exp) {
+			return "", time.Time{}, errors.WithStack(errors.New("token is expired"))
+		}
+	}
+	if v.c.Audience != "" && !jwtclaims.HasAudience(r.Aud, v.c.Audience) {
+		return "", time.Time{}, errors.WithStack(errors.New("invalid audience"))
+	}
+	scopes := make(map[string]bool)
+	for _, s := range strings.Fields(r.Scope) {
+		scopes[s] = true
+	}
+	for _, s := range p.Scopes {
+		if !scopes[s] {
+			return "", time.Time{}, errors.WithStack(
+				fmt.Errorf("token has no scope %q", s))
+		}
+	}
+	if r.Sub == "" {
+		return "", time.Time{}, errors.WithStack(errors.New("token has no subject"))
+	}
+	return r.Sub, exp, nil
+}
+
+// Introspect returns response of the introspection endpoint for access
+// token as is.
+func (v *Validator) Introspect(accessToken string) (*Response, error) {
+	form := url.Values{
+		"token":           {accessToken},
+		"token_type_hint": {"access_token"},
+	}
+	req, err := http.NewRequest(
+		http.MethodPost,
+		v.c.URL,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(v.c.ClientID), url.QueryEscape(v.c.ClientSecret))
+
+	ctx := v.c.ContextCreator.CreateContext(v.c.ProviderID)
+	resp, err := authkit.ContextHTTPClient(ctx).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.WithStack(errors.Errorf(
+			"Unexpected response status: %d, %s",
+			resp.StatusCode,
+			resp.Status))
+	}
+	r := &Response{}
+	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return r, nil
+}
@@ -0,0 +1,128 @@
+package introspection
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/letsrock-today/authkit/authkit/middleware"
+)
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	perm := &middleware.DefaultPermission{Scopes: []string{"api.get"}}
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"active": true,
+			"scope":  "api.get api.post",
+			"sub":    "user@example.com",
+			"aud":    []string{"api"},
+			"exp":    now.Add(time.Hour).Unix(),
+		}
+	}
+
+	cases := []struct {
+		name   string
+		status int
+		resp   map[string]interface{}
+		perm   interface{}
+		valid  bool
+	}{
+		{
+			name:  "valid",
+			resp:  valid(),
+			perm:  perm,
+			valid: true,
+		},
+		{
+			name: "invalid permission object",
+			resp: valid(),
+			perm: middleware.DefaultPermission{},
+		},
+		{
+			name: "inactive",
+			resp: map[string]interface{}{"active": false},
+			perm: perm,
+		},
+		{
+			name: "expired",
+			resp: func() map[string]interface{} {
+				r := valid()
+				r["exp"] = now.Unix()
+				return r
+			}(),
+			perm: perm,
+		},
+		{
+			name: "wrong audience",
+			resp: func() map[string]interface{} {
+				r := valid()
+				r["aud"] = "other"
+				return r
+			}(),
+			perm: perm,
+		},
+		{
+			name: "missing scope",
+			resp: valid(),
+			perm: &middleware.DefaultPermission{Scopes: []string{"api.delete"}},
+		},
+		{
+			name: "no subject",
+			resp: func() map[string]interface{} {
+				r := valid()
+				delete(r, "sub")
+				return r
+			}(),
+			perm: perm,
+		},
+		{
+			name:   "server error",
+			status: http.StatusUnauthorized,
+			resp:   valid(),
+			perm:   perm,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					id, secret, ok := r.BasicAuth()
+					assert.True(ok)
+					assert.Equal("client-id", id)
+					assert.Equal("client-secret", secret)
+					assert.Equal(http.MethodPost, r.Method)
+					assert.Equal("access-token", r.PostFormValue("token"))
+					assert.Equal("access_token", r.PostFormValue("token_type_hint"))
+					if c.status != 0 {
+						w.WriteHeader(c.status)
+					}
+					json.NewEncoder(w).Encode(c.resp)
+				}))
+			defer srv.Close()
+
+			v := New(Config{
+				URL:          srv.URL,
+				ClientID:     "client-id",
+				ClientSecret: "client-secret",
+				Audience:     "api",
+			})
+			v.now = func() time.Time { return now }
+
+			subj, exp, err := v.ValidateWithExpiry("access-token", c.perm)
+			if !c.valid {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal("user@example.com", subj)
+			assert.Equal(now.Add(time.Hour), exp)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Package jwks provides cache of public keys, fetched from JSON Web Key Set
+// URL of the authorization server (or OpenID Connect provider). Keys are
+// re-fetched, when JWT is signed with unknown key (server rotated keys).
+package jwks
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/mendsley/gojwk"
+	"github.com/pkg/errors"
+)
+
+// DefaultMinRefreshInterval is a default min interval between fetches of
+// keys.
+const DefaultMinRefreshInterval = time.Minute
+
+// Config is a configuration of the KeySet.
+type Config struct {
+
+	// URL of JSON Web Key Set. Required.
+	URL string
+
+	// MinRefreshInterval is a min interval between fetches of keys. It
+	// prevents hammering of the server with tokens, signed by unknown keys.
+	// Default is DefaultMinRefreshInterval.
+	MinRefreshInterval time.Duration
+
+	// HTTPClient used to fetch keys. Default is http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// KeySet is a cache of public keys. It is safe for concurrent use.
+type KeySet struct {
+	c Config
+
+	// for use by tests
+	now func() time.Time
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// New returns new KeySet. Keys are fetched on first use.
+func New(c Config) *KeySet {
+	if c.URL == "" {
+		panic("URL must be provided")
+	}
+	if c.MinRefreshInterval <= 0 {
+		c.MinRefreshInterval = DefaultMinRefreshInterval
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = http.DefaultClient
+	}
+	return &KeySet{
+		c:   c,
+		now: time.Now,
+	}
+}
+
+// Key returns public key with given ID. Keys are re-fetched, if key is
+// unknown, but not more often than MinRefreshInterval.
+func (s *KeySet) Key(kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.keys[kid]; ok {
+		return k, nil
+	}
+	// Unknown key, server may have rotated keys.
+	if !s.fetched.IsZero() && s.now().Sub(s.fetched) < s.c.MinRefreshInterval {
+		return nil, errors.WithStack(fmt.Errorf("unknown key %q", kid))
+	}
+	if err := s.fetch(); err != nil {
+		return nil, err
+	}
+	if k, ok := s.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, errors.WithStack(fmt.Errorf("unknown key %q", kid))
+}
+
+// Keyfunc is a jwt.Keyfunc, which returns key by "kid" header of the token.
+// It accepts only asymmetric signing methods (RSA and ECDSA).
+func (s *KeySet) Keyfunc(t *jwt.Token) (interface{}, error) {
+	switch t.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+	default:
+		return nil, fmt.Errorf("unexpected signing method %q", t.Method.Alg())
+	}
+	kid, _ := t.Header["kid"].(string)
+	return s.Key(kid)
+}
+
+// fetch replaces cached keys with keys from URL.
+// It should be called with s.mu held.
+func (s *KeySet) fetch() error {
+	// Remember attempt even if it fails, to not retry on every request.
+	s.fetched = s.now()
+	resp, err := s.c.HTTPClient.Get(s.c.URL)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.WithStack(fmt.Errorf("fetch keys: %s", resp.Status))
+	}
+	var set struct {
+		Keys []gojwk.Key `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return errors.WithStack(err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for i := range set.Keys {
+		k := &set.Keys[i]
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pk, err := k.DecodePublicKey()
+		if err != nil {
+			// Skip keys of unsupported types.
+			continue
+		}
+		keys[k.Kid] = pk
+	}
+	s.keys = keys
+	return nil
+}
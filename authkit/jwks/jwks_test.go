@@ -0,0 +1,74 @@
+package jwks
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/letsrock-today/authkit/authkit/jwks/jwkstest"
+)
+
+func TestKeyRotation(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Unix(1500000000, 0)
+
+	srv := jwkstest.NewServer()
+	defer srv.Close()
+	srv.AddKey(t, "k1")
+	s := New(Config{URL: srv.URL})
+	s.now = func() time.Time { return now }
+
+	_, err := s.Key("k1")
+	assert.NoError(err)
+	_, err = s.Key("k1")
+	assert.NoError(err)
+	assert.Equal(1, srv.Fetches(), "keys should be cached")
+
+	// Server rotates keys, but keys are not re-fetched too often.
+	srv.AddKey(t, "k2")
+	_, err = s.Key("k2")
+	assert.Error(err)
+	assert.Equal(1, srv.Fetches())
+
+	now = now.Add(DefaultMinRefreshInterval)
+	_, err = s.Key("k2")
+	assert.NoError(err)
+	assert.Equal(2, srv.Fetches())
+
+	// Unknown key after refresh.
+	now = now.Add(DefaultMinRefreshInterval)
+	srv.AddKey(t, "k3")
+	srv.HideKey("k3")
+	_, err = s.Key("k3")
+	assert.Error(err)
+	assert.Equal(3, srv.Fetches())
+}
+
+func TestKeyfunc(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := jwkstest.NewServer()
+	defer srv.Close()
+	srv.AddKey(t, "k1")
+	s := New(Config{URL: srv.URL})
+
+	claims := jwt.MapClaims{"sub": "user"}
+	_, err := jwt.Parse(srv.Sign(t, "k1", claims), s.Keyfunc)
+	assert.NoError(err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString([]byte("secret"))
+	assert.NoError(err)
+	_, err = jwt.Parse(signed, s.Keyfunc)
+	assert.Error(err)
+
+	token = jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	token.Header["kid"] = "k1"
+	signed, err = token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	assert.NoError(err)
+	_, err = jwt.Parse(signed, s.Keyfunc)
+	assert.Error(err)
+}
@@ -0,0 +1,100 @@
+// Package jwkstest provides JSON Web Key Set server for tests of packages,
+// which verify JWTs with keys, fetched from JWKS URL.
+package jwkstest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/mendsley/gojwk"
+	"github.com/stretchr/testify/require"
+)
+
+// Server serves public keys of RSA key pairs, and signs tokens with private
+// keys. It should be closed after use.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PrivateKey
+	hidden  map[string]bool
+	fetches int
+}
+
+// NewServer starts new Server without keys. JWKS is served at Server.URL.
+func NewServer() *Server {
+	s := &Server{
+		keys:   make(map[string]*rsa.PrivateKey),
+		hidden: make(map[string]bool),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveKeys))
+	return s
+}
+
+// AddKey generates new key pair with given ID and publishes public key.
+func (s *Server) AddKey(t *testing.T, kid string) {
+	k, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[kid] = k
+	delete(s.hidden, kid)
+}
+
+// HideKey stops publishing of the key, but it still may be used to sign
+// tokens (to emulate tokens, signed by unknown key).
+func (s *Server) HideKey(kid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hidden[kid] = true
+}
+
+// Sign returns token with given claims, signed with key with given ID.
+func (s *Server) Sign(t *testing.T, kid string, claims jwt.Claims) string {
+	s.mu.Lock()
+	k := s.keys[kid]
+	s.mu.Unlock()
+	require.NotNil(t, k, "unknown key %q", kid)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(k)
+	require.NoError(t, err)
+	return signed
+}
+
+// Fetches returns number of requests to the server.
+func (s *Server) Fetches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+func (s *Server) serveKeys(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetches++
+	set := struct {
+		Keys []*gojwk.Key `json:"keys"`
+	}{}
+	for kid, k := range s.keys {
+		if s.hidden[kid] {
+			continue
+		}
+		pk, err := gojwk.PublicKey(k.Public())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		pk.Kid = kid
+		pk.Use = "sig"
+		set.Keys = append(set.Keys, pk)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(set)
+}
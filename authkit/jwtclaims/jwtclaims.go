@@ -0,0 +1,50 @@
+// Package jwtclaims provides helpers to read registered claims of JWT
+// (RFC 7519), decoded into map (like jwt.MapClaims) or into interface{}
+// fields of a struct. It is shared by validators of access and ID tokens.
+package jwtclaims
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audience returns "aud" claim, which may be string or array of strings.
+func Audience(aud interface{}) []string {
+	switch aud := aud.(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		r := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if a, ok := a.(string); ok {
+				r = append(r, a)
+			}
+		}
+		return r
+	}
+	return nil
+}
+
+// HasAudience checks that "aud" claim contains expected audience.
+func HasAudience(aud interface{}, expected string) bool {
+	for _, a := range Audience(aud) {
+		if a == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// NumericDate returns time from NumericDate claim (like "exp" or "nbf"),
+// decoded as float64 or json.Number. It returns false, if claim is missing
+// or has another type.
+func NumericDate(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case json.Number:
+		n, err := v.Int64()
+		return time.Unix(n, 0), err == nil
+	}
+	return time.Time{}, false
+}
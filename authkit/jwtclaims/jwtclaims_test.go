@@ -0,0 +1,51 @@
+package jwtclaims
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudience(t *testing.T) {
+	assert := assert.New(t)
+	cases := []struct {
+		aud      interface{}
+		expected []string
+	}{
+		{nil, nil},
+		{"client", []string{"client"}},
+		{[]interface{}{"client", 1, "other"}, []string{"client", "other"}},
+		{42.0, nil},
+	}
+	for _, c := range cases {
+		assert.Equal(c.expected, Audience(c.aud), "aud: %v", c.aud)
+	}
+
+	assert.True(HasAudience("client", "client"))
+	assert.True(HasAudience([]interface{}{"other", "client"}, "client"))
+	assert.False(HasAudience([]interface{}{"other"}, "client"))
+	assert.False(HasAudience(nil, "client"))
+}
+
+func TestNumericDate(t *testing.T) {
+	assert := assert.New(t)
+	cases := []struct {
+		v        interface{}
+		expected time.Time
+		ok       bool
+	}{
+		{nil, time.Time{}, false},
+		{"1500000000", time.Time{}, false},
+		{1500000000.0, time.Unix(1500000000, 0), true},
+		{json.Number("1500000000"), time.Unix(1500000000, 0), true},
+	}
+	for _, c := range cases {
+		d, ok := NumericDate(c.v)
+		assert.Equal(c.ok, ok, "v: %v", c.v)
+		assert.Equal(c.expected, d, "v: %v", c.v)
+	}
+	_, ok := NumericDate(json.Number("1.5e9x"))
+	assert.False(ok)
+}
@@ -0,0 +1,170 @@
+// Package jwtvalidator provides authkit.TokenValidator, which validates JWT
+// access tokens locally, without a round-trip to the authorization server.
+// Tokens are verified with public keys, fetched from JWKS URL of the
+// authorization server. Keys are cached and re-fetched, when token is signed
+// with unknown key (authorization server rotated keys).
+//
+// Validator checks signature, issuer, audience, expiry and scopes of
+// middleware.DefaultPermission. Resource and action of the permission
+// cannot be checked offline and are ignored. Revoked token stays valid
+// until it expires, so access tokens should be short-lived.
+package jwtvalidator
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit/jwks"
+	"github.com/letsrock-today/authkit/authkit/jwtclaims"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+)
+
+// DefaultMinRefreshInterval is a default min interval between fetches of
+// keys.
+const DefaultMinRefreshInterval = jwks.DefaultMinRefreshInterval
+
+// Config is a configuration of the Validator.
+type Config struct {
+
+	// JWKSURL is a URL of JSON Web Key Set of the authorization server.
+	// Required.
+	JWKSURL string
+
+	// Issuer expected in "iss" claim. Required, otherwise token of any
+	// issuer, which shares keys, is accepted.
+	Issuer string
+
+	// Audience expected in "aud" claim (usually, identifier of the
+	// resource server). Required, otherwise token, issued for another
+	// resource server, is accepted.
+	Audience string
+
+	// Leeway is an allowed clock skew for "exp" and "nbf" claims. Optional.
+	Leeway time.Duration
+
+	// MinRefreshInterval is a min interval between fetches of keys. It
+	// prevents hammering of authorization server with tokens, signed by
+	// unknown keys. Default is DefaultMinRefreshInterval.
+	MinRefreshInterval time.Duration
+
+	// HTTPClient used to fetch keys. Default is http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Validator is an authkit.TokenValidator for JWT access tokens. It also
+// implements authkit.ExpiringTokenValidator.
+type Validator struct {
+	c    Config
+	keys *jwks.KeySet
+
+	// for use by tests
+	now func() time.Time
+}
+
+// New returns new Validator.
+func New(c Config) *Validator {
+	if c.JWKSURL == "" {
+		panic("JWKSURL must be provided")
+	}
+	if c.Issuer == "" {
+		panic("Issuer must be provided")
+	}
+	if c.Audience == "" {
+		panic("Audience must be provided")
+	}
+	return &Validator{
+		c: c,
+		keys: jwks.New(jwks.Config{
+			URL:                c.JWKSURL,
+			MinRefreshInterval: c.MinRefreshInterval,
+			HTTPClient:         c.HTTPClient,
+		}),
+		now: time.Now,
+	}
+}
+
+// Validate validates access token and returns its subject.
+// Permission descriptor should be *middleware.DefaultPermission.
+func (v *Validator) Validate(
+	accessToken string,
+	permissionDescriptor interface{}) (string, error) {
+	subj, _, err := v.ValidateWithExpiry(accessToken, permissionDescriptor)
+	return subj, err
+}
+
+// ValidateWithExpiry validates access token and returns its subject and
+// expiration time.
+func (v *Validator) ValidateWithExpiry(
+	accessToken string,
+	permissionDescriptor interface{}) (string, time.Time, error) {
+	p, ok := permissionDescriptor.(*middleware.DefaultPermission)
+	if !ok {
+		return "", time.Time{}, errors.WithStack(errors.New("invalid permission object"))
+	}
+	claims := jwt.MapClaims{}
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	if _, err := parser.ParseWithClaims(accessToken, claims, v.keys.Keyfunc); err != nil {
+		return "", time.Time{}, errors.WithStack(err)
+	}
+	expiry, err := v.verifyClaims(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	scopes := tokenScopes(claims)
+	for _, s := range p.Scopes {
+		if !scopes[s] {
+			return "", time.Time{}, errors.WithStack(
+				fmt.Errorf("token has no scope %q", s))
+		}
+	}
+	subj, _ := claims["sub"].(string)
+	if subj == "" {
+		return "", time.Time{}, errors.WithStack(errors.New("token has no subject"))
+	}
+	return subj, expiry, nil
+}
+
+func (v *Validator) verifyClaims(claims jwt.MapClaims) (time.Time, error) {
+	now := v.now()
+	exp, ok := jwtclaims.NumericDate(claims["exp"])
+	if !ok {
+		return time.Time{}, errors.WithStack(errors.New("token has no expiration time"))
+	}
+	if now.After(exp.Add(v.c.Leeway)) {
+		return time.Time{}, errors.WithStack(errors.New("token is expired"))
+	}
+	if nbf, ok := jwtclaims.NumericDate(claims["nbf"]); ok && now.Add(v.c.Leeway).Before(nbf) {
+		return time.Time{}, errors.WithStack(errors.New("token is not valid yet"))
+	}
+	if iss, _ := claims["iss"].(string); iss != v.c.Issuer {
+		return time.Time{}, errors.WithStack(fmt.Errorf("invalid issuer %q", iss))
+	}
+	if !jwtclaims.HasAudience(claims["aud"], v.c.Audience) {
+		return time.Time{}, errors.WithStack(errors.New("invalid audience"))
+	}
+	return exp, nil
+}
+
+// tokenScopes returns set of scopes from "scope" claim (space-delimited
+// string, RFC 8693) or "scp" claim (array, used by Hydra).
+func tokenScopes(claims jwt.MapClaims) map[string]bool {
+	scopes := make(map[string]bool)
+	if s, ok := claims["scope"].(string); ok {
+		for _, s := range strings.Fields(s) {
+			scopes[s] = true
+		}
+	}
+	if a, ok := claims["scp"].([]interface{}); ok {
+		for _, s := range a {
+			if s, ok := s.(string); ok {
+				scopes[s] = true
+			}
+		}
+	}
+	return scopes
+}
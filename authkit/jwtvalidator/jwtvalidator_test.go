@@ -0,0 +1,139 @@
+package jwtvalidator
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/letsrock-today/authkit/authkit/jwks/jwkstest"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+)
+
+func testClaims(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": "user@example.com",
+		"iss": "https://issuer.example.com",
+		"aud": []string{"api", "other"},
+		"exp": now.Add(time.Hour).Unix(),
+		"scp": []string{"api.get", "api.post"},
+	}
+}
+
+func testCreateValidator(url string, now time.Time) *Validator {
+	v := New(Config{
+		JWKSURL:  url,
+		Issuer:   "https://issuer.example.com",
+		Audience: "api",
+	})
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+	valid := Config{
+		JWKSURL:  "https://issuer.example.com/keys",
+		Issuer:   "https://issuer.example.com",
+		Audience: "api",
+	}
+	assert.NotPanics(func() { New(valid) })
+	for _, update := range []func(*Config){
+		func(c *Config) { c.JWKSURL = "" },
+		func(c *Config) { c.Issuer = "" },
+		func(c *Config) { c.Audience = "" },
+	} {
+		c := valid
+		update(&c)
+		assert.Panics(func() { New(c) })
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	perm := &middleware.DefaultPermission{Scopes: []string{"api.get"}}
+
+	cases := []struct {
+		name   string
+		update func(jwt.MapClaims)
+		perm   interface{}
+		valid  bool
+	}{
+		{
+			name:  "valid",
+			perm:  perm,
+			valid: true,
+		},
+		{
+			name:   "valid, string audience and scope",
+			update: func(c jwt.MapClaims) { c["aud"] = "api"; delete(c, "scp"); c["scope"] = "api.get x" },
+			perm:   perm,
+			valid:  true,
+		},
+		{
+			name: "invalid permission object",
+			perm: middleware.DefaultPermission{},
+		},
+		{
+			name:   "wrong issuer",
+			update: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+			perm:   perm,
+		},
+		{
+			name:   "wrong audience",
+			update: func(c jwt.MapClaims) { c["aud"] = "other" },
+			perm:   perm,
+		},
+		{
+			name:   "expired",
+			update: func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Second).Unix() },
+			perm:   perm,
+		},
+		{
+			name:   "no expiration",
+			update: func(c jwt.MapClaims) { delete(c, "exp") },
+			perm:   perm,
+		},
+		{
+			name:   "not valid yet",
+			update: func(c jwt.MapClaims) { c["nbf"] = now.Add(time.Minute).Unix() },
+			perm:   perm,
+		},
+		{
+			name: "no subject",
+			update: func(c jwt.MapClaims) {
+				delete(c, "sub")
+			},
+			perm: perm,
+		},
+		{
+			name: "missing scope",
+			perm: &middleware.DefaultPermission{Scopes: []string{"api.get", "api.delete"}},
+		},
+	}
+
+	srv := jwkstest.NewServer()
+	defer srv.Close()
+	srv.AddKey(t, "k1")
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+			v := testCreateValidator(srv.URL, now)
+			claims := testClaims(now)
+			if c.update != nil {
+				c.update(claims)
+			}
+			token := srv.Sign(t, "k1", claims)
+			subj, expiry, err := v.ValidateWithExpiry(token, c.perm)
+			if !c.valid {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal("user@example.com", subj)
+			assert.Equal(now.Add(time.Hour), expiry)
+		})
+	}
+}
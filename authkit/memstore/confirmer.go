@@ -0,0 +1,113 @@
+package memstore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+// Confirmer is an authkit.Confirmer, which doesn't send anything, but keeps
+// requests in memory. Tests may use it to check requested confirmations.
+type Confirmer interface {
+	authkit.Confirmer
+	authkit.EmailChangeConfirmer
+
+	// Confirmations returns all requested confirmations in order of requests.
+	Confirmations() []Confirmation
+}
+
+// Confirmation holds parameters of confirmation request.
+type Confirmation struct {
+	Login        string
+	Email        string
+	Name         string
+	PasswordHash string
+
+	// PasswordChange is true for password change requests and false for
+	// email confirmation requests.
+	PasswordChange bool
+
+	// OldEmail is set for email change requests (Email is a new email) and
+	// notifications.
+	OldEmail string
+
+	// EmailChange is true for email change requests.
+	EmailChange bool
+
+	// EmailChanged is true for email change notifications (sent to the
+	// OldEmail).
+	EmailChanged bool
+}
+
+// NewConfirmer returns new in-memory Confirmer.
+func NewConfirmer() Confirmer {
+	return &confirmer{}
+}
+
+type confirmer struct {
+	mu            sync.Mutex
+	confirmations []Confirmation
+}
+
+func (c *confirmer) Confirmations() []Confirmation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Confirmation(nil), c.confirmations...)
+}
+
+func (c *confirmer) RequestEmailConfirmation(
+	_ context.Context,
+	login, email, name string) authkit.UserServiceError {
+	c.add(Confirmation{
+		Login: login,
+		Email: email,
+		Name:  name,
+	})
+	return nil
+}
+
+func (c *confirmer) RequestPasswordChangeConfirmation(
+	_ context.Context,
+	login, email, name, passwordHash string) authkit.UserServiceError {
+	c.add(Confirmation{
+		Login:          login,
+		Email:          email,
+		Name:           name,
+		PasswordHash:   passwordHash,
+		PasswordChange: true,
+	})
+	return nil
+}
+
+func (c *confirmer) RequestEmailChangeConfirmation(
+	_ context.Context,
+	login, oldEmail, newEmail, name string) authkit.UserServiceError {
+	c.add(Confirmation{
+		Login:       login,
+		Email:       newEmail,
+		Name:        name,
+		OldEmail:    oldEmail,
+		EmailChange: true,
+	})
+	return nil
+}
+
+func (c *confirmer) NotifyEmailChanged(
+	_ context.Context,
+	login, oldEmail, newEmail, name string) authkit.UserServiceError {
+	c.add(Confirmation{
+		Login:        login,
+		Email:        newEmail,
+		Name:         name,
+		OldEmail:     oldEmail,
+		EmailChanged: true,
+	})
+	return nil
+}
+
+func (c *confirmer) add(cf Confirmation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.confirmations = append(c.confirmations, cf)
+}
@@ -0,0 +1,20 @@
+package memstore
+
+import (
+	"testing"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/storetest"
+)
+
+func TestUserStoreConformance(t *testing.T) {
+	storetest.TestUserStore(t, func(*testing.T) (authkit.UserStore, func()) {
+		return NewUserStore(testHasher), func() {}
+	})
+}
+
+func TestProfileServiceConformance(t *testing.T) {
+	storetest.TestProfileService(t, func(*testing.T) (authkit.ProfileService, func()) {
+		return NewProfileService(), func() {}
+	})
+}
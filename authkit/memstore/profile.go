@@ -0,0 +1,167 @@
+package memstore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+// ProfileService is an in-memory authkit.ProfileService, which additionally
+// allows to retrieve and delete stored profile and to change email.
+type ProfileService interface {
+	authkit.ProfileService
+	authkit.EmailChanger
+	authkit.AccountProfileService
+}
+
+// Profile is a simple authkit.Profile implementation, used to store profiles
+// in memory.
+type Profile struct {
+	Login          string `json:"login"`
+	Email          string `json:"email"`
+	EmailConfirmed bool   `json:"emailconfirmed"`
+	FormattedName  string `json:"formattedname"`
+}
+
+// GetLogin returns login.
+func (p Profile) GetLogin() string {
+	return p.Login
+}
+
+// SetLogin sets login.
+func (p *Profile) SetLogin(login string) {
+	p.Login = login
+}
+
+// GetEmail returns email.
+func (p Profile) GetEmail() string {
+	return p.Email
+}
+
+// IsEmailConfirmed returns true if email is confirmed.
+func (p Profile) IsEmailConfirmed() bool {
+	return p.EmailConfirmed
+}
+
+// GetFormattedName returns user's name.
+func (p Profile) GetFormattedName() string {
+	return p.FormattedName
+}
+
+// NewProfileService returns new in-memory ProfileService.
+// Profiles of any type can be saved into the service, but only fields
+// accessible via authkit.Profile interface are kept.
+func NewProfileService() ProfileService {
+	return &profileService{
+		profiles: make(map[string]*Profile),
+	}
+}
+
+type profileService struct {
+	mu       sync.RWMutex
+	profiles map[string]*Profile
+}
+
+func (s *profileService) Profile(
+	_ context.Context,
+	login string) (authkit.Profile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.profiles[login]
+	if !ok {
+		return nil, errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	c := *p
+	return &c, nil
+}
+
+func (s *profileService) EnsureExists(
+	_ context.Context,
+	login, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.profiles[login]; !ok {
+		s.profiles[login] = &Profile{
+			Login: login,
+			Email: email,
+		}
+	}
+	return nil
+}
+
+func (s *profileService) Save(_ context.Context, p authkit.Profile) error {
+	if p == nil || p.GetLogin() == "" {
+		return errors.New("invalid profile")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profiles[p.GetLogin()] = &Profile{
+		Login:          p.GetLogin(),
+		Email:          p.GetEmail(),
+		EmailConfirmed: p.IsEmailConfirmed(),
+		FormattedName:  p.GetFormattedName(),
+	}
+	return nil
+}
+
+func (s *profileService) SetEmailConfirmed(
+	_ context.Context,
+	login, email string,
+	confirmed bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.profiles[login]
+	if !ok || p.Email != email {
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	p.EmailConfirmed = confirmed
+	return nil
+}
+
+func (s *profileService) Email(
+	_ context.Context,
+	login string) (string, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.profiles[login]
+	if !ok {
+		return "", "", errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	return p.Email, p.FormattedName, nil
+}
+
+func (s *profileService) ConfirmedEmail(
+	_ context.Context,
+	login string) (string, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.profiles[login]
+	if !ok || !p.EmailConfirmed {
+		return "", "", errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	return p.Email, p.FormattedName, nil
+}
+
+func (s *profileService) ChangeEmail(
+	_ context.Context,
+	login, oldEmail, newEmail string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.profiles[login]
+	if !ok || p.Email != oldEmail {
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	p.Email = newEmail
+	p.EmailConfirmed = true
+	return nil
+}
+
+func (s *profileService) DeleteProfile(_ context.Context, login string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.profiles, login)
+	return nil
+}
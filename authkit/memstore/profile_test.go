@@ -0,0 +1,62 @@
+package memstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+func TestProfileService(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	s := NewProfileService()
+
+	_, _, err := s.Email(ctx, "valid@login.ok")
+	assert.True(authkit.IsUserNotFound(err))
+
+	assert.NoError(s.EnsureExists(ctx, "valid@login.ok", "valid@login.ok"))
+	email, name, err := s.Email(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Equal("valid@login.ok", email)
+	assert.Equal("", name)
+	_, _, err = s.ConfirmedEmail(ctx, "valid@login.ok")
+	assert.True(authkit.IsUserNotFound(err))
+
+	// EnsureExists doesn't overwrite existing profile.
+	assert.NoError(s.EnsureExists(ctx, "valid@login.ok", "other@login.ok"))
+	email, _, err = s.Email(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Equal("valid@login.ok", email)
+
+	err = s.SetEmailConfirmed(ctx, "valid@login.ok", "other@login.ok", true)
+	assert.True(authkit.IsUserNotFound(err))
+	assert.NoError(s.SetEmailConfirmed(ctx, "valid@login.ok", "valid@login.ok", true))
+	email, _, err = s.ConfirmedEmail(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Equal("valid@login.ok", email)
+
+	assert.NoError(s.Save(ctx, &Profile{
+		Login:         "valid@login.ok",
+		Email:         "new@login.ok",
+		FormattedName: "Valid User",
+	}))
+	email, name, err = s.Email(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Equal("new@login.ok", email)
+	assert.Equal("Valid User", name)
+	_, _, err = s.ConfirmedEmail(ctx, "valid@login.ok")
+	assert.True(authkit.IsUserNotFound(err))
+
+	p, err := s.Profile(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Equal("new@login.ok", p.GetEmail())
+	p.SetLogin("changed@login.ok")
+	p, err = s.Profile(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Equal("valid@login.ok", p.GetLogin())
+
+	assert.Error(s.Save(ctx, &Profile{}))
+}
@@ -0,0 +1,129 @@
+package memstore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+// refreshTokenFamily is shared by all tokens of the family, so that family
+// is revoked at once.
+type refreshTokenFamily struct {
+	revoked bool
+}
+
+type refreshToken struct {
+	family     *refreshTokenFamily
+	superseded bool
+	claimed    time.Time
+	updated    time.Time
+}
+
+type refreshTokenStore struct {
+	mu sync.Mutex
+
+	// refresh token hash -> token
+	refreshTokens map[string]*refreshToken
+
+	lastPurge time.Time
+	now       func() time.Time
+}
+
+// purgeInterval is a minimal interval between removals of expired refresh
+// token records.
+const purgeInterval = time.Minute
+
+func newRefreshTokenStore() *refreshTokenStore {
+	return &refreshTokenStore{
+		refreshTokens: make(map[string]*refreshToken),
+		now:           time.Now,
+	}
+}
+
+func (s *refreshTokenStore) ClaimRefreshToken(
+	_ context.Context,
+	token string) authkit.UserServiceError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.purge(now)
+	t, ok := s.refreshTokens[token]
+	if !ok {
+		t = &refreshToken{family: &refreshTokenFamily{}}
+		s.refreshTokens[token] = t
+	}
+	if t.superseded || t.family.revoked {
+		return errors.WithStack(authkit.NewRefreshTokenReusedError(nil))
+	}
+	if now.Sub(t.claimed) < authkit.RefreshTokenClaimTimeout {
+		return errors.WithStack(authkit.NewRefreshTokenClaimedError(nil))
+	}
+	t.claimed = now
+	t.updated = now
+	return nil
+}
+
+func (s *refreshTokenStore) ReleaseRefreshToken(
+	_ context.Context,
+	token string) authkit.UserServiceError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.refreshTokens[token]; ok && !t.superseded {
+		t.claimed = time.Time{}
+	}
+	return nil
+}
+
+func (s *refreshTokenStore) RotateRefreshToken(
+	_ context.Context,
+	old, new string) authkit.UserServiceError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	t, ok := s.refreshTokens[old]
+	if !ok {
+		t = &refreshToken{family: &refreshTokenFamily{}}
+		s.refreshTokens[old] = t
+	}
+	if t.superseded || t.family.revoked {
+		return errors.WithStack(authkit.NewRefreshTokenReusedError(nil))
+	}
+	if _, ok := s.refreshTokens[new]; ok {
+		// Unknown token has been rotated concurrently.
+		return errors.WithStack(authkit.NewRefreshTokenReusedError(nil))
+	}
+	t.superseded = true
+	t.claimed = time.Time{}
+	t.updated = now
+	s.refreshTokens[new] = &refreshToken{family: t.family, updated: now}
+	return nil
+}
+
+func (s *refreshTokenStore) RevokeRefreshTokenFamily(
+	_ context.Context,
+	token string) authkit.UserServiceError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.refreshTokens[token]; ok {
+		t.family.revoked = true
+	}
+	return nil
+}
+
+// purge removes records, which are older than authkit.RefreshTokenRetention.
+// Caller should hold the lock.
+func (s *refreshTokenStore) purge(now time.Time) {
+	if now.Sub(s.lastPurge) < purgeInterval {
+		return
+	}
+	s.lastPurge = now
+	for k, t := range s.refreshTokens {
+		if now.Sub(t.updated) > authkit.RefreshTokenRetention {
+			delete(s.refreshTokens, k)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+type session struct {
+	authkit.Session
+	token *oauth2.Token
+}
+
+type sessionStore struct {
+	mu sync.RWMutex
+
+	// session ID -> session
+	sessions map[string]*session
+
+	// access token -> session ID
+	ids map[string]string
+
+	// exists used to check that user exists
+	exists func(login string) bool
+}
+
+func newSessionStore(exists func(string) bool) *sessionStore {
+	return &sessionStore{
+		sessions: make(map[string]*session),
+		ids:      make(map[string]string),
+		exists:   exists,
+	}
+}
+
+func (s *sessionStore) CreateSession(
+	_ context.Context,
+	ss authkit.Session,
+	token *oauth2.Token) authkit.UserServiceError {
+	if !s.exists(ss.Login) {
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[ss.ID]; ok {
+		return errors.WithStack(authkit.NewDuplicateUserError(nil))
+	}
+	s.sessions[ss.ID] = &session{ss, copyToken(token)}
+	s.index(ss.ID, token)
+	return nil
+}
+
+func (s *sessionStore) Sessions(
+	_ context.Context,
+	login string) ([]authkit.Session, authkit.UserServiceError) {
+	if !s.exists(login) {
+		return nil, errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sessions := []authkit.Session{}
+	for _, ss := range s.sessions {
+		if ss.Login == login {
+			sessions = append(sessions, ss.Session)
+		}
+	}
+	sort.Sort(byCreated(sessions))
+	return sessions, nil
+}
+
+func (s *sessionStore) SessionByAccessToken(
+	_ context.Context,
+	accessToken string) (authkit.Session, *oauth2.Token, authkit.UserServiceError) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.ids[accessToken]
+	if !ok || accessToken == "" {
+		return authkit.Session{}, nil, errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	ss := s.sessions[id]
+	return ss.Session, copyToken(ss.token), nil
+}
+
+func (s *sessionStore) SessionToken(
+	_ context.Context,
+	login, id string) (*oauth2.Token, authkit.UserServiceError) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ss, ok := s.sessions[id]
+	if !ok || ss.Login != login {
+		return nil, errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	return copyToken(ss.token), nil
+}
+
+func (s *sessionStore) UpdateSessionToken(
+	_ context.Context,
+	id string,
+	token *oauth2.Token) authkit.UserServiceError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ss, ok := s.sessions[id]
+	if !ok {
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	delete(s.ids, ss.token.AccessToken)
+	ss.token = copyToken(token)
+	s.index(id, token)
+	return nil
+}
+
+func (s *sessionStore) TouchSession(
+	_ context.Context,
+	accessToken, ip string,
+	lastUsed time.Time) authkit.UserServiceError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.ids[accessToken]
+	if !ok {
+		return nil
+	}
+	ss := s.sessions[id]
+	ss.IP = ip
+	ss.LastUsed = lastUsed
+	return nil
+}
+
+func (s *sessionStore) DeleteSession(
+	_ context.Context,
+	login, id string) authkit.UserServiceError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ss, ok := s.sessions[id]
+	if !ok || ss.Login != login {
+		return nil
+	}
+	delete(s.ids, ss.token.AccessToken)
+	delete(s.sessions, id)
+	return nil
+}
+
+// deleteSessions removes all user's sessions.
+func (s *sessionStore) deleteSessions(login string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, ss := range s.sessions {
+		if ss.Login == login {
+			delete(s.ids, ss.token.AccessToken)
+			delete(s.sessions, id)
+		}
+	}
+}
+
+func (s *sessionStore) index(id string, token *oauth2.Token) {
+	if token.AccessToken != "" {
+		s.ids[token.AccessToken] = id
+	}
+}
+
+type byCreated []authkit.Session
+
+func (s byCreated) Len() int           { return len(s) }
+func (s byCreated) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byCreated) Less(i, j int) bool { return s[i].Created.Before(s[j].Created) }
@@ -0,0 +1,527 @@
+// Package memstore provides goroutine-safe in-memory implementations of
+// authkit.UserService, authkit.TokenStore and authkit.ProfileService.
+// Implementations are intended for development and tests, data is not
+// persisted anywhere and lost after application exit.
+package memstore
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/passhash"
+)
+
+// NewUserService returns new in-memory authkit.UserService, which uses
+// provided authkit.Confirmer to request confirmations. If c is nil, then
+// Confirmer, returned by NewConfirmer, is used. See NewUserStore for h.
+func NewUserService(c authkit.Confirmer, h passhash.Hasher) authkit.UserService {
+	if c == nil {
+		c = NewConfirmer()
+	}
+	s := newUserStore(h)
+	return struct {
+		authkit.UserStore
+		authkit.TOTPStore
+		authkit.RecoveryCodeStore
+		authkit.AccountStore
+		authkit.IdentityStore
+		authkit.SessionStore
+		authkit.RefreshTokenFamilyStore
+		authkit.Confirmer
+	}{
+		s,
+		s,
+		s,
+		s,
+		s,
+		s,
+		s,
+		c,
+	}
+}
+
+// NewUserStore returns new in-memory authkit.UserStore, which uses h to hash
+// passwords. If h is nil, then passhash.Default() is used.
+// Returned store also implements authkit.TOTPStore,
+// authkit.RecoveryCodeStore, authkit.AccountStore, authkit.IdentityStore,
+// authkit.SessionStore and authkit.RefreshTokenFamilyStore.
+func NewUserStore(h passhash.Hasher) authkit.UserStore {
+	return newUserStore(h)
+}
+
+func newUserStore(h passhash.Hasher) *userStore {
+	if h == nil {
+		h = passhash.Default()
+	}
+	s := &userStore{
+		users:      make(map[string]*user),
+		hasher:     h,
+		identities: make(map[string]map[string]string),
+	}
+	s.tokenStore = newTokenStore(s.exists)
+	s.sessionStore = newSessionStore(s.exists)
+	return s
+}
+
+// NewTokenStore returns new in-memory authkit.TokenStore. Returned store
+// doesn't keep users, so it accepts tokens for any login.
+// Returned store also implements authkit.RefreshTokenFamilyStore.
+func NewTokenStore() authkit.TokenStore {
+	return newTokenStore(nil)
+}
+
+type user struct {
+	login        string
+	passwordHash string
+	totpSecret   string
+	totpCounter  int64
+
+	// hashes of recovery codes
+	recoveryCodes map[string]bool
+
+	// provider ID -> external identity
+	identities map[string]string
+}
+
+func (u user) Login() string {
+	return u.login
+}
+
+func (u user) PasswordHash() string {
+	return u.passwordHash
+}
+
+type userStore struct {
+	*tokenStore
+	*sessionStore
+	mu     sync.RWMutex
+	users  map[string]*user
+	hasher passhash.Hasher
+
+	// provider ID -> external identity -> login
+	identities map[string]map[string]string
+}
+
+func (s *userStore) exists(login string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.users[login]
+	return ok
+}
+
+func (s *userStore) User(
+	_ context.Context,
+	login string) (authkit.User, authkit.UserServiceError) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[login]
+	if !ok {
+		return nil, errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	return *u, nil
+}
+
+func (s *userStore) Principal(u authkit.User) interface{} {
+	return u
+}
+
+func (s *userStore) Create(
+	_ context.Context,
+	login, password string) authkit.UserServiceError {
+	h, err := s.hasher.Hash(password)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[login]; ok {
+		return errors.WithStack(authkit.NewDuplicateUserError(nil))
+	}
+	s.users[login] = &user{
+		login:        login,
+		passwordHash: h,
+	}
+	return nil
+}
+
+func (s *userStore) Authenticate(
+	_ context.Context,
+	login, password string) authkit.UserServiceError {
+	s.mu.RLock()
+	u, ok := s.users[login]
+	var old string
+	if ok {
+		old = u.passwordHash
+	}
+	s.mu.RUnlock()
+	if !ok || old == authkit.NoPasswordHash {
+		// User without password can't authenticate.
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	valid, rehash, err := s.hasher.Verify(password, old)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !valid {
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	if rehash {
+		// Failed rehash doesn't prevent login, it will be retried next time.
+		if h, err := s.hasher.Hash(password); err == nil {
+			s.mu.Lock()
+			if u.passwordHash == old {
+				u.passwordHash = h
+			}
+			s.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+func (s *userStore) UpdatePassword(
+	_ context.Context,
+	login, oldPasswordHash, newPassword string) authkit.UserServiceError {
+	h, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[login]
+	if !ok || u.passwordHash != oldPasswordHash {
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	u.passwordHash = h
+	return nil
+}
+
+func (s *userStore) TOTPSecret(
+	_ context.Context,
+	login string) (string, authkit.UserServiceError) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[login]
+	if !ok {
+		return "", errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	return u.totpSecret, nil
+}
+
+func (s *userStore) UpdateTOTPSecret(
+	_ context.Context,
+	login, secret string) authkit.UserServiceError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[login]
+	if !ok {
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	u.totpSecret = secret
+	u.totpCounter = 0
+	return nil
+}
+
+func (s *userStore) UseTOTPCounter(
+	_ context.Context,
+	login string,
+	counter int64) (bool, authkit.UserServiceError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[login]
+	if !ok {
+		return false, errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	if counter <= u.totpCounter {
+		return false, nil
+	}
+	u.totpCounter = counter
+	return true, nil
+}
+
+func (s *userStore) UpdateRecoveryCodes(
+	_ context.Context,
+	login string,
+	hashes []string) authkit.UserServiceError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[login]
+	if !ok {
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	u.recoveryCodes = make(map[string]bool, len(hashes))
+	for _, h := range hashes {
+		u.recoveryCodes[h] = true
+	}
+	return nil
+}
+
+func (s *userStore) UseRecoveryCode(
+	_ context.Context,
+	login, hash string) (bool, authkit.UserServiceError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[login]
+	if !ok {
+		return false, errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	if !u.recoveryCodes[hash] {
+		return false, nil
+	}
+	delete(u.recoveryCodes, hash)
+	return true, nil
+}
+
+func (s *userStore) DeleteUser(
+	_ context.Context,
+	login string) authkit.UserServiceError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[login]; !ok {
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	for pid, identity := range s.users[login].identities {
+		delete(s.identities[pid], identity)
+	}
+	delete(s.users, login)
+	s.tokenStore.deleteTokens(login)
+	s.sessionStore.deleteSessions(login)
+	return nil
+}
+
+func (s *userStore) LoginByIdentity(
+	_ context.Context,
+	providerID, identity string) (string, authkit.UserServiceError) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	login, ok := s.identities[providerID][identity]
+	if !ok {
+		return "", errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	return login, nil
+}
+
+func (s *userStore) LinkIdentity(
+	_ context.Context,
+	login, providerID, identity string) authkit.UserServiceError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[login]
+	if !ok {
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	if l, ok := s.identities[providerID][identity]; ok {
+		if l != login {
+			return errors.WithStack(authkit.NewDuplicateUserError(nil))
+		}
+		return nil
+	}
+	if _, ok := u.identities[providerID]; ok {
+		return errors.WithStack(authkit.NewDuplicateUserError(nil))
+	}
+	s.link(u, providerID, identity)
+	return nil
+}
+
+func (s *userStore) CreateWithIdentity(
+	_ context.Context,
+	login, providerID, identity string) authkit.UserServiceError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[login]; ok {
+		return errors.WithStack(authkit.NewDuplicateUserError(nil))
+	}
+	if _, ok := s.identities[providerID][identity]; ok {
+		return errors.WithStack(authkit.NewDuplicateUserError(nil))
+	}
+	u := &user{
+		login:        login,
+		passwordHash: authkit.NoPasswordHash,
+	}
+	s.users[login] = u
+	s.link(u, providerID, identity)
+	return nil
+}
+
+// link links identity to the user. Caller should hold the lock.
+func (s *userStore) link(u *user, providerID, identity string) {
+	if u.identities == nil {
+		u.identities = make(map[string]string)
+	}
+	u.identities[providerID] = identity
+	logins, ok := s.identities[providerID]
+	if !ok {
+		logins = make(map[string]string)
+		s.identities[providerID] = logins
+	}
+	logins[identity] = u.login
+}
+
+func (s *userStore) Identities(
+	_ context.Context,
+	login string) (map[string]string, authkit.UserServiceError) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[login]
+	if !ok {
+		return nil, errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	identities := make(map[string]string, len(u.identities))
+	for pid, identity := range u.identities {
+		identities[pid] = identity
+	}
+	return identities, nil
+}
+
+func (s *userStore) UnlinkIdentity(
+	_ context.Context,
+	login, providerID string) authkit.UserServiceError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[login]
+	if !ok {
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	if identity, ok := u.identities[providerID]; ok {
+		if u.passwordHash == authkit.NoPasswordHash && len(u.identities) == 1 {
+			return errors.WithStack(authkit.NewLastLoginMethodError(nil))
+		}
+		delete(s.identities[providerID], identity)
+		delete(u.identities, providerID)
+	}
+	return nil
+}
+
+type tokenStore struct {
+	*refreshTokenStore
+	mu sync.RWMutex
+
+	// login -> provider ID -> token
+	tokens map[string]map[string]*oauth2.Token
+
+	// provider ID -> access token -> login
+	logins map[string]map[string]string
+
+	// exists used to check that user exists, may be nil
+	exists func(login string) bool
+}
+
+func newTokenStore(exists func(string) bool) *tokenStore {
+	return &tokenStore{
+		refreshTokenStore: newRefreshTokenStore(),
+		tokens:            make(map[string]map[string]*oauth2.Token),
+		logins:            make(map[string]map[string]string),
+		exists:            exists,
+	}
+}
+
+func (s *tokenStore) OAuth2Token(
+	_ context.Context,
+	login, providerID string) (*oauth2.Token, authkit.UserServiceError) {
+	if s.exists != nil && !s.exists(login) {
+		return nil, errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copyToken(s.tokens[login][providerID]), nil
+}
+
+func (s *tokenStore) OAuth2TokenAndLoginByAccessToken(
+	_ context.Context,
+	accessToken, providerID string) (*oauth2.Token, string, authkit.UserServiceError) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	login, ok := s.logins[providerID][accessToken]
+	if !ok || accessToken == "" {
+		return nil, "", errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	return copyToken(s.tokens[login][providerID]), login, nil
+}
+
+func (s *tokenStore) UpdateOAuth2Token(
+	_ context.Context,
+	login, providerID string,
+	token *oauth2.Token) authkit.UserServiceError {
+	if s.exists != nil && !s.exists(login) {
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens, ok := s.tokens[login]
+	if !ok {
+		tokens = make(map[string]*oauth2.Token)
+		s.tokens[login] = tokens
+	}
+	logins, ok := s.logins[providerID]
+	if !ok {
+		logins = make(map[string]string)
+		s.logins[providerID] = logins
+	}
+	if old := tokens[providerID]; old != nil {
+		delete(logins, old.AccessToken)
+	}
+	if token == nil {
+		delete(tokens, providerID)
+		return nil
+	}
+	tokens[providerID] = copyToken(token)
+	if token.AccessToken != "" {
+		logins[token.AccessToken] = login
+	}
+	return nil
+}
+
+func (s *tokenStore) OAuth2Tokens(
+	_ context.Context,
+	login string) (map[string]*oauth2.Token, authkit.UserServiceError) {
+	if s.exists != nil && !s.exists(login) {
+		return nil, errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tokens := make(map[string]*oauth2.Token, len(s.tokens[login]))
+	for pid, t := range s.tokens[login] {
+		tokens[pid] = copyToken(t)
+	}
+	return tokens, nil
+}
+
+// deleteTokens removes all user's tokens.
+func (s *tokenStore) deleteTokens(login string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for pid, t := range s.tokens[login] {
+		delete(s.logins[pid], t.AccessToken)
+	}
+	delete(s.tokens, login)
+}
+
+// RevokeAccessToken removes access token from the store, but keeps the rest
+// of the token (refresh token), similar to the sample MongoDB store.
+func (s *tokenStore) RevokeAccessToken(
+	_ context.Context,
+	providerID, accessToken string) authkit.UserServiceError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	login, ok := s.logins[providerID][accessToken]
+	if !ok {
+		return nil
+	}
+	delete(s.logins[providerID], accessToken)
+	if t := s.tokens[login][providerID]; t != nil {
+		t.AccessToken = ""
+	}
+	return nil
+}
+
+func copyToken(t *oauth2.Token) *oauth2.Token {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
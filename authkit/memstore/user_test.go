@@ -0,0 +1,204 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/passhash"
+)
+
+// testHasher uses cheap parameters to keep tests fast.
+var testHasher = passhash.New(
+	passhash.NewArgon2id(passhash.Argon2idParams{Time: 1, Memory: 64, Threads: 1}),
+	passhash.NewPBKDF2(1000))
+
+func TestUserStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	s := NewUserStore(testHasher)
+
+	_, err := s.User(ctx, "valid@login.ok")
+	assert.True(authkit.IsUserNotFound(err))
+
+	assert.NoError(s.Create(ctx, "valid@login.ok", "valid_password"))
+	err = s.Create(ctx, "valid@login.ok", "other_password")
+	assert.True(authkit.IsDuplicateUser(err))
+
+	u, err := s.User(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Equal("valid@login.ok", u.Login())
+	assert.NotEqual("valid_password", u.PasswordHash())
+	assert.Equal(u, s.Principal(u))
+
+	assert.NoError(s.Authenticate(ctx, "valid@login.ok", "valid_password"))
+	err = s.Authenticate(ctx, "valid@login.ok", "invalid_password")
+	assert.True(authkit.IsUserNotFound(err))
+	err = s.Authenticate(ctx, "unknown@login.ok", "valid_password")
+	assert.True(authkit.IsUserNotFound(err))
+
+	err = s.UpdatePassword(ctx, "valid@login.ok", "invalid_hash", "new_password")
+	assert.True(authkit.IsUserNotFound(err))
+	assert.NoError(s.UpdatePassword(ctx, "valid@login.ok", u.PasswordHash(), "new_password"))
+	assert.NoError(s.Authenticate(ctx, "valid@login.ok", "new_password"))
+	err = s.Authenticate(ctx, "valid@login.ok", "valid_password")
+	assert.True(authkit.IsUserNotFound(err))
+}
+
+func TestUserStoreRehash(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	s := NewUserStore(testHasher)
+
+	assert.NoError(s.Create(ctx, "valid@login.ok", "valid_password"))
+	legacy, err := passhash.NewPBKDF2(1000).Hash("valid_password")
+	assert.NoError(err)
+	s.(*userStore).users["valid@login.ok"].passwordHash = legacy
+
+	assert.NoError(s.Authenticate(ctx, "valid@login.ok", "valid_password"))
+	u, err := s.User(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.NotEqual(legacy, u.PasswordHash())
+	assert.Contains(u.PasswordHash(), "$argon2id$")
+	assert.NoError(s.Authenticate(ctx, "valid@login.ok", "valid_password"))
+
+	// Failed authentication doesn't upgrade hash.
+	s.(*userStore).users["valid@login.ok"].passwordHash = legacy
+	err = s.Authenticate(ctx, "valid@login.ok", "invalid_password")
+	assert.True(authkit.IsUserNotFound(err))
+	u, err = s.User(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Equal(legacy, u.PasswordHash())
+}
+
+func TestUserStoreConcurrentCreate(t *testing.T) {
+	ctx := context.Background()
+	s := NewUserStore(testHasher)
+	const n = 20
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		ok   int
+		dups int
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Create(ctx, "valid@login.ok", "valid_password")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				ok++
+			case authkit.IsDuplicateUser(err):
+				dups++
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, ok)
+	assert.Equal(t, n-1, dups)
+}
+
+func TestTokenStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	s := NewUserStore(testHasher)
+
+	token := &oauth2.Token{AccessToken: "xxx", RefreshToken: "rrr"}
+	err := s.UpdateOAuth2Token(ctx, "unknown@login.ok", "provider-1", token)
+	assert.True(authkit.IsUserNotFound(err))
+	_, err = s.OAuth2Token(ctx, "unknown@login.ok", "provider-1")
+	assert.True(authkit.IsUserNotFound(err))
+
+	assert.NoError(s.Create(ctx, "valid@login.ok", "valid_password"))
+	tt, err := s.OAuth2Token(ctx, "valid@login.ok", "provider-1")
+	assert.NoError(err)
+	assert.Nil(tt)
+
+	assert.NoError(s.UpdateOAuth2Token(ctx, "valid@login.ok", "provider-1", token))
+	tt, err = s.OAuth2Token(ctx, "valid@login.ok", "provider-1")
+	assert.NoError(err)
+	assert.Equal("xxx", tt.AccessToken)
+
+	tt, login, err := s.OAuth2TokenAndLoginByAccessToken(ctx, "xxx", "provider-1")
+	assert.NoError(err)
+	assert.Equal("valid@login.ok", login)
+	assert.Equal("rrr", tt.RefreshToken)
+	_, _, err = s.OAuth2TokenAndLoginByAccessToken(ctx, "xxx", "provider-2")
+	assert.True(authkit.IsUserNotFound(err))
+
+	// Replaced token is not found by old access token.
+	token2 := &oauth2.Token{AccessToken: "yyy", RefreshToken: "rrr2"}
+	assert.NoError(s.UpdateOAuth2Token(ctx, "valid@login.ok", "provider-1", token2))
+	_, _, err = s.OAuth2TokenAndLoginByAccessToken(ctx, "xxx", "provider-1")
+	assert.True(authkit.IsUserNotFound(err))
+	_, login, err = s.OAuth2TokenAndLoginByAccessToken(ctx, "yyy", "provider-1")
+	assert.NoError(err)
+	assert.Equal("valid@login.ok", login)
+
+	// Stored token is not affected by modification of the original one.
+	token2.AccessToken = "zzz"
+	tt, err = s.OAuth2Token(ctx, "valid@login.ok", "provider-1")
+	assert.NoError(err)
+	assert.Equal("yyy", tt.AccessToken)
+
+	assert.NoError(s.RevokeAccessToken(ctx, "provider-1", "yyy"))
+	assert.NoError(s.RevokeAccessToken(ctx, "provider-1", "unknown"))
+	_, _, err = s.OAuth2TokenAndLoginByAccessToken(ctx, "yyy", "provider-1")
+	assert.True(authkit.IsUserNotFound(err))
+	tt, err = s.OAuth2Token(ctx, "valid@login.ok", "provider-1")
+	assert.NoError(err)
+	assert.Equal("", tt.AccessToken)
+	assert.Equal("rrr2", tt.RefreshToken)
+}
+
+func TestTokenStoreConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	s := NewTokenStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			login := fmt.Sprintf("user%d@login.ok", i%5)
+			at := fmt.Sprintf("token-%d", i)
+			assert.NoError(t, s.UpdateOAuth2Token(
+				ctx,
+				login,
+				"provider-1",
+				&oauth2.Token{AccessToken: at}))
+			_, _, _ = s.OAuth2TokenAndLoginByAccessToken(ctx, at, "provider-1")
+			_ = s.RevokeAccessToken(ctx, "provider-1", at)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestPurgeRefreshTokens(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	now := time.Now()
+	s := newRefreshTokenStore()
+	s.now = func() time.Time { return now }
+
+	assert.NoError(s.RotateRefreshToken(ctx, "rt-1", "rt-2"))
+	now = now.Add(authkit.RefreshTokenRetention / 2)
+	assert.NoError(s.RotateRefreshToken(ctx, "other-1", "other-2"))
+
+	// Records are removed after retention period since the last rotation.
+	now = now.Add(authkit.RefreshTokenRetention/2 + time.Minute)
+	assert.NoError(s.ClaimRefreshToken(ctx, "new-1"))
+	assert.NotContains(s.refreshTokens, "rt-1")
+	assert.NotContains(s.refreshTokens, "rt-2")
+	assert.Contains(s.refreshTokens, "other-1")
+	assert.Contains(s.refreshTokens, "other-2")
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strings"
 	"time"
@@ -36,14 +37,28 @@ type (
 		// Required.
 		UserService authkit.MiddlewareUserService
 
+		// SessionStore used to refresh token of the session and to track
+		// last use of the session. Optional. If nil, and UserService
+		// implements authkit.SessionStore, then UserService is used.
+		// Otherwise, token is refreshed via UserService.
+		SessionStore authkit.SessionStore
+
 		// OAuth2Config used to refresh OAuth2 token.
 		// Optional. Default value is nil, which disables token refresh.
+		// If UserService (or SessionStore) implements
+		// authkit.RefreshTokenFamilyStore, then reuse of rotated refresh
+		// tokens is detected (see persisttoken) and denies access.
 		OAuth2Config authkit.OAuth2Config
 
 		// ContextCreator used to obtain context to store and refresh OAuth2 token.
 		// Optional. Default value is nil, which disables token refresh.
 		ContextCreator authkit.ContextCreator
 
+		// RefreshLocker coordinates refresh of the same token by several
+		// instances of the application. Optional. Concurrent refreshes
+		// within one instance are coalesced anyway.
+		RefreshLocker authkit.RefreshLocker
+
 		// AuthHeaderName is a name of header to be used to update auth token on
 		// the client.
 		AuthHeaderName string
@@ -114,9 +129,13 @@ func AccessTokenWithConfig(config AccessTokenConfig) echo.MiddlewareFunc {
 	if config.TokenValidator == nil {
 		panic("TokenValidator must be provided")
 	}
+	if config.SessionStore == nil {
+		config.SessionStore, _ = config.UserService.(authkit.SessionStore)
+	}
 	if reportEffectiveConfig != nil {
 		reportEffectiveConfig(config)
 	}
+	refreshes := newRefreshGroup()
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -153,28 +172,58 @@ func AccessTokenWithConfig(config AccessTokenConfig) echo.MiddlewareFunc {
 					return errAccessDenied
 				}
 				// Update OAuth2 token and save it in DB.
-				ctx := config.ContextCreator.CreateContext(
-					config.PrivateProviderID)
-				t, err1 := persisttoken.WrapOAuth2ConfigUseAccessToken(
-					config.OAuth2Config,
-					token,
-					config.PrivateProviderID,
-					config.UserService,
-					func(t *oauth2.Token) error {
-						// Restrict period of time during which we allow to
-						// refresh token. This is not quite similar to
-						// traditional HTTP session timeout, but for the same
-						// purpose. If there were no requests to API since access
-						// token expired and it expired more than this interval
-						// ago, then we assume session inactive and not keep it.
-						if !t.Valid() &&
-							!t.Expiry.IsZero() &&
-							time.Since(t.Expiry) > config.RefreshAllowedInterval {
-							return errors.New("token expired too long ago")
-						}
-						return nil
-					}).TokenSource(ctx, nil).Token()
+				ctx := withHTTPClient(
+					req.Context(),
+					config.ContextCreator.CreateContext(
+						config.PrivateProviderID))
+				checkRefreshable := func(t *oauth2.Token) error {
+					// Restrict period of time during which we allow to
+					// refresh token. This is not quite similar to
+					// traditional HTTP session timeout, but for the same
+					// purpose. If there were no requests to API since access
+					// token expired and it expired more than this interval
+					// ago, then we assume session inactive and not keep it.
+					if !t.Valid() &&
+						!t.Expiry.IsZero() &&
+						time.Since(t.Expiry) > config.RefreshAllowedInterval {
+						return errors.New("token expired too long ago")
+					}
+					return nil
+				}
+				var cfg authkit.OAuth2Config
+				if config.SessionStore != nil {
+					cfg = persisttoken.WrapOAuth2ConfigUseSession(
+						config.OAuth2Config,
+						token,
+						config.SessionStore,
+						checkRefreshable)
+				} else {
+					cfg = persisttoken.WrapOAuth2ConfigUseAccessToken(
+						config.OAuth2Config,
+						token,
+						config.PrivateProviderID,
+						config.UserService,
+						checkRefreshable)
+				}
+				// Concurrent requests with the same expired token (which
+				// is common for SPA) share single refresh, otherwise they
+				// would invalidate each other's refresh tokens. Refresh
+				// is not canceled with the request, which started it,
+				// because other requests wait for its result.
+				t, err1 := refreshes.do(ctx, token, func() (*oauth2.Token, error) {
+					ctx, cancel := context.WithTimeout(
+						authkit.Detach(ctx),
+						refreshTimeout)
+					defer cancel()
+					return refresh(c, ctx, config.RefreshLocker, cfg, token)
+				})
 				if err1 != nil {
+					if authkit.IsRefreshTokenReused(err1) {
+						// Token is likely stolen, its family is revoked
+						// and user has to login again.
+						c.Logger().Warnf("%+v", errors.WithStack(err1))
+						return errAccessDenied
+					}
 					c.Logger().Debugf("%+v", errors.WithStack(err1))
 					return errAccessDenied
 				}
@@ -193,8 +242,19 @@ func AccessTokenWithConfig(config AccessTokenConfig) echo.MiddlewareFunc {
 				c.Response().Header().Set(config.AuthHeaderName, token)
 			}
 
+			if config.SessionStore != nil {
+				// Failure to track session's use doesn't prevent access.
+				if err := config.SessionStore.TouchSession(
+					req.Context(),
+					token,
+					c.RealIP(),
+					time.Now()); err != nil {
+					c.Logger().Debugf("%+v", errors.WithStack(err))
+				}
+			}
+
 			// Find user.
-			user, err := config.UserService.User(login)
+			user, err := config.UserService.User(req.Context(), login)
 			if err != nil {
 				c.Logger().Debugf("%+v", errors.WithStack(err))
 				return errAccessDenied
@@ -207,3 +267,46 @@ func AccessTokenWithConfig(config AccessTokenConfig) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// refresh refreshes token via cfg, holding lock of the locker (if provided).
+// If token has been refreshed by another instance, it returns token with
+// new access token only.
+func refresh(
+	c echo.Context,
+	ctx context.Context,
+	locker authkit.RefreshLocker,
+	cfg authkit.OAuth2Config,
+	accessToken string) (*oauth2.Token, error) {
+	if locker == nil {
+		return cfg.TokenSource(ctx, nil).Token()
+	}
+	refreshed, err := locker.Lock(ctx, accessToken)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if refreshed != "" {
+		return &oauth2.Token{AccessToken: refreshed}, nil
+	}
+	t, err := cfg.TokenSource(ctx, nil).Token()
+	newAccessToken := ""
+	if err == nil {
+		newAccessToken = t.AccessToken
+	}
+	if err := locker.Unlock(ctx, accessToken, newAccessToken); err != nil {
+		// Lock will expire eventually.
+		c.Logger().Debugf("%+v", errors.WithStack(err))
+	}
+	return t, err
+}
+
+// withHTTPClient returns request's context, enriched with http.Client from
+// the context, created by the ContextCreator. So that store methods, called
+// during token refresh, receive request's context, and OAuth2 calls still use
+// the client, configured by the application.
+func withHTTPClient(reqCtx, clientCtx context.Context) context.Context {
+	client := clientCtx.Value(oauth2.HTTPClient)
+	if client == nil {
+		return reqCtx
+	}
+	return context.WithValue(reqCtx, oauth2.HTTPClient, client)
+}
@@ -5,12 +5,14 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 
 	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 
 	"github.com/letsrock-today/authkit/authkit"
 	"github.com/letsrock-today/authkit/authkit/mocks"
@@ -59,12 +61,15 @@ func TestAccessTokenWithConfig(t *testing.T) {
 	us := new(mocks.UserService)
 	us.On(
 		"User",
+		mock.Anything,
 		"valid@login.ok").Return(user, nil)
 	us.On(
 		"User",
+		mock.Anything,
 		"unknown@login.ok").Return(nil, authkit.NewUserNotFoundError(nil))
 	us.On(
 		"OAuth2TokenAndLoginByAccessToken",
+		mock.Anything,
 		"xxx",
 		"xxx-provider").Return(&oauth2.Token{
 		AccessToken:  "xxx",
@@ -72,6 +77,7 @@ func TestAccessTokenWithConfig(t *testing.T) {
 	}, "valid@login.ok", nil)
 	us.On(
 		"OAuth2TokenAndLoginByAccessToken",
+		mock.Anything,
 		"zzz",
 		"xxx-provider").Return(nil, "", authkit.NewUserNotFoundError(nil))
 	us.On(
@@ -245,6 +251,155 @@ func TestAccessTokenWithConfig(t *testing.T) {
 	}
 }
 
+func TestAccessTokenSession(t *testing.T) {
+	assert := assert.New(t)
+	user := testUser{"valid@login.ok", "name"}
+	us := new(mocks.UserService)
+	us.On(
+		"User",
+		mock.Anything,
+		"valid@login.ok").Return(user, nil)
+	us.On(
+		"Principal",
+		user).Return(user)
+	ss := new(mocks.SessionStore)
+	ss.On(
+		"SessionByAccessToken",
+		mock.Anything,
+		"old").Return(authkit.Session{ID: "session-1"}, &oauth2.Token{
+		AccessToken:  "old",
+		RefreshToken: "rrr",
+		Expiry:       time.Now().Add(-time.Minute),
+	}, nil)
+	ss.On(
+		"UpdateSessionToken",
+		mock.Anything,
+		"session-1",
+		&oauth2.Token{
+			AccessToken:  "xxx",
+			RefreshToken: "rrr",
+		}).Return(nil)
+	ss.On(
+		"TouchSession",
+		mock.Anything,
+		"xxx",
+		mock.Anything,
+		mock.Anything).Return(nil)
+
+	e := echo.New()
+	next := testNextHandler{checkPrincipal: true}
+	e.GET(
+		"/permitted",
+		next.next,
+		AccessTokenWithConfig(AccessTokenConfig{
+			PrivateProviderID: "xxx-provider",
+			UserService:       us,
+			SessionStore:      ss,
+			PermissionMapper:  testPermMapper{},
+			TokenValidator: testTokenValidator{
+				allowed: map[string]bool{
+					"GET:/permitted:xxx": true,
+				},
+			},
+			OAuth2Config:   testOAuth2Config{},
+			ContextCreator: authkit.DefaultContextCreator{},
+			AuthHeaderName: "xxx-auth",
+		}))
+
+	// Expired token of the session is refreshed and stored in the session.
+	w := httptest.NewRecorder()
+	r := testNewGetPermitted(t)
+	r.Header.Set(echo.HeaderAuthorization, "bearer old")
+	e.ServeHTTP(echo.NewResponse(w, e), r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("xxx", w.Header().Get("xxx-auth"))
+	ss.AssertExpectations(t)
+	us.AssertNotCalled(t, "UpdateOAuth2Token", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAccessTokenRefreshLocker(t *testing.T) {
+	assert := assert.New(t)
+	user := testUser{"valid@login.ok", "name"}
+	us := new(mocks.UserService)
+	us.On(
+		"User",
+		mock.Anything,
+		"valid@login.ok").Return(user, nil)
+	us.On(
+		"Principal",
+		user).Return(user)
+	locker := new(mocks.RefreshLocker)
+
+	// Token has been refreshed by another instance already.
+	locker.On(
+		"Lock",
+		mock.Anything,
+		"old").Return("xxx", nil).Once()
+
+	e := echo.New()
+	next := testNextHandler{checkPrincipal: true}
+	e.GET(
+		"/permitted",
+		next.next,
+		AccessTokenWithConfig(AccessTokenConfig{
+			PrivateProviderID: "xxx-provider",
+			UserService:       us,
+			PermissionMapper:  testPermMapper{},
+			TokenValidator: testTokenValidator{
+				allowed: map[string]bool{
+					"GET:/permitted:xxx": true,
+				},
+			},
+			OAuth2Config:   testOAuth2Config{},
+			ContextCreator: authkit.DefaultContextCreator{},
+			RefreshLocker:  locker,
+			AuthHeaderName: "xxx-auth",
+		}))
+
+	w := httptest.NewRecorder()
+	r := testNewGetPermitted(t)
+	r.Header.Set(echo.HeaderAuthorization, "bearer old")
+	e.ServeHTTP(echo.NewResponse(w, e), r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("xxx", w.Header().Get("xxx-auth"))
+	us.AssertNotCalled(t, "OAuth2TokenAndLoginByAccessToken", mock.Anything, mock.Anything, mock.Anything)
+
+	// Lock is acquired, token is refreshed by this instance. Another token is
+	// used, because result of the previous refresh is reused for a while.
+	us.On(
+		"OAuth2TokenAndLoginByAccessToken",
+		mock.Anything,
+		"old-2",
+		"xxx-provider").Return(&oauth2.Token{
+		AccessToken:  "old-2",
+		RefreshToken: "rrr",
+		Expiry:       time.Now().Add(-time.Minute),
+	}, "valid@login.ok", nil)
+	us.On(
+		"UpdateOAuth2Token",
+		mock.Anything,
+		"valid@login.ok",
+		"xxx-provider",
+		mock.Anything).Return(nil)
+	locker.On(
+		"Lock",
+		mock.Anything,
+		"old-2").Return("", nil).Once()
+	locker.On(
+		"Unlock",
+		mock.Anything,
+		"old-2",
+		"xxx").Return(nil).Once()
+
+	w = httptest.NewRecorder()
+	r = testNewGetPermitted(t)
+	r.Header.Set(echo.HeaderAuthorization, "bearer old-2")
+	e.ServeHTTP(echo.NewResponse(w, e), r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("xxx", w.Header().Get("xxx-auth"))
+	locker.AssertExpectations(t)
+}
+
 func testNewGetUnprotected(t *testing.T) *http.Request {
 	r, err := http.NewRequest(echo.GET, "/unprotected", nil)
 	assert.NoError(t, err)
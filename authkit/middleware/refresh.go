@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pkg/errors"
+)
+
+// refreshGrace is a period, during which result of successful refresh is
+// kept and returned for requests with the same (superseded) access token,
+// which arrive after refresh is completed.
+const refreshGrace = 10 * time.Second
+
+// refreshTimeout limits duration of the refresh, which doesn't depend on
+// the request's context.
+const refreshTimeout = time.Minute
+
+var errRefreshAborted = errors.New("token refresh aborted")
+
+// refreshGroup coalesces concurrent refreshes of the same access token, so
+// that only one request refreshes token and others receive its result.
+type refreshGroup struct {
+	mu sync.Mutex
+
+	// access token -> refresh in progress or recently completed
+	calls map[string]*refreshCall
+
+	grace time.Duration
+}
+
+type refreshCall struct {
+	done  chan struct{}
+	token *oauth2.Token
+	err   error
+}
+
+func newRefreshGroup() *refreshGroup {
+	return &refreshGroup{
+		calls: make(map[string]*refreshCall),
+		grace: refreshGrace,
+	}
+}
+
+// do calls refresh, unless refresh of the same access token is in progress
+// or has been completed successfully less than grace period ago. In the
+// latter case it waits for result of that refresh (or until ctx is done).
+// Refresh should not depend on context of the request, which calls it,
+// because other requests wait for its result.
+func (g *refreshGroup) do(
+	ctx context.Context,
+	accessToken string,
+	refresh func() (*oauth2.Token, error)) (*oauth2.Token, error) {
+	g.mu.Lock()
+	if c, ok := g.calls[accessToken]; ok {
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.token, c.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c := &refreshCall{done: make(chan struct{}), err: errRefreshAborted}
+	g.calls[accessToken] = c
+	g.mu.Unlock()
+
+	// Waiters are released, even if refresh panics.
+	defer func() {
+		if c.err != nil || g.grace <= 0 {
+			g.forget(accessToken, c)
+		} else {
+			time.AfterFunc(g.grace, func() {
+				g.forget(accessToken, c)
+			})
+		}
+		close(c.done)
+	}()
+	c.token, c.err = refresh()
+	return c.token, c.err
+}
+
+// forget removes call c from the group, unless it has been replaced already.
+func (g *refreshGroup) forget(accessToken string, c *refreshCall) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.calls[accessToken] == c {
+		delete(g.calls, accessToken)
+	}
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshGroup(t *testing.T) {
+	assert := assert.New(t)
+	g := newRefreshGroup()
+	release := make(chan struct{})
+	var calls int32
+	refresh := func() (*oauth2.Token, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &oauth2.Token{AccessToken: "new"}, nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	tokens := make([]*oauth2.Token, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = g.do(context.Background(), "old", refresh)
+		}(i)
+	}
+	// Let all requests join the refresh in progress.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(int32(1), atomic.LoadInt32(&calls))
+	for _, tok := range tokens {
+		assert.Equal("new", tok.AccessToken)
+	}
+
+	// Completed refresh is reused by late requests during grace period.
+	tok, err := g.do(context.Background(), "old", refresh)
+	assert.NoError(err)
+	assert.Equal("new", tok.AccessToken)
+	assert.Equal(int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestRefreshGroupGrace(t *testing.T) {
+	assert := assert.New(t)
+	g := newRefreshGroup()
+	g.grace = 10 * time.Millisecond
+	var calls int32
+	refresh := func() (*oauth2.Token, error) {
+		atomic.AddInt32(&calls, 1)
+		return &oauth2.Token{AccessToken: "new"}, nil
+	}
+	_, err := g.do(context.Background(), "old", refresh)
+	assert.NoError(err)
+	_, err = g.do(context.Background(), "old", refresh)
+	assert.NoError(err)
+	assert.Equal(int32(1), atomic.LoadInt32(&calls))
+
+	// Result is forgotten after grace period.
+	time.Sleep(50 * time.Millisecond)
+	_, err = g.do(context.Background(), "old", refresh)
+	assert.NoError(err)
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	// Failed refresh is not reused.
+	fail := func() (*oauth2.Token, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errors.New("refresh failed")
+	}
+	_, err = g.do(context.Background(), "other", fail)
+	assert.Error(err)
+	_, err = g.do(context.Background(), "other", fail)
+	assert.Error(err)
+	assert.Equal(int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestRefreshGroupPanic(t *testing.T) {
+	assert := assert.New(t)
+	g := newRefreshGroup()
+	release := make(chan struct{})
+	go func() {
+		defer func() { recover() }()
+		g.do(context.Background(), "old", func() (*oauth2.Token, error) {
+			<-release
+			panic("refresh panicked")
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// Waiting request is released with error.
+	done := make(chan error)
+	go func() {
+		_, err := g.do(context.Background(), "old", func() (*oauth2.Token, error) {
+			t.Error("refresh should not be called")
+			return nil, nil
+		})
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	select {
+	case err := <-done:
+		assert.Equal(errRefreshAborted, err)
+	case <-time.After(time.Second):
+		t.Fatal("waiting request is not released")
+	}
+
+	// Next request refreshes token again.
+	tok, err := g.do(context.Background(), "old", func() (*oauth2.Token, error) {
+		return &oauth2.Token{AccessToken: "new"}, nil
+	})
+	assert.NoError(err)
+	assert.Equal("new", tok.AccessToken)
+}
+
+func TestRefreshGroupContext(t *testing.T) {
+	assert := assert.New(t)
+	g := newRefreshGroup()
+	release := make(chan struct{})
+	defer close(release)
+	go g.do(context.Background(), "old", func() (*oauth2.Token, error) {
+		<-release
+		return &oauth2.Token{AccessToken: "new"}, nil
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	// Waiting request may be canceled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := g.do(ctx, "old", func() (*oauth2.Token, error) {
+		t.Error("refresh should not be called")
+		return nil, nil
+	})
+	assert.Equal(context.Canceled, err)
+}
@@ -26,6 +26,16 @@ type (
 		// PrivateOAuth2Config used to access private provider via private network.
 		// So, URLs may be accessible only within DMZ, hence different config.
 		PrivateOAuth2Config OAuth2Config
+
+		// DisablePKCE disables PKCE (RFC 7636) in auth code URLs and code
+		// exchange for providers, which reject extra parameters.
+		DisablePKCE bool
+
+		// IDTokenVerifier enables OpenID Connect for the provider: nonce is
+		// added to auth code URLs, id_token is required in token response
+		// and is verified, its claims are passed to SocialProfileService,
+		// if it implements IDTokenProfileService. Optional.
+		IDTokenVerifier IDTokenVerifier
 	}
 
 	// OAuth2Config is an interface extracted from the "golang.org/x/oauth2".Config.
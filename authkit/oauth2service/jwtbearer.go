@@ -0,0 +1,148 @@
+package oauth2service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+const (
+	jwtBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+	defaultAssertionLifetime = time.Minute
+)
+
+// JWTBearerIssuer is a TokenIssuer, which obtains token for user with JWT
+// Bearer grant (RFC 7523). App signs an assertion with user's login as a
+// subject and exchanges it at the token endpoint. Authorization server
+// should be configured to trust the app's key.
+type JWTBearerIssuer struct {
+
+	// OAuth2Config provides client credentials, token URL and scopes.
+	// Client is authenticated with HTTP Basic, if ClientID is not empty.
+	// Required.
+	OAuth2Config *oauth2.Config
+
+	// SigningMethod and Key used to sign assertion. Required.
+	SigningMethod jwt.SigningMethod
+	Key           interface{}
+
+	// KeyID is put into "kid" header of assertion. Optional.
+	KeyID string
+
+	// Issuer of assertion. Optional. Default is OAuth2Config.ClientID.
+	Issuer string
+
+	// Audience of assertion. Optional. Default is token URL.
+	Audience string
+
+	// Lifetime of assertion. Optional. Default is one minute.
+	Lifetime time.Duration
+
+	// ContextCreator and ProviderID used to obtain context (and
+	// http.Client) for requests to the token endpoint. Optional.
+	ContextCreator authkit.ContextCreator
+	ProviderID     string
+}
+
+// IssueToken implements TokenIssuer.
+func (i JWTBearerIssuer) IssueToken(login string) (*oauth2.Token, error) {
+	conf := i.OAuth2Config
+	iss := i.Issuer
+	if iss == "" {
+		iss = conf.ClientID
+	}
+	aud := i.Audience
+	if aud == "" {
+		aud = conf.Endpoint.TokenURL
+	}
+	lifetime := i.Lifetime
+	if lifetime == 0 {
+		lifetime = defaultAssertionLifetime
+	}
+	now := time.Now()
+	claims := jwt.StandardClaims{
+		Issuer:    iss,
+		Subject:   login,
+		Audience:  aud,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(lifetime).Unix(),
+	}
+	token := jwt.NewWithClaims(i.SigningMethod, claims)
+	if i.KeyID != "" {
+		token.Header["kid"] = i.KeyID
+	}
+	assertion, err := token.SignedString(i.Key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	form := url.Values{
+		"grant_type": {jwtBearerGrantType},
+		"assertion":  {assertion},
+	}
+	if len(conf.Scopes) > 0 {
+		form.Set("scope", strings.Join(conf.Scopes, " "))
+	}
+	req, err := http.NewRequest(
+		http.MethodPost,
+		conf.Endpoint.TokenURL,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if conf.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(conf.ClientID), url.QueryEscape(conf.ClientSecret))
+	}
+
+	cc := i.ContextCreator
+	if cc == nil {
+		cc = authkit.DefaultContextCreator{}
+	}
+	ctx := cc.CreateContext(i.ProviderID)
+	resp, err := authkit.ContextHTTPClient(ctx).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Error response is JSON (RFC 6749, section 5.2), but proxies may
+		// respond with anything, so error code is reported on best-effort
+		// basis.
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return nil, errors.WithStack(errors.Errorf(
+			"Unexpected response status: %d, %s, %s",
+			resp.StatusCode,
+			resp.Status,
+			e.Error))
+	}
+	var raw map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	t := &oauth2.Token{}
+	t.AccessToken, _ = raw["access_token"].(string)
+	t.TokenType, _ = raw["token_type"].(string)
+	t.RefreshToken, _ = raw["refresh_token"].(string)
+	if e, ok := raw["expires_in"].(float64); ok && e > 0 {
+		t.Expiry = now.Add(time.Duration(e) * time.Second)
+	}
+	if t.AccessToken == "" {
+		return nil, errors.WithStack(errors.New("server response missing access_token"))
+	}
+	return t.WithExtra(raw), nil
+}
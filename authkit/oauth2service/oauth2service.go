@@ -0,0 +1,183 @@
+// Package oauth2service provides authkit.AuthService, built on standard
+// OAuth2 endpoints instead of vendor-specific API. Tokens are revoked via
+// Token Revocation endpoint (RFC 7009) and validated via Token
+// Introspection endpoint (RFC 7662, see introspection package). Tokens for
+// own web app are issued by configurable TokenIssuer (see JWTBearerIssuer
+// for standard implementation).
+//
+// Consent tokens are not defined by any standard. Authorization server,
+// which delegates login and consent to the app, should be supported by
+// ConsentTokenGenerator.
+package oauth2service
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/introspection"
+)
+
+type (
+
+	// TokenIssuer issues token of the authorization server for own web app
+	// in case of form-based login within app (see
+	// authkit.HandlerAuthService.IssueToken).
+	TokenIssuer interface {
+		IssueToken(login string) (*oauth2.Token, error)
+	}
+
+	// TokenIssuerFunc is an adapter to use function as TokenIssuer.
+	TokenIssuerFunc func(login string) (*oauth2.Token, error)
+
+	// ConsentTokenGenerator generates consent tokens for authorization
+	// server, which delegates login and consent to the app. See
+	// authkit.HandlerAuthService for description of methods.
+	ConsentTokenGenerator interface {
+		GenerateConsentToken(
+			subj string,
+			scopes []string,
+			challenge string) (string, error)
+		GenerateConsentTokenPriv(
+			subj string,
+			scopes []string,
+			clientID string) (string, error)
+	}
+)
+
+// IssueToken calls f(login).
+func (f TokenIssuerFunc) IssueToken(login string) (*oauth2.Token, error) {
+	return f(login)
+}
+
+// ErrNotSupported returned by consent methods, when ConsentTokenGenerator
+// is not configured.
+var ErrNotSupported = errors.New("not supported")
+
+// Config represents configuration for oauth2service.New().
+type Config struct {
+
+	// ClientID and ClientSecret are credentials of the app, used to
+	// authenticate to revocation and introspection endpoints (HTTP Basic).
+	// Required.
+	ClientID     string
+	ClientSecret string
+
+	// RevocationURL is a URL of the revocation endpoint. Required.
+	RevocationURL string
+
+	// IntrospectionURL is a URL of the introspection endpoint. Required.
+	IntrospectionURL string
+
+	// Audience expected in introspection response. Optional.
+	Audience string
+
+	// TokenIssuer used to issue tokens for own web app. Required.
+	TokenIssuer TokenIssuer
+
+	// ConsentTokenGenerator used to generate consent tokens. Optional.
+	ConsentTokenGenerator ConsentTokenGenerator
+
+	// ContextCreator and ProviderIDTrustedContext used to obtain context
+	// (and http.Client) for requests to revocation and introspection
+	// endpoints. Optional.
+	ContextCreator           authkit.ContextCreator
+	ProviderIDTrustedContext string
+}
+
+// Valid validates configuration.
+func (c Config) Valid() bool {
+	return c.ClientID != "" &&
+		c.RevocationURL != "" &&
+		c.IntrospectionURL != "" &&
+		c.TokenIssuer != nil
+}
+
+// New creates new AuthService, backed by standard OAuth2 endpoints.
+// Returned service also implements authkit.ExpiringTokenValidator.
+func New(c Config) authkit.AuthService {
+	if !c.Valid() {
+		panic("invalid argument")
+	}
+	if c.ContextCreator == nil {
+		c.ContextCreator = authkit.DefaultContextCreator{}
+	}
+	return &service{
+		c,
+		introspection.New(introspection.Config{
+			URL:            c.IntrospectionURL,
+			ClientID:       c.ClientID,
+			ClientSecret:   c.ClientSecret,
+			Audience:       c.Audience,
+			ContextCreator: c.ContextCreator,
+			ProviderID:     c.ProviderIDTrustedContext,
+		}),
+	}
+}
+
+type service struct {
+	Config
+	*introspection.Validator
+}
+
+func (s service) GenerateConsentToken(
+	subj string,
+	scopes []string,
+	challenge string) (string, error) {
+	if s.ConsentTokenGenerator == nil {
+		return "", errors.WithStack(ErrNotSupported)
+	}
+	return s.ConsentTokenGenerator.GenerateConsentToken(subj, scopes, challenge)
+}
+
+func (s service) GenerateConsentTokenPriv(
+	subj string,
+	scopes []string,
+	clientID string) (string, error) {
+	if s.ConsentTokenGenerator == nil {
+		return "", errors.WithStack(ErrNotSupported)
+	}
+	return s.ConsentTokenGenerator.GenerateConsentTokenPriv(subj, scopes, clientID)
+}
+
+func (s service) IssueToken(login string) (*oauth2.Token, error) {
+	return s.TokenIssuer.IssueToken(login)
+}
+
+// RevokeAccessToken revokes token according to RFC 7009. Token may be
+// either access or refresh token, so no token_type_hint is sent.
+// Server responds with 200 for invalid tokens as well, so that repeated
+// revocation is not an error.
+func (s service) RevokeAccessToken(accessToken string) error {
+	form := url.Values{
+		"token": {accessToken},
+	}
+	req, err := http.NewRequest(
+		http.MethodPost,
+		s.RevocationURL,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(s.ClientID), url.QueryEscape(s.ClientSecret))
+
+	ctx := s.ContextCreator.CreateContext(s.ProviderIDTrustedContext)
+	resp, err := authkit.ContextHTTPClient(ctx).Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.WithStack(errors.Errorf(
+			"Unexpected response status: %d, %s",
+			resp.StatusCode,
+			resp.Status))
+	}
+	return nil
+}
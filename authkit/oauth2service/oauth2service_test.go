@@ -0,0 +1,177 @@
+package oauth2service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/middleware"
+)
+
+var testKey = []byte("some-key")
+
+func testCreateServer(t *testing.T) *httptest.Server {
+	assert := assert.New(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/revoke", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		assert.Equal("client-id", id)
+		assert.Equal("client-secret", secret)
+		assert.Empty(r.PostFormValue("token_type_hint"))
+		if r.PostFormValue("token") == "unavailable" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	mux.HandleFunc("/introspect", func(w http.ResponseWriter, r *http.Request) {
+		resp := map[string]interface{}{"active": false}
+		if r.PostFormValue("token") == "access-token" {
+			resp = map[string]interface{}{
+				"active": true,
+				"sub":    "user@example.com",
+				"scope":  "api.get",
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, _, _ := r.BasicAuth()
+		assert.Equal("web-app", id)
+		assert.Equal(jwtBearerGrantType, r.PostFormValue("grant_type"))
+		assert.Equal("a b", r.PostFormValue("scope"))
+		claims := &jwt.StandardClaims{}
+		_, err := jwt.ParseWithClaims(
+			r.PostFormValue("assertion"),
+			claims,
+			func(t *jwt.Token) (interface{}, error) {
+				assert.Equal("key-1", t.Header["kid"])
+				return testKey, nil
+			})
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		assert.Equal("web-app", claims.Issuer)
+		assert.True(claims.VerifyAudience("http://"+r.Host+"/token", true))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "token-for-" + claims.Subject,
+			"token_type":    "bearer",
+			"refresh_token": "refresh-token",
+			"expires_in":    3600,
+		})
+	})
+	return httptest.NewServer(mux)
+}
+
+func testCreateService(url string) authkit.AuthService {
+	return New(Config{
+		ClientID:         "client-id",
+		ClientSecret:     "client-secret",
+		RevocationURL:    url + "/revoke",
+		IntrospectionURL: url + "/introspect",
+		TokenIssuer: JWTBearerIssuer{
+			OAuth2Config: &oauth2.Config{
+				ClientID:     "web-app",
+				ClientSecret: "web-app-secret",
+				Scopes:       []string{"a", "b"},
+				Endpoint:     oauth2.Endpoint{TokenURL: url + "/token"},
+			},
+			SigningMethod: jwt.SigningMethodHS256,
+			Key:           testKey,
+			KeyID:         "key-1",
+		},
+	})
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	assert := assert.New(t)
+	srv := testCreateServer(t)
+	defer srv.Close()
+	s := testCreateService(srv.URL)
+
+	assert.NoError(s.RevokeAccessToken("access-token"))
+	assert.Error(s.RevokeAccessToken("unavailable"))
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+	srv := testCreateServer(t)
+	defer srv.Close()
+	s := testCreateService(srv.URL)
+
+	perm := &middleware.DefaultPermission{Scopes: []string{"api.get"}}
+	subj, err := s.Validate("access-token", perm)
+	assert.NoError(err)
+	assert.Equal("user@example.com", subj)
+
+	_, err = s.Validate("other-token", perm)
+	assert.Error(err)
+
+	_, ok := s.(authkit.ExpiringTokenValidator)
+	assert.True(ok)
+}
+
+func TestIssueToken(t *testing.T) {
+	assert := assert.New(t)
+	srv := testCreateServer(t)
+	defer srv.Close()
+	s := testCreateService(srv.URL)
+
+	token, err := s.IssueToken("user@example.com")
+	assert.NoError(err)
+	assert.Equal("token-for-user@example.com", token.AccessToken)
+	assert.Equal("refresh-token", token.RefreshToken)
+	assert.WithinDuration(time.Now().Add(time.Hour), token.Expiry, time.Minute)
+}
+
+func TestIssueTokenRejected(t *testing.T) {
+	assert := assert.New(t)
+	srv := testCreateServer(t)
+	defer srv.Close()
+	i := testCreateService(srv.URL).(*service).TokenIssuer.(JWTBearerIssuer)
+	i.Key = []byte("wrong-key")
+
+	_, err := i.IssueToken("user@example.com")
+	assert.Error(err)
+}
+
+func TestIssueTokenProxyError(t *testing.T) {
+	assert := assert.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("<html>Bad Gateway</html>"))
+		}))
+	defer srv.Close()
+	i := testCreateService(srv.URL).(*service).TokenIssuer.(JWTBearerIssuer)
+
+	// Status is reported, even if body is not JSON.
+	_, err := i.IssueToken("user@example.com")
+	assert.Error(err)
+	assert.Contains(err.Error(), "502")
+}
+
+func TestConsentTokens(t *testing.T) {
+	assert := assert.New(t)
+	s := New(Config{
+		ClientID:         "client-id",
+		RevocationURL:    "http://foo.com/revoke",
+		IntrospectionURL: "http://foo.com/introspect",
+		TokenIssuer: TokenIssuerFunc(func(string) (*oauth2.Token, error) {
+			return nil, nil
+		}),
+	})
+	_, err := s.GenerateConsentToken("user", nil, "challenge")
+	assert.Equal(ErrNotSupported, errors.Cause(err))
+	_, err = s.GenerateConsentTokenPriv("user", nil, "client-id")
+	assert.Equal(ErrNotSupported, errors.Cause(err))
+}
@@ -0,0 +1,431 @@
+package oidc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+// DefaultRefreshInterval is a default interval between fetches of provider
+// metadata.
+const DefaultRefreshInterval = 24 * time.Hour
+
+// DefaultRetryInterval is a default interval between attempts to re-fetch
+// provider metadata after failure.
+const DefaultRetryInterval = time.Minute
+
+const discoveryPath = "/.well-known/openid-configuration"
+
+// DiscoveryConfig is a configuration of the Discovery.
+type DiscoveryConfig struct {
+
+	// Issuer is an issuer identifier of the provider (URL without
+	// "/.well-known/openid-configuration" suffix). Required.
+	Issuer string
+
+	// RefreshInterval is an interval, after which cached metadata is
+	// re-fetched. Default is DefaultRefreshInterval.
+	RefreshInterval time.Duration
+
+	// RetryInterval is an interval, after which failed re-fetch is
+	// retried (cached metadata is used meanwhile). Default is
+	// DefaultRetryInterval.
+	RetryInterval time.Duration
+
+	// HTTPClient used to fetch metadata and keys. Default is
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Metadata is a provider metadata from the discovery document (OpenID
+// Connect Discovery 1.0, section 3). Only fields used by authkit are
+// declared.
+type Metadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint,omitempty"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	RevocationEndpoint                string   `json:"revocation_endpoint,omitempty"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint,omitempty"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported,omitempty"`
+}
+
+// Discovery fetches and caches metadata of the provider. It is safe for
+// concurrent use.
+type Discovery struct {
+	c DiscoveryConfig
+
+	// for use by tests
+	now func() time.Time
+
+	mu    sync.Mutex
+	md    *Metadata
+	next  time.Time // time of the next fetch
+	fetch *discoveryFetch
+}
+
+// discoveryFetch is a fetch of metadata in progress. Concurrent callers
+// without cached metadata wait for it, instead of starting their own fetch.
+type discoveryFetch struct {
+	done chan struct{}
+	md   *Metadata
+	err  error
+}
+
+// NewDiscovery returns new Discovery. Metadata is fetched on first use.
+func NewDiscovery(c DiscoveryConfig) *Discovery {
+	if c.Issuer == "" {
+		panic("Issuer must be provided")
+	}
+	if c.RefreshInterval <= 0 {
+		c.RefreshInterval = DefaultRefreshInterval
+	}
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = DefaultRetryInterval
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = http.DefaultClient
+	}
+	return &Discovery{
+		c:   c,
+		now: time.Now,
+	}
+}
+
+// Metadata returns cached metadata, re-fetching it, if it is older than
+// RefreshInterval. Metadata is fetched by one caller at a time, other callers
+// get cached metadata meanwhile. If re-fetch fails, then previously fetched
+// metadata is returned, and re-fetch is retried after RetryInterval.
+func (d *Discovery) Metadata() (*Metadata, error) {
+	d.mu.Lock()
+	if d.md != nil && (d.fetch != nil || d.now().Before(d.next)) {
+		md := d.md
+		d.mu.Unlock()
+		return md, nil
+	}
+	if f := d.fetch; f != nil {
+		d.mu.Unlock()
+		<-f.done
+		return f.md, f.err
+	}
+	f := &discoveryFetch{done: make(chan struct{})}
+	d.fetch = f
+	d.mu.Unlock()
+
+	md, err := d.fetchMetadata()
+
+	d.mu.Lock()
+	switch {
+	case err == nil:
+		d.md = md
+		d.next = d.now().Add(d.c.RefreshInterval)
+		f.md = md
+	case d.md != nil:
+		// Remember attempt, to not retry on every call.
+		d.next = d.now().Add(d.c.RetryInterval)
+		f.md = d.md
+	default:
+		f.err = err
+	}
+	d.fetch = nil
+	d.mu.Unlock()
+	close(f.done)
+	return f.md, f.err
+}
+
+// ProviderConfig holds parameters of OAuth2Provider, which are not
+// discoverable.
+type ProviderConfig struct {
+	ID           string
+	Name         string
+	IconURL      string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+
+	// Scopes to request. Scope "openid" is added, if missing.
+	Scopes []string
+}
+
+// Provider returns OpenID Connect provider, configured from metadata.
+// Code flow (response type "code" and authorization_code grant) and
+// client_secret_basic or client_secret_post auth method should be
+// supported by the provider. PKCE is disabled, if provider advertises code
+// challenge methods without S256.
+// If provider doesn't support client_secret_basic, then OAuth2Config sends
+// client credentials in the body of token requests. It does it with its own
+// HTTP client, global registry of golang.org/x/oauth2 is not modified.
+// OAuth2Config and IDTokenVerifier of the provider are bound to d, they use
+// endpoints and keys of the current (refreshed) metadata. DisablePKCE is
+// determined once, by metadata at the moment of the call.
+func (d *Discovery) Provider(c ProviderConfig) (authkit.OAuth2Provider, error) {
+	md, err := d.Metadata()
+	if err != nil {
+		return authkit.OAuth2Provider{}, err
+	}
+	if !contains(c.Scopes, "openid") {
+		c.Scopes = append([]string{"openid"}, c.Scopes...)
+	}
+	return authkit.OAuth2Provider{
+		ID:           c.ID,
+		Name:         c.Name,
+		IconURL:      c.IconURL,
+		OAuth2Config: &discoveredConfig{d: d, c: c, md: md},
+		DisablePKCE: len(md.CodeChallengeMethodsSupported) > 0 &&
+			!contains(md.CodeChallengeMethodsSupported, "S256"),
+		IDTokenVerifier: &discoveredVerifier{d: d, clientID: c.ClientID, md: md},
+	}, nil
+}
+
+// current returns current metadata of d, or md, if metadata is not
+// available (which is not expected, once it has been fetched).
+func (d *Discovery) current(md *Metadata) *Metadata {
+	if m, err := d.Metadata(); err == nil {
+		return m
+	}
+	return md
+}
+
+// discoveredConfig is an authkit.OAuth2Config, which uses endpoints of the
+// current metadata of the Discovery.
+type discoveredConfig struct {
+	d  *Discovery
+	c  ProviderConfig
+	md *Metadata
+}
+
+func (c *discoveredConfig) config() *oauth2.Config {
+	return c.configFor(c.d.current(c.md))
+}
+
+func (c *discoveredConfig) configFor(md *Metadata) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.c.ClientID,
+		ClientSecret: c.c.ClientSecret,
+		Scopes:       c.c.Scopes,
+		RedirectURL:  c.c.RedirectURL,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  md.AuthorizationEndpoint,
+			TokenURL: md.TokenEndpoint,
+		},
+	}
+}
+
+// tokenContext returns config for the current metadata and context for
+// its token requests. If provider doesn't support client_secret_basic,
+// then HTTP client of the context is replaced with one, which moves
+// credentials to the body of token requests.
+func (c *discoveredConfig) tokenContext(
+	ctx context.Context) (*oauth2.Config, context.Context) {
+	md := c.d.current(c.md)
+	cfg := c.configFor(md)
+	// Default is client_secret_basic (Discovery 1.0, section 3).
+	methods := md.TokenEndpointAuthMethodsSupported
+	if len(methods) == 0 || contains(methods, "client_secret_basic") {
+		return cfg, ctx
+	}
+	client := authkit.ContextHTTPClient(ctx)
+	t := client.Transport
+	if t == nil {
+		t = http.DefaultTransport
+	}
+	pc := *client
+	pc.Transport = clientSecretPostTransport{
+		base:         t,
+		tokenURL:     md.TokenEndpoint,
+		clientID:     c.c.ClientID,
+		clientSecret: c.c.ClientSecret,
+	}
+	return cfg, context.WithValue(ctx, oauth2.HTTPClient, &pc)
+}
+
+func (c *discoveredConfig) TokenSource(
+	ctx context.Context,
+	t *oauth2.Token) oauth2.TokenSource {
+	cfg, ctx := c.tokenContext(ctx)
+	return cfg.TokenSource(ctx, t)
+}
+
+func (c *discoveredConfig) AuthCodeURL(
+	state string,
+	opts ...oauth2.AuthCodeOption) string {
+	return c.config().AuthCodeURL(state, opts...)
+}
+
+func (c *discoveredConfig) PasswordCredentialsToken(
+	ctx context.Context,
+	username, password string) (*oauth2.Token, error) {
+	cfg, ctx := c.tokenContext(ctx)
+	return cfg.PasswordCredentialsToken(ctx, username, password)
+}
+
+func (c *discoveredConfig) Exchange(
+	ctx context.Context,
+	code string) (*oauth2.Token, error) {
+	cfg, ctx := c.tokenContext(ctx)
+	return cfg.Exchange(ctx, code)
+}
+
+func (c *discoveredConfig) Client(
+	ctx context.Context,
+	t *oauth2.Token) *http.Client {
+	return oauth2.NewClient(ctx, c.TokenSource(ctx, t))
+}
+
+// clientSecretPostTransport moves client credentials from Authorization
+// header to the body of requests to the token endpoint
+// (client_secret_post auth method).
+type clientSecretPostTransport struct {
+	base         http.RoundTripper
+	tokenURL     string
+	clientID     string
+	clientSecret string
+}
+
+func (t clientSecretPostTransport) RoundTrip(
+	req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodPost ||
+		req.Body == nil ||
+		req.URL.String() != t.tokenURL ||
+		req.Header.Get("Authorization") == "" {
+		return t.base.RoundTrip(req)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	form.Set("client_id", t.clientID)
+	form.Set("client_secret", t.clientSecret)
+	body = []byte(form.Encode())
+	// RoundTripper should not modify request.
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Del("Authorization")
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return t.base.RoundTrip(r)
+}
+
+// discoveredVerifier is an authkit.IDTokenVerifier, which uses keys from
+// jwks_uri of the current metadata of the Discovery. Verifier (and its
+// cache of keys) is re-created, when jwks_uri changes.
+type discoveredVerifier struct {
+	d        *Discovery
+	clientID string
+
+	mu sync.Mutex
+	md *Metadata
+	v  *Verifier
+}
+
+func (v *discoveredVerifier) VerifyIDToken(
+	rawIDToken, nonce string) (authkit.IDTokenClaims, error) {
+	return v.verifier().VerifyIDToken(rawIDToken, nonce)
+}
+
+func (v *discoveredVerifier) verifier() *Verifier {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	md := v.d.current(v.md)
+	if v.v == nil || md.JWKSURI != v.md.JWKSURI {
+		v.md = md
+		v.v = NewVerifier(Config{
+			Issuer:     md.Issuer,
+			ClientID:   v.clientID,
+			JWKSURL:    md.JWKSURI,
+			HTTPClient: v.d.c.HTTPClient,
+		})
+	}
+	return v.v
+}
+
+func (d *Discovery) fetchMetadata() (*Metadata, error) {
+	u := strings.TrimSuffix(d.c.Issuer, "/") + discoveryPath
+	resp, err := d.c.HTTPClient.Get(u)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.WithStack(fmt.Errorf("fetch metadata: %s", resp.Status))
+	}
+	md := &Metadata{}
+	if err := json.NewDecoder(resp.Body).Decode(md); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := d.validate(md); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// validate checks that metadata belongs to the issuer and that provider
+// supports flow, used by authkit.
+func (d *Discovery) validate(md *Metadata) error {
+	// Issuer should match exactly (Discovery 1.0, section 4.3), otherwise
+	// id_tokens would not be accepted anyway.
+	if md.Issuer != d.c.Issuer {
+		return errors.WithStack(fmt.Errorf(
+			"issuer mismatch: expected %q, got %q",
+			d.c.Issuer,
+			md.Issuer))
+	}
+	if md.AuthorizationEndpoint == "" ||
+		md.TokenEndpoint == "" ||
+		md.JWKSURI == "" {
+		return errors.WithStack(errors.New("required endpoint is missing"))
+	}
+	if !contains(md.ResponseTypesSupported, "code") {
+		return errors.WithStack(errors.New("response type \"code\" is not supported"))
+	}
+	// Default is authorization_code and implicit (Discovery 1.0, section 3).
+	if len(md.GrantTypesSupported) > 0 &&
+		!contains(md.GrantTypesSupported, "authorization_code") {
+		return errors.WithStack(errors.New("grant type \"authorization_code\" is not supported"))
+	}
+	methods := md.TokenEndpointAuthMethodsSupported
+	if len(methods) > 0 &&
+		!contains(methods, "client_secret_basic") &&
+		!contains(methods, "client_secret_post") {
+		return errors.WithStack(fmt.Errorf(
+			"none of supported token endpoint auth methods %v is supported by authkit",
+			methods))
+	}
+	return nil
+}
+
+func contains(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,412 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/letsrock-today/authkit/authkit/jwks/jwkstest"
+)
+
+// testIssuer is a local OpenID Connect provider.
+type testIssuer struct {
+	*httptest.Server
+	keys *jwkstest.Server
+
+	mu       sync.Mutex
+	update   func(map[string]interface{})
+	status   int
+	fetches  int
+	tokenReq map[string]string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	s := &testIssuer{keys: jwkstest.NewServer()}
+	s.keys.AddKey(t, "k1")
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.fetches++
+		if s.status != 0 {
+			w.WriteHeader(s.status)
+			return
+		}
+		md := map[string]interface{}{
+			"issuer":                                s.URL,
+			"authorization_endpoint":                s.URL + "/auth",
+			"token_endpoint":                        s.URL + "/token",
+			"jwks_uri":                              s.keys.URL,
+			"response_types_supported":              []string{"code", "id_token"},
+			"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+			"token_endpoint_auth_methods_supported": []string{"client_secret_basic"},
+			"code_challenge_methods_supported":      []string{"plain", "S256"},
+		}
+		if s.update != nil {
+			s.update(md)
+		}
+		json.NewEncoder(w).Encode(md)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		s.mu.Lock()
+		s.tokenReq = map[string]string{
+			"basic_client_id":     id,
+			"basic_client_secret": secret,
+			"client_id":           r.PostFormValue("client_id"),
+			"client_secret":       r.PostFormValue("client_secret"),
+		}
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access-token",
+			"token_type":   "bearer",
+			"id_token": s.keys.Sign(t, "k1", jwt.MapClaims{
+				"iss":   s.URL,
+				"sub":   "12345",
+				"aud":   "client-id",
+				"exp":   time.Now().Add(time.Hour).Unix(),
+				"nonce": "nonce",
+			}),
+		})
+	})
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *testIssuer) Close() {
+	s.Server.Close()
+	s.keys.Close()
+}
+
+func (s *testIssuer) set(status int, update func(map[string]interface{})) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	s.update = update
+}
+
+func (s *testIssuer) tokenRequest() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokenReq
+}
+
+func (s *testIssuer) fetchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+func TestDiscoveryProvider(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	srv := newTestIssuer(t)
+	defer srv.Close()
+
+	d := NewDiscovery(DiscoveryConfig{Issuer: srv.URL})
+	p, err := d.Provider(ProviderConfig{
+		ID:           "local",
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		Scopes:       []string{"email"},
+	})
+	require.NoError(err)
+	assert.Equal("local", p.ID)
+	assert.False(p.DisablePKCE)
+	require.NotNil(p.IDTokenVerifier)
+
+	u := p.OAuth2Config.AuthCodeURL("state")
+	assert.Contains(u, srv.URL+"/auth?")
+	assert.Contains(u, "scope=openid+email")
+
+	// Code flow against the issuer with verification of id_token.
+	token, err := p.OAuth2Config.Exchange(context.Background(), "code")
+	require.NoError(err)
+	assert.Equal("client-id", srv.tokenRequest()["basic_client_id"])
+	assert.Equal("client-secret", srv.tokenRequest()["basic_client_secret"])
+	rawIDToken, _ := token.Extra("id_token").(string)
+	claims, err := p.IDTokenVerifier.VerifyIDToken(rawIDToken, "nonce")
+	require.NoError(err)
+	assert.Equal("12345", claims.String("sub"))
+}
+
+func TestDiscoveryProviderClientSecretPost(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	srv := newTestIssuer(t)
+	defer srv.Close()
+	srv.set(0, func(md map[string]interface{}) {
+		md["token_endpoint_auth_methods_supported"] = []string{"client_secret_post"}
+		md["code_challenge_methods_supported"] = []string{"plain"}
+	})
+
+	p, err := NewDiscovery(DiscoveryConfig{Issuer: srv.URL}).Provider(ProviderConfig{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+	})
+	require.NoError(err)
+	assert.True(p.DisablePKCE)
+
+	_, err = p.OAuth2Config.Exchange(context.Background(), "code")
+	require.NoError(err)
+	req := srv.tokenRequest()
+	assert.Empty(req["basic_client_id"])
+	assert.Equal("client-id", req["client_id"])
+	assert.Equal("client-secret", req["client_secret"])
+}
+
+func TestDiscoveryValidation(t *testing.T) {
+	cases := []struct {
+		name   string
+		update func(map[string]interface{})
+		valid  bool
+	}{
+		{
+			name: "defaults",
+			update: func(md map[string]interface{}) {
+				delete(md, "grant_types_supported")
+				delete(md, "token_endpoint_auth_methods_supported")
+				delete(md, "code_challenge_methods_supported")
+			},
+			valid: true,
+		},
+		{
+			name:   "issuer mismatch",
+			update: func(md map[string]interface{}) { md["issuer"] = "https://evil.example.com" },
+		},
+		{
+			name:   "no token endpoint",
+			update: func(md map[string]interface{}) { delete(md, "token_endpoint") },
+		},
+		{
+			name:   "no jwks_uri",
+			update: func(md map[string]interface{}) { delete(md, "jwks_uri") },
+		},
+		{
+			name: "code response type is not supported",
+			update: func(md map[string]interface{}) {
+				md["response_types_supported"] = []string{"id_token", "id_token token"}
+			},
+		},
+		{
+			name: "code grant is not supported",
+			update: func(md map[string]interface{}) {
+				md["grant_types_supported"] = []string{"implicit"}
+			},
+		},
+		{
+			name: "auth methods are not supported",
+			update: func(md map[string]interface{}) {
+				md["token_endpoint_auth_methods_supported"] = []string{"private_key_jwt"}
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+			srv := newTestIssuer(t)
+			defer srv.Close()
+			srv.set(0, c.update)
+
+			_, err := NewDiscovery(DiscoveryConfig{Issuer: srv.URL}).Metadata()
+			if c.valid {
+				assert.NoError(err)
+			} else {
+				assert.Error(err)
+			}
+		})
+	}
+}
+
+func TestDiscoveryRefresh(t *testing.T) {
+	assert := assert.New(t)
+	srv := newTestIssuer(t)
+	defer srv.Close()
+	now := time.Unix(1500000000, 0)
+
+	d := NewDiscovery(DiscoveryConfig{Issuer: srv.URL + "/"})
+	d.now = func() time.Time { return now }
+
+	// Trailing slash of issuer is not trimmed in comparison.
+	_, err := d.Metadata()
+	assert.Error(err)
+
+	d = NewDiscovery(DiscoveryConfig{
+		Issuer:          srv.URL,
+		RefreshInterval: time.Hour,
+		RetryInterval:   time.Minute,
+	})
+	d.now = func() time.Time { return now }
+	fetches := srv.fetchCount()
+
+	md, err := d.Metadata()
+	assert.NoError(err)
+	assert.Equal(srv.URL+"/token", md.TokenEndpoint)
+	_, err = d.Metadata()
+	assert.NoError(err)
+	assert.Equal(fetches+1, srv.fetchCount(), "metadata should be cached")
+
+	// Document changes and is re-fetched after refresh interval.
+	srv.set(0, func(md map[string]interface{}) {
+		md["token_endpoint"] = srv.URL + "/token2"
+	})
+	now = now.Add(time.Hour)
+	md, err = d.Metadata()
+	assert.NoError(err)
+	assert.Equal(srv.URL+"/token2", md.TokenEndpoint)
+	assert.Equal(fetches+2, srv.fetchCount())
+
+	// Stale document is used, when issuer is unavailable.
+	srv.set(http.StatusServiceUnavailable, nil)
+	now = now.Add(time.Hour)
+	md, err = d.Metadata()
+	assert.NoError(err)
+	assert.Equal(srv.URL+"/token2", md.TokenEndpoint)
+	assert.Equal(fetches+3, srv.fetchCount())
+
+	// Failed attempt is remembered, it is not repeated on every call.
+	md, err = d.Metadata()
+	assert.NoError(err)
+	assert.Equal(srv.URL+"/token2", md.TokenEndpoint)
+	assert.Equal(fetches+3, srv.fetchCount())
+
+	// Failed attempt is retried after retry interval.
+	now = now.Add(time.Minute)
+	_, err = d.Metadata()
+	assert.NoError(err)
+	assert.Equal(fetches+4, srv.fetchCount())
+
+	// Successful fetch is cached for refresh interval again.
+	srv.set(0, nil)
+	now = now.Add(time.Minute)
+	md, err = d.Metadata()
+	assert.NoError(err)
+	assert.Equal(srv.URL+"/token", md.TokenEndpoint)
+	assert.Equal(fetches+5, srv.fetchCount())
+	now = now.Add(time.Minute)
+	_, err = d.Metadata()
+	assert.NoError(err)
+	assert.Equal(fetches+5, srv.fetchCount())
+}
+
+func TestDiscoveryConcurrentFetch(t *testing.T) {
+	assert := assert.New(t)
+	srv := newTestIssuer(t)
+	defer srv.Close()
+	now := time.Unix(1500000000, 0)
+	var nowMu sync.Mutex
+
+	// Fetch is blocked, until release is closed.
+	release := make(chan struct{})
+	client := &http.Client{Transport: roundTripFunc(
+		func(r *http.Request) (*http.Response, error) {
+			<-release
+			return http.DefaultTransport.RoundTrip(r)
+		})}
+	d := NewDiscovery(DiscoveryConfig{
+		Issuer:          srv.URL,
+		RefreshInterval: time.Hour,
+		HTTPClient:      client,
+	})
+	d.now = func() time.Time {
+		nowMu.Lock()
+		defer nowMu.Unlock()
+		return now
+	}
+	fetches := srv.fetchCount()
+
+	// Callers without cached metadata wait for the single fetch.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			md, err := d.Metadata()
+			if assert.NoError(err) {
+				assert.Equal(srv.URL+"/token", md.TokenEndpoint)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(fetches+1, srv.fetchCount())
+
+	// Callers get cached metadata, while it is re-fetched.
+	release = make(chan struct{})
+	nowMu.Lock()
+	now = now.Add(time.Hour)
+	nowMu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := d.Metadata()
+		assert.NoError(err)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		md, err := d.Metadata()
+		if assert.NoError(err) {
+			assert.Equal(srv.URL+"/token", md.TokenEndpoint)
+		}
+	}
+	close(release)
+	<-done
+	assert.Equal(fetches+2, srv.fetchCount())
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestDiscoveryProviderRefresh(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	srv := newTestIssuer(t)
+	defer srv.Close()
+	keys := jwkstest.NewServer()
+	defer keys.Close()
+	keys.AddKey(t, "k2")
+	now := time.Unix(1500000000, 0)
+
+	d := NewDiscovery(DiscoveryConfig{Issuer: srv.URL, RefreshInterval: time.Hour})
+	d.now = func() time.Time { return now }
+	p, err := d.Provider(ProviderConfig{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+	})
+	require.NoError(err)
+	rawIDToken := keys.Sign(t, "k2", jwt.MapClaims{
+		"iss":   srv.URL,
+		"sub":   "12345",
+		"aud":   "client-id",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": "nonce",
+	})
+	_, err = p.IDTokenVerifier.VerifyIDToken(rawIDToken, "nonce")
+	assert.Error(err, "key is not published yet")
+
+	// Provider rotates endpoints and keys, provider follows refreshed
+	// metadata.
+	srv.set(0, func(md map[string]interface{}) {
+		md["authorization_endpoint"] = srv.URL + "/auth2"
+		md["jwks_uri"] = keys.URL
+	})
+	now = now.Add(time.Hour)
+	assert.Contains(p.OAuth2Config.AuthCodeURL("state"), srv.URL+"/auth2?")
+	claims, err := p.IDTokenVerifier.VerifyIDToken(rawIDToken, "nonce")
+	require.NoError(err)
+	assert.Equal("12345", claims.String("sub"))
+}
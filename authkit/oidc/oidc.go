@@ -0,0 +1,101 @@
+// Package oidc provides OpenID Connect support for external providers:
+// authkit.IDTokenVerifier, which verifies id_token with keys from the
+// provider's JWKS URL, and Discovery, which configures authkit.OAuth2Provider
+// from the provider's discovery document
+// (".well-known/openid-configuration").
+package oidc
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/jwks"
+	"github.com/letsrock-today/authkit/authkit/jwtclaims"
+)
+
+// Config is a configuration of the Verifier.
+type Config struct {
+
+	// Issuer is an issuer identifier of the provider, expected in "iss"
+	// claim. Required.
+	Issuer string
+
+	// ClientID of the app, expected in "aud" claim. Required.
+	ClientID string
+
+	// JWKSURL is a URL of JSON Web Key Set of the provider. Required.
+	JWKSURL string
+
+	// Leeway is an allowed clock skew for "exp" claim. Optional.
+	Leeway time.Duration
+
+	// HTTPClient used to fetch keys. Default is http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Verifier is an authkit.IDTokenVerifier.
+type Verifier struct {
+	c    Config
+	keys *jwks.KeySet
+
+	// for use by tests
+	now func() time.Time
+}
+
+// NewVerifier returns new Verifier.
+func NewVerifier(c Config) *Verifier {
+	if c.Issuer == "" || c.ClientID == "" || c.JWKSURL == "" {
+		panic("invalid argument")
+	}
+	return &Verifier{
+		c: c,
+		keys: jwks.New(jwks.Config{
+			URL:        c.JWKSURL,
+			HTTPClient: c.HTTPClient,
+		}),
+		now: time.Now,
+	}
+}
+
+// VerifyIDToken implements authkit.IDTokenVerifier. Verification follows
+// OpenID Connect Core 1.0, section 3.1.3.7.
+func (v *Verifier) VerifyIDToken(
+	rawIDToken, nonce string) (authkit.IDTokenClaims, error) {
+	claims := jwt.MapClaims{}
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	if _, err := parser.ParseWithClaims(rawIDToken, claims, v.keys.Keyfunc); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if iss, _ := claims["iss"].(string); iss != v.c.Issuer {
+		return nil, errors.WithStack(fmt.Errorf("invalid issuer %q", iss))
+	}
+	if !jwtclaims.HasAudience(claims["aud"], v.c.ClientID) {
+		return nil, errors.WithStack(errors.New("invalid audience"))
+	}
+	aud := jwtclaims.Audience(claims["aud"])
+	if azp, ok := claims["azp"].(string); (ok || len(aud) > 1) && azp != v.c.ClientID {
+		return nil, errors.WithStack(fmt.Errorf("invalid authorized party %q", azp))
+	}
+	exp, ok := jwtclaims.NumericDate(claims["exp"])
+	if !ok {
+		return nil, errors.WithStack(errors.New("token has no expiration time"))
+	}
+	if v.now().After(exp.Add(v.c.Leeway)) {
+		return nil, errors.WithStack(errors.New("token is expired"))
+	}
+	if nonce == "" {
+		return nil, errors.WithStack(errors.New("nonce is required"))
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, errors.WithStack(errors.New("invalid nonce"))
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.WithStack(errors.New("token has no subject"))
+	}
+	return authkit.IDTokenClaims(claims), nil
+}
@@ -0,0 +1,116 @@
+package oidc
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/letsrock-today/authkit/authkit/jwks/jwkstest"
+)
+
+func TestVerifyIDToken(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	cases := []struct {
+		name   string
+		update func(jwt.MapClaims)
+		nonce  string
+		valid  bool
+	}{
+		{
+			name:  "valid",
+			nonce: "nonce",
+			valid: true,
+		},
+		{
+			name: "valid, several audiences",
+			update: func(c jwt.MapClaims) {
+				c["aud"] = []string{"client-id", "other"}
+				c["azp"] = "client-id"
+			},
+			nonce: "nonce",
+			valid: true,
+		},
+		{
+			name:   "several audiences without azp",
+			update: func(c jwt.MapClaims) { c["aud"] = []string{"client-id", "other"} },
+			nonce:  "nonce",
+		},
+		{
+			name:   "wrong azp",
+			update: func(c jwt.MapClaims) { c["azp"] = "other" },
+			nonce:  "nonce",
+		},
+		{
+			name:   "wrong issuer",
+			update: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+			nonce:  "nonce",
+		},
+		{
+			name:   "wrong audience",
+			update: func(c jwt.MapClaims) { c["aud"] = "other" },
+			nonce:  "nonce",
+		},
+		{
+			name:   "expired",
+			update: func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Second).Unix() },
+			nonce:  "nonce",
+		},
+		{
+			name:  "wrong nonce",
+			nonce: "other",
+		},
+		{
+			name:   "no nonce in token",
+			update: func(c jwt.MapClaims) { delete(c, "nonce") },
+			nonce:  "nonce",
+		},
+		{
+			name:   "no expected nonce",
+			update: func(c jwt.MapClaims) { delete(c, "nonce") },
+		},
+		{
+			name:   "no subject",
+			update: func(c jwt.MapClaims) { delete(c, "sub") },
+			nonce:  "nonce",
+		},
+	}
+
+	srv := jwkstest.NewServer()
+	defer srv.Close()
+	srv.AddKey(t, "k1")
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+			v := NewVerifier(Config{
+				Issuer:   "https://issuer.example.com",
+				ClientID: "client-id",
+				JWKSURL:  srv.URL,
+			})
+			v.now = func() time.Time { return now }
+			claims := jwt.MapClaims{
+				"iss":   "https://issuer.example.com",
+				"sub":   "12345",
+				"aud":   "client-id",
+				"exp":   now.Add(time.Hour).Unix(),
+				"iat":   now.Unix(),
+				"nonce": "nonce",
+				"email": "user@example.com",
+			}
+			if c.update != nil {
+				c.update(claims)
+			}
+			r, err := v.VerifyIDToken(srv.Sign(t, "k1", claims), c.nonce)
+			if !c.valid {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal("12345", r.String("sub"))
+			assert.Equal("user@example.com", r.String("email"))
+		})
+	}
+}
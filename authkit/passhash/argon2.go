@@ -0,0 +1,113 @@
+package passhash
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2idParams are parameters of the argon2id algorithm.
+type Argon2idParams struct {
+	Time    uint32 // number of passes
+	Memory  uint32 // memory in KiB
+	Threads uint8  // degree of parallelism
+}
+
+// DefaultArgon2idParams follow the OWASP recommendation.
+var DefaultArgon2idParams = Argon2idParams{
+	Time:    2,
+	Memory:  19 * 1024,
+	Threads: 1,
+}
+
+const argon2idID = "argon2id"
+
+// NewArgon2id returns Encoder, which uses argon2id with provided parameters.
+func NewArgon2id(params Argon2idParams) Encoder {
+	return argon2idEncoder(params)
+}
+
+type argon2idEncoder Argon2idParams
+
+func (e argon2idEncoder) Hash(password string) (string, error) {
+	s, err := salt()
+	if err != nil {
+		return "", err
+	}
+	return e.encode(password, s).String(), nil
+}
+
+func (e argon2idEncoder) encode(password string, salt []byte) phc {
+	return phc{
+		id:      argon2idID,
+		version: strconv.Itoa(argon2.Version),
+		params: map[string]string{
+			"m": strconv.FormatUint(uint64(e.Memory), 10),
+			"t": strconv.FormatUint(uint64(e.Time), 10),
+			"p": strconv.FormatUint(uint64(e.Threads), 10),
+		},
+		salt: salt,
+		key: argon2.IDKey(
+			[]byte(password),
+			salt,
+			e.Time,
+			e.Memory,
+			e.Threads,
+			keyLen),
+	}
+}
+
+func (e argon2idEncoder) Recognizes(encoded string) bool {
+	return phcID(encoded) == argon2idID
+}
+
+func (e argon2idEncoder) Verify(password, encoded string) (bool, error) {
+	p, params, err := e.parse(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey(
+		[]byte(password),
+		p.salt,
+		params.Time,
+		params.Memory,
+		params.Threads,
+		uint32(len(p.key)))
+	return equal(key, p.key), nil
+}
+
+func (e argon2idEncoder) NeedsRehash(encoded string) bool {
+	p, params, err := e.parse(encoded)
+	return err != nil ||
+		params != Argon2idParams(e) ||
+		len(p.salt) != saltLen ||
+		len(p.key) != keyLen
+}
+
+func (e argon2idEncoder) parse(encoded string) (phc, Argon2idParams, error) {
+	p, err := parsePHC(encoded)
+	if err != nil {
+		return phc{}, Argon2idParams{}, err
+	}
+	if p.id != argon2idID || p.version != strconv.Itoa(argon2.Version) {
+		return phc{}, Argon2idParams{}, errors.WithStack(ErrUnknownFormat)
+	}
+	m, err := p.intParam("m")
+	if err != nil {
+		return phc{}, Argon2idParams{}, err
+	}
+	t, err := p.intParam("t")
+	if err != nil {
+		return phc{}, Argon2idParams{}, err
+	}
+	threads, err := p.intParam("p")
+	if err != nil || threads > 255 {
+		return phc{}, Argon2idParams{}, errors.WithStack(ErrUnknownFormat)
+	}
+	return p, Argon2idParams{
+		Time:    uint32(t),
+		Memory:  uint32(m),
+		Threads: uint8(threads),
+	}, nil
+}
@@ -0,0 +1,49 @@
+package passhash
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultBcryptCost is a default cost of the bcrypt algorithm.
+const DefaultBcryptCost = 12
+
+// NewBcrypt returns Encoder, which uses bcrypt with provided cost.
+// Note, that bcrypt uses only first 72 bytes of the password.
+func NewBcrypt(cost int) Encoder {
+	return bcryptEncoder(cost)
+}
+
+type bcryptEncoder int
+
+func (e bcryptEncoder) Hash(password string) (string, error) {
+	h, err := bcrypt.GenerateFromPassword([]byte(password), int(e))
+	return string(h), errors.WithStack(err)
+}
+
+func (e bcryptEncoder) Recognizes(encoded string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(encoded, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e bcryptEncoder) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	switch err {
+	case nil:
+		return true, nil
+	case bcrypt.ErrMismatchedHashAndPassword:
+		return false, nil
+	}
+	return false, errors.Wrap(ErrUnknownFormat, err.Error())
+}
+
+func (e bcryptEncoder) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != int(e)
+}
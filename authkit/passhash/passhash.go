@@ -0,0 +1,121 @@
+// Package passhash provides password hashing for authkit.UserStore
+// implementations. All supported algorithms (bcrypt, scrypt, argon2id and
+// PBKDF2) produce self-describing hashes, which contain algorithm, parameters
+// and salt, so that hashes created with different algorithms or parameters
+// may be kept in the same store.
+//
+// Hashes (except bcrypt, which has its own well-known format) use the PHC
+// string format:
+//
+//	$<id>[$v=<version>]$<param>=<value>(,<param>=<value>)*$<salt>$<hash>
+//
+// where salt and hash are encoded with unpadded standard base64.
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+
+	"github.com/pkg/errors"
+)
+
+type (
+
+	// Encoder implements single hashing algorithm with fixed parameters.
+	Encoder interface {
+
+		// Hash returns self-describing hash of the password.
+		Hash(password string) (string, error)
+
+		// Recognizes returns true if encoded hash is produced by the same
+		// algorithm (parameters may differ).
+		Recognizes(encoded string) bool
+
+		// Verify checks password against encoded hash, produced by the same
+		// algorithm. Parameters are taken from the encoded hash.
+		Verify(password, encoded string) (bool, error)
+
+		// NeedsRehash returns true if encoded hash was produced with
+		// parameters, different from the encoder's ones.
+		NeedsRehash(encoded string) bool
+	}
+
+	// Hasher hashes passwords according to the current policy and verifies
+	// them against hashes produced by any known algorithm.
+	Hasher interface {
+
+		// Hash returns self-describing hash of the password, produced with
+		// the current policy.
+		Hash(password string) (string, error)
+
+		// Verify checks password against encoded hash. If password matches,
+		// but hash doesn't conform to the current policy, then rehash is true,
+		// and caller should replace stored hash with a new one, returned by
+		// Hash.
+		Verify(password, encoded string) (ok, rehash bool, err error)
+	}
+
+	hasher struct {
+		current Encoder
+		legacy  []Encoder
+	}
+)
+
+// ErrUnknownFormat returned when encoded hash is not recognized by any of
+// configured encoders.
+var ErrUnknownFormat = errors.New("unknown password hash format")
+
+// New returns Hasher, which hashes passwords with current encoder.
+// Legacy encoders are used only to verify existing hashes.
+func New(current Encoder, legacy ...Encoder) Hasher {
+	return hasher{current, legacy}
+}
+
+// Default returns Hasher, which uses argon2id with default parameters and
+// recognizes hashes of all other supported algorithms.
+func Default() Hasher {
+	return New(
+		NewArgon2id(DefaultArgon2idParams),
+		NewBcrypt(DefaultBcryptCost),
+		NewScrypt(DefaultScryptParams),
+		NewPBKDF2(DefaultPBKDF2Iterations))
+}
+
+func (h hasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h hasher) Verify(password, encoded string) (bool, bool, error) {
+	if h.current.Recognizes(encoded) {
+		ok, err := h.current.Verify(password, encoded)
+		if !ok || err != nil {
+			return false, false, err
+		}
+		return true, h.current.NeedsRehash(encoded), nil
+	}
+	for _, e := range h.legacy {
+		if e.Recognizes(encoded) {
+			ok, err := e.Verify(password, encoded)
+			if !ok || err != nil {
+				return false, false, err
+			}
+			return true, true, nil
+		}
+	}
+	return false, false, errors.WithStack(ErrUnknownFormat)
+}
+
+const (
+	saltLen = 16
+	keyLen  = 32
+)
+
+func salt() ([]byte, error) {
+	b := make([]byte, saltLen)
+	_, err := rand.Read(b)
+	return b, errors.WithStack(err)
+}
+
+func equal(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
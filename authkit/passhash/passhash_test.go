@@ -0,0 +1,178 @@
+package passhash
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Cheap parameters, used to keep tests fast.
+var (
+	testArgon2id = NewArgon2id(Argon2idParams{Time: 1, Memory: 64, Threads: 1})
+	testBcrypt   = NewBcrypt(4)
+	testScrypt   = NewScrypt(ScryptParams{LogN: 4, R: 8, P: 1})
+	testPBKDF2   = NewPBKDF2(1000)
+)
+
+func TestEncoders(t *testing.T) {
+	encoders := map[string]Encoder{
+		"argon2id": testArgon2id,
+		"bcrypt":   testBcrypt,
+		"scrypt":   testScrypt,
+		"pbkdf2":   testPBKDF2,
+	}
+	for name, e := range encoders {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			h, err := e.Hash("secret")
+			require.NoError(t, err)
+			assert.True(strings.HasPrefix(h, "$"))
+			assert.True(e.Recognizes(h))
+			assert.False(e.NeedsRehash(h))
+
+			ok, err := e.Verify("secret", h)
+			assert.NoError(err)
+			assert.True(ok)
+			ok, err = e.Verify("invalid", h)
+			assert.NoError(err)
+			assert.False(ok)
+
+			// Salt is random.
+			h2, err := e.Hash("secret")
+			require.NoError(t, err)
+			assert.NotEqual(h, h2)
+
+			for other, oe := range encoders {
+				if other != name {
+					assert.False(oe.Recognizes(h), other)
+				}
+			}
+		})
+	}
+}
+
+func TestReferenceHashes(t *testing.T) {
+	assert := assert.New(t)
+	// Produced with Python hashlib.
+	ok, err := testScrypt.Verify(
+		"secret",
+		"$scrypt$ln=4,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$gEeb/KeWbm5g+kBQOFr1yJbkjBxxxDOkhSmrSXFFwOg")
+	assert.NoError(err)
+	assert.True(ok)
+	ok, err = testPBKDF2.Verify(
+		"secret",
+		"$pbkdf2-sha256$i=1000$MDEyMzQ1Njc4OWFiY2RlZg$tiKWHy4FAGCWE8gn6GtKhaxD2OeeAUUWXFT/p1aaNl8")
+	assert.NoError(err)
+	assert.True(ok)
+}
+
+func TestShortSaltOrKey(t *testing.T) {
+	cases := []struct {
+		e       Encoder
+		encoded string
+	}{
+		{testPBKDF2, "$pbkdf2-sha256$i=1000$MDEyMzQ1Njc4OWFiY2RlZg$"},
+		{testPBKDF2, "$pbkdf2-sha256$i=1000$MDEyMzQ1Njc4OWFiY2RlZg$tiKWHy4F"},
+		{testPBKDF2, "$pbkdf2-sha256$i=1000$$tiKWHy4FAGCWE8gn6GtKhaxD2OeeAUUWXFT/p1aaNl8"},
+		{testScrypt, "$scrypt$ln=4,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$"},
+		{testArgon2id, "$argon2id$v=19$m=64,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$"},
+	}
+	for _, c := range cases {
+		ok, err := c.e.Verify("secret", c.encoded)
+		assert.Error(t, err, c.encoded)
+		assert.False(t, ok, c.encoded)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	assert := assert.New(t)
+	h, err := testArgon2id.Hash("secret")
+	require.NoError(t, err)
+	assert.True(NewArgon2id(Argon2idParams{Time: 2, Memory: 64, Threads: 1}).NeedsRehash(h))
+
+	h, err = testBcrypt.Hash("secret")
+	require.NoError(t, err)
+	assert.True(NewBcrypt(5).NeedsRehash(h))
+
+	h, err = testScrypt.Hash("secret")
+	require.NoError(t, err)
+	assert.True(NewScrypt(ScryptParams{LogN: 5, R: 8, P: 1}).NeedsRehash(h))
+
+	h, err = testPBKDF2.Hash("secret")
+	require.NoError(t, err)
+	assert.True(NewPBKDF2(2000).NeedsRehash(h))
+}
+
+func TestHasher(t *testing.T) {
+	assert := assert.New(t)
+	h := New(testArgon2id, testBcrypt, testScrypt, testPBKDF2)
+
+	current, err := h.Hash("secret")
+	require.NoError(t, err)
+	assert.True(testArgon2id.Recognizes(current))
+	ok, rehash, err := h.Verify("secret", current)
+	assert.NoError(err)
+	assert.True(ok)
+	assert.False(rehash)
+	ok, rehash, err = h.Verify("invalid", current)
+	assert.NoError(err)
+	assert.False(ok)
+	assert.False(rehash)
+
+	// Hashes of legacy encoders are verified and upgraded.
+	for _, e := range []Encoder{testBcrypt, testScrypt, testPBKDF2} {
+		legacy, err := e.Hash("secret")
+		require.NoError(t, err)
+		ok, rehash, err = h.Verify("secret", legacy)
+		assert.NoError(err)
+		assert.True(ok)
+		assert.True(rehash)
+		ok, rehash, err = h.Verify("invalid", legacy)
+		assert.NoError(err)
+		assert.False(ok)
+		assert.False(rehash)
+	}
+
+	// Current algorithm with outdated parameters.
+	old, err := NewArgon2id(Argon2idParams{Time: 2, Memory: 64, Threads: 1}).Hash("secret")
+	require.NoError(t, err)
+	ok, rehash, err = h.Verify("secret", old)
+	assert.NoError(err)
+	assert.True(ok)
+	assert.True(rehash)
+
+	for _, invalid := range []string{
+		"",
+		"5ebe2294ecd0e0f08eab7690d2a6ee69",
+		"$unknown$i=1$c2FsdA$a2V5",
+		"$pbkdf2-sha256$i=x$c2FsdA$a2V5",
+		"$pbkdf2-sha256$i=1$!!!$a2V5",
+		"$argon2id$v=19$m=64,t=1$c2FsdA$a2V5",
+	} {
+		ok, _, err = h.Verify("secret", invalid)
+		assert.False(ok, invalid)
+		assert.Equal(ErrUnknownFormat, errors.Cause(err), invalid)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	assert := assert.New(t)
+	h := Default()
+	legacy, err := testPBKDF2.Hash("secret")
+	require.NoError(t, err)
+	ok, rehash, err := h.Verify("secret", legacy)
+	assert.NoError(err)
+	assert.True(ok)
+	assert.True(rehash)
+
+	current, err := h.Hash("secret")
+	require.NoError(t, err)
+	assert.True(strings.HasPrefix(current, "$argon2id$v=19$m=19456,t=2,p=1$"))
+	ok, rehash, err = h.Verify("secret", current)
+	assert.NoError(err)
+	assert.True(ok)
+	assert.False(rehash)
+}
@@ -0,0 +1,71 @@
+package passhash
+
+import (
+	"crypto/sha256"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// DefaultPBKDF2Iterations follows the OWASP recommendation for
+// PBKDF2-HMAC-SHA256.
+const DefaultPBKDF2Iterations = 600000
+
+const pbkdf2ID = "pbkdf2-sha256"
+
+// NewPBKDF2 returns Encoder, which uses PBKDF2 with HMAC-SHA256 and provided
+// number of iterations.
+func NewPBKDF2(iterations int) Encoder {
+	return pbkdf2Encoder(iterations)
+}
+
+type pbkdf2Encoder int
+
+func (e pbkdf2Encoder) Hash(password string) (string, error) {
+	s, err := salt()
+	if err != nil {
+		return "", err
+	}
+	return phc{
+		id: pbkdf2ID,
+		params: map[string]string{
+			"i": strconv.Itoa(int(e)),
+		},
+		salt: s,
+		key:  pbkdf2.Key([]byte(password), s, int(e), keyLen, sha256.New),
+	}.String(), nil
+}
+
+func (e pbkdf2Encoder) Recognizes(encoded string) bool {
+	return phcID(encoded) == pbkdf2ID
+}
+
+func (e pbkdf2Encoder) Verify(password, encoded string) (bool, error) {
+	p, i, err := e.parse(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := pbkdf2.Key([]byte(password), p.salt, i, len(p.key), sha256.New)
+	return equal(key, p.key), nil
+}
+
+func (e pbkdf2Encoder) NeedsRehash(encoded string) bool {
+	p, i, err := e.parse(encoded)
+	return err != nil ||
+		i != int(e) ||
+		len(p.salt) != saltLen ||
+		len(p.key) != keyLen
+}
+
+func (e pbkdf2Encoder) parse(encoded string) (phc, int, error) {
+	p, err := parsePHC(encoded)
+	if err != nil {
+		return phc{}, 0, err
+	}
+	if p.id != pbkdf2ID {
+		return phc{}, 0, errors.WithStack(ErrUnknownFormat)
+	}
+	i, err := p.intParam("i")
+	return p, i, err
+}
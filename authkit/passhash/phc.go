@@ -0,0 +1,108 @@
+package passhash
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// phc is a parsed hash in the PHC string format.
+type phc struct {
+	id      string
+	version string
+	params  map[string]string
+	salt    []byte
+	key     []byte
+}
+
+func (p phc) String() string {
+	names := make([]string, 0, len(p.params))
+	for _, n := range phcParamOrder[p.id] {
+		if v, ok := p.params[n]; ok {
+			names = append(names, n+"="+v)
+		}
+	}
+	parts := []string{"", p.id}
+	if p.version != "" {
+		parts = append(parts, "v="+p.version)
+	}
+	parts = append(
+		parts,
+		strings.Join(names, ","),
+		b64.EncodeToString(p.salt),
+		b64.EncodeToString(p.key))
+	return strings.Join(parts, "$")
+}
+
+// phcParamOrder keeps order of parameters in the encoded hash.
+var phcParamOrder = map[string][]string{
+	argon2idID: {"m", "t", "p"},
+	scryptID:   {"ln", "r", "p"},
+	pbkdf2ID:   {"i"},
+}
+
+var b64 = base64.RawStdEncoding
+
+// Minimal lengths of salt and key, accepted by parsePHC.
+const (
+	minSaltLen = 16
+	minKeyLen  = 16
+)
+
+func phcID(encoded string) string {
+	if !strings.HasPrefix(encoded, "$") {
+		return ""
+	}
+	parts := strings.SplitN(encoded[1:], "$", 2)
+	return parts[0]
+}
+
+func parsePHC(encoded string) (phc, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) < 5 || parts[0] != "" {
+		return phc{}, errors.WithStack(ErrUnknownFormat)
+	}
+	p := phc{
+		id:     parts[1],
+		params: make(map[string]string),
+	}
+	parts = parts[2:]
+	if strings.HasPrefix(parts[0], "v=") {
+		p.version = strings.TrimPrefix(parts[0], "v=")
+		parts = parts[1:]
+	}
+	if len(parts) != 3 {
+		return phc{}, errors.WithStack(ErrUnknownFormat)
+	}
+	for _, kv := range strings.Split(parts[0], ",") {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			return phc{}, errors.WithStack(ErrUnknownFormat)
+		}
+		p.params[kv[:i]] = kv[i+1:]
+	}
+	var err error
+	if p.salt, err = b64.DecodeString(parts[1]); err != nil {
+		return phc{}, errors.Wrap(ErrUnknownFormat, err.Error())
+	}
+	if p.key, err = b64.DecodeString(parts[2]); err != nil {
+		return phc{}, errors.Wrap(ErrUnknownFormat, err.Error())
+	}
+	// Verify derives len(key) bytes, so empty or short key would match
+	// (almost) any password.
+	if len(p.salt) < minSaltLen || len(p.key) < minKeyLen {
+		return phc{}, errors.Wrap(ErrUnknownFormat, "salt or key is too short")
+	}
+	return p, nil
+}
+
+// intParam returns positive integer parameter.
+func (p phc) intParam(name string) (int, error) {
+	v, err := strconv.Atoi(p.params[name])
+	if err != nil || v <= 0 {
+		return 0, errors.Wrapf(ErrUnknownFormat, "invalid parameter %q", name)
+	}
+	return v, nil
+}
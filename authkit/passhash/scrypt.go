@@ -0,0 +1,105 @@
+package passhash
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ScryptParams are parameters of the scrypt algorithm.
+type ScryptParams struct {
+	LogN uint8 // log2 of the CPU/memory cost parameter N
+	R    int   // block size
+	P    int   // parallelization
+}
+
+// DefaultScryptParams follow the OWASP recommendation.
+var DefaultScryptParams = ScryptParams{
+	LogN: 17,
+	R:    8,
+	P:    1,
+}
+
+const scryptID = "scrypt"
+
+// NewScrypt returns Encoder, which uses scrypt with provided parameters.
+func NewScrypt(params ScryptParams) Encoder {
+	return scryptEncoder(params)
+}
+
+type scryptEncoder ScryptParams
+
+func (e scryptEncoder) Hash(password string) (string, error) {
+	s, err := salt()
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), s, 1<<e.LogN, e.R, e.P, keyLen)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return phc{
+		id: scryptID,
+		params: map[string]string{
+			"ln": strconv.Itoa(int(e.LogN)),
+			"r":  strconv.Itoa(e.R),
+			"p":  strconv.Itoa(e.P),
+		},
+		salt: s,
+		key:  key,
+	}.String(), nil
+}
+
+func (e scryptEncoder) Recognizes(encoded string) bool {
+	return phcID(encoded) == scryptID
+}
+
+func (e scryptEncoder) Verify(password, encoded string) (bool, error) {
+	p, params, err := e.parse(encoded)
+	if err != nil {
+		return false, err
+	}
+	key, err := scrypt.Key(
+		[]byte(password),
+		p.salt,
+		1<<params.LogN,
+		params.R,
+		params.P,
+		len(p.key))
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return equal(key, p.key), nil
+}
+
+func (e scryptEncoder) NeedsRehash(encoded string) bool {
+	p, params, err := e.parse(encoded)
+	return err != nil ||
+		params != ScryptParams(e) ||
+		len(p.salt) != saltLen ||
+		len(p.key) != keyLen
+}
+
+func (e scryptEncoder) parse(encoded string) (phc, ScryptParams, error) {
+	p, err := parsePHC(encoded)
+	if err != nil {
+		return phc{}, ScryptParams{}, err
+	}
+	if p.id != scryptID {
+		return phc{}, ScryptParams{}, errors.WithStack(ErrUnknownFormat)
+	}
+	ln, err := p.intParam("ln")
+	if err != nil || ln > 62 {
+		return phc{}, ScryptParams{}, errors.WithStack(ErrUnknownFormat)
+	}
+	r, err := p.intParam("r")
+	if err != nil {
+		return phc{}, ScryptParams{}, err
+	}
+	pp, err := p.intParam("p")
+	if err != nil {
+		return phc{}, ScryptParams{}, err
+	}
+	return p, ScryptParams{LogN: uint8(ln), R: r, P: pp}, nil
+}
@@ -1,6 +1,8 @@
 package persisttoken
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
 
 	"golang.org/x/net/context"
@@ -11,18 +13,20 @@ import (
 
 // WrapOAuth2Config wraps authkit.OAuth2Config or oauth2.Config with
 // logic for store/retrieve token from provided authkit.TokenStore.
+// If ts implements authkit.RefreshTokenFamilyStore, then rotated refresh
+// tokens are tracked (see TokenSource).
 func WrapOAuth2Config(
 	c authkit.OAuth2Config,
 	login, providerID string,
 	ts authkit.TokenStore,
 	checkRefreshable func(*oauth2.Token) error) authkit.OAuth2Config {
+	fs, _ := ts.(authkit.RefreshTokenFamilyStore)
 	return &config{
-		cfg:        c,
-		providerID: providerID,
-		ts:         ts,
-		prepare: func() (*oauth2.Token, string, error) {
-			t, err := ts.OAuth2Token(login, providerID)
-			return t, login, err
+		cfg: c,
+		fs:  fs,
+		prepare: func(ctx context.Context) (*oauth2.Token, slot, error) {
+			t, err := ts.OAuth2Token(ctx, login, providerID)
+			return t, tokenStoreSlot(ts, login, providerID), err
 		},
 		checkRefreshable: checkRefreshable,
 	}
@@ -31,29 +35,81 @@ func WrapOAuth2Config(
 // WrapOAuth2ConfigUseAccessToken wraps authkit.OAuth2Config or oauth2.Config
 // with logic for store/retrieve token from provided authkit.TokenStore.
 // It uses passed access token to find associated login and OAuth2 token.
+// If ts implements authkit.RefreshTokenFamilyStore, then rotated refresh
+// tokens are tracked (see TokenSource).
 func WrapOAuth2ConfigUseAccessToken(
 	c authkit.OAuth2Config,
 	accessToken, providerID string,
 	ts authkit.TokenStore,
 	checkRefreshable func(*oauth2.Token) error) authkit.OAuth2Config {
+	fs, _ := ts.(authkit.RefreshTokenFamilyStore)
 	return &config{
-		cfg:        c,
-		providerID: providerID,
-		ts:         ts,
-		prepare: func() (*oauth2.Token, string, error) {
-			return ts.OAuth2TokenAndLoginByAccessToken(
+		cfg: c,
+		fs:  fs,
+		prepare: func(ctx context.Context) (*oauth2.Token, slot, error) {
+			t, login, err := ts.OAuth2TokenAndLoginByAccessToken(
+				ctx,
 				accessToken,
 				providerID)
+			return t, tokenStoreSlot(ts, login, providerID), err
 		},
 		checkRefreshable: checkRefreshable,
 	}
 }
 
+// WrapOAuth2ConfigUseSession wraps authkit.OAuth2Config or oauth2.Config
+// with logic for store/retrieve token from provided authkit.SessionStore.
+// It uses passed access token to find session, refreshed token replaces
+// token of the same session.
+// If ss implements authkit.RefreshTokenFamilyStore, then rotated refresh
+// tokens are tracked (see TokenSource).
+func WrapOAuth2ConfigUseSession(
+	c authkit.OAuth2Config,
+	accessToken string,
+	ss authkit.SessionStore,
+	checkRefreshable func(*oauth2.Token) error) authkit.OAuth2Config {
+	fs, _ := ss.(authkit.RefreshTokenFamilyStore)
+	return &config{
+		cfg: c,
+		fs:  fs,
+		prepare: func(ctx context.Context) (*oauth2.Token, slot, error) {
+			s, t, err := ss.SessionByAccessToken(ctx, accessToken)
+			return t, slot{
+				update: func(ctx context.Context, t *oauth2.Token) error {
+					return ss.UpdateSessionToken(ctx, s.ID, t)
+				},
+				remove: func(ctx context.Context) error {
+					return ss.DeleteSession(ctx, s.Login, s.ID)
+				},
+			}, err
+		},
+		checkRefreshable: checkRefreshable,
+	}
+}
+
+// slot is a place in the store, where token has been found. Refreshed token
+// is saved to the same place. Token is removed, when its refresh token
+// family is revoked.
+type slot struct {
+	update func(context.Context, *oauth2.Token) error
+	remove func(context.Context) error
+}
+
+func tokenStoreSlot(ts authkit.TokenStore, login, providerID string) slot {
+	return slot{
+		update: func(ctx context.Context, t *oauth2.Token) error {
+			return ts.UpdateOAuth2Token(ctx, login, providerID, t)
+		},
+		remove: func(ctx context.Context) error {
+			return ts.UpdateOAuth2Token(ctx, login, providerID, nil)
+		},
+	}
+}
+
 type config struct {
 	cfg              authkit.OAuth2Config
-	providerID       string
-	ts               authkit.TokenStore
-	prepare          func() (*oauth2.Token, string, error)
+	fs               authkit.RefreshTokenFamilyStore
+	prepare          func(context.Context) (*oauth2.Token, slot, error)
 	checkRefreshable func(*oauth2.Token) error
 }
 
@@ -63,15 +119,28 @@ func (c *config) Client(
 	return oauth2.NewClient(ctx, c.TokenSource(ctx, t))
 }
 
+// TokenSource returns token source, which retrieves token from the store
+// and saves refreshed token back.
+//
+// If the store implements authkit.RefreshTokenFamilyStore, then refresh
+// token is claimed in the store before it is exchanged, and rotation is
+// recorded after exchange (if authorization server rotates refresh tokens).
+// If refresh token is claimed by another caller at the moment, Token()
+// returns authkit.RefreshTokenClaimedError. If refresh token has been
+// refreshed by another caller already, Token() returns token from the
+// store. When superseded refresh token is used again (stale copy of token
+// is found in the store), the whole family is revoked in the store, token
+// is removed from the store and Token() returns
+// authkit.RefreshTokenReusedError. Note, that tokens are not revoked at the
+// authorization server.
 func (c *config) TokenSource(
 	ctx context.Context,
 	t *oauth2.Token) oauth2.TokenSource {
 	return oauth2.ReuseTokenSource(
 		t,
 		persistTokenSource{
-			providerID:       c.providerID,
-			ts:               c.ts,
 			cfg:              c.cfg,
+			fs:               c.fs,
 			ctx:              ctx,
 			prepare:          c.prepare,
 			checkRefreshable: c.checkRefreshable,
@@ -97,25 +166,39 @@ func (c *config) Exchange(
 }
 
 type persistTokenSource struct {
-	providerID       string
-	ts               authkit.TokenStore
 	cfg              authkit.OAuth2Config
+	fs               authkit.RefreshTokenFamilyStore
 	ctx              context.Context
-	prepare          func() (*oauth2.Token, string, error)
+	prepare          func(context.Context) (*oauth2.Token, slot, error)
 	checkRefreshable func(*oauth2.Token) error
 }
 
+// Token retrieves token from the store and refreshes it, if required.
+// Context, passed to TokenSource, is used for calls to the store as well.
 func (p persistTokenSource) Token() (*oauth2.Token, error) {
-	t, login, err := p.prepare()
+	t, s, err := p.prepare(p.ctx)
 	if err != nil {
 		return nil, err
 	}
+	claimed, err := p.claim(t, s)
+	if err != nil || claimed != t {
+		return claimed, err
+	}
 	new, err := p.cfg.TokenSource(p.ctx, t).Token()
 	if err != nil {
+		p.release(t)
 		return nil, err
 	}
 	if new != t {
-		if err := p.ts.UpdateOAuth2Token(login, p.providerID, new); err != nil {
+		// Token is saved before rotation is recorded, so that other
+		// callers, which find refresh token superseded, find new token in
+		// the store (see reused).
+		if err := s.update(p.ctx, new); err != nil {
+			p.release(t)
+			return nil, err
+		}
+		if err := p.rotate(t, new); err != nil {
+			p.rotateFailed(t, s, err)
 			return nil, err
 		}
 		// Still refresh token for server's internal use, but return error to
@@ -126,6 +209,115 @@ func (p persistTokenSource) Token() (*oauth2.Token, error) {
 				return nil, err
 			}
 		}
+	} else {
+		p.release(t)
 	}
 	return new, nil
 }
+
+// tracked checks whether refresh of the token is tracked in the family
+// store. Token is refreshed only if it is not valid.
+func (p persistTokenSource) tracked(t *oauth2.Token) bool {
+	return p.fs != nil && t != nil && t.RefreshToken != "" && !t.Valid()
+}
+
+// claim claims refresh token of t before it is exchanged (if family store is
+// provided). It returns t, if caller should exchange it, or token, refreshed
+// by another caller.
+func (p persistTokenSource) claim(t *oauth2.Token, s slot) (*oauth2.Token, error) {
+	if !p.tracked(t) {
+		return t, nil
+	}
+	err := p.fs.ClaimRefreshToken(p.ctx, hash(t.RefreshToken))
+	if authkit.IsRefreshTokenReused(err) {
+		return p.reused(t, s, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// reused handles superseded refresh token. Token is saved before its
+// predecessor is superseded, so if the store still keeps old token, then it
+// is a stale copy, and the whole family is revoked and token is removed
+// from the store. Otherwise token has been refreshed by another caller
+// (possibly, another instance of the application) and new token is
+// returned.
+func (p persistTokenSource) reused(
+	old *oauth2.Token,
+	s slot,
+	reuseErr error) (*oauth2.Token, error) {
+	t, _, err := p.prepare(p.ctx)
+	if err != nil {
+		// Token is looked up by access token, which has been replaced.
+		return nil, err
+	}
+	if t == nil {
+		// Token has been removed already (family has been revoked by
+		// another caller).
+		return nil, reuseErr
+	}
+	if t.RefreshToken != old.RefreshToken {
+		return t, nil
+	}
+	if err := p.fs.RevokeRefreshTokenFamily(
+		p.ctx,
+		hash(old.RefreshToken)); err != nil {
+		return nil, err
+	}
+	if err := s.remove(p.ctx); err != nil {
+		return nil, err
+	}
+	return nil, reuseErr
+}
+
+// release cancels claim of refresh token of t, which hasn't been rotated.
+// Error is ignored, claim expires anyway.
+func (p persistTokenSource) release(t *oauth2.Token) {
+	if p.tracked(t) {
+		p.fs.ReleaseRefreshToken(p.ctx, hash(t.RefreshToken))
+	}
+}
+
+// rotate records rotation of the claimed refresh token.
+func (p persistTokenSource) rotate(old, new *oauth2.Token) error {
+	if !p.tracked(old) {
+		return nil
+	}
+	if new.RefreshToken == "" || old.RefreshToken == new.RefreshToken {
+		// Authorization server doesn't rotate refresh tokens.
+		p.release(old)
+		return nil
+	}
+	return p.fs.RotateRefreshToken(
+		p.ctx,
+		hash(old.RefreshToken),
+		hash(new.RefreshToken))
+}
+
+// rotateFailed resolves claim of refresh token of old, when new token has
+// been saved, but its rotation hasn't been recorded. If old token has been
+// superseded or its family has been revoked meanwhile, then family is
+// revoked and token is removed from the store, like in reused. Otherwise
+// claim is released, so that it doesn't block the token until it expires.
+// Errors are ignored, caller returns error of rotation anyway.
+func (p persistTokenSource) rotateFailed(
+	old *oauth2.Token,
+	s slot,
+	err error) {
+	if !authkit.IsRefreshTokenReused(err) {
+		p.release(old)
+		return
+	}
+	if p.fs.RevokeRefreshTokenFamily(p.ctx, hash(old.RefreshToken)) == nil {
+		s.remove(p.ctx)
+	}
+}
+
+// hash returns hash of the refresh token to be passed to the family store,
+// so that superseded tokens are not kept in plain text.
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
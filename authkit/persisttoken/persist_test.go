@@ -8,9 +8,12 @@ import (
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/memstore"
 	"github.com/letsrock-today/authkit/authkit/mocks"
 )
 
@@ -24,22 +27,26 @@ func TestWrapOAuth2Config(t *testing.T) {
 	ts := &mocks.TokenStore{}
 	ts.On(
 		"OAuth2Token",
+		mock.Anything,
 		"valid@login.ok",
 		"provider-1").
 		Return(old, nil)
 	ts.On(
 		"OAuth2Token",
+		mock.Anything,
 		"valid@login.ok",
 		"provider-2").
 		Return(new, nil)
 	ts.On(
 		"OAuth2Token",
+		mock.Anything,
 		"valid@login.ok",
 		"provider-3").
 		Return(new, nil)
 
 	ts.On(
 		"UpdateOAuth2Token",
+		mock.Anything,
 		"valid@login.ok",
 		mock.Anything,
 		mock.Anything).Return(nil).Once()
@@ -80,22 +87,26 @@ func TestWrapOAuth2ConfigiUseAccessToken(t *testing.T) {
 	ts := &mocks.TokenStore{}
 	ts.On(
 		"OAuth2TokenAndLoginByAccessToken",
+		mock.Anything,
 		"valid-access-token",
 		"provider-1").
 		Return(old, "valid@login.ok", nil)
 	ts.On(
 		"OAuth2TokenAndLoginByAccessToken",
+		mock.Anything,
 		"valid-access-token",
 		"provider-2").
 		Return(new, "valid@login.ok", nil)
 	ts.On(
 		"OAuth2TokenAndLoginByAccessToken",
+		mock.Anything,
 		"valid-access-token",
 		"provider-3").
 		Return(new, "valid@login.ok", nil)
 
 	ts.On(
 		"UpdateOAuth2Token",
+		mock.Anything,
 		"valid@login.ok",
 		mock.Anything,
 		mock.Anything).Return(nil).Once()
@@ -125,3 +136,227 @@ func TestWrapOAuth2ConfigiUseAccessToken(t *testing.T) {
 
 	ts.AssertNumberOfCalls(t, "UpdateOAuth2Token", 1)
 }
+
+func TestWrapOAuth2ConfigUseSession(t *testing.T) {
+	assert := assert.New(t)
+	old := &oauth2.Token{
+		AccessToken: "old",
+		Expiry:      time.Now().Add(-1 * time.Hour)}
+	new := &oauth2.Token{
+		AccessToken: "new",
+		Expiry:      time.Now().Add(1 * time.Hour)}
+	ss := &mocks.SessionStore{}
+	ss.On(
+		"SessionByAccessToken",
+		mock.Anything,
+		"old").
+		Return(authkit.Session{ID: "session-1"}, old, nil)
+	ss.On(
+		"UpdateSessionToken",
+		mock.Anything,
+		"session-1",
+		new).Return(nil).Once()
+
+	testCfg := &mocks.OAuth2Config{}
+	testCfg.On(
+		"TokenSource",
+		mock.Anything,
+		old).
+		Return(oauth2.StaticTokenSource(new))
+
+	cfg := WrapOAuth2ConfigUseSession(testCfg, "old", ss, nil)
+	tok, err := cfg.TokenSource(context.Background(), nil).Token()
+	assert.NoError(err)
+	assert.Equal(new, tok)
+	ss.AssertExpectations(t)
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	ts := memstore.NewTokenStore()
+	stale := &oauth2.Token{
+		AccessToken:  "access-1",
+		RefreshToken: "refresh-1",
+		Expiry:       time.Now().Add(-1 * time.Hour)}
+	assert.NoError(ts.UpdateOAuth2Token(ctx, "valid@login.ok", "provider", stale))
+
+	testCfg := &mocks.OAuth2Config{}
+	testCfg.On(
+		"TokenSource",
+		mock.Anything,
+		mock.Anything).
+		Return(oauth2.StaticTokenSource(&oauth2.Token{
+			AccessToken:  "access-2",
+			RefreshToken: "refresh-2",
+			Expiry:       time.Now().Add(1 * time.Hour)})).Once()
+	testCfg.On(
+		"TokenSource",
+		mock.Anything,
+		mock.Anything).
+		Return(oauth2.StaticTokenSource(&oauth2.Token{
+			AccessToken:  "access-3",
+			RefreshToken: "refresh-3",
+			Expiry:       time.Now().Add(1 * time.Hour)})).Once()
+	cfg := WrapOAuth2Config(testCfg, "valid@login.ok", "provider", ts, nil)
+
+	tok, err := cfg.TokenSource(ctx, nil).Token()
+	assert.NoError(err)
+	assert.Equal("refresh-2", tok.RefreshToken)
+
+	// Stale copy of the token (like in concurrent request) reuses
+	// superseded refresh token.
+	assert.NoError(ts.UpdateOAuth2Token(ctx, "valid@login.ok", "provider", stale))
+	_, err = cfg.TokenSource(ctx, nil).Token()
+	assert.True(authkit.IsRefreshTokenReused(err), "unexpected error: %+v", err)
+	tok, err = ts.OAuth2Token(ctx, "valid@login.ok", "provider")
+	assert.NoError(err)
+	assert.Nil(tok, "token should be removed")
+}
+
+// testStaleTokenStore returns stale token on the first lookup, like the
+// store read by a caller concurrently with refresh by another caller.
+type testStaleTokenStore struct {
+	authkit.TokenStore
+	authkit.RefreshTokenFamilyStore
+	stale *oauth2.Token
+}
+
+func (s *testStaleTokenStore) OAuth2Token(
+	ctx context.Context,
+	login, providerID string) (*oauth2.Token, authkit.UserServiceError) {
+	if t := s.stale; t != nil {
+		s.stale = nil
+		return t, nil
+	}
+	return s.TokenStore.OAuth2Token(ctx, login, providerID)
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	ts := memstore.NewTokenStore()
+	stale := &oauth2.Token{
+		AccessToken:  "access-1",
+		RefreshToken: "refresh-1",
+		Expiry:       time.Now().Add(-1 * time.Hour)}
+	assert.NoError(ts.UpdateOAuth2Token(ctx, "valid@login.ok", "provider", stale))
+
+	testCfg := &mocks.OAuth2Config{}
+	testCfg.On(
+		"TokenSource",
+		mock.Anything,
+		mock.Anything).
+		Return(oauth2.StaticTokenSource(&oauth2.Token{
+			AccessToken:  "access-2",
+			RefreshToken: "refresh-2",
+			Expiry:       time.Now().Add(1 * time.Hour)})).Once()
+	cfg := WrapOAuth2Config(testCfg, "valid@login.ok", "provider", ts, nil)
+	_, err := cfg.TokenSource(ctx, nil).Token()
+	assert.NoError(err)
+
+	// Caller, which read token before another caller refreshed it, receives
+	// refreshed token, family is not revoked.
+	s := &testStaleTokenStore{ts, ts.(authkit.RefreshTokenFamilyStore), stale}
+	cfg = WrapOAuth2Config(testCfg, "valid@login.ok", "provider", s, nil)
+	tok, err := cfg.TokenSource(ctx, nil).Token()
+	assert.NoError(err)
+	assert.Equal("refresh-2", tok.RefreshToken)
+	testCfg.AssertExpectations(t)
+
+	// Token, which is being refreshed by another caller, is not exchanged.
+	fs := ts.(authkit.RefreshTokenFamilyStore)
+	assert.NoError(ts.UpdateOAuth2Token(ctx, "valid@login.ok", "provider", &oauth2.Token{
+		AccessToken:  "access-3",
+		RefreshToken: "refresh-3",
+		Expiry:       time.Now().Add(-1 * time.Hour)}))
+	assert.NoError(fs.ClaimRefreshToken(ctx, hash("refresh-3")))
+	_, err = cfg.TokenSource(ctx, nil).Token()
+	assert.True(authkit.IsRefreshTokenClaimed(err), "unexpected error: %+v", err)
+	testCfg.AssertExpectations(t)
+}
+
+func TestRefreshTokenReuseRemoved(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	ts := memstore.NewTokenStore()
+	fs := ts.(authkit.RefreshTokenFamilyStore)
+	stale := &oauth2.Token{
+		AccessToken:  "access-1",
+		RefreshToken: "refresh-1",
+		Expiry:       time.Now().Add(-1 * time.Hour)}
+	assert.NoError(fs.ClaimRefreshToken(ctx, hash("refresh-1")))
+	assert.NoError(fs.RotateRefreshToken(ctx, hash("refresh-1"), hash("refresh-2")))
+
+	// Stale copy is found, but token has been removed from the store by
+	// another caller, which detected reuse.
+	testCfg := &mocks.OAuth2Config{}
+	s := &testStaleTokenStore{ts, fs, stale}
+	cfg := WrapOAuth2Config(testCfg, "valid@login.ok", "provider", s, nil)
+	_, err := cfg.TokenSource(ctx, nil).Token()
+	assert.True(authkit.IsRefreshTokenReused(err), "unexpected error: %+v", err)
+	testCfg.AssertExpectations(t)
+}
+
+// testRotateErrorStore fails to record rotation of refresh token.
+type testRotateErrorStore struct {
+	authkit.TokenStore
+	authkit.RefreshTokenFamilyStore
+	err authkit.UserServiceError
+}
+
+func (s testRotateErrorStore) RotateRefreshToken(
+	ctx context.Context,
+	old, new string) authkit.UserServiceError {
+	return s.err
+}
+
+func TestRefreshTokenRotateError(t *testing.T) {
+	cases := []struct {
+		name    string
+		err     authkit.UserServiceError
+		revoked bool
+	}{
+		{"store error", errors.New("store error"), false},
+		{"reuse", authkit.NewRefreshTokenReusedError(nil), true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+			ctx := context.Background()
+			ts := memstore.NewTokenStore()
+			fs := ts.(authkit.RefreshTokenFamilyStore)
+			assert.NoError(ts.UpdateOAuth2Token(ctx, "valid@login.ok", "provider", &oauth2.Token{
+				AccessToken:  "access-1",
+				RefreshToken: "refresh-1",
+				Expiry:       time.Now().Add(-1 * time.Hour)}))
+
+			testCfg := &mocks.OAuth2Config{}
+			testCfg.On(
+				"TokenSource",
+				mock.Anything,
+				mock.Anything).
+				Return(oauth2.StaticTokenSource(&oauth2.Token{
+					AccessToken:  "access-2",
+					RefreshToken: "refresh-2",
+					Expiry:       time.Now().Add(1 * time.Hour)}))
+			s := testRotateErrorStore{ts, fs, c.err}
+			cfg := WrapOAuth2Config(testCfg, "valid@login.ok", "provider", s, nil)
+			_, err := cfg.TokenSource(ctx, nil).Token()
+			assert.Equal(c.err, err)
+
+			tok, err := ts.OAuth2Token(ctx, "valid@login.ok", "provider")
+			assert.NoError(err)
+			err = fs.ClaimRefreshToken(ctx, hash("refresh-1"))
+			if c.revoked {
+				// Family is revoked and token is removed.
+				assert.Nil(tok)
+				assert.True(authkit.IsRefreshTokenReused(err), "unexpected error: %+v", err)
+			} else {
+				// Claim is released, saved token is kept.
+				assert.Equal("refresh-2", tok.RefreshToken)
+				assert.NoError(err)
+			}
+		})
+	}
+}
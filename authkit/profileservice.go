@@ -1,6 +1,9 @@
 package authkit
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+)
 
 type (
 
@@ -16,22 +19,24 @@ type (
 	}
 
 	// ProfileService provides methods to persist user profiles (locally).
+	// Use AdaptProfileService to obtain ProfileService from the older
+	// context-free implementation.
 	ProfileService interface {
 
 		// EnsureExists creates new empty profile if it is not exists already.
-		EnsureExists(login, email string) error
+		EnsureExists(ctx context.Context, login, email string) error
 
 		// Save saves profile.
-		Save(Profile) error
+		Save(ctx context.Context, p Profile) error
 
 		// SetEmailConfirmed sets email confirmed flag.
-		SetEmailConfirmed(login, email string, confirmed bool) error
+		SetEmailConfirmed(ctx context.Context, login, email string, confirmed bool) error
 
 		// Email returns (confirmed or not) email address (and user name) by login.
-		Email(login string) (email, name string, err error)
+		Email(ctx context.Context, login string) (email, name string, err error)
 
 		// ConfirmedEmail returns confirmed email address (and user name) by login.
-		ConfirmedEmail(login string) (email, name string, err error)
+		ConfirmedEmail(ctx context.Context, login string) (email, name string, err error)
 	}
 
 	// SocialProfileServices allows to discover SocialProfileService by provider ID.
@@ -0,0 +1,171 @@
+// Package ratelimit provides in-memory authkit.RateLimiter implementation,
+// based on token buckets. Limits are applied separately per login, per email
+// and per client IP address for every action.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+type (
+
+	// Limit allows Requests requests per Interval (with bursts up to
+	// Requests). Zero Requests disables limit.
+	Limit struct {
+		Requests int
+		Interval time.Duration
+	}
+
+	// Config holds configuration parameters for New.
+	Config struct {
+		Login Limit
+		Email Limit
+		IP    Limit
+	}
+
+	bucket struct {
+		tokens float64
+		last   time.Time
+	}
+
+	limiter struct {
+		Config
+		mu        sync.Mutex
+		buckets   map[string]*bucket
+		lastPurge time.Time
+		now       func() time.Time
+	}
+)
+
+// DefaultConfig used by New for zero limits.
+var DefaultConfig = Config{
+	Login: Limit{Requests: 3, Interval: time.Hour},
+	Email: Limit{Requests: 3, Interval: time.Hour},
+	IP:    Limit{Requests: 20, Interval: time.Hour},
+}
+
+// New returns new in-memory authkit.RateLimiter. Zero limits in c are
+// replaced with limits from DefaultConfig (use Requests < 0 to disable limit).
+// New panics, if Interval of enabled limit is not positive (or is too short
+// to refill a single request).
+func New(c Config) authkit.RateLimiter {
+	if c.Login == (Limit{}) {
+		c.Login = DefaultConfig.Login
+	}
+	if c.Email == (Limit{}) {
+		c.Email = DefaultConfig.Email
+	}
+	if c.IP == (Limit{}) {
+		c.IP = DefaultConfig.IP
+	}
+	for _, l := range []Limit{c.Login, c.Email, c.IP} {
+		if l.Requests > 0 && l.interval() <= 0 {
+			panic("Interval of the limit must be positive")
+		}
+	}
+	return &limiter{
+		Config:  c,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+type limitKey struct {
+	key   string
+	limit Limit
+}
+
+func (l *limiter) Allow(
+	_ context.Context,
+	action, login, email, ip string) error {
+	keys := make([]limitKey, 0, 3)
+	for _, k := range []struct {
+		kind, value string
+		limit       Limit
+	}{
+		{"login", login, l.Login},
+		{"email", email, l.Email},
+		{"ip", ip, l.IP},
+	} {
+		if k.value != "" && k.limit.Requests > 0 {
+			keys = append(keys, limitKey{action + ":" + k.kind + ":" + k.value, k.limit})
+		}
+	}
+
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.purge(now)
+
+	// Check all buckets first, so that rejected request is not counted.
+	var retry time.Duration
+	for _, k := range keys {
+		if d := l.bucket(k, now).wait(k.limit); d > retry {
+			retry = d
+		}
+	}
+	if retry > 0 {
+		return authkit.NewRateLimitError(retry, nil)
+	}
+	for _, k := range keys {
+		l.buckets[k.key].tokens--
+	}
+	return nil
+}
+
+// bucket returns refilled bucket for the key. Caller should hold the lock.
+func (l *limiter) bucket(k limitKey, now time.Time) *bucket {
+	b, ok := l.buckets[k.key]
+	if !ok {
+		b = &bucket{tokens: float64(k.limit.Requests), last: now}
+		l.buckets[k.key] = b
+		return b
+	}
+	b.tokens += float64(now.Sub(b.last)) / float64(k.limit.interval())
+	if max := float64(k.limit.Requests); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+	return b
+}
+
+// wait returns duration until next request is allowed.
+func (b *bucket) wait(limit Limit) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(limit.interval()))
+}
+
+// interval returns time to refill single token.
+func (l Limit) interval() time.Duration {
+	return l.Interval / time.Duration(l.Requests)
+}
+
+// purgeInterval is a minimal interval between removals of full buckets.
+const purgeInterval = time.Minute
+
+// purge removes buckets, which would be full now (they are equal to absent
+// ones). Caller should hold the lock.
+func (l *limiter) purge(now time.Time) {
+	if now.Sub(l.lastPurge) < purgeInterval {
+		return
+	}
+	l.lastPurge = now
+	longest := l.Login.Interval
+	if l.Email.Interval > longest {
+		longest = l.Email.Interval
+	}
+	if l.IP.Interval > longest {
+		longest = l.IP.Interval
+	}
+	for k, b := range l.buckets {
+		if now.Sub(b.last) >= longest {
+			delete(l.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+func newTestLimiter(c Config) (*limiter, *time.Time) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(c).(*limiter)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimiter(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	l, now := newTestLimiter(Config{
+		Login: Limit{Requests: 2, Interval: time.Hour},
+		Email: Limit{Requests: -1},
+		IP:    Limit{Requests: -1},
+	})
+	const action = authkit.RateLimitRestorePassword
+
+	assert.NoError(l.Allow(ctx, action, "user", "", ""))
+	assert.NoError(l.Allow(ctx, action, "user", "", ""))
+	err := l.Allow(ctx, action, "user", "", "")
+	assert.True(authkit.IsRateLimited(err))
+	retry, ok := authkit.RetryAfter(err)
+	assert.True(ok)
+	assert.Equal(30*time.Minute, retry)
+
+	// Other logins and actions are not affected.
+	assert.NoError(l.Allow(ctx, action, "other", "", ""))
+	assert.NoError(l.Allow(ctx, authkit.RateLimitConfirmationEmail, "user", "", ""))
+
+	// Tokens are refilled with time.
+	*now = now.Add(20 * time.Minute)
+	err = l.Allow(ctx, action, "user", "", "")
+	retry, _ = authkit.RetryAfter(err)
+	assert.Equal(10*time.Minute, retry)
+	*now = now.Add(10 * time.Minute)
+	assert.NoError(l.Allow(ctx, action, "user", "", ""))
+	assert.True(authkit.IsRateLimited(l.Allow(ctx, action, "user", "", "")))
+
+	// Bucket is not refilled above limit.
+	*now = now.Add(24 * time.Hour)
+	assert.NoError(l.Allow(ctx, action, "user", "", ""))
+	assert.NoError(l.Allow(ctx, action, "user", "", ""))
+	assert.True(authkit.IsRateLimited(l.Allow(ctx, action, "user", "", "")))
+}
+
+func TestLimiterKinds(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	l, _ := newTestLimiter(Config{
+		Login: Limit{Requests: 10, Interval: time.Hour},
+		Email: Limit{Requests: 1, Interval: time.Hour},
+		IP:    Limit{Requests: 2, Interval: time.Hour},
+	})
+	const action = authkit.RateLimitRestorePassword
+
+	assert.NoError(l.Allow(ctx, action, "user1", "a@b.c", "1.1.1.1"))
+	// Same email with another login.
+	assert.True(authkit.IsRateLimited(
+		l.Allow(ctx, action, "user2", "a@b.c", "2.2.2.2")))
+	// Rejected request is not counted for other keys.
+	assert.NoError(l.Allow(ctx, action, "user2", "d@e.f", "2.2.2.2"))
+	assert.NoError(l.Allow(ctx, action, "user3", "g@h.i", "2.2.2.2"))
+	// Same IP with other logins and emails.
+	assert.True(authkit.IsRateLimited(
+		l.Allow(ctx, action, "user4", "j@k.l", "2.2.2.2")))
+}
+
+func TestLimiterPurge(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	l, now := newTestLimiter(Config{})
+
+	assert.NoError(l.Allow(ctx, authkit.RateLimitRestorePassword, "user", "a@b.c", "1.1.1.1"))
+	assert.Len(l.buckets, 3)
+	*now = now.Add(time.Hour)
+	assert.NoError(l.Allow(ctx, authkit.RateLimitRestorePassword, "other", "", ""))
+	assert.Len(l.buckets, 1)
+}
+
+func TestNewInvalidLimit(t *testing.T) {
+	assert := assert.New(t)
+	assert.Panics(func() { New(Config{Login: Limit{Requests: 3}}) })
+	assert.Panics(func() { New(Config{IP: Limit{Requests: 3, Interval: -time.Hour}}) })
+	assert.Panics(func() { New(Config{Email: Limit{Requests: 3, Interval: 2}}) })
+	assert.NotPanics(func() { New(Config{Login: Limit{Requests: -1}}) })
+	assert.NotPanics(func() { New(Config{}) })
+}
@@ -0,0 +1,76 @@
+package authkit
+
+import (
+	"context"
+	"time"
+)
+
+// Actions, limited by RateLimiter.
+const (
+	// RateLimitRestorePassword is an action of the RestorePassword handler.
+	RateLimitRestorePassword = "restore-password"
+
+	// RateLimitConfirmationEmail is an action of the SendConfirmationEmail
+	// handler.
+	RateLimitConfirmationEmail = "confirmation-email"
+
+	// RateLimitEmailChange is an action of the ChangeEmail handler.
+	RateLimitEmailChange = "email-change"
+)
+
+type (
+
+	// RateLimiter limits frequency of requests, which send emails to users
+	// (so that service couldn't be used to spam a mailbox).
+	RateLimiter interface {
+
+		// Allow registers request for the action and returns
+		// RateLimitError if limit for the login, email or client's IP
+		// address is exceeded. Rejected requests should not be counted.
+		// Empty login, email or ip is not limited (handler may check
+		// limits in several calls, e.g. before and after user lookup).
+		Allow(ctx context.Context, action, login, email, ip string) error
+	}
+
+	// RateLimitError indicates that request rejected because of rate limit.
+	RateLimitError interface {
+		UserServiceError
+		causer
+		IsRateLimited() bool
+
+		// RetryAfter returns duration, after which request can be repeated.
+		RetryAfter() time.Duration
+	}
+
+	rateLimitError struct {
+		userServiceError
+		retryAfter time.Duration
+	}
+)
+
+// NewRateLimitError returns new RateLimitError.
+func NewRateLimitError(retryAfter time.Duration, cause error) RateLimitError {
+	return rateLimitError{userServiceError{cause}, retryAfter}
+}
+
+func (rateLimitError) Error() string {
+	return "rate limit exceeded"
+}
+
+func (rateLimitError) IsRateLimited() bool {
+	return true
+}
+
+func (e rateLimitError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// IsRateLimited checks whether error is or caused by the RateLimitError.
+func IsRateLimited(err error) bool {
+	return existsCause(err, func(e error) bool {
+		e1, ok := e.(RateLimitError)
+		return ok && e1.IsRateLimited()
+	})
+}
+
+//go:generate mockery -name RateLimiter
@@ -0,0 +1,64 @@
+// Package recoverycode generates single-use recovery codes, which let users
+// regain access to their accounts, when they lose their second factor or
+// access to their email. Codes are random enough to be stored as SHA-256
+// hashes (like API keys), slow password hashing is not required for them.
+package recoverycode
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultCount is a number of codes, generated for the user at once.
+	DefaultCount = 10
+
+	// codeSize is a number of random bytes in the code (50 bits of entropy
+	// after encoding into 10 base32 chars).
+	codeSize = 7
+	codeLen  = 10
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Generate returns n new random codes in "xxxxx-xxxxx" format.
+func Generate(n int) ([]string, error) {
+	codes := make([]string, n)
+	b := make([]byte, codeSize)
+	for i := range codes {
+		if _, err := rand.Read(b); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		s := strings.ToLower(encoding.EncodeToString(b))[:codeLen]
+		codes[i] = s[:codeLen/2] + "-" + s[codeLen/2:]
+	}
+	return codes, nil
+}
+
+// Hash returns hash of the code to be stored. Code is normalized before
+// hashing, so that case, spaces and hyphens typed by the user don't matter.
+func Hash(code string) string {
+	code = strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ', '\t':
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashAll returns hashes of all codes.
+func HashAll(codes []string) []string {
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = Hash(c)
+	}
+	return hashes
+}
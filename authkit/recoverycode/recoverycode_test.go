@@ -0,0 +1,32 @@
+package recoverycode
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	assert := assert.New(t)
+	codes, err := Generate(DefaultCount)
+	require.NoError(t, err)
+	assert.Len(codes, DefaultCount)
+	seen := make(map[string]bool)
+	for _, c := range codes {
+		assert.Regexp(regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`), c)
+		assert.False(seen[c], "duplicate code %s", c)
+		seen[c] = true
+	}
+}
+
+func TestHash(t *testing.T) {
+	assert := assert.New(t)
+	h := Hash("abcde-fghij")
+	assert.Len(h, 64)
+	assert.Equal(h, Hash("ABCDEFGHIJ"))
+	assert.Equal(h, Hash(" abcde fghij "))
+	assert.NotEqual(h, Hash("abcde-fghik"))
+	assert.Equal([]string{h, Hash("x")}, HashAll([]string{"abcdefghij", "x"}))
+}
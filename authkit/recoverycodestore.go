@@ -0,0 +1,19 @@
+package authkit
+
+import "context"
+
+// RecoveryCodeStore provides methods to persist users' single-use recovery
+// codes. Codes are passed to the store already hashed, store should keep
+// them as is. UserService implementation may implement this interface to
+// enable recovery code handlers.
+type RecoveryCodeStore interface {
+
+	// UpdateRecoveryCodes replaces all user's recovery codes with new ones.
+	UpdateRecoveryCodes(ctx context.Context, login string, hashes []string) UserServiceError
+
+	// UseRecoveryCode removes user's recovery code. It returns false, if
+	// user doesn't have such code (or it has already been used).
+	UseRecoveryCode(ctx context.Context, login, hash string) (bool, UserServiceError)
+}
+
+//go:generate mockery -name RecoveryCodeStore
@@ -0,0 +1,24 @@
+package authkit
+
+import "context"
+
+// RefreshLocker coordinates refresh of the same access token by several
+// instances of the application (concurrent requests within one instance are
+// coalesced by the middleware itself). Implementation may be based on any
+// shared storage with locks and expiration (like Redis or SQL database).
+type RefreshLocker interface {
+
+	// Lock acquires exclusive lock for refresh of the access token. It
+	// waits, while lock is held by another instance (or until ctx is done).
+	// If token has been refreshed by another instance recently, it returns
+	// new access token without acquiring the lock. Otherwise, it returns
+	// empty string, and caller should refresh token and call Unlock.
+	Lock(ctx context.Context, accessToken string) (refreshed string, err error)
+
+	// Unlock releases lock, acquired by Lock. New access token (empty, if
+	// refresh failed) should be kept for a short while and returned by
+	// Lock to other instances, which try to refresh the same token.
+	Unlock(ctx context.Context, accessToken, newAccessToken string) error
+}
+
+//go:generate mockery -name RefreshLocker
@@ -0,0 +1,131 @@
+package authkit
+
+import (
+	"context"
+	"time"
+)
+
+// RefreshTokenClaimTimeout is a period, during which refresh token, claimed
+// with RefreshTokenFamilyStore.ClaimRefreshToken, can't be claimed again.
+// It should be long enough to exchange refresh token at the authorization
+// server. Claim, which hasn't been followed by rotation in this period (caller
+// crashed), expires, so that token could be used again.
+const RefreshTokenClaimTimeout = time.Minute
+
+// RefreshTokenRetention is a period, during which RefreshTokenFamilyStore
+// keeps record of the refresh token since its last claim or rotation.
+// Store may remove older records, so reuse of refresh tokens, which have
+// been superseded earlier, is not detected. Authorization server is
+// expected to expire such tokens by then.
+const RefreshTokenRetention = 30 * 24 * time.Hour
+
+type (
+
+	// RefreshTokenFamilyStore provides methods to track families of refresh
+	// tokens. Family is a chain of refresh tokens, obtained one from another,
+	// when authorization server rotates refresh token on every refresh.
+	// Every token of the family, except the latest one, is superseded and
+	// should never be used again. Tokens are passed to the store already
+	// hashed, store should keep them as is.
+	// Store only keeps records about tokens, it doesn't (and can't) revoke
+	// tokens at the authorization server.
+	// TokenStore (or SessionStore) implementation may implement this
+	// interface to enable reuse detection in the persisttoken package.
+	RefreshTokenFamilyStore interface {
+
+		// ClaimRefreshToken should be called before refresh token is
+		// exchanged at the authorization server, so that only one caller
+		// (possibly, in another instance of the application) exchanges it.
+		// Unknown token starts new family. It returns
+		// RefreshTokenReusedError, if token has been superseded already or
+		// its family is revoked, and RefreshTokenClaimedError, if token has
+		// been claimed by another caller less than RefreshTokenClaimTimeout
+		// ago.
+		ClaimRefreshToken(ctx context.Context, token string) UserServiceError
+
+		// ReleaseRefreshToken cancels claim of the token, which hasn't been
+		// rotated (exchange failed or authorization server doesn't rotate
+		// refresh tokens). It does nothing, if token is unknown or
+		// superseded.
+		ReleaseRefreshToken(ctx context.Context, token string) UserServiceError
+
+		// RotateRefreshToken records that claimed refresh token old is
+		// superseded by new. New token joins family of the old one. It
+		// returns RefreshTokenReusedError, if old token has been superseded
+		// already or its family is revoked.
+		RotateRefreshToken(ctx context.Context, old, new string) UserServiceError
+
+		// RevokeRefreshTokenFamily marks all tokens of the family of the
+		// token as superseded, so that any attempt to claim them fails. It
+		// returns nil, if token is unknown.
+		RevokeRefreshTokenFamily(ctx context.Context, token string) UserServiceError
+	}
+
+	// RefreshTokenReusedError indicates that superseded refresh token has
+	// been used again. It means that token has been stolen (or that stale
+	// copy of the token has been kept somewhere).
+	RefreshTokenReusedError interface {
+		UserServiceError
+		causer
+		IsRefreshTokenReused() bool
+	}
+
+	// RefreshTokenClaimedError indicates that refresh token is being
+	// exchanged by another caller right now. It is not a sign of token
+	// reuse, caller may retry later or use token, obtained by another
+	// caller.
+	RefreshTokenClaimedError interface {
+		UserServiceError
+		causer
+		IsRefreshTokenClaimed() bool
+	}
+
+	refreshTokenReusedError  struct{ userServiceError }
+	refreshTokenClaimedError struct{ userServiceError }
+)
+
+// NewRefreshTokenReusedError returns new RefreshTokenReusedError.
+func NewRefreshTokenReusedError(cause error) RefreshTokenReusedError {
+	return refreshTokenReusedError{userServiceError{cause}}
+}
+
+func (refreshTokenReusedError) Error() string {
+	return "refresh token reused"
+}
+
+func (refreshTokenReusedError) IsRefreshTokenReused() bool {
+	return true
+}
+
+// IsRefreshTokenReused checks whether error is or caused by the
+// RefreshTokenReusedError.
+func IsRefreshTokenReused(err error) bool {
+	return existsCause(err, func(e error) bool {
+		e1, ok := e.(RefreshTokenReusedError)
+		return ok && e1.IsRefreshTokenReused()
+	})
+}
+
+// NewRefreshTokenClaimedError returns new RefreshTokenClaimedError.
+func NewRefreshTokenClaimedError(cause error) RefreshTokenClaimedError {
+	return refreshTokenClaimedError{userServiceError{cause}}
+}
+
+func (refreshTokenClaimedError) Error() string {
+	return "refresh token claimed"
+}
+
+func (refreshTokenClaimedError) IsRefreshTokenClaimed() bool {
+	return true
+}
+
+// IsRefreshTokenClaimed checks whether error is or caused by the
+// RefreshTokenClaimedError.
+func IsRefreshTokenClaimed(err error) bool {
+	return existsCause(err, func(e error) bool {
+		e1, ok := e.(RefreshTokenClaimedError)
+		return ok && e1.IsRefreshTokenClaimed()
+	})
+}
+
+//go:generate mockery -name RefreshTokenFamilyStore
@@ -0,0 +1,66 @@
+package authkit
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+type (
+
+	// Session describes token of the private provider, issued to one of
+	// user's devices (browsers).
+	Session struct {
+		ID    string
+		Login string
+
+		// Device is a User-Agent of the client, which obtained token.
+		Device string
+
+		// IP is an address, from which session was used last time.
+		IP string
+
+		Created  time.Time
+		LastUsed time.Time
+	}
+
+	// SessionStore provides methods to persist several tokens of the private
+	// provider per user, one per session. UserService implementation may
+	// implement this interface to enable session handlers. If it does,
+	// handlers keep private provider's tokens in sessions instead of the
+	// TokenStore, so that login on another device doesn't overwrite token of
+	// the first one.
+	SessionStore interface {
+
+		// CreateSession saves new session with token. It returns
+		// UserNotFoundError, if user doesn't exist.
+		CreateSession(ctx context.Context, s Session, token *oauth2.Token) UserServiceError
+
+		// Sessions returns all user's sessions, ordered by creation time.
+		Sessions(ctx context.Context, login string) ([]Session, UserServiceError)
+
+		// SessionByAccessToken returns session and its token by access
+		// token. It returns UserNotFoundError, if there is no such session.
+		SessionByAccessToken(ctx context.Context, accessToken string) (Session, *oauth2.Token, UserServiceError)
+
+		// SessionToken returns token of the user's session. It returns
+		// UserNotFoundError, if user doesn't have such session.
+		SessionToken(ctx context.Context, login, id string) (*oauth2.Token, UserServiceError)
+
+		// UpdateSessionToken replaces token of the session (after refresh).
+		// It returns UserNotFoundError, if there is no such session.
+		UpdateSessionToken(ctx context.Context, id string, token *oauth2.Token) UserServiceError
+
+		// TouchSession updates IP and LastUsed of the session with access
+		// token. It returns nil, if there is no such session.
+		TouchSession(ctx context.Context, accessToken, ip string, lastUsed time.Time) UserServiceError
+
+		// DeleteSession deletes user's session. It returns nil, if user
+		// doesn't have such session. Token should be revoked by caller
+		// beforehand.
+		DeleteSession(ctx context.Context, login, id string) UserServiceError
+	}
+)
+
+//go:generate mockery -name SessionStore
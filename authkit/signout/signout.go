@@ -0,0 +1,177 @@
+// Package signout revokes all tokens of the user ("sign out everywhere"):
+// tokens of the private provider (including tokens of sessions) and tokens
+// of linked external providers. It may be used by the application to end
+// user's sessions after suspected compromise or by administrative tools.
+package signout
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+// Config holds dependencies of Everywhere and other functions of the
+// package. Functions, other than Everywhere, use only some of them.
+type Config struct {
+
+	// PrivateProviderID is an ID of the private OAuth2 provider. Tokens of
+	// this provider are revoked via AuthService. Required.
+	PrivateProviderID string
+
+	// AuthService used to revoke tokens (access and refresh) of the
+	// private provider. Required.
+	AuthService authkit.HandlerAuthService
+
+	// TokenInvalidator used to remove cached decisions about revoked tokens
+	// of the private provider. Optional.
+	TokenInvalidator authkit.TokenInvalidator
+
+	// TokenStore used to clear revoked tokens. Required.
+	TokenStore authkit.TokenStore
+
+	// AccountStore used to enumerate user's tokens. Required.
+	AccountStore authkit.AccountStore
+
+	// SessionStore used to enumerate and delete user's sessions. Optional.
+	SessionStore authkit.SessionStore
+
+	// OAuth2Providers, SocialProfileServices and ContextCreator used to
+	// revoke tokens of external providers, which SocialProfileService
+	// implements authkit.SocialTokenRevoker. Optional. If
+	// SocialProfileServices is nil, tokens of external providers are only
+	// cleared from the store. If ContextCreator is nil, then
+	// authkit.DefaultContextCreator is used.
+	OAuth2Providers       []authkit.OAuth2Provider
+	SocialProfileServices authkit.SocialProfileServices
+	ContextCreator        authkit.ContextCreator
+
+	// SocialRevokeFailed, if not nil, is called, when token of the external
+	// provider could not be revoked. Optional.
+	SocialRevokeFailed func(providerID string, err error)
+}
+
+// Everywhere revokes all user's tokens and clears them from the store.
+//
+// Tokens of the private provider are revoked first and cleared only after
+// successful revocation, so that call can be repeated after failure.
+// Tokens of external providers are cleared first and revoked at the
+// provider on best-effort basis (provider may not support revocation at
+// all), failure to revoke them doesn't stop the process.
+func Everywhere(ctx context.Context, c Config, login string) error {
+	tokens, err := c.AccountStore.OAuth2Tokens(ctx, login)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for pid, t := range tokens {
+		if t == nil {
+			continue
+		}
+		if pid != c.PrivateProviderID {
+			if err := c.TokenStore.UpdateOAuth2Token(ctx, login, pid, nil); err != nil {
+				return errors.WithStack(err)
+			}
+			// Token is not usable by the app anymore and will expire
+			// eventually, if provider failed to revoke it.
+			if err := RevokeSocialToken(c, pid, t); err != nil &&
+				c.SocialRevokeFailed != nil {
+				c.SocialRevokeFailed(pid, err)
+			}
+			continue
+		}
+		if err := RevokePrivateToken(c, t); err != nil {
+			return err
+		}
+		if err := c.TokenStore.UpdateOAuth2Token(ctx, login, pid, nil); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return RevokeSessions(ctx, c, login, "")
+}
+
+// RevokePrivateToken revokes access and refresh tokens of the private
+// provider. It uses AuthService and TokenInvalidator of c.
+func RevokePrivateToken(c Config, t *oauth2.Token) error {
+	for _, token := range []string{t.AccessToken, t.RefreshToken} {
+		if token == "" {
+			continue
+		}
+		err := c.AuthService.RevokeAccessToken(token)
+		if c.TokenInvalidator != nil {
+			c.TokenInvalidator.InvalidateToken(token)
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// RevokeSessions revokes tokens of all user's sessions and deletes
+// sessions, except the session with access token keep (if not empty). It
+// does nothing, if SessionStore of c is nil.
+func RevokeSessions(ctx context.Context, c Config, login, keep string) error {
+	if c.SessionStore == nil {
+		return nil
+	}
+	sessions, err := c.SessionStore.Sessions(ctx, login)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, s := range sessions {
+		t, err := c.SessionStore.SessionToken(ctx, login, s.ID)
+		if err != nil {
+			if authkit.IsUserNotFound(err) {
+				// Session has been deleted concurrently.
+				continue
+			}
+			return errors.WithStack(err)
+		}
+		if keep != "" && t.AccessToken == keep {
+			continue
+		}
+		if err := RevokePrivateToken(c, t); err != nil {
+			return err
+		}
+		if err := c.SessionStore.DeleteSession(ctx, login, s.ID); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// RevokeSocialToken revokes token at the external provider, if provider's
+// SocialProfileService implements authkit.SocialTokenRevoker. It does
+// nothing, if SocialProfileServices of c is nil or provider is unknown.
+func RevokeSocialToken(c Config, pid string, token *oauth2.Token) error {
+	if c.SocialProfileServices == nil {
+		return nil
+	}
+	var p *authkit.OAuth2Provider
+	for i := range c.OAuth2Providers {
+		if c.OAuth2Providers[i].ID == pid {
+			p = &c.OAuth2Providers[i]
+			break
+		}
+	}
+	if p == nil {
+		return nil
+	}
+	s, err := c.SocialProfileServices.SocialProfileService(pid)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	r, ok := s.(authkit.SocialTokenRevoker)
+	if !ok {
+		return nil
+	}
+	cc := c.ContextCreator
+	if cc == nil {
+		cc = authkit.DefaultContextCreator{}
+	}
+	ctx := cc.CreateContext(pid)
+	return errors.WithStack(r.RevokeToken(p.OAuth2Config.Client(ctx, token), token))
+}
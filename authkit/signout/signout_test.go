@@ -0,0 +1,72 @@
+package signout
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/oauth2"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/memstore"
+	"github.com/letsrock-today/authkit/authkit/mocks"
+	"github.com/letsrock-today/authkit/authkit/passhash"
+)
+
+func TestEverywhere(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	s := memstore.NewUserStore(passhash.New(passhash.NewBcrypt(4)))
+	require.NoError(t, s.Create(ctx, "valid@login.ok", "valid_password"))
+	require.NoError(t, s.UpdateOAuth2Token(
+		ctx,
+		"valid@login.ok",
+		"private",
+		&oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-1"}))
+	require.NoError(t, s.UpdateOAuth2Token(
+		ctx,
+		"valid@login.ok",
+		"fb",
+		&oauth2.Token{AccessToken: "fb-access"}))
+	ss := s.(authkit.SessionStore)
+	require.NoError(t, ss.CreateSession(
+		ctx,
+		authkit.Session{ID: "session-1", Login: "valid@login.ok"},
+		&oauth2.Token{AccessToken: "access-2", RefreshToken: "refresh-2"}))
+
+	as := new(mocks.AuthService)
+	as.On("RevokeAccessToken", "access-1").Return(errors.New("unavailable")).Once()
+	c := Config{
+		PrivateProviderID: "private",
+		AuthService:       as,
+		TokenStore:        s,
+		AccountStore:      s.(authkit.AccountStore),
+		SessionStore:      ss,
+	}
+
+	// Token of the private provider is kept, if it is not revoked.
+	assert.Error(Everywhere(ctx, c, "valid@login.ok"))
+	token, err := s.OAuth2Token(ctx, "valid@login.ok", "private")
+	assert.NoError(err)
+	assert.NotNil(token)
+
+	// Refresh tokens are revoked along with access tokens.
+	as.On("RevokeAccessToken", "access-1").Return(nil).Once()
+	as.On("RevokeAccessToken", "refresh-1").Return(nil).Once()
+	as.On("RevokeAccessToken", "access-2").Return(nil).Once()
+	as.On("RevokeAccessToken", "refresh-2").Return(nil).Once()
+	assert.NoError(Everywhere(ctx, c, "valid@login.ok"))
+	tokens, err := c.AccountStore.OAuth2Tokens(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Empty(tokens)
+	sessions, err := ss.Sessions(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Empty(sessions)
+	as.AssertExpectations(t)
+
+	err = Everywhere(ctx, c, "unknown@login.ok")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+}
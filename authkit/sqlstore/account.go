@@ -0,0 +1,79 @@
+package sqlstore
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+func (s *userStore) OAuth2Tokens(
+	ctx context.Context,
+	login string) (map[string]*oauth2.Token, authkit.UserServiceError) {
+	if _, err := s.User(ctx, login); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(
+		ctx,
+		s.d.Rebind(`SELECT provider_id, access_token, token_type, refresh_token, expiry
+			FROM authkit_tokens WHERE login = ?`),
+		login)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	tokens := make(map[string]*oauth2.Token)
+	for rows.Next() {
+		var (
+			pid    string
+			expiry int64
+		)
+		t := &oauth2.Token{}
+		if err := rows.Scan(
+			&pid,
+			&t.AccessToken,
+			&t.TokenType,
+			&t.RefreshToken,
+			&expiry); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		t.Expiry = expiryFromDB(expiry)
+		tokens[pid] = t
+	}
+	return tokens, errors.WithStack(rows.Err())
+}
+
+func (s *userStore) DeleteUser(
+	ctx context.Context,
+	login string) authkit.UserServiceError {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, q := range []string{
+		"DELETE FROM authkit_tokens WHERE login = ?",
+		"DELETE FROM authkit_recovery_codes WHERE login = ?",
+		"DELETE FROM authkit_identities WHERE login = ?",
+		"DELETE FROM authkit_sessions WHERE login = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, s.d.Rebind(q), login); err != nil {
+			tx.Rollback()
+			return errors.WithStack(err)
+		}
+	}
+	r, err := tx.ExecContext(
+		ctx,
+		s.d.Rebind("DELETE FROM authkit_users WHERE login = ?"),
+		login)
+	if err == nil {
+		err = requireAffected(r)
+	}
+	if err != nil {
+		tx.Rollback()
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(tx.Commit())
+}
@@ -0,0 +1,226 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit/attempts"
+)
+
+// attemptRetries limits number of retries of optimistic counter update.
+const attemptRetries = 10
+
+var errAttemptConflict = errors.New("too many concurrent attempts")
+
+// NewAttemptStore returns new attempts.Store, which keeps counters in db, so
+// that attempts are tracked across all instances of application.
+func NewAttemptStore(db *sql.DB, d Dialect) attempts.Store {
+	return &attemptStore{db: db, d: d}
+}
+
+type (
+	attemptStore struct {
+		db *sql.DB
+		d  Dialect
+
+		mu        sync.Mutex
+		lastPurge time.Time
+	}
+
+	attemptCounter struct {
+		failures      int
+		last          int64
+		expires       int64
+		reserved      int
+		reservedUntil int64
+	}
+)
+
+func (s *attemptStore) Reserve(
+	ctx context.Context,
+	key string,
+	now time.Time,
+	lease time.Duration,
+	delay func(n int) time.Duration) (time.Duration, error) {
+	if err := s.purge(ctx, now); err != nil {
+		return 0, err
+	}
+	var retry time.Duration
+	err := s.update(ctx, key, now, func(c *attemptCounter) bool {
+		// Concurrent attempt may be made a bit earlier than the last one,
+		// so elapsed time is checked only if delay is required.
+		last := expiryFromDB(c.last)
+		if d := delay(c.failures + c.reserved); d > 0 && d > now.Sub(last) {
+			retry = d - now.Sub(last)
+			return false
+		}
+		c.reserved++
+		if now.After(last) {
+			c.last = expiryToDB(now)
+		}
+		c.reservedUntil = expiryToDB(now.Add(lease))
+		return true
+	})
+	return retry, err
+}
+
+func (s *attemptStore) Add(
+	ctx context.Context,
+	key string,
+	now time.Time,
+	ttl time.Duration) (int, error) {
+	if err := s.purge(ctx, now); err != nil {
+		return 0, err
+	}
+	var failures int
+	err := s.update(ctx, key, now, func(c *attemptCounter) bool {
+		if c.reserved > 0 {
+			c.reserved--
+		}
+		c.failures++
+		if now.After(expiryFromDB(c.last)) {
+			c.last = expiryToDB(now)
+		}
+		c.expires = expiryToDB(now.Add(ttl))
+		failures = c.failures
+		return true
+	})
+	return failures, err
+}
+
+func (s *attemptStore) Release(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_attempts SET reserved = reserved - 1
+			WHERE attempt_key = ? AND reserved > 0`),
+		key)
+	return errors.WithStack(err)
+}
+
+func (s *attemptStore) Reset(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind("DELETE FROM authkit_attempts WHERE attempt_key = ?"),
+		key)
+	return errors.WithStack(err)
+}
+
+// update reads counter for the key (with expired values cleared), applies f
+// to it and saves it, if f returns true. Counter is saved only if it has not
+// been modified concurrently, otherwise update is repeated.
+func (s *attemptStore) update(
+	ctx context.Context,
+	key string,
+	now time.Time,
+	f func(c *attemptCounter) bool) error {
+	for i := 0; i < attemptRetries; i++ {
+		var (
+			c   attemptCounter
+			old *attemptCounter
+		)
+		err := s.db.QueryRowContext(
+			ctx,
+			s.d.Rebind(`SELECT failures, last_attempt, expires,
+				reserved, reserved_until
+				FROM authkit_attempts WHERE attempt_key = ?`),
+			key).Scan(&c.failures, &c.last, &c.expires, &c.reserved, &c.reservedUntil)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return errors.WithStack(err)
+		default:
+			saved := c
+			old = &saved
+		}
+		if !now.Before(expiryFromDB(c.expires)) {
+			c.failures = 0
+		}
+		if !now.Before(expiryFromDB(c.reservedUntil)) {
+			c.reserved = 0
+		}
+		if !f(&c) {
+			return nil
+		}
+		ok, err := s.save(ctx, key, old, c)
+		if err != nil || ok {
+			return err
+		}
+	}
+	return errors.WithStack(errAttemptConflict)
+}
+
+// save inserts counter c (if old is nil) or replaces old one. It returns
+// false, if counter has been modified concurrently.
+func (s *attemptStore) save(
+	ctx context.Context,
+	key string,
+	old *attemptCounter,
+	c attemptCounter) (bool, error) {
+	if old == nil {
+		_, err := s.db.ExecContext(
+			ctx,
+			s.d.Rebind(`INSERT INTO authkit_attempts
+				(attempt_key, failures, last_attempt, expires,
+					reserved, reserved_until)
+				VALUES (?, ?, ?, ?, ?, ?)`),
+			key,
+			c.failures,
+			c.last,
+			c.expires,
+			c.reserved,
+			c.reservedUntil)
+		if s.d.IsUniqueViolation(err) {
+			return false, nil
+		}
+		return err == nil, errors.WithStack(err)
+	}
+	r, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_attempts
+			SET failures = ?, last_attempt = ?, expires = ?,
+				reserved = ?, reserved_until = ?
+			WHERE attempt_key = ? AND failures = ? AND last_attempt = ?
+				AND expires = ? AND reserved = ? AND reserved_until = ?`),
+		c.failures,
+		c.last,
+		c.expires,
+		c.reserved,
+		c.reservedUntil,
+		key,
+		old.failures,
+		old.last,
+		old.expires,
+		old.reserved,
+		old.reservedUntil)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return n != 0, nil
+}
+
+// purge removes expired counters. It does nothing, if counters have been
+// removed less than purgeInterval ago.
+func (s *attemptStore) purge(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	if now.Sub(s.lastPurge) < purgeInterval {
+		s.mu.Unlock()
+		return nil
+	}
+	s.lastPurge = now
+	s.mu.Unlock()
+	_, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`DELETE FROM authkit_attempts
+			WHERE expires < ? AND reserved_until < ?`),
+		expiryToDB(now),
+		expiryToDB(now))
+	return errors.WithStack(err)
+}
@@ -0,0 +1,101 @@
+package sqlstore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/attempts"
+)
+
+func TestAttemptStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	db, cleanup := openDB(t)
+	defer cleanup()
+	s := NewAttemptStore(db, SQLite)
+	now := time.Now()
+	delay := func(n int) time.Duration {
+		if n < 2 {
+			return 0
+		}
+		return time.Minute
+	}
+
+	n, err := s.Add(ctx, "a", now, time.Hour)
+	assert.NoError(err)
+	assert.Equal(1, n)
+
+	// Reserved attempt is counted together with failures.
+	retry, err := s.Reserve(ctx, "a", now, time.Minute, delay)
+	assert.NoError(err)
+	assert.Equal(time.Duration(0), retry)
+	retry, err = s.Reserve(ctx, "a", now, time.Minute, delay)
+	assert.NoError(err)
+	assert.Equal(time.Minute, retry)
+
+	// Release and Add release reservation.
+	assert.NoError(s.Release(ctx, "a"))
+	retry, err = s.Reserve(ctx, "a", now, time.Minute, delay)
+	assert.NoError(err)
+	assert.Equal(time.Duration(0), retry)
+	n, err = s.Add(ctx, "a", now, time.Hour)
+	assert.NoError(err)
+	assert.Equal(2, n)
+	retry, err = s.Reserve(ctx, "a", now.Add(time.Second), time.Minute, delay)
+	assert.NoError(err)
+	assert.Equal(time.Minute-time.Second, retry)
+
+	// Failures expire.
+	n, err = s.Add(ctx, "a", now.Add(2*time.Hour), time.Hour)
+	assert.NoError(err)
+	assert.Equal(1, n)
+
+	assert.NoError(s.Reset(ctx, "a"))
+	n, err = s.Add(ctx, "a", now, time.Hour)
+	assert.NoError(err)
+	assert.Equal(1, n)
+}
+
+func TestAttemptStoreConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	db, cleanup := openDB(t)
+	defer cleanup()
+	policy := attempts.Policy{
+		Threshold: 3,
+		BaseDelay: time.Minute,
+		MaxDelay:  time.Hour,
+		Window:    time.Hour,
+	}
+	tr := attempts.New(attempts.Config{
+		Login: policy,
+		IP:    policy,
+		Store: NewAttemptStore(db, SQLite),
+	})
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tr.Check(ctx, "user", "1.1.1.1"); err != nil {
+				assert.True(authkit.IsAccountLocked(err), "%+v", err)
+				return
+			}
+			mu.Lock()
+			allowed++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(policy.Threshold, allowed)
+}
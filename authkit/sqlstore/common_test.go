@@ -0,0 +1,36 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/letsrock-today/authkit/authkit/passhash"
+)
+
+// testHasher uses cheap parameters to keep tests fast.
+var testHasher = passhash.New(
+	passhash.NewArgon2id(passhash.Argon2idParams{Time: 1, Memory: 64, Threads: 1}),
+	passhash.NewPBKDF2(1000))
+
+// openDB returns migrated SQLite database in a temporary directory and
+// a function to remove it.
+func openDB(t *testing.T) (*sql.DB, func()) {
+	dir, err := ioutil.TempDir("", "sqlstore")
+	require.NoError(t, err)
+	db, err := sql.Open(
+		"sqlite3",
+		"file:"+filepath.Join(dir, "test.db")+"?_busy_timeout=5000&_txlock=immediate")
+	require.NoError(t, err)
+	require.NoError(t, Migrate(context.Background(), db, SQLite))
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
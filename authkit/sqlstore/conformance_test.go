@@ -0,0 +1,22 @@
+package sqlstore
+
+import (
+	"testing"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/storetest"
+)
+
+func TestUserStoreConformance(t *testing.T) {
+	storetest.TestUserStore(t, func(t *testing.T) (authkit.UserStore, func()) {
+		db, cleanup := openDB(t)
+		return NewUserStore(db, SQLite, testHasher), cleanup
+	})
+}
+
+func TestProfileServiceConformance(t *testing.T) {
+	storetest.TestProfileService(t, func(t *testing.T) (authkit.ProfileService, func()) {
+		db, cleanup := openDB(t)
+		return NewProfileService(db, SQLite), cleanup
+	})
+}
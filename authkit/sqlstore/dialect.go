@@ -0,0 +1,74 @@
+package sqlstore
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect hides differences between SQL databases from the store.
+// Application may provide its own implementation for databases, which are
+// not supported out of the box.
+type Dialect interface {
+
+	// Rebind converts query with "?" placeholders into the dialect's syntax.
+	Rebind(query string) string
+
+	// IsUniqueViolation checks whether error is caused by violation of
+	// unique (or primary key) constraint.
+	IsUniqueViolation(err error) bool
+}
+
+var (
+	// SQLite is a Dialect for SQLite (tested with github.com/mattn/go-sqlite3).
+	SQLite Dialect = sqlite{}
+
+	// Postgres is a Dialect for PostgreSQL (github.com/lib/pq and similar).
+	Postgres Dialect = postgres{}
+)
+
+type sqlite struct{}
+
+func (sqlite) Rebind(query string) string {
+	return query
+}
+
+func (sqlite) IsUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "UNIQUE constraint failed") ||
+		strings.Contains(msg, "PRIMARY KEY must be unique")
+}
+
+type postgres struct{}
+
+func (postgres) Rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (postgres) IsUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	// Drivers expose SQLSTATE differently, check most common ways.
+	if e, ok := err.(interface {
+		SQLState() string
+	}); ok {
+		return e.SQLState() == "23505"
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "23505") ||
+		strings.Contains(msg, "duplicate key value violates unique constraint")
+}
@@ -0,0 +1,184 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+func (s *userStore) LoginByIdentity(
+	ctx context.Context,
+	providerID, identity string) (string, authkit.UserServiceError) {
+	var login string
+	err := s.db.QueryRowContext(
+		ctx,
+		s.d.Rebind(`SELECT login FROM authkit_identities
+			WHERE provider_id = ? AND identity = ?`),
+		providerID,
+		identity).Scan(&login)
+	if err == sql.ErrNoRows {
+		return "", errors.WithStack(authkit.NewUserNotFoundError(err))
+	}
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return login, nil
+}
+
+func (s *userStore) LinkIdentity(
+	ctx context.Context,
+	login, providerID, identity string) authkit.UserServiceError {
+	if _, err := s.User(ctx, login); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`INSERT INTO authkit_identities (provider_id, identity, login)
+			VALUES (?, ?, ?)`),
+		providerID,
+		identity,
+		login)
+	if !s.d.IsUniqueViolation(err) {
+		return errors.WithStack(err)
+	}
+	// Identity is already linked (to this or another login) or user has
+	// another identity of this provider.
+	l, lerr := s.LoginByIdentity(ctx, providerID, identity)
+	if lerr == nil && l == login {
+		return nil
+	}
+	if lerr != nil && !authkit.IsUserNotFound(lerr) {
+		return lerr
+	}
+	return errors.WithStack(authkit.NewDuplicateUserError(err))
+}
+
+func (s *userStore) CreateWithIdentity(
+	ctx context.Context,
+	login, providerID, identity string) authkit.UserServiceError {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		s.d.Rebind("INSERT INTO authkit_users (login, password_hash) VALUES (?, ?)"),
+		login,
+		authkit.NoPasswordHash)
+	if err == nil {
+		_, err = tx.ExecContext(
+			ctx,
+			s.d.Rebind(`INSERT INTO authkit_identities (provider_id, identity, login)
+				VALUES (?, ?, ?)`),
+			providerID,
+			identity,
+			login)
+	}
+	if err != nil {
+		tx.Rollback()
+		if s.d.IsUniqueViolation(err) {
+			return errors.WithStack(authkit.NewDuplicateUserError(err))
+		}
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+func (s *userStore) Identities(
+	ctx context.Context,
+	login string) (map[string]string, authkit.UserServiceError) {
+	if _, err := s.User(ctx, login); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(
+		ctx,
+		s.d.Rebind(`SELECT provider_id, identity
+			FROM authkit_identities WHERE login = ?`),
+		login)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	identities := make(map[string]string)
+	for rows.Next() {
+		var pid, identity string
+		if err := rows.Scan(&pid, &identity); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		identities[pid] = identity
+	}
+	return identities, errors.WithStack(rows.Err())
+}
+
+// UnlinkIdentity locks the user's row first, so that concurrent unlinks for
+// the same user are serialized and the last login method can't be removed.
+func (s *userStore) UnlinkIdentity(
+	ctx context.Context,
+	login, providerID string) authkit.UserServiceError {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := s.unlinkIdentity(ctx, tx, login, providerID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+func (s *userStore) unlinkIdentity(
+	ctx context.Context,
+	tx *sql.Tx,
+	login, providerID string) authkit.UserServiceError {
+	r, err := tx.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_users SET password_hash = password_hash
+			WHERE login = ?`),
+		login)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if n, err := r.RowsAffected(); err != nil || n == 0 {
+		return errors.WithStack(authkit.NewUserNotFoundError(err))
+	}
+	var (
+		hash         string
+		total, found int
+	)
+	if err := tx.QueryRowContext(
+		ctx,
+		s.d.Rebind("SELECT password_hash FROM authkit_users WHERE login = ?"),
+		login).Scan(&hash); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := tx.QueryRowContext(
+		ctx,
+		s.d.Rebind(`SELECT COUNT(*) FROM authkit_identities WHERE login = ?`),
+		login).Scan(&total); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := tx.QueryRowContext(
+		ctx,
+		s.d.Rebind(`SELECT COUNT(*) FROM authkit_identities
+			WHERE login = ? AND provider_id = ?`),
+		login,
+		providerID).Scan(&found); err != nil {
+		return errors.WithStack(err)
+	}
+	if found == 0 {
+		return nil
+	}
+	if hash == authkit.NoPasswordHash && total == 1 {
+		return errors.WithStack(authkit.NewLastLoginMethodError(nil))
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		s.d.Rebind(`DELETE FROM authkit_identities
+			WHERE login = ? AND provider_id = ?`),
+		login,
+		providerID)
+	return errors.WithStack(err)
+}
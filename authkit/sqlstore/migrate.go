@@ -0,0 +1,199 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// migration is a single step of schema evolution. Migrations are applied in
+// order of versions, every migration in its own transaction.
+// Note: statements should use SQL, which is understood by all supported
+// dialects. Never modify migrations, which are already released, add new ones.
+type migration struct {
+	version    int
+	statements []string
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		statements: []string{
+			`CREATE TABLE authkit_users (
+				login VARCHAR(255) NOT NULL PRIMARY KEY,
+				password_hash VARCHAR(255) NOT NULL
+			)`,
+			`CREATE TABLE authkit_tokens (
+				login VARCHAR(255) NOT NULL,
+				provider_id VARCHAR(255) NOT NULL,
+				access_token TEXT NOT NULL,
+				token_type VARCHAR(255) NOT NULL,
+				refresh_token TEXT NOT NULL,
+				expiry BIGINT NOT NULL,
+				PRIMARY KEY (login, provider_id)
+			)`,
+			`CREATE INDEX authkit_tokens_access_token
+				ON authkit_tokens (provider_id, access_token)`,
+			`CREATE TABLE authkit_profiles (
+				login VARCHAR(255) NOT NULL PRIMARY KEY,
+				email VARCHAR(255) NOT NULL,
+				email_confirmed BOOLEAN NOT NULL,
+				formatted_name VARCHAR(255) NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 2,
+		statements: []string{
+			`ALTER TABLE authkit_users
+				ADD COLUMN totp_secret VARCHAR(255) NOT NULL DEFAULT ''`,
+			`ALTER TABLE authkit_users
+				ADD COLUMN totp_counter BIGINT NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		version: 3,
+		statements: []string{
+			`CREATE TABLE authkit_recovery_codes (
+				login VARCHAR(255) NOT NULL,
+				code_hash VARCHAR(255) NOT NULL,
+				PRIMARY KEY (login, code_hash)
+			)`,
+		},
+	},
+	{
+		version: 4,
+		statements: []string{
+			`CREATE TABLE authkit_identities (
+				provider_id VARCHAR(255) NOT NULL,
+				identity VARCHAR(255) NOT NULL,
+				login VARCHAR(255) NOT NULL,
+				PRIMARY KEY (provider_id, identity)
+			)`,
+			`CREATE UNIQUE INDEX authkit_identities_login
+				ON authkit_identities (login, provider_id)`,
+		},
+	},
+	{
+		version: 5,
+		statements: []string{
+			`CREATE TABLE authkit_sessions (
+				id VARCHAR(255) NOT NULL PRIMARY KEY,
+				login VARCHAR(255) NOT NULL,
+				device TEXT NOT NULL,
+				ip VARCHAR(255) NOT NULL,
+				created BIGINT NOT NULL,
+				last_used BIGINT NOT NULL,
+				access_token TEXT NOT NULL,
+				token_type VARCHAR(255) NOT NULL,
+				refresh_token TEXT NOT NULL,
+				expiry BIGINT NOT NULL
+			)`,
+			`CREATE INDEX authkit_sessions_login
+				ON authkit_sessions (login)`,
+			`CREATE INDEX authkit_sessions_access_token
+				ON authkit_sessions (access_token)`,
+		},
+	},
+	{
+		version: 6,
+		statements: []string{
+			`CREATE TABLE authkit_refresh_tokens (
+				token_hash VARCHAR(255) NOT NULL PRIMARY KEY,
+				family VARCHAR(255) NOT NULL,
+				superseded BOOLEAN NOT NULL
+			)`,
+			`CREATE INDEX authkit_refresh_tokens_family
+				ON authkit_refresh_tokens (family)`,
+		},
+	},
+	{
+		version: 7,
+		statements: []string{
+			`ALTER TABLE authkit_refresh_tokens
+				ADD COLUMN claimed BIGINT NOT NULL DEFAULT 0`,
+			`ALTER TABLE authkit_refresh_tokens
+				ADD COLUMN updated BIGINT NOT NULL DEFAULT 0`,
+			`CREATE INDEX authkit_refresh_tokens_updated
+				ON authkit_refresh_tokens (updated)`,
+		},
+	},
+	{
+		version: 8,
+		statements: []string{
+			`CREATE TABLE authkit_attempts (
+				attempt_key VARCHAR(255) NOT NULL PRIMARY KEY,
+				failures INTEGER NOT NULL,
+				last_attempt BIGINT NOT NULL,
+				expires BIGINT NOT NULL,
+				reserved INTEGER NOT NULL,
+				reserved_until BIGINT NOT NULL
+			)`,
+			`CREATE INDEX authkit_attempts_expires
+				ON authkit_attempts (expires)`,
+		},
+	},
+}
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS authkit_schema_migrations (
+	version INTEGER NOT NULL PRIMARY KEY
+)`
+
+// Migrate creates or updates database schema, required by the store.
+// It should be called at application start, before store is used.
+// Migrate is safe to call on already up-to-date database.
+func Migrate(ctx context.Context, db *sql.DB, d Dialect) error {
+	if _, err := db.ExecContext(ctx, createMigrationsTable); err != nil {
+		return errors.WithStack(err)
+	}
+	current, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := apply(ctx, db, d, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns version of the last applied migration (or 0 if there
+// are no migrations applied yet).
+func SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var v sql.NullInt64
+	err := db.QueryRowContext(
+		ctx,
+		"SELECT MAX(version) FROM authkit_schema_migrations").Scan(&v)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return int(v.Int64), nil
+}
+
+func apply(ctx context.Context, db *sql.DB, d Dialect, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// Register version first, so that concurrent migration from another
+	// instance of application fails early on unique constraint.
+	if _, err := tx.ExecContext(
+		ctx,
+		d.Rebind("INSERT INTO authkit_schema_migrations (version) VALUES (?)"),
+		m.version); err != nil {
+		tx.Rollback()
+		return errors.Wrapf(err, "migration %d", m.version)
+	}
+	for _, s := range m.statements {
+		if _, err := tx.ExecContext(ctx, s); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "migration %d", m.version)
+		}
+	}
+	return errors.WithStack(tx.Commit())
+}
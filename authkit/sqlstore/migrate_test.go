@@ -0,0 +1,45 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	db, cleanup := openDB(t)
+	defer cleanup()
+
+	v, err := SchemaVersion(ctx, db)
+	assert.NoError(err)
+	assert.Equal(migrations[len(migrations)-1].version, v)
+
+	// Repeated migration is no-op.
+	assert.NoError(Migrate(ctx, db, SQLite))
+	v, err = SchemaVersion(ctx, db)
+	assert.NoError(err)
+	assert.Equal(migrations[len(migrations)-1].version, v)
+
+	// Versions are strictly increasing.
+	for i := 1; i < len(migrations); i++ {
+		assert.True(migrations[i-1].version < migrations[i].version)
+	}
+}
+
+func TestDialect(t *testing.T) {
+	assert := assert.New(t)
+	q := "SELECT a FROM t WHERE b = ? AND c = ?"
+	assert.Equal(q, SQLite.Rebind(q))
+	assert.Equal("SELECT a FROM t WHERE b = $1 AND c = $2", Postgres.Rebind(q))
+
+	assert.False(SQLite.IsUniqueViolation(nil))
+	assert.True(SQLite.IsUniqueViolation(
+		errors.New("UNIQUE constraint failed: authkit_users.login")))
+	assert.False(Postgres.IsUniqueViolation(errors.New("some error")))
+	assert.True(Postgres.IsUniqueViolation(errors.New(
+		`pq: duplicate key value violates unique constraint "authkit_users_pkey"`)))
+}
@@ -0,0 +1,205 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+// ProfileService is a database/sql authkit.ProfileService, which additionally
+// allows to retrieve and delete stored profile and to change email.
+type ProfileService interface {
+	authkit.ProfileService
+	authkit.EmailChanger
+	authkit.AccountProfileService
+}
+
+// Profile is a simple authkit.Profile implementation, used to load profiles
+// from the database.
+type Profile struct {
+	Login          string `json:"login"`
+	Email          string `json:"email"`
+	EmailConfirmed bool   `json:"emailconfirmed"`
+	FormattedName  string `json:"formattedname"`
+}
+
+// GetLogin returns login.
+func (p Profile) GetLogin() string {
+	return p.Login
+}
+
+// SetLogin sets login.
+func (p *Profile) SetLogin(login string) {
+	p.Login = login
+}
+
+// GetEmail returns email.
+func (p Profile) GetEmail() string {
+	return p.Email
+}
+
+// IsEmailConfirmed returns true if email is confirmed.
+func (p Profile) IsEmailConfirmed() bool {
+	return p.EmailConfirmed
+}
+
+// GetFormattedName returns user's name.
+func (p Profile) GetFormattedName() string {
+	return p.FormattedName
+}
+
+// NewProfileService returns new ProfileService, which keeps profiles in db.
+// Profiles of any type can be saved into the service, but only fields
+// accessible via authkit.Profile interface are kept.
+func NewProfileService(db *sql.DB, d Dialect) ProfileService {
+	return &profileService{db: db, d: d}
+}
+
+type profileService struct {
+	db *sql.DB
+	d  Dialect
+}
+
+func (s *profileService) Profile(
+	ctx context.Context,
+	login string) (authkit.Profile, error) {
+	p := &Profile{Login: login}
+	err := s.db.QueryRowContext(
+		ctx,
+		s.d.Rebind(`SELECT email, email_confirmed, formatted_name
+			FROM authkit_profiles WHERE login = ?`),
+		login).Scan(&p.Email, &p.EmailConfirmed, &p.FormattedName)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithStack(authkit.NewUserNotFoundError(err))
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return p, nil
+}
+
+func (s *profileService) EnsureExists(
+	ctx context.Context,
+	login, email string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`INSERT INTO authkit_profiles
+			(login, email, email_confirmed, formatted_name)
+			VALUES (?, ?, ?, '')`),
+		login,
+		email,
+		false)
+	if s.d.IsUniqueViolation(err) {
+		return nil
+	}
+	return errors.WithStack(err)
+}
+
+func (s *profileService) Save(ctx context.Context, p authkit.Profile) error {
+	if p == nil || p.GetLogin() == "" {
+		return errors.New("invalid profile")
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	r, err := tx.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_profiles
+			SET email = ?, email_confirmed = ?, formatted_name = ?
+			WHERE login = ?`),
+		p.GetEmail(),
+		p.IsEmailConfirmed(),
+		p.GetFormattedName(),
+		p.GetLogin())
+	if err != nil {
+		tx.Rollback()
+		return errors.WithStack(err)
+	}
+	if n, err := r.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			_, err = tx.ExecContext(
+				ctx,
+				s.d.Rebind(`INSERT INTO authkit_profiles
+					(login, email, email_confirmed, formatted_name)
+					VALUES (?, ?, ?, ?)`),
+				p.GetLogin(),
+				p.GetEmail(),
+				p.IsEmailConfirmed(),
+				p.GetFormattedName())
+		}
+		if err != nil {
+			tx.Rollback()
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+func (s *profileService) SetEmailConfirmed(
+	ctx context.Context,
+	login, email string,
+	confirmed bool) error {
+	r, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_profiles SET email_confirmed = ?
+			WHERE login = ? AND email = ?`),
+		confirmed,
+		login,
+		email)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(requireAffected(r))
+}
+
+func (s *profileService) Email(
+	ctx context.Context,
+	login string) (string, string, error) {
+	p, err := s.Profile(ctx, login)
+	if err != nil {
+		return "", "", err
+	}
+	return p.GetEmail(), p.GetFormattedName(), nil
+}
+
+func (s *profileService) ConfirmedEmail(
+	ctx context.Context,
+	login string) (string, string, error) {
+	p, err := s.Profile(ctx, login)
+	if err != nil {
+		return "", "", err
+	}
+	if !p.IsEmailConfirmed() {
+		return "", "", errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	return p.GetEmail(), p.GetFormattedName(), nil
+}
+
+func (s *profileService) ChangeEmail(
+	ctx context.Context,
+	login, oldEmail, newEmail string) error {
+	r, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_profiles SET email = ?, email_confirmed = ?
+			WHERE login = ? AND email = ?`),
+		newEmail,
+		true,
+		login,
+		oldEmail)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(requireAffected(r))
+}
+
+func (s *profileService) DeleteProfile(ctx context.Context, login string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind("DELETE FROM authkit_profiles WHERE login = ?"),
+		login)
+	return errors.WithStack(err)
+}
@@ -0,0 +1,67 @@
+package sqlstore
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+func (s *userStore) UpdateRecoveryCodes(
+	ctx context.Context,
+	login string,
+	hashes []string) authkit.UserServiceError {
+	if _, err := s.User(ctx, login); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		s.d.Rebind("DELETE FROM authkit_recovery_codes WHERE login = ?"),
+		login); err != nil {
+		tx.Rollback()
+		return errors.WithStack(err)
+	}
+	for _, h := range hashes {
+		if _, err := tx.ExecContext(
+			ctx,
+			s.d.Rebind(`INSERT INTO authkit_recovery_codes (login, code_hash)
+				VALUES (?, ?)`),
+			login,
+			h); err != nil {
+			tx.Rollback()
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+func (s *userStore) UseRecoveryCode(
+	ctx context.Context,
+	login, hash string) (bool, authkit.UserServiceError) {
+	r, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`DELETE FROM authkit_recovery_codes
+			WHERE login = ? AND code_hash = ?`),
+		login,
+		hash)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	if n > 0 {
+		return true, nil
+	}
+	// Distinguish used code from absent user.
+	if _, err := s.User(ctx, login); err != nil {
+		return false, err
+	}
+	return false, nil
+}
@@ -0,0 +1,233 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+// purgeInterval is a minimal interval between removals of expired records
+// (refresh tokens, attempt counters).
+const purgeInterval = time.Minute
+
+func (s *userStore) ClaimRefreshToken(
+	ctx context.Context,
+	token string) authkit.UserServiceError {
+	now := time.Now()
+	if err := s.purgeRefreshTokens(ctx, now); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := s.claimRefreshToken(ctx, tx, token, now); err != nil {
+		tx.Rollback()
+		if s.d.IsUniqueViolation(err) {
+			// Unknown token has been claimed concurrently.
+			err = authkit.NewRefreshTokenClaimedError(err)
+		}
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+func (s *userStore) claimRefreshToken(
+	ctx context.Context,
+	tx *sql.Tx,
+	token string,
+	now time.Time) error {
+	var (
+		superseded bool
+		claimed    int64
+	)
+	err := tx.QueryRowContext(
+		ctx,
+		s.d.Rebind(`SELECT superseded, claimed FROM authkit_refresh_tokens
+			WHERE token_hash = ?`),
+		token).Scan(&superseded, &claimed)
+	if err == sql.ErrNoRows {
+		_, err = tx.ExecContext(
+			ctx,
+			s.d.Rebind(`INSERT INTO authkit_refresh_tokens
+				(token_hash, family, superseded, claimed, updated)
+				VALUES (?, ?, ?, ?, ?)`),
+			token,
+			token,
+			false,
+			expiryToDB(now),
+			expiryToDB(now))
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if superseded {
+		return authkit.NewRefreshTokenReusedError(nil)
+	}
+	if now.Sub(expiryFromDB(claimed)) < authkit.RefreshTokenClaimTimeout {
+		return authkit.NewRefreshTokenClaimedError(nil)
+	}
+	r, err := tx.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_refresh_tokens SET claimed = ?, updated = ?
+			WHERE token_hash = ? AND superseded = ? AND claimed = ?`),
+		expiryToDB(now),
+		expiryToDB(now),
+		token,
+		false,
+		claimed)
+	if err != nil {
+		return err
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// Token has been claimed or rotated concurrently.
+		return authkit.NewRefreshTokenClaimedError(nil)
+	}
+	return nil
+}
+
+func (s *userStore) ReleaseRefreshToken(
+	ctx context.Context,
+	token string) authkit.UserServiceError {
+	_, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_refresh_tokens SET claimed = ?
+			WHERE token_hash = ? AND superseded = ?`),
+		0,
+		token,
+		false)
+	return errors.WithStack(err)
+}
+
+func (s *userStore) RotateRefreshToken(
+	ctx context.Context,
+	old, new string) authkit.UserServiceError {
+	now := time.Now()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	family, err := s.supersedeRefreshToken(ctx, tx, old, now)
+	if err == nil {
+		_, err = tx.ExecContext(
+			ctx,
+			s.d.Rebind(`INSERT INTO authkit_refresh_tokens
+				(token_hash, family, superseded, claimed, updated)
+				VALUES (?, ?, ?, ?, ?)`),
+			new,
+			family,
+			false,
+			0,
+			expiryToDB(now))
+	}
+	if err != nil {
+		tx.Rollback()
+		if s.d.IsUniqueViolation(err) {
+			// Unknown token has been rotated concurrently.
+			err = authkit.NewRefreshTokenReusedError(err)
+		}
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+// supersedeRefreshToken marks token as superseded and returns its family.
+// Unknown token starts new family.
+func (s *userStore) supersedeRefreshToken(
+	ctx context.Context,
+	tx *sql.Tx,
+	token string,
+	now time.Time) (string, error) {
+	var (
+		family     string
+		superseded bool
+	)
+	err := tx.QueryRowContext(
+		ctx,
+		s.d.Rebind(`SELECT family, superseded FROM authkit_refresh_tokens
+			WHERE token_hash = ?`),
+		token).Scan(&family, &superseded)
+	if err == sql.ErrNoRows {
+		_, err = tx.ExecContext(
+			ctx,
+			s.d.Rebind(`INSERT INTO authkit_refresh_tokens
+				(token_hash, family, superseded, claimed, updated)
+				VALUES (?, ?, ?, ?, ?)`),
+			token,
+			token,
+			true,
+			0,
+			expiryToDB(now))
+		return token, err
+	}
+	if err != nil {
+		return "", err
+	}
+	if superseded {
+		return "", authkit.NewRefreshTokenReusedError(nil)
+	}
+	r, err := tx.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_refresh_tokens
+			SET superseded = ?, claimed = ?, updated = ?
+			WHERE token_hash = ? AND superseded = ?`),
+		true,
+		0,
+		expiryToDB(now),
+		token,
+		false)
+	if err != nil {
+		return "", err
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		// Token has been rotated concurrently.
+		return "", authkit.NewRefreshTokenReusedError(nil)
+	}
+	return family, nil
+}
+
+func (s *userStore) RevokeRefreshTokenFamily(
+	ctx context.Context,
+	token string) authkit.UserServiceError {
+	_, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_refresh_tokens SET superseded = ?
+			WHERE family IN (SELECT family FROM authkit_refresh_tokens
+				WHERE token_hash = ?)`),
+		true,
+		token)
+	return errors.WithStack(err)
+}
+
+// purgeRefreshTokens removes records, which are older than
+// authkit.RefreshTokenRetention. It does nothing, if records have been
+// removed less than purgeInterval ago.
+func (s *userStore) purgeRefreshTokens(
+	ctx context.Context,
+	now time.Time) authkit.UserServiceError {
+	s.mu.Lock()
+	if now.Sub(s.lastPurge) < purgeInterval {
+		s.mu.Unlock()
+		return nil
+	}
+	s.lastPurge = now
+	s.mu.Unlock()
+	_, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind("DELETE FROM authkit_refresh_tokens WHERE updated < ?"),
+		expiryToDB(now.Add(-authkit.RefreshTokenRetention)))
+	return errors.WithStack(err)
+}
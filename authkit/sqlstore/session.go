@@ -0,0 +1,184 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+const selectSession = `SELECT id, login, device, ip, created, last_used,
+	access_token, token_type, refresh_token, expiry FROM authkit_sessions`
+
+func (s *userStore) CreateSession(
+	ctx context.Context,
+	ss authkit.Session,
+	token *oauth2.Token) authkit.UserServiceError {
+	if _, err := s.User(ctx, ss.Login); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`INSERT INTO authkit_sessions
+			(id, login, device, ip, created, last_used,
+			access_token, token_type, refresh_token, expiry)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		ss.ID,
+		ss.Login,
+		ss.Device,
+		ss.IP,
+		expiryToDB(ss.Created),
+		expiryToDB(ss.LastUsed),
+		token.AccessToken,
+		token.TokenType,
+		token.RefreshToken,
+		expiryToDB(token.Expiry))
+	if s.d.IsUniqueViolation(err) {
+		return errors.WithStack(authkit.NewDuplicateUserError(err))
+	}
+	return errors.WithStack(err)
+}
+
+func (s *userStore) Sessions(
+	ctx context.Context,
+	login string) ([]authkit.Session, authkit.UserServiceError) {
+	if _, err := s.User(ctx, login); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(
+		ctx,
+		s.d.Rebind(selectSession+" WHERE login = ? ORDER BY created"),
+		login)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	sessions := []authkit.Session{}
+	for rows.Next() {
+		ss, _, err := scanSession(rows)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		sessions = append(sessions, ss)
+	}
+	return sessions, errors.WithStack(rows.Err())
+}
+
+func (s *userStore) SessionByAccessToken(
+	ctx context.Context,
+	accessToken string) (authkit.Session, *oauth2.Token, authkit.UserServiceError) {
+	if accessToken == "" {
+		return authkit.Session{}, nil, errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	ss, t, err := scanSession(s.db.QueryRowContext(
+		ctx,
+		s.d.Rebind(selectSession+" WHERE access_token = ?"),
+		accessToken))
+	if err == sql.ErrNoRows {
+		return authkit.Session{}, nil, errors.WithStack(authkit.NewUserNotFoundError(err))
+	}
+	if err != nil {
+		return authkit.Session{}, nil, errors.WithStack(err)
+	}
+	return ss, t, nil
+}
+
+func (s *userStore) SessionToken(
+	ctx context.Context,
+	login, id string) (*oauth2.Token, authkit.UserServiceError) {
+	_, t, err := scanSession(s.db.QueryRowContext(
+		ctx,
+		s.d.Rebind(selectSession+" WHERE id = ? AND login = ?"),
+		id,
+		login))
+	if err == sql.ErrNoRows {
+		return nil, errors.WithStack(authkit.NewUserNotFoundError(err))
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return t, nil
+}
+
+func (s *userStore) UpdateSessionToken(
+	ctx context.Context,
+	id string,
+	token *oauth2.Token) authkit.UserServiceError {
+	r, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_sessions
+			SET access_token = ?, token_type = ?, refresh_token = ?, expiry = ?
+			WHERE id = ?`),
+		token.AccessToken,
+		token.TokenType,
+		token.RefreshToken,
+		expiryToDB(token.Expiry),
+		id)
+	if err == nil {
+		err = requireAffected(r)
+	}
+	return errors.WithStack(err)
+}
+
+func (s *userStore) TouchSession(
+	ctx context.Context,
+	accessToken, ip string,
+	lastUsed time.Time) authkit.UserServiceError {
+	if accessToken == "" {
+		return nil
+	}
+	_, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_sessions SET ip = ?, last_used = ?
+			WHERE access_token = ?`),
+		ip,
+		expiryToDB(lastUsed),
+		accessToken)
+	return errors.WithStack(err)
+}
+
+func (s *userStore) DeleteSession(
+	ctx context.Context,
+	login, id string) authkit.UserServiceError {
+	_, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind("DELETE FROM authkit_sessions WHERE id = ? AND login = ?"),
+		id,
+		login)
+	return errors.WithStack(err)
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row scanner) (authkit.Session, *oauth2.Token, error) {
+	var (
+		ss                     authkit.Session
+		created, lastUsed, exp int64
+	)
+	t := &oauth2.Token{}
+	if err := row.Scan(
+		&ss.ID,
+		&ss.Login,
+		&ss.Device,
+		&ss.IP,
+		&created,
+		&lastUsed,
+		&t.AccessToken,
+		&t.TokenType,
+		&t.RefreshToken,
+		&exp); err != nil {
+		return authkit.Session{}, nil, err
+	}
+	ss.Created = expiryFromDB(created)
+	ss.LastUsed = expiryFromDB(lastUsed)
+	t.Expiry = expiryFromDB(exp)
+	return ss, t, nil
+}
@@ -0,0 +1,70 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+func (s *userStore) TOTPSecret(
+	ctx context.Context,
+	login string) (string, authkit.UserServiceError) {
+	var secret string
+	err := s.db.QueryRowContext(
+		ctx,
+		s.d.Rebind("SELECT totp_secret FROM authkit_users WHERE login = ?"),
+		login).Scan(&secret)
+	if err == sql.ErrNoRows {
+		return "", errors.WithStack(authkit.NewUserNotFoundError(err))
+	}
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return secret, nil
+}
+
+func (s *userStore) UpdateTOTPSecret(
+	ctx context.Context,
+	login, secret string) authkit.UserServiceError {
+	r, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_users SET totp_secret = ?, totp_counter = 0
+			WHERE login = ?`),
+		secret,
+		login)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(requireAffected(r))
+}
+
+func (s *userStore) UseTOTPCounter(
+	ctx context.Context,
+	login string,
+	counter int64) (bool, authkit.UserServiceError) {
+	r, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_users SET totp_counter = ?
+			WHERE login = ? AND totp_counter < ?`),
+		counter,
+		login,
+		counter)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	if n > 0 {
+		return true, nil
+	}
+	// Distinguish used counter from absent user.
+	if _, err := s.User(ctx, login); err != nil {
+		return false, err
+	}
+	return false, nil
+}
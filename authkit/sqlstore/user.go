@@ -0,0 +1,351 @@
+// Package sqlstore provides implementations of authkit.UserStore,
+// authkit.TokenStore, authkit.ProfileService and attempts.Store, backed by
+// database/sql.
+// Database schema should be created with Migrate before stores are used.
+// Driver is not imported by this package, application should import one
+// and provide matching Dialect.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pkg/errors"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/passhash"
+)
+
+// NewUserService returns new authkit.UserService, which keeps users in db and
+// uses provided authkit.Confirmer to request confirmations.
+// See NewUserStore for h.
+func NewUserService(
+	db *sql.DB,
+	d Dialect,
+	c authkit.Confirmer,
+	h passhash.Hasher) authkit.UserService {
+	s := newUserStore(db, d, h)
+	return struct {
+		authkit.UserStore
+		authkit.TOTPStore
+		authkit.RecoveryCodeStore
+		authkit.AccountStore
+		authkit.IdentityStore
+		authkit.SessionStore
+		authkit.RefreshTokenFamilyStore
+		authkit.Confirmer
+	}{
+		s,
+		s,
+		s,
+		s,
+		s,
+		s,
+		s,
+		c,
+	}
+}
+
+// NewUserStore returns new authkit.UserStore, which keeps users in db.
+// Returned store also implements authkit.TokenStore, tokens are kept in a
+// separate table, one row per user and provider.
+// Returned store also implements authkit.TOTPStore,
+// authkit.RecoveryCodeStore, authkit.AccountStore, authkit.IdentityStore,
+// authkit.SessionStore and authkit.RefreshTokenFamilyStore.
+// Passwords are hashed with h, if h is nil, then passhash.Default() is used.
+func NewUserStore(db *sql.DB, d Dialect, h passhash.Hasher) authkit.UserStore {
+	return newUserStore(db, d, h)
+}
+
+func newUserStore(db *sql.DB, d Dialect, h passhash.Hasher) *userStore {
+	if h == nil {
+		h = passhash.Default()
+	}
+	return &userStore{db: db, d: d, hasher: h}
+}
+
+type user struct {
+	login        string
+	passwordHash string
+}
+
+func (u user) Login() string {
+	return u.login
+}
+
+func (u user) PasswordHash() string {
+	return u.passwordHash
+}
+
+type userStore struct {
+	db     *sql.DB
+	d      Dialect
+	hasher passhash.Hasher
+
+	// mu guards lastPurge of refresh token records.
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+func (s *userStore) User(
+	ctx context.Context,
+	login string) (authkit.User, authkit.UserServiceError) {
+	u := user{login: login}
+	err := s.db.QueryRowContext(
+		ctx,
+		s.d.Rebind("SELECT password_hash FROM authkit_users WHERE login = ?"),
+		login).Scan(&u.passwordHash)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithStack(authkit.NewUserNotFoundError(err))
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return u, nil
+}
+
+func (s *userStore) Principal(u authkit.User) interface{} {
+	return u
+}
+
+func (s *userStore) Create(
+	ctx context.Context,
+	login, password string) authkit.UserServiceError {
+	h, err := s.hasher.Hash(password)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = s.db.ExecContext(
+		ctx,
+		s.d.Rebind("INSERT INTO authkit_users (login, password_hash) VALUES (?, ?)"),
+		login,
+		h)
+	if s.d.IsUniqueViolation(err) {
+		return errors.WithStack(authkit.NewDuplicateUserError(err))
+	}
+	return errors.WithStack(err)
+}
+
+func (s *userStore) Authenticate(
+	ctx context.Context,
+	login, password string) authkit.UserServiceError {
+	u, err := s.User(ctx, login)
+	if err != nil {
+		return err
+	}
+	if u.PasswordHash() == authkit.NoPasswordHash {
+		// User without password can't authenticate.
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	valid, rehash, err := s.hasher.Verify(password, u.PasswordHash())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !valid {
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	if rehash {
+		// Failed rehash doesn't prevent login, it will be retried next time.
+		if h, err := s.hasher.Hash(password); err == nil {
+			s.db.ExecContext(
+				ctx,
+				s.d.Rebind(`UPDATE authkit_users SET password_hash = ?
+					WHERE login = ? AND password_hash = ?`),
+				h,
+				login,
+				u.PasswordHash())
+		}
+	}
+	return nil
+}
+
+func (s *userStore) UpdatePassword(
+	ctx context.Context,
+	login, oldPasswordHash, newPassword string) authkit.UserServiceError {
+	h, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	r, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_users SET password_hash = ?
+			WHERE login = ? AND password_hash = ?`),
+		h,
+		login,
+		oldPasswordHash)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(requireAffected(r))
+}
+
+func (s *userStore) OAuth2Token(
+	ctx context.Context,
+	login, providerID string) (*oauth2.Token, authkit.UserServiceError) {
+	if _, err := s.User(ctx, login); err != nil {
+		return nil, err
+	}
+	t, err := scanToken(s.db.QueryRowContext(
+		ctx,
+		s.d.Rebind(`SELECT access_token, token_type, refresh_token, expiry
+			FROM authkit_tokens WHERE login = ? AND provider_id = ?`),
+		login,
+		providerID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return t, nil
+}
+
+func (s *userStore) OAuth2TokenAndLoginByAccessToken(
+	ctx context.Context,
+	accessToken, providerID string) (*oauth2.Token, string, authkit.UserServiceError) {
+	if accessToken == "" {
+		return nil, "", errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	var login string
+	t, err := scanToken(
+		s.db.QueryRowContext(
+			ctx,
+			s.d.Rebind(`SELECT access_token, token_type, refresh_token, expiry, login
+				FROM authkit_tokens WHERE provider_id = ? AND access_token = ?`),
+			providerID,
+			accessToken),
+		&login)
+	if err == sql.ErrNoRows {
+		return nil, "", errors.WithStack(authkit.NewUserNotFoundError(err))
+	}
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	return t, login, nil
+}
+
+func (s *userStore) UpdateOAuth2Token(
+	ctx context.Context,
+	login, providerID string,
+	token *oauth2.Token) authkit.UserServiceError {
+	if _, err := s.User(ctx, login); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := updateToken(ctx, tx, s.d, login, providerID, token); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+// RevokeAccessToken removes access token from the store, but keeps the rest
+// of the token (refresh token), similar to the sample MongoDB store.
+func (s *userStore) RevokeAccessToken(
+	ctx context.Context,
+	providerID, accessToken string) authkit.UserServiceError {
+	if accessToken == "" {
+		return nil
+	}
+	_, err := s.db.ExecContext(
+		ctx,
+		s.d.Rebind(`UPDATE authkit_tokens SET access_token = ''
+			WHERE provider_id = ? AND access_token = ?`),
+		providerID,
+		accessToken)
+	return errors.WithStack(err)
+}
+
+func updateToken(
+	ctx context.Context,
+	tx *sql.Tx,
+	d Dialect,
+	login, providerID string,
+	token *oauth2.Token) error {
+	if token == nil {
+		_, err := tx.ExecContext(
+			ctx,
+			d.Rebind("DELETE FROM authkit_tokens WHERE login = ? AND provider_id = ?"),
+			login,
+			providerID)
+		return errors.WithStack(err)
+	}
+	expiry := expiryToDB(token.Expiry)
+	r, err := tx.ExecContext(
+		ctx,
+		d.Rebind(`UPDATE authkit_tokens
+			SET access_token = ?, token_type = ?, refresh_token = ?, expiry = ?
+			WHERE login = ? AND provider_id = ?`),
+		token.AccessToken,
+		token.TokenType,
+		token.RefreshToken,
+		expiry,
+		login,
+		providerID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if n, err := r.RowsAffected(); err != nil || n > 0 {
+		return errors.WithStack(err)
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		d.Rebind(`INSERT INTO authkit_tokens
+			(login, provider_id, access_token, token_type, refresh_token, expiry)
+			VALUES (?, ?, ?, ?, ?, ?)`),
+		login,
+		providerID,
+		token.AccessToken,
+		token.TokenType,
+		token.RefreshToken,
+		expiry)
+	return errors.WithStack(err)
+}
+
+func scanToken(row *sql.Row, extra ...interface{}) (*oauth2.Token, error) {
+	t := &oauth2.Token{}
+	var expiry int64
+	dest := append(
+		[]interface{}{&t.AccessToken, &t.TokenType, &t.RefreshToken, &expiry},
+		extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	t.Expiry = expiryFromDB(expiry)
+	return t, nil
+}
+
+// Expiry (and other times) is stored as Unix time in nanoseconds, zero time
+// is stored as 0.
+func expiryToDB(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func expiryFromDB(v int64) time.Time {
+	if v == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, v)
+}
+
+// requireAffected returns UserNotFoundError if statement didn't affect rows.
+func requireAffected(r sql.Result) error {
+	n, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return authkit.NewUserNotFoundError(nil)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package sqlstore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/passhash"
+)
+
+func TestUserStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	db, cleanup := openDB(t)
+	defer cleanup()
+	s := NewUserStore(db, SQLite, testHasher)
+
+	_, err := s.User(ctx, "valid@login.ok")
+	assert.True(authkit.IsUserNotFound(err))
+
+	assert.NoError(s.Create(ctx, "valid@login.ok", "valid_password"))
+	err = s.Create(ctx, "valid@login.ok", "other_password")
+	assert.True(authkit.IsDuplicateUser(err))
+
+	u, err := s.User(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Equal("valid@login.ok", u.Login())
+	assert.NotEqual("valid_password", u.PasswordHash())
+	assert.Equal(u, s.Principal(u))
+
+	assert.NoError(s.Authenticate(ctx, "valid@login.ok", "valid_password"))
+	err = s.Authenticate(ctx, "valid@login.ok", "invalid_password")
+	assert.True(authkit.IsUserNotFound(err))
+	err = s.Authenticate(ctx, "unknown@login.ok", "valid_password")
+	assert.True(authkit.IsUserNotFound(err))
+
+	err = s.UpdatePassword(ctx, "valid@login.ok", "invalid_hash", "new_password")
+	assert.True(authkit.IsUserNotFound(err))
+	assert.NoError(s.UpdatePassword(ctx, "valid@login.ok", u.PasswordHash(), "new_password"))
+	assert.NoError(s.Authenticate(ctx, "valid@login.ok", "new_password"))
+	err = s.Authenticate(ctx, "valid@login.ok", "valid_password")
+	assert.True(authkit.IsUserNotFound(err))
+}
+
+func TestUserStoreRehash(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	db, cleanup := openDB(t)
+	defer cleanup()
+	s := NewUserStore(db, SQLite, testHasher)
+
+	legacy, err := passhash.NewPBKDF2(1000).Hash("valid_password")
+	assert.NoError(err)
+	_, err = db.Exec(
+		"INSERT INTO authkit_users (login, password_hash) VALUES (?, ?)",
+		"valid@login.ok",
+		legacy)
+	assert.NoError(err)
+
+	err = s.Authenticate(ctx, "valid@login.ok", "invalid_password")
+	assert.True(authkit.IsUserNotFound(err))
+	u, err := s.User(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Equal(legacy, u.PasswordHash())
+
+	assert.NoError(s.Authenticate(ctx, "valid@login.ok", "valid_password"))
+	u, err = s.User(ctx, "valid@login.ok")
+	assert.NoError(err)
+	assert.Contains(u.PasswordHash(), "$argon2id$")
+	assert.NoError(s.Authenticate(ctx, "valid@login.ok", "valid_password"))
+}
+
+func TestUserStoreConcurrentCreate(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := openDB(t)
+	defer cleanup()
+	s := NewUserStore(db, SQLite, testHasher)
+	const n = 20
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		ok   int
+		dups int
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Create(ctx, "valid@login.ok", "valid_password")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				ok++
+			case authkit.IsDuplicateUser(err):
+				dups++
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, ok)
+	assert.Equal(t, n-1, dups)
+}
+
+func TestTokenStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	db, cleanup := openDB(t)
+	defer cleanup()
+	s := NewUserStore(db, SQLite, testHasher)
+
+	token := &oauth2.Token{AccessToken: "xxx", RefreshToken: "rrr"}
+	err := s.UpdateOAuth2Token(ctx, "unknown@login.ok", "provider-1", token)
+	assert.True(authkit.IsUserNotFound(err))
+	_, err = s.OAuth2Token(ctx, "unknown@login.ok", "provider-1")
+	assert.True(authkit.IsUserNotFound(err))
+
+	assert.NoError(s.Create(ctx, "valid@login.ok", "valid_password"))
+	tt, err := s.OAuth2Token(ctx, "valid@login.ok", "provider-1")
+	assert.NoError(err)
+	assert.Nil(tt)
+
+	assert.NoError(s.UpdateOAuth2Token(ctx, "valid@login.ok", "provider-1", token))
+	tt, err = s.OAuth2Token(ctx, "valid@login.ok", "provider-1")
+	assert.NoError(err)
+	assert.Equal("xxx", tt.AccessToken)
+
+	tt, login, err := s.OAuth2TokenAndLoginByAccessToken(ctx, "xxx", "provider-1")
+	assert.NoError(err)
+	assert.Equal("valid@login.ok", login)
+	assert.Equal("rrr", tt.RefreshToken)
+	_, _, err = s.OAuth2TokenAndLoginByAccessToken(ctx, "xxx", "provider-2")
+	assert.True(authkit.IsUserNotFound(err))
+
+	// Replaced token is not found by old access token.
+	token2 := &oauth2.Token{AccessToken: "yyy", RefreshToken: "rrr2"}
+	assert.NoError(s.UpdateOAuth2Token(ctx, "valid@login.ok", "provider-1", token2))
+	_, _, err = s.OAuth2TokenAndLoginByAccessToken(ctx, "xxx", "provider-1")
+	assert.True(authkit.IsUserNotFound(err))
+	_, login, err = s.OAuth2TokenAndLoginByAccessToken(ctx, "yyy", "provider-1")
+	assert.NoError(err)
+	assert.Equal("valid@login.ok", login)
+
+	// Stored token is not affected by modification of the original one.
+	token2.AccessToken = "zzz"
+	tt, err = s.OAuth2Token(ctx, "valid@login.ok", "provider-1")
+	assert.NoError(err)
+	assert.Equal("yyy", tt.AccessToken)
+
+	assert.NoError(s.RevokeAccessToken(ctx, "provider-1", "yyy"))
+	assert.NoError(s.RevokeAccessToken(ctx, "provider-1", "unknown"))
+	_, _, err = s.OAuth2TokenAndLoginByAccessToken(ctx, "yyy", "provider-1")
+	assert.True(authkit.IsUserNotFound(err))
+	tt, err = s.OAuth2Token(ctx, "valid@login.ok", "provider-1")
+	assert.NoError(err)
+	assert.Equal("", tt.AccessToken)
+	assert.Equal("rrr2", tt.RefreshToken)
+}
+
+func TestTokenStoreExpiry(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	db, cleanup := openDB(t)
+	defer cleanup()
+	s := NewUserStore(db, SQLite, testHasher)
+	assert.NoError(s.Create(ctx, "valid@login.ok", "valid_password"))
+
+	expiry := time.Now().Add(time.Hour)
+	assert.NoError(s.UpdateOAuth2Token(
+		ctx,
+		"valid@login.ok",
+		"provider-1",
+		&oauth2.Token{AccessToken: "xxx", TokenType: "Bearer", Expiry: expiry}))
+	tt, err := s.OAuth2Token(ctx, "valid@login.ok", "provider-1")
+	assert.NoError(err)
+	assert.Equal("Bearer", tt.TokenType)
+	assert.True(expiry.Equal(tt.Expiry))
+
+	assert.NoError(s.UpdateOAuth2Token(
+		ctx,
+		"valid@login.ok",
+		"provider-1",
+		&oauth2.Token{AccessToken: "yyy"}))
+	tt, err = s.OAuth2Token(ctx, "valid@login.ok", "provider-1")
+	assert.NoError(err)
+	assert.True(tt.Expiry.IsZero())
+
+	// Tokens of different providers are independent.
+	assert.NoError(s.UpdateOAuth2Token(
+		ctx,
+		"valid@login.ok",
+		"provider-2",
+		&oauth2.Token{AccessToken: "zzz"}))
+	assert.NoError(s.UpdateOAuth2Token(ctx, "valid@login.ok", "provider-1", nil))
+	tt, err = s.OAuth2Token(ctx, "valid@login.ok", "provider-1")
+	assert.NoError(err)
+	assert.Nil(tt)
+	tt, err = s.OAuth2Token(ctx, "valid@login.ok", "provider-2")
+	assert.NoError(err)
+	assert.Equal("zzz", tt.AccessToken)
+}
+
+func TestPurgeRefreshTokens(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	db, cleanup := openDB(t)
+	defer cleanup()
+	s := newUserStore(db, SQLite, testHasher)
+
+	assert.NoError(s.RotateRefreshToken(ctx, "rt-1", "rt-2"))
+	assert.NoError(s.RotateRefreshToken(ctx, "other-1", "other-2"))
+	_, err := db.ExecContext(
+		ctx,
+		"UPDATE authkit_refresh_tokens SET updated = ? WHERE family = ?",
+		expiryToDB(time.Now().Add(-authkit.RefreshTokenRetention-time.Minute)),
+		"rt-1")
+	assert.NoError(err)
+
+	// Records are removed after retention period since the last rotation.
+	assert.NoError(s.ClaimRefreshToken(ctx, "new-1"))
+	var n int
+	assert.NoError(db.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM authkit_refresh_tokens WHERE family = ?",
+		"rt-1").Scan(&n))
+	assert.Equal(0, n)
+	assert.NoError(db.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM authkit_refresh_tokens").Scan(&n))
+	assert.Equal(3, n)
+}
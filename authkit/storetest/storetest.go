@@ -0,0 +1,1418 @@
+// Package storetest provides conformance tests for implementations of
+// authkit.UserStore (including authkit.TokenStore and optional
+// authkit.TOTPStore, authkit.RecoveryCodeStore, authkit.AccountStore,
+// authkit.IdentityStore, authkit.SessionStore and
+// authkit.RefreshTokenFamilyStore) and authkit.ProfileService.
+// Tests check contracts, which handlers and middleware rely on. Implementation
+// packages should call them from their own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.TestUserStore(t, func(t *testing.T) (authkit.UserStore, func()) {
+//			return NewUserStore(nil), func() {}
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+type (
+
+	// UserStoreFactory creates new empty store for a single test.
+	// Returned function is called at the end of the test to release resources.
+	UserStoreFactory func(t *testing.T) (authkit.UserStore, func())
+
+	// ProfileServiceFactory creates new empty service for a single test.
+	// Returned function is called at the end of the test to release resources.
+	ProfileServiceFactory func(t *testing.T) (authkit.ProfileService, func())
+)
+
+// TestUserStore runs conformance tests for authkit.UserStore. Every subtest
+// uses separate store, created by newStore.
+func TestUserStore(t *testing.T, newStore UserStoreFactory) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, authkit.UserStore)
+	}{
+		{"User", testUser},
+		{"Create", testCreate},
+		{"ConcurrentCreate", testConcurrentCreate},
+		{"Authenticate", testAuthenticate},
+		{"UpdatePassword", testUpdatePassword},
+		{"OAuth2Token", testOAuth2Token},
+		{"OAuth2TokenAndLoginByAccessToken", testOAuth2TokenAndLoginByAccessToken},
+		{"UpdateOAuth2Token", testUpdateOAuth2Token},
+		{"ConcurrentUpdateOAuth2Token", testConcurrentUpdateOAuth2Token},
+		{"RevokeAccessToken", testRevokeAccessToken},
+		{"TOTPSecret", withTOTPStore(testTOTPSecret)},
+		{"UseTOTPCounter", withTOTPStore(testUseTOTPCounter)},
+		{"ConcurrentUseTOTPCounter", withTOTPStore(testConcurrentUseTOTPCounter)},
+		{"RecoveryCodes", withRecoveryCodeStore(testRecoveryCodes)},
+		{"ConcurrentUseRecoveryCode", withRecoveryCodeStore(testConcurrentUseRecoveryCode)},
+		{"OAuth2Tokens", withAccountStore(testOAuth2Tokens)},
+		{"DeleteUser", withAccountStore(testDeleteUser)},
+		{"LinkIdentity", withIdentityStore(testLinkIdentity)},
+		{"ConcurrentLinkIdentity", withIdentityStore(testConcurrentLinkIdentity)},
+		{"CreateWithIdentity", withIdentityStore(testCreateWithIdentity)},
+		{"UnlinkIdentity", withIdentityStore(testUnlinkIdentity)},
+		{"UnlinkLastIdentity", withIdentityStore(testUnlinkLastIdentity)},
+		{"ConcurrentUnlinkIdentity", withIdentityStore(testConcurrentUnlinkIdentity)},
+		{"Sessions", withSessionStore(testSessions)},
+		{"UpdateSessionToken", withSessionStore(testUpdateSessionToken)},
+		{"DeleteUserSessions", withSessionStore(testDeleteUserSessions)},
+		{"RotateRefreshToken", withRefreshTokenFamilyStore(testRotateRefreshToken)},
+		{"ClaimRefreshToken", withRefreshTokenFamilyStore(testClaimRefreshToken)},
+		{"ConcurrentClaimRefreshToken", withRefreshTokenFamilyStore(testConcurrentClaimRefreshToken)},
+		{"ConcurrentRotateRefreshToken", withRefreshTokenFamilyStore(testConcurrentRotateRefreshToken)},
+		{"RevokeRefreshTokenFamily", withRefreshTokenFamilyStore(testRevokeRefreshTokenFamily)},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s, cleanup := newStore(t)
+			defer cleanup()
+			tt.fn(t, s)
+		})
+	}
+}
+
+// TestProfileService runs conformance tests for authkit.ProfileService.
+// Every subtest uses separate service, created by newService.
+func TestProfileService(t *testing.T, newService ProfileServiceFactory) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, authkit.ProfileService)
+	}{
+		{"EnsureExists", testEnsureExists},
+		{"Save", testSave},
+		{"SetEmailConfirmed", testSetEmailConfirmed},
+		{"ConfirmedEmail", testConfirmedEmail},
+		{"ConcurrentEnsureExists", testConcurrentEnsureExists},
+		{"ChangeEmail", testChangeEmail},
+		{"DeleteProfile", testDeleteProfile},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s, cleanup := newService(t)
+			defer cleanup()
+			tt.fn(t, s)
+		})
+	}
+}
+
+const (
+	login    = "valid@login.ok"
+	password = "valid_password"
+	provider = "provider-1"
+)
+
+func createUser(t *testing.T, s authkit.UserStore, login string) {
+	require.NoError(t, s.Create(context.Background(), login, password))
+}
+
+func testUser(t *testing.T, s authkit.UserStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	_, err := s.User(ctx, login)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	createUser(t, s, login)
+	u, err := s.User(ctx, login)
+	require.NoError(t, err)
+	assert.Equal(login, u.Login())
+	assert.NotEmpty(u.PasswordHash())
+	assert.NotEqual(password, u.PasswordHash(), "password should not be stored as is")
+	assert.NotNil(s.Principal(u))
+
+	_, err = s.User(ctx, "unknown@login.ok")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+}
+
+func testCreate(t *testing.T, s authkit.UserStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	assert.NoError(s.Create(ctx, login, password))
+	err := s.Create(ctx, login, "other_password")
+	assert.True(authkit.IsDuplicateUser(err), "unexpected error: %+v", err)
+
+	// Failed Create doesn't change existing user.
+	assert.NoError(s.Authenticate(ctx, login, password))
+
+	assert.NoError(s.Create(ctx, "other@login.ok", password))
+}
+
+func testConcurrentCreate(t *testing.T, s authkit.UserStore) {
+	ctx := context.Background()
+	const n = 20
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		ok     int
+		dups   int
+		failed []error
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Create(ctx, login, password)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				ok++
+			case authkit.IsDuplicateUser(err):
+				dups++
+			default:
+				failed = append(failed, err)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Empty(t, failed)
+	assert.Equal(t, 1, ok)
+	assert.Equal(t, n-1, dups)
+}
+
+func testAuthenticate(t *testing.T, s authkit.UserStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	err := s.Authenticate(ctx, login, password)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	createUser(t, s, login)
+	assert.NoError(s.Authenticate(ctx, login, password))
+	err = s.Authenticate(ctx, login, "invalid_password")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	err = s.Authenticate(ctx, login, authkit.NoPasswordHash)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+}
+
+func testUpdatePassword(t *testing.T, s authkit.UserStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	err := s.UpdatePassword(ctx, login, "any_hash", "new_password")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	createUser(t, s, login)
+	u, err := s.User(ctx, login)
+	require.NoError(t, err)
+
+	err = s.UpdatePassword(ctx, login, "invalid_hash", "new_password")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	assert.NoError(s.Authenticate(ctx, login, password))
+
+	assert.NoError(s.UpdatePassword(ctx, login, u.PasswordHash(), "new_password"))
+	assert.NoError(s.Authenticate(ctx, login, "new_password"))
+	err = s.Authenticate(ctx, login, password)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	// Old hash can't be used twice (it's used as a one-time confirmation).
+	err = s.UpdatePassword(ctx, login, u.PasswordHash(), "other_password")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	assert.NoError(s.Authenticate(ctx, login, "new_password"))
+}
+
+func testOAuth2Token(t *testing.T, s authkit.UserStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	_, err := s.OAuth2Token(ctx, login, provider)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	createUser(t, s, login)
+	token, err := s.OAuth2Token(ctx, login, provider)
+	assert.NoError(err)
+	assert.Nil(token)
+
+	require.NoError(t, s.UpdateOAuth2Token(
+		ctx,
+		login,
+		provider,
+		&oauth2.Token{
+			AccessToken:  "access-1",
+			TokenType:    "Bearer",
+			RefreshToken: "refresh-1",
+		}))
+	token, err = s.OAuth2Token(ctx, login, provider)
+	require.NoError(t, err)
+	require.NotNil(t, token)
+	assert.Equal("access-1", token.AccessToken)
+	assert.Equal("Bearer", token.TokenType)
+	assert.Equal("refresh-1", token.RefreshToken)
+
+	token, err = s.OAuth2Token(ctx, login, "provider-2")
+	assert.NoError(err)
+	assert.Nil(token)
+}
+
+func testOAuth2TokenAndLoginByAccessToken(t *testing.T, s authkit.UserStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	createUser(t, s, login)
+	createUser(t, s, "other@login.ok")
+	require.NoError(t, s.UpdateOAuth2Token(
+		ctx,
+		login,
+		provider,
+		&oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-1"}))
+	require.NoError(t, s.UpdateOAuth2Token(
+		ctx,
+		"other@login.ok",
+		provider,
+		&oauth2.Token{AccessToken: "access-2", RefreshToken: "refresh-2"}))
+	require.NoError(t, s.UpdateOAuth2Token(
+		ctx,
+		"other@login.ok",
+		"provider-2",
+		&oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-3"}))
+
+	token, l, err := s.OAuth2TokenAndLoginByAccessToken(ctx, "access-1", provider)
+	require.NoError(t, err)
+	assert.Equal(login, l)
+	assert.Equal("refresh-1", token.RefreshToken)
+
+	token, l, err = s.OAuth2TokenAndLoginByAccessToken(ctx, "access-2", provider)
+	require.NoError(t, err)
+	assert.Equal("other@login.ok", l)
+	assert.Equal("refresh-2", token.RefreshToken)
+
+	// Same access token of another provider belongs to another user.
+	token, l, err = s.OAuth2TokenAndLoginByAccessToken(ctx, "access-1", "provider-2")
+	require.NoError(t, err)
+	assert.Equal("other@login.ok", l)
+	assert.Equal("refresh-3", token.RefreshToken)
+
+	_, _, err = s.OAuth2TokenAndLoginByAccessToken(ctx, "access-2", "provider-2")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	_, _, err = s.OAuth2TokenAndLoginByAccessToken(ctx, "unknown", provider)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	_, _, err = s.OAuth2TokenAndLoginByAccessToken(ctx, "", provider)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+}
+
+func testUpdateOAuth2Token(t *testing.T, s authkit.UserStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	token := &oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-1"}
+	err := s.UpdateOAuth2Token(ctx, login, provider, token)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	createUser(t, s, login)
+	require.NoError(t, s.UpdateOAuth2Token(ctx, login, provider, token))
+
+	// Stored token is not affected by modification of the original one.
+	token.AccessToken = "modified"
+	stored, err := s.OAuth2Token(ctx, login, provider)
+	require.NoError(t, err)
+	assert.Equal("access-1", stored.AccessToken)
+
+	// Replaced token is not found by old access token.
+	require.NoError(t, s.UpdateOAuth2Token(
+		ctx,
+		login,
+		provider,
+		&oauth2.Token{AccessToken: "access-2", RefreshToken: "refresh-2"}))
+	_, _, err = s.OAuth2TokenAndLoginByAccessToken(ctx, "access-1", provider)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	stored, l, err := s.OAuth2TokenAndLoginByAccessToken(ctx, "access-2", provider)
+	require.NoError(t, err)
+	assert.Equal(login, l)
+	assert.Equal("refresh-2", stored.RefreshToken)
+	stored, err = s.OAuth2Token(ctx, login, provider)
+	require.NoError(t, err)
+	assert.Equal("access-2", stored.AccessToken)
+}
+
+func testConcurrentUpdateOAuth2Token(t *testing.T, s authkit.UserStore) {
+	ctx := context.Background()
+	const n = 20
+	for i := 0; i < 5; i++ {
+		createUser(t, s, fmt.Sprintf("user%d@login.ok", i))
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l := fmt.Sprintf("user%d@login.ok", i%5)
+			at := fmt.Sprintf("access-%d", i)
+			assert.NoError(t, s.UpdateOAuth2Token(
+				ctx,
+				l,
+				provider,
+				&oauth2.Token{AccessToken: at}))
+			_, _, _ = s.OAuth2TokenAndLoginByAccessToken(ctx, at, provider)
+		}(i)
+	}
+	wg.Wait()
+
+	// Every user has exactly one token, which is found by its access token.
+	for i := 0; i < 5; i++ {
+		l := fmt.Sprintf("user%d@login.ok", i)
+		token, err := s.OAuth2Token(ctx, l, provider)
+		require.NoError(t, err)
+		require.NotNil(t, token)
+		_, found, err := s.OAuth2TokenAndLoginByAccessToken(ctx, token.AccessToken, provider)
+		assert.NoError(t, err)
+		assert.Equal(t, l, found)
+	}
+}
+
+func testRevokeAccessToken(t *testing.T, s authkit.UserStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// Revocation of unknown token is not an error.
+	assert.NoError(s.RevokeAccessToken(ctx, provider, "unknown"))
+
+	createUser(t, s, login)
+	require.NoError(t, s.UpdateOAuth2Token(
+		ctx,
+		login,
+		provider,
+		&oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-1"}))
+	require.NoError(t, s.UpdateOAuth2Token(
+		ctx,
+		login,
+		"provider-2",
+		&oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-2"}))
+
+	assert.NoError(s.RevokeAccessToken(ctx, provider, "access-1"))
+	_, _, err := s.OAuth2TokenAndLoginByAccessToken(ctx, "access-1", provider)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	// Refresh token is kept, so that access token can be refreshed.
+	token, err := s.OAuth2Token(ctx, login, provider)
+	require.NoError(t, err)
+	if token != nil {
+		assert.Empty(token.AccessToken)
+		assert.Equal("refresh-1", token.RefreshToken)
+	}
+
+	// Tokens of other providers are not affected.
+	_, l, err := s.OAuth2TokenAndLoginByAccessToken(ctx, "access-1", "provider-2")
+	assert.NoError(err)
+	assert.Equal(login, l)
+}
+
+func testEnsureExists(t *testing.T, s authkit.ProfileService) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	_, _, err := s.Email(ctx, login)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	assert.NoError(s.EnsureExists(ctx, login, login))
+	email, name, err := s.Email(ctx, login)
+	assert.NoError(err)
+	assert.Equal(login, email)
+	assert.Empty(name)
+
+	// EnsureExists doesn't overwrite existing profile.
+	assert.NoError(s.EnsureExists(ctx, login, "other@login.ok"))
+	email, _, err = s.Email(ctx, login)
+	assert.NoError(err)
+	assert.Equal(login, email)
+}
+
+func testSave(t *testing.T, s authkit.ProfileService) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// Save creates profile if it doesn't exist.
+	assert.NoError(s.Save(ctx, &profile{
+		Login:         login,
+		Email:         login,
+		FormattedName: "Valid User",
+	}))
+	email, name, err := s.Email(ctx, login)
+	assert.NoError(err)
+	assert.Equal(login, email)
+	assert.Equal("Valid User", name)
+
+	assert.NoError(s.Save(ctx, &profile{
+		Login:         login,
+		Email:         "new@login.ok",
+		FormattedName: "New Name",
+	}))
+	email, name, err = s.Email(ctx, login)
+	assert.NoError(err)
+	assert.Equal("new@login.ok", email)
+	assert.Equal("New Name", name)
+}
+
+func testSetEmailConfirmed(t *testing.T, s authkit.ProfileService) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	err := s.SetEmailConfirmed(ctx, login, login, true)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	require.NoError(t, s.EnsureExists(ctx, login, login))
+
+	// Email should match the current one (it could be changed after
+	// confirmation was requested).
+	err = s.SetEmailConfirmed(ctx, login, "other@login.ok", true)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	_, _, err = s.ConfirmedEmail(ctx, login)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	assert.NoError(s.SetEmailConfirmed(ctx, login, login, true))
+	email, _, err := s.ConfirmedEmail(ctx, login)
+	assert.NoError(err)
+	assert.Equal(login, email)
+
+	// Repeated confirmation is not an error.
+	assert.NoError(s.SetEmailConfirmed(ctx, login, login, true))
+
+	assert.NoError(s.SetEmailConfirmed(ctx, login, login, false))
+	_, _, err = s.ConfirmedEmail(ctx, login)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+}
+
+func testConfirmedEmail(t *testing.T, s authkit.ProfileService) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	_, _, err := s.ConfirmedEmail(ctx, login)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	require.NoError(t, s.Save(ctx, &profile{
+		Login:          login,
+		Email:          login,
+		EmailConfirmed: true,
+		FormattedName:  "Valid User",
+	}))
+	email, name, err := s.ConfirmedEmail(ctx, login)
+	assert.NoError(err)
+	assert.Equal(login, email)
+	assert.Equal("Valid User", name)
+
+	// Saved unconfirmed email resets confirmation.
+	require.NoError(t, s.Save(ctx, &profile{
+		Login: login,
+		Email: "new@login.ok",
+	}))
+	_, _, err = s.ConfirmedEmail(ctx, login)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+}
+
+func testConcurrentEnsureExists(t *testing.T, s authkit.ProfileService) {
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, s.EnsureExists(ctx, login, login))
+		}()
+	}
+	wg.Wait()
+	email, _, err := s.Email(ctx, login)
+	assert.NoError(t, err)
+	assert.Equal(t, login, email)
+}
+
+// profile is a minimal authkit.Profile, used to check that stores accept
+// profiles of foreign types.
+type profile struct {
+	Login          string
+	Email          string
+	EmailConfirmed bool
+	FormattedName  string
+}
+
+func (p profile) GetLogin() string {
+	return p.Login
+}
+
+func (p *profile) SetLogin(login string) {
+	p.Login = login
+}
+
+func (p profile) GetEmail() string {
+	return p.Email
+}
+
+func (p profile) IsEmailConfirmed() bool {
+	return p.EmailConfirmed
+}
+
+func (p profile) GetFormattedName() string {
+	return p.FormattedName
+}
+
+// withTOTPStore skips test, if store doesn't implement authkit.TOTPStore.
+func withTOTPStore(
+	fn func(*testing.T, authkit.UserStore, authkit.TOTPStore)) func(*testing.T, authkit.UserStore) {
+	return func(t *testing.T, s authkit.UserStore) {
+		ts, ok := s.(authkit.TOTPStore)
+		if !ok {
+			t.Skip("store doesn't implement authkit.TOTPStore")
+		}
+		fn(t, s, ts)
+	}
+}
+
+func testTOTPSecret(t *testing.T, s authkit.UserStore, ts authkit.TOTPStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	_, err := ts.TOTPSecret(ctx, login)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	err = ts.UpdateTOTPSecret(ctx, login, "SECRET")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	createUser(t, s, login)
+	secret, err := ts.TOTPSecret(ctx, login)
+	assert.NoError(err)
+	assert.Empty(secret, "second factor should be disabled for new user")
+
+	assert.NoError(ts.UpdateTOTPSecret(ctx, login, "SECRET"))
+	secret, err = ts.TOTPSecret(ctx, login)
+	assert.NoError(err)
+	assert.Equal("SECRET", secret)
+
+	// Other users are not affected.
+	createUser(t, s, "other@login.ok")
+	secret, err = ts.TOTPSecret(ctx, "other@login.ok")
+	assert.NoError(err)
+	assert.Empty(secret)
+
+	assert.NoError(ts.UpdateTOTPSecret(ctx, login, ""))
+	secret, err = ts.TOTPSecret(ctx, login)
+	assert.NoError(err)
+	assert.Empty(secret)
+}
+
+func testUseTOTPCounter(t *testing.T, s authkit.UserStore, ts authkit.TOTPStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	_, err := ts.UseTOTPCounter(ctx, login, 10)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	createUser(t, s, login)
+	require.NoError(t, ts.UpdateTOTPSecret(ctx, login, "SECRET"))
+
+	ok, err := ts.UseTOTPCounter(ctx, login, 10)
+	assert.NoError(err)
+	assert.True(ok)
+
+	// Same and earlier counters are rejected.
+	ok, err = ts.UseTOTPCounter(ctx, login, 10)
+	assert.NoError(err)
+	assert.False(ok)
+	ok, err = ts.UseTOTPCounter(ctx, login, 9)
+	assert.NoError(err)
+	assert.False(ok)
+
+	ok, err = ts.UseTOTPCounter(ctx, login, 11)
+	assert.NoError(err)
+	assert.True(ok)
+
+	// New secret resets counter.
+	require.NoError(t, ts.UpdateTOTPSecret(ctx, login, "OTHER"))
+	ok, err = ts.UseTOTPCounter(ctx, login, 5)
+	assert.NoError(err)
+	assert.True(ok)
+}
+
+func testConcurrentUseTOTPCounter(t *testing.T, s authkit.UserStore, ts authkit.TOTPStore) {
+	ctx := context.Background()
+	createUser(t, s, login)
+	require.NoError(t, ts.UpdateTOTPSecret(ctx, login, "SECRET"))
+
+	const n = 20
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		used   int
+		failed []error
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := ts.UseTOTPCounter(ctx, login, 100)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed = append(failed, err)
+			}
+			if ok {
+				used++
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Empty(t, failed)
+	assert.Equal(t, 1, used, "code should be accepted only once")
+}
+
+// withRecoveryCodeStore skips test, if store doesn't implement
+// authkit.RecoveryCodeStore.
+func withRecoveryCodeStore(
+	fn func(*testing.T, authkit.UserStore, authkit.RecoveryCodeStore)) func(*testing.T, authkit.UserStore) {
+	return func(t *testing.T, s authkit.UserStore) {
+		rs, ok := s.(authkit.RecoveryCodeStore)
+		if !ok {
+			t.Skip("store doesn't implement authkit.RecoveryCodeStore")
+		}
+		fn(t, s, rs)
+	}
+}
+
+func testRecoveryCodes(t *testing.T, s authkit.UserStore, rs authkit.RecoveryCodeStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	err := rs.UpdateRecoveryCodes(ctx, login, []string{"h1", "h2"})
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	_, err = rs.UseRecoveryCode(ctx, login, "h1")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	createUser(t, s, login)
+	createUser(t, s, "other@login.ok")
+	ok, err := rs.UseRecoveryCode(ctx, login, "h1")
+	assert.NoError(err)
+	assert.False(ok)
+
+	require.NoError(t, rs.UpdateRecoveryCodes(ctx, login, []string{"h1", "h2"}))
+
+	// Codes of other users are not accepted.
+	ok, err = rs.UseRecoveryCode(ctx, "other@login.ok", "h1")
+	assert.NoError(err)
+	assert.False(ok)
+
+	ok, err = rs.UseRecoveryCode(ctx, login, "h1")
+	assert.NoError(err)
+	assert.True(ok)
+
+	// Code is single-use.
+	ok, err = rs.UseRecoveryCode(ctx, login, "h1")
+	assert.NoError(err)
+	assert.False(ok)
+
+	// New codes replace old ones.
+	require.NoError(t, rs.UpdateRecoveryCodes(ctx, login, []string{"h3"}))
+	ok, err = rs.UseRecoveryCode(ctx, login, "h2")
+	assert.NoError(err)
+	assert.False(ok)
+	ok, err = rs.UseRecoveryCode(ctx, login, "h3")
+	assert.NoError(err)
+	assert.True(ok)
+}
+
+func testConcurrentUseRecoveryCode(t *testing.T, s authkit.UserStore, rs authkit.RecoveryCodeStore) {
+	ctx := context.Background()
+	createUser(t, s, login)
+	require.NoError(t, rs.UpdateRecoveryCodes(ctx, login, []string{"h1"}))
+
+	const n = 20
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		used   int
+		failed []error
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := rs.UseRecoveryCode(ctx, login, "h1")
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed = append(failed, err)
+			}
+			if ok {
+				used++
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Empty(t, failed)
+	assert.Equal(t, 1, used, "code should be accepted only once")
+}
+
+func testChangeEmail(t *testing.T, s authkit.ProfileService) {
+	ec, ok := s.(authkit.EmailChanger)
+	if !ok {
+		t.Skip("service doesn't implement authkit.EmailChanger")
+	}
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	err := ec.ChangeEmail(ctx, login, login, "new@login.ok")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	require.NoError(t, s.EnsureExists(ctx, login, login))
+
+	// Old email should match the current one.
+	err = ec.ChangeEmail(ctx, login, "other@login.ok", "new@login.ok")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	email, _, err := s.Email(ctx, login)
+	assert.NoError(err)
+	assert.Equal(login, email)
+
+	assert.NoError(ec.ChangeEmail(ctx, login, login, "new@login.ok"))
+	email, _, err = s.ConfirmedEmail(ctx, login)
+	assert.NoError(err)
+	assert.Equal("new@login.ok", email)
+
+	// Token for the old email can't be used twice.
+	err = ec.ChangeEmail(ctx, login, login, "other@login.ok")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+}
+
+func withAccountStore(
+	fn func(*testing.T, authkit.UserStore, authkit.AccountStore)) func(*testing.T, authkit.UserStore) {
+	return func(t *testing.T, s authkit.UserStore) {
+		as, ok := s.(authkit.AccountStore)
+		if !ok {
+			t.Skip("store doesn't implement authkit.AccountStore")
+		}
+		fn(t, s, as)
+	}
+}
+
+func testOAuth2Tokens(t *testing.T, s authkit.UserStore, as authkit.AccountStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	_, err := as.OAuth2Tokens(ctx, login)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	createUser(t, s, login)
+	tokens, err := as.OAuth2Tokens(ctx, login)
+	assert.NoError(err)
+	assert.Empty(tokens)
+
+	require.NoError(t, s.UpdateOAuth2Token(
+		ctx,
+		login,
+		provider,
+		&oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-1"}))
+	require.NoError(t, s.UpdateOAuth2Token(
+		ctx,
+		login,
+		"provider-2",
+		&oauth2.Token{AccessToken: "access-2"}))
+	createUser(t, s, "other@login.ok")
+	require.NoError(t, s.UpdateOAuth2Token(
+		ctx,
+		"other@login.ok",
+		provider,
+		&oauth2.Token{AccessToken: "access-3"}))
+
+	tokens, err = as.OAuth2Tokens(ctx, login)
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	require.NotNil(t, tokens[provider])
+	assert.Equal("access-1", tokens[provider].AccessToken)
+	assert.Equal("refresh-1", tokens[provider].RefreshToken)
+	require.NotNil(t, tokens["provider-2"])
+	assert.Equal("access-2", tokens["provider-2"].AccessToken)
+}
+
+func testDeleteUser(t *testing.T, s authkit.UserStore, as authkit.AccountStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	err := as.DeleteUser(ctx, login)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	createUser(t, s, login)
+	createUser(t, s, "other@login.ok")
+	require.NoError(t, s.UpdateOAuth2Token(
+		ctx,
+		login,
+		provider,
+		&oauth2.Token{AccessToken: "access-1"}))
+	require.NoError(t, s.UpdateOAuth2Token(
+		ctx,
+		"other@login.ok",
+		provider,
+		&oauth2.Token{AccessToken: "access-2"}))
+
+	assert.NoError(as.DeleteUser(ctx, login))
+	_, err = s.User(ctx, login)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	_, _, err = s.OAuth2TokenAndLoginByAccessToken(ctx, "access-1", provider)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	// Other users are not affected.
+	_, l, err := s.OAuth2TokenAndLoginByAccessToken(ctx, "access-2", provider)
+	assert.NoError(err)
+	assert.Equal("other@login.ok", l)
+
+	// Login can be used again, old data is not restored.
+	createUser(t, s, login)
+	token, err := s.OAuth2Token(ctx, login, provider)
+	assert.NoError(err)
+	assert.Nil(token)
+}
+
+func withIdentityStore(
+	fn func(*testing.T, authkit.UserStore, authkit.IdentityStore)) func(*testing.T, authkit.UserStore) {
+	return func(t *testing.T, s authkit.UserStore) {
+		is, ok := s.(authkit.IdentityStore)
+		if !ok {
+			t.Skip("store doesn't implement authkit.IdentityStore")
+		}
+		fn(t, s, is)
+	}
+}
+
+func testLinkIdentity(t *testing.T, s authkit.UserStore, is authkit.IdentityStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	_, err := is.LoginByIdentity(ctx, provider, "identity-1")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	err = is.LinkIdentity(ctx, login, provider, "identity-1")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	createUser(t, s, login)
+	createUser(t, s, "other@login.ok")
+	assert.NoError(is.LinkIdentity(ctx, login, provider, "identity-1"))
+	assert.NoError(is.LinkIdentity(ctx, login, "provider-2", "identity-1"))
+	l, err := is.LoginByIdentity(ctx, provider, "identity-1")
+	assert.NoError(err)
+	assert.Equal(login, l)
+	l, err = is.LoginByIdentity(ctx, "provider-2", "identity-1")
+	assert.NoError(err)
+	assert.Equal(login, l)
+
+	// Repeated linking is not an error.
+	assert.NoError(is.LinkIdentity(ctx, login, provider, "identity-1"))
+
+	// Identity can't be linked to another user.
+	err = is.LinkIdentity(ctx, "other@login.ok", provider, "identity-1")
+	assert.True(authkit.IsDuplicateUser(err), "unexpected error: %+v", err)
+
+	// User can't have two identities of the same provider.
+	err = is.LinkIdentity(ctx, login, provider, "identity-2")
+	assert.True(authkit.IsDuplicateUser(err), "unexpected error: %+v", err)
+	_, err = is.LoginByIdentity(ctx, provider, "identity-2")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	// Identities are removed with user.
+	if as, ok := s.(authkit.AccountStore); ok {
+		require.NoError(t, as.DeleteUser(ctx, login))
+		_, err = is.LoginByIdentity(ctx, provider, "identity-1")
+		assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+		assert.NoError(is.LinkIdentity(ctx, "other@login.ok", provider, "identity-1"))
+	}
+}
+
+func testConcurrentLinkIdentity(t *testing.T, s authkit.UserStore, is authkit.IdentityStore) {
+	ctx := context.Background()
+	const n = 10
+	for i := 0; i < n; i++ {
+		createUser(t, s, fmt.Sprintf("user%d@login.ok", i))
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		linked  []string
+		unknown []error
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(l string) {
+			defer wg.Done()
+			err := is.LinkIdentity(ctx, l, provider, "identity-1")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				linked = append(linked, l)
+			case !authkit.IsDuplicateUser(err):
+				unknown = append(unknown, err)
+			}
+		}(fmt.Sprintf("user%d@login.ok", i))
+	}
+	wg.Wait()
+
+	assert.Empty(t, unknown)
+	require.Len(t, linked, 1, "identity should be linked exactly once")
+	l, err := is.LoginByIdentity(ctx, provider, "identity-1")
+	assert.NoError(t, err)
+	assert.Equal(t, linked[0], l)
+}
+
+func testCreateWithIdentity(t *testing.T, s authkit.UserStore, is authkit.IdentityStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	assert.NoError(is.CreateWithIdentity(ctx, login, provider, "identity-1"))
+	u, err := s.User(ctx, login)
+	require.NoError(t, err)
+	assert.Equal(authkit.NoPasswordHash, u.PasswordHash())
+	l, err := is.LoginByIdentity(ctx, provider, "identity-1")
+	assert.NoError(err)
+	assert.Equal(login, l)
+
+	// User without password can't authenticate.
+	err = s.Authenticate(ctx, login, authkit.NoPasswordHash)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	err = is.CreateWithIdentity(ctx, login, "provider-2", "identity-2")
+	assert.True(authkit.IsDuplicateUser(err), "unexpected error: %+v", err)
+	err = is.CreateWithIdentity(ctx, "other@login.ok", provider, "identity-1")
+	assert.True(authkit.IsDuplicateUser(err), "unexpected error: %+v", err)
+	_, err = s.User(ctx, "other@login.ok")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	// Password can be set later.
+	assert.NoError(s.UpdatePassword(ctx, login, authkit.NoPasswordHash, password))
+	assert.NoError(s.Authenticate(ctx, login, password))
+}
+
+func testUnlinkIdentity(t *testing.T, s authkit.UserStore, is authkit.IdentityStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	_, err := is.Identities(ctx, login)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	createUser(t, s, login)
+	identities, err := is.Identities(ctx, login)
+	assert.NoError(err)
+	assert.Empty(identities)
+
+	require.NoError(t, is.LinkIdentity(ctx, login, provider, "identity-1"))
+	require.NoError(t, is.LinkIdentity(ctx, login, "provider-2", "identity-2"))
+	identities, err = is.Identities(ctx, login)
+	assert.NoError(err)
+	assert.Equal(map[string]string{
+		provider:     "identity-1",
+		"provider-2": "identity-2",
+	}, identities)
+
+	assert.NoError(is.UnlinkIdentity(ctx, login, provider))
+	_, err = is.LoginByIdentity(ctx, provider, "identity-1")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	identities, err = is.Identities(ctx, login)
+	assert.NoError(err)
+	assert.Equal(map[string]string{"provider-2": "identity-2"}, identities)
+
+	// Repeated unlinking is not an error.
+	assert.NoError(is.UnlinkIdentity(ctx, login, provider))
+
+	// Identity can be linked again (to any user).
+	createUser(t, s, "other@login.ok")
+	assert.NoError(is.LinkIdentity(ctx, "other@login.ok", provider, "identity-1"))
+}
+
+func testUnlinkLastIdentity(t *testing.T, s authkit.UserStore, is authkit.IdentityStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	require.NoError(t, is.CreateWithIdentity(ctx, login, provider, "identity-1"))
+	require.NoError(t, is.LinkIdentity(ctx, login, "provider-2", "identity-2"))
+	assert.NoError(is.UnlinkIdentity(ctx, login, "provider-2"))
+
+	// User without password can't lose the last identity.
+	err := is.UnlinkIdentity(ctx, login, provider)
+	assert.True(authkit.IsLastLoginMethod(err), "unexpected error: %+v", err)
+	l, err := is.LoginByIdentity(ctx, provider, "identity-1")
+	assert.NoError(err)
+	assert.Equal(login, l)
+
+	// Unknown provider is not an error.
+	assert.NoError(is.UnlinkIdentity(ctx, login, "provider-2"))
+
+	// User with password can.
+	require.NoError(t, s.UpdatePassword(ctx, login, authkit.NoPasswordHash, password))
+	assert.NoError(is.UnlinkIdentity(ctx, login, provider))
+	identities, err := is.Identities(ctx, login)
+	assert.NoError(err)
+	assert.Empty(identities)
+}
+
+func testConcurrentUnlinkIdentity(t *testing.T, s authkit.UserStore, is authkit.IdentityStore) {
+	ctx := context.Background()
+	const n = 5
+	require.NoError(t, is.CreateWithIdentity(ctx, login, "provider-0", "identity-0"))
+	for i := 1; i < n; i++ {
+		require.NoError(t, is.LinkIdentity(
+			ctx,
+			login,
+			fmt.Sprintf("provider-%d", i),
+			fmt.Sprintf("identity-%d", i)))
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		unlinked int
+		last     int
+		unknown  []error
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(pid string) {
+			defer wg.Done()
+			err := is.UnlinkIdentity(ctx, login, pid)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				unlinked++
+			case authkit.IsLastLoginMethod(err):
+				last++
+			default:
+				unknown = append(unknown, err)
+			}
+		}(fmt.Sprintf("provider-%d", i))
+	}
+	wg.Wait()
+
+	assert.Empty(t, unknown)
+	assert.Equal(t, n-1, unlinked)
+	assert.Equal(t, 1, last)
+	identities, err := is.Identities(ctx, login)
+	assert.NoError(t, err)
+	assert.Len(t, identities, 1, "user should keep the last identity")
+}
+
+func testDeleteProfile(t *testing.T, s authkit.ProfileService) {
+	ap, ok := s.(authkit.AccountProfileService)
+	if !ok {
+		t.Skip("service doesn't implement authkit.AccountProfileService")
+	}
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// Deletion of absent profile is not an error.
+	assert.NoError(ap.DeleteProfile(ctx, login))
+
+	require.NoError(t, s.EnsureExists(ctx, login, login))
+	require.NoError(t, s.EnsureExists(ctx, "other@login.ok", "other@login.ok"))
+	p, err := ap.Profile(ctx, login)
+	require.NoError(t, err)
+	assert.Equal(login, p.GetEmail())
+
+	assert.NoError(ap.DeleteProfile(ctx, login))
+	_, err = ap.Profile(ctx, login)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	_, _, err = s.Email(ctx, login)
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	// Other profiles are not affected.
+	_, _, err = s.Email(ctx, "other@login.ok")
+	assert.NoError(err)
+}
+
+func withSessionStore(
+	fn func(*testing.T, authkit.UserStore, authkit.SessionStore)) func(*testing.T, authkit.UserStore) {
+	return func(t *testing.T, s authkit.UserStore) {
+		ss, ok := s.(authkit.SessionStore)
+		if !ok {
+			t.Skip("store doesn't implement authkit.SessionStore")
+		}
+		fn(t, s, ss)
+	}
+}
+
+func testSessions(t *testing.T, s authkit.UserStore, ss authkit.SessionStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	created := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	session := func(id, login string, created time.Time) authkit.Session {
+		return authkit.Session{
+			ID:       id,
+			Login:    login,
+			Device:   "device of " + id,
+			IP:       "127.0.0.1",
+			Created:  created,
+			LastUsed: created,
+		}
+	}
+
+	err := ss.CreateSession(ctx, session("session-1", login, created), &oauth2.Token{AccessToken: "access-1"})
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	createUser(t, s, login)
+	createUser(t, s, "other@login.ok")
+	sessions, err := ss.Sessions(ctx, login)
+	assert.NoError(err)
+	assert.Empty(sessions)
+
+	// Sessions are listed in order of creation.
+	require.NoError(t, ss.CreateSession(
+		ctx,
+		session("session-2", login, created.Add(time.Hour)),
+		&oauth2.Token{AccessToken: "access-2", RefreshToken: "refresh-2"}))
+	require.NoError(t, ss.CreateSession(
+		ctx,
+		session("session-1", login, created),
+		&oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-1"}))
+	require.NoError(t, ss.CreateSession(
+		ctx,
+		session("session-3", "other@login.ok", created),
+		&oauth2.Token{AccessToken: "access-3"}))
+	sessions, err = ss.Sessions(ctx, login)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal("session-1", sessions[0].ID)
+	assert.Equal(login, sessions[0].Login)
+	assert.Equal("device of session-1", sessions[0].Device)
+	assert.Equal("127.0.0.1", sessions[0].IP)
+	assert.True(created.Equal(sessions[0].Created))
+	assert.True(created.Equal(sessions[0].LastUsed))
+	assert.Equal("session-2", sessions[1].ID)
+
+	// Tokens of different sessions are kept separately.
+	session1, token, err := ss.SessionByAccessToken(ctx, "access-1")
+	require.NoError(t, err)
+	assert.Equal("session-1", session1.ID)
+	assert.Equal(login, session1.Login)
+	assert.Equal("refresh-1", token.RefreshToken)
+	token, err = ss.SessionToken(ctx, login, "session-2")
+	require.NoError(t, err)
+	assert.Equal("access-2", token.AccessToken)
+	_, err = ss.SessionToken(ctx, login, "session-3")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	_, _, err = ss.SessionByAccessToken(ctx, "unknown")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	lastUsed := created.Add(2 * time.Hour)
+	assert.NoError(ss.TouchSession(ctx, "access-2", "10.0.0.1", lastUsed))
+	assert.NoError(ss.TouchSession(ctx, "unknown", "10.0.0.1", lastUsed))
+	sessions, err = ss.Sessions(ctx, login)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal("10.0.0.1", sessions[1].IP)
+	assert.True(lastUsed.Equal(sessions[1].LastUsed))
+	assert.Equal("127.0.0.1", sessions[0].IP)
+
+	// Session of another user is not deleted.
+	assert.NoError(ss.DeleteSession(ctx, login, "session-3"))
+	_, _, err = ss.SessionByAccessToken(ctx, "access-3")
+	assert.NoError(err)
+
+	assert.NoError(ss.DeleteSession(ctx, login, "session-1"))
+	assert.NoError(ss.DeleteSession(ctx, login, "session-1"))
+	_, _, err = ss.SessionByAccessToken(ctx, "access-1")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	sessions, err = ss.Sessions(ctx, login)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal("session-2", sessions[0].ID)
+}
+
+func testUpdateSessionToken(t *testing.T, s authkit.UserStore, ss authkit.SessionStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	err := ss.UpdateSessionToken(ctx, "session-1", &oauth2.Token{AccessToken: "access-2"})
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	createUser(t, s, login)
+	require.NoError(t, ss.CreateSession(
+		ctx,
+		authkit.Session{ID: "session-1", Login: login, Created: time.Now()},
+		&oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-1"}))
+	expiry := time.Now().Add(time.Hour).Round(time.Second)
+	assert.NoError(ss.UpdateSessionToken(
+		ctx,
+		"session-1",
+		&oauth2.Token{
+			AccessToken:  "access-2",
+			TokenType:    "Bearer",
+			RefreshToken: "refresh-2",
+			Expiry:       expiry,
+		}))
+
+	_, _, err = ss.SessionByAccessToken(ctx, "access-1")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+	session, token, err := ss.SessionByAccessToken(ctx, "access-2")
+	require.NoError(t, err)
+	assert.Equal("session-1", session.ID)
+	assert.Equal("Bearer", token.TokenType)
+	assert.Equal("refresh-2", token.RefreshToken)
+	assert.True(expiry.Equal(token.Expiry))
+}
+
+func testDeleteUserSessions(t *testing.T, s authkit.UserStore, ss authkit.SessionStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	as, ok := s.(authkit.AccountStore)
+	if !ok {
+		t.Skip("store doesn't implement authkit.AccountStore")
+	}
+
+	createUser(t, s, login)
+	require.NoError(t, ss.CreateSession(
+		ctx,
+		authkit.Session{ID: "session-1", Login: login, Created: time.Now()},
+		&oauth2.Token{AccessToken: "access-1"}))
+	require.NoError(t, as.DeleteUser(ctx, login))
+	_, _, err := ss.SessionByAccessToken(ctx, "access-1")
+	assert.True(authkit.IsUserNotFound(err), "unexpected error: %+v", err)
+
+	// Login can be used again, old sessions are not restored.
+	createUser(t, s, login)
+	sessions, err := ss.Sessions(ctx, login)
+	assert.NoError(err)
+	assert.Empty(sessions)
+}
+
+func withRefreshTokenFamilyStore(
+	fn func(*testing.T, authkit.RefreshTokenFamilyStore)) func(*testing.T, authkit.UserStore) {
+	return func(t *testing.T, s authkit.UserStore) {
+		fs, ok := s.(authkit.RefreshTokenFamilyStore)
+		if !ok {
+			t.Skip("store doesn't implement authkit.RefreshTokenFamilyStore")
+		}
+		fn(t, fs)
+	}
+}
+
+func testRotateRefreshToken(t *testing.T, fs authkit.RefreshTokenFamilyStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// Unknown token starts new family.
+	assert.NoError(fs.RotateRefreshToken(ctx, "rt-1", "rt-2"))
+	assert.NoError(fs.RotateRefreshToken(ctx, "rt-2", "rt-3"))
+
+	// Superseded tokens can't be rotated again.
+	err := fs.RotateRefreshToken(ctx, "rt-1", "rt-4")
+	assert.True(authkit.IsRefreshTokenReused(err), "unexpected error: %+v", err)
+	err = fs.RotateRefreshToken(ctx, "rt-2", "rt-4")
+	assert.True(authkit.IsRefreshTokenReused(err), "unexpected error: %+v", err)
+
+	// Latest token is still valid.
+	assert.NoError(fs.RotateRefreshToken(ctx, "rt-3", "rt-4"))
+}
+
+func testClaimRefreshToken(t *testing.T, fs authkit.RefreshTokenFamilyStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// Claimed token can't be claimed again, until claim is released.
+	assert.NoError(fs.ClaimRefreshToken(ctx, "rt-1"))
+	err := fs.ClaimRefreshToken(ctx, "rt-1")
+	assert.True(authkit.IsRefreshTokenClaimed(err), "unexpected error: %+v", err)
+	assert.NoError(fs.ReleaseRefreshToken(ctx, "rt-1"))
+	assert.NoError(fs.ClaimRefreshToken(ctx, "rt-1"))
+
+	// Superseded token can't be claimed, release doesn't restore it.
+	assert.NoError(fs.RotateRefreshToken(ctx, "rt-1", "rt-2"))
+	assert.NoError(fs.ReleaseRefreshToken(ctx, "rt-1"))
+	err = fs.ClaimRefreshToken(ctx, "rt-1")
+	assert.True(authkit.IsRefreshTokenReused(err), "unexpected error: %+v", err)
+
+	// Successor is not claimed.
+	assert.NoError(fs.ClaimRefreshToken(ctx, "rt-2"))
+	assert.NoError(fs.ReleaseRefreshToken(ctx, "unknown"))
+}
+
+func testConcurrentClaimRefreshToken(t *testing.T, fs authkit.RefreshTokenFamilyStore) {
+	ctx := context.Background()
+	require.NoError(t, fs.RotateRefreshToken(ctx, "rt-0", "rt-1"))
+
+	const n = 20
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed int
+		failed  []error
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := fs.ClaimRefreshToken(ctx, "rt-1")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				claimed++
+			case !authkit.IsRefreshTokenClaimed(err):
+				failed = append(failed, err)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Empty(t, failed)
+	assert.Equal(t, 1, claimed, "token should be claimed only once")
+}
+
+func testConcurrentRotateRefreshToken(t *testing.T, fs authkit.RefreshTokenFamilyStore) {
+	ctx := context.Background()
+	require.NoError(t, fs.RotateRefreshToken(ctx, "rt-0", "rt-1"))
+
+	const n = 20
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		rotated int
+		failed  []error
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := fs.RotateRefreshToken(ctx, "rt-1", fmt.Sprintf("rt-2-%d", i))
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				rotated++
+			case !authkit.IsRefreshTokenReused(err):
+				failed = append(failed, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Empty(t, failed)
+	assert.Equal(t, 1, rotated, "token should be rotated only once")
+}
+
+func testRevokeRefreshTokenFamily(t *testing.T, fs authkit.RefreshTokenFamilyStore) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	assert.NoError(fs.RevokeRefreshTokenFamily(ctx, "unknown"))
+
+	require.NoError(t, fs.RotateRefreshToken(ctx, "rt-1", "rt-2"))
+	require.NoError(t, fs.RotateRefreshToken(ctx, "rt-2", "rt-3"))
+	require.NoError(t, fs.RotateRefreshToken(ctx, "other-1", "other-2"))
+
+	// Any token of the family revokes the latest one.
+	assert.NoError(fs.RevokeRefreshTokenFamily(ctx, "rt-1"))
+	err := fs.ClaimRefreshToken(ctx, "rt-3")
+	assert.True(authkit.IsRefreshTokenReused(err), "unexpected error: %+v", err)
+	err = fs.RotateRefreshToken(ctx, "rt-3", "rt-4")
+	assert.True(authkit.IsRefreshTokenReused(err), "unexpected error: %+v", err)
+
+	// Other families are not affected.
+	assert.NoError(fs.RotateRefreshToken(ctx, "other-2", "other-3"))
+}
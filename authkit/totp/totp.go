@@ -0,0 +1,128 @@
+// Package totp implements time-based one-time passwords (RFC 6238), as used
+// by authenticator apps (Google Authenticator, FreeOTP, etc.). Codes are
+// 6 digits long, computed with HMAC-SHA1 over 30 seconds time steps, which
+// are defaults understood by all common apps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Digits is a number of digits in the code.
+	Digits = 6
+
+	// Period is a duration of the time step.
+	Period = 30 * time.Second
+
+	// Skew is a number of time steps before and after current one, codes
+	// for which are accepted by Validate (to tolerate clock drift and
+	// delays of user's input).
+	Skew = 1
+
+	secretSize = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ErrInvalidSecret returned when secret is not a valid base32 string.
+var ErrInvalidSecret = errors.New("invalid totp secret")
+
+// GenerateSecret returns new random base32-encoded secret.
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// Counter returns number of the time step for time t.
+func Counter(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns code for the base32-encoded secret at time t.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(Counter(t)), Digits), nil
+}
+
+// Validate checks code for the base32-encoded secret at time t (with Skew).
+// It returns time step counter, matched by the code, which should be stored
+// to reject repeated use of the same code.
+func Validate(secret, code string, t time.Time) (int64, bool, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(code) != Digits {
+		return 0, false, nil
+	}
+	counter := Counter(t)
+	for i := int64(-Skew); i <= Skew; i++ {
+		c := hotp(key, uint64(counter+i), Digits)
+		if subtle.ConstantTimeCompare([]byte(c), []byte(code)) == 1 {
+			return counter + i, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// ProvisioningURI returns otpauth URI for the secret, which can be shown
+// to the user as a QR code to add account into authenticator app.
+// See https://github.com/google/google-authenticator/wiki/Key-Uri-Format.
+func ProvisioningURI(issuer, account, secret string) string {
+	label := url.PathEscape(account)
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+	v := url.Values{}
+	v.Set("secret", secret)
+	if issuer != "" {
+		v.Set("issuer", issuer)
+	}
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int64(Period/time.Second)))
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	s := strings.ToUpper(strings.TrimRight(secret, "="))
+	key, err := encoding.DecodeString(s)
+	if err != nil || len(key) == 0 {
+		return nil, errors.WithStack(ErrInvalidSecret)
+	}
+	return key, nil
+}
+
+// hotp computes HOTP value (RFC 4226).
+func hotp(key []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	m := hmac.New(sha1.New, key)
+	m.Write(msg[:])
+	sum := m.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, v%mod)
+}
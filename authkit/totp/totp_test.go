@@ -0,0 +1,80 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors from RFC 6238, Appendix B (SHA1).
+func TestRFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := base32.StdEncoding.EncodeToString(key)
+	cases := []struct {
+		time int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, c := range cases {
+		tm := time.Unix(c.time, 0)
+		assert.Equal(t, c.code, hotp(key, uint64(Counter(tm)), 8), "time %d", c.time)
+		code, err := Code(secret, tm)
+		assert.NoError(t, err)
+		assert.Equal(t, c.code[2:], code, "time %d", c.time)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	now := time.Unix(1500000000, 0)
+
+	code, err := Code(secret, now)
+	require.NoError(t, err)
+	counter, ok, err := Validate(secret, code, now)
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(Counter(now), counter)
+
+	// Previous and next steps are accepted.
+	counter, ok, _ = Validate(secret, code, now.Add(Period))
+	assert.True(ok)
+	assert.Equal(Counter(now), counter)
+	_, ok, _ = Validate(secret, code, now.Add(-Period))
+	assert.True(ok)
+
+	// But not farther ones.
+	_, ok, _ = Validate(secret, code, now.Add(2*Period))
+	assert.False(ok)
+
+	_, ok, _ = Validate(secret, "12345", now)
+	assert.False(ok)
+
+	_, _, err = Validate("not base32!", code, now)
+	assert.Error(err)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	assert := assert.New(t)
+	u, err := url.Parse(ProvisioningURI("Example App", "user@example.com", "JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+	assert.Equal("otpauth", u.Scheme)
+	assert.Equal("totp", u.Host)
+	assert.Equal("/Example App:user@example.com", u.Path)
+	q := u.Query()
+	assert.Equal("JBSWY3DPEHPK3PXP", q.Get("secret"))
+	assert.Equal("Example App", q.Get("issuer"))
+	assert.Equal("6", q.Get("digits"))
+	assert.Equal("30", q.Get("period"))
+}
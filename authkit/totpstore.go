@@ -0,0 +1,59 @@
+package authkit
+
+import "context"
+
+type (
+
+	// TOTPStore provides methods to persist users' TOTP (RFC 6238) secrets,
+	// used as a second authentication factor. UserService implementation may
+	// implement this interface to enable two-factor authentication in
+	// handlers.
+	TOTPStore interface {
+
+		// TOTPSecret returns user's TOTP secret (base32-encoded), or empty
+		// string, if second factor is not enabled for the user.
+		TOTPSecret(ctx context.Context, login string) (string, UserServiceError)
+
+		// UpdateTOTPSecret saves or updates user's TOTP secret. Empty secret
+		// disables second factor for the user. Used counter is reset.
+		UpdateTOTPSecret(ctx context.Context, login, secret string) UserServiceError
+
+		// UseTOTPCounter stores time step counter of successfully verified code.
+		// It returns false, if counter is not greater than previously stored one
+		// (code or earlier code has already been used), to prevent replay.
+		UseTOTPCounter(ctx context.Context, login string, counter int64) (bool, UserServiceError)
+	}
+
+	// InvalidCodeError indicates that second factor code is invalid or has
+	// already been used.
+	InvalidCodeError interface {
+		UserServiceError
+		causer
+		IsInvalidCode() bool
+	}
+
+	invalidCodeError struct{ userServiceError }
+)
+
+// NewInvalidCodeError returns new InvalidCodeError.
+func NewInvalidCodeError(cause error) InvalidCodeError {
+	return invalidCodeError{userServiceError{cause}}
+}
+
+func (invalidCodeError) Error() string {
+	return "invalid second factor code"
+}
+
+func (invalidCodeError) IsInvalidCode() bool {
+	return true
+}
+
+// IsInvalidCode checks whether error is or caused by the InvalidCodeError.
+func IsInvalidCode(err error) bool {
+	return existsCause(err, func(e error) bool {
+		e1, ok := e.(InvalidCodeError)
+		return ok && e1.IsInvalidCode()
+	})
+}
+
+//go:generate mockery -name TOTPStore
@@ -1,10 +1,19 @@
 package authkit
 
-import "golang.org/x/oauth2"
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+)
 
 type (
 
 	// UserService provides methods to persist users and send confirmations.
+	// All methods, which may access storage or network, accept context of the
+	// request, so that cancellation, deadlines and request-scoped values
+	// (like tracing data) are propagated into the application's store.
+	// Use AdaptUserService to obtain UserService from the older context-free
+	// implementation.
 	UserService interface {
 		UserStore
 		Confirmer
@@ -23,10 +32,10 @@ type (
 	// Confirmer provides methods to request confirmations.
 	Confirmer interface {
 		// RequestEmailConfirmation requests user to confirm email address.
-		RequestEmailConfirmation(login, email, name string) UserServiceError
+		RequestEmailConfirmation(ctx context.Context, login, email, name string) UserServiceError
 
 		// RequestPasswordChangeConfirmation requests user confirmation to change password (via email).
-		RequestPasswordChangeConfirmation(login, email, name, passwordHash string) UserServiceError
+		RequestPasswordChangeConfirmation(ctx context.Context, login, email, name, passwordHash string) UserServiceError
 	}
 
 	// MiddlewareUserService provides methods to persist user.
@@ -53,26 +62,27 @@ type (
 	// TokenStore provides methods to persist OAuth2 token in the custom store.
 	TokenStore interface {
 		// OAuth2Token returns OAuth2 token by login and OAuth2 provider ID.
-		OAuth2Token(login, providerID string) (*oauth2.Token, UserServiceError)
+		OAuth2Token(ctx context.Context, login, providerID string) (*oauth2.Token, UserServiceError)
 
 		// OAuth2TokenAndLoginByAccessToken returns OAuth2 token and login
 		// by accessToken and OAuth2 provider ID.
 		OAuth2TokenAndLoginByAccessToken(
+			ctx context.Context,
 			accessToken, providerID string) (*oauth2.Token, string, UserServiceError)
 
 		// UpdateOAuth2Token saves or updates oauth2 token for user and provider.
-		UpdateOAuth2Token(login, providerID string, token *oauth2.Token) UserServiceError
+		UpdateOAuth2Token(ctx context.Context, login, providerID string, token *oauth2.Token) UserServiceError
 
 		// RevokeAccessToken revokes access token (or, rather, informs store
 		// about revoked token, because token should be revoked by call to
 		// AuthService).
-		RevokeAccessToken(providerID, accessToken string) UserServiceError
+		RevokeAccessToken(ctx context.Context, providerID, accessToken string) UserServiceError
 	}
 
 	// commonMethods contains methods, common for both middleware and handler.
 	commonMethods interface {
 		// User returns user by login.
-		User(login string) (User, UserServiceError)
+		User(ctx context.Context, login string) (User, UserServiceError)
 	}
 
 	// middlewareMethods contains methods specific to middleware.
@@ -85,13 +95,13 @@ type (
 	// handlerMethods contains methods specific to handler.
 	handlerMethods interface {
 		// Create creates new user.
-		Create(login, password string) UserServiceError
+		Create(ctx context.Context, login, password string) UserServiceError
 
 		// Authenticate authenticates user, returns nil, if account exists and enabled.
-		Authenticate(login, password string) UserServiceError
+		Authenticate(ctx context.Context, login, password string) UserServiceError
 
 		// UpdatePassword updates user's password.
-		UpdatePassword(login, oldPasswordHash, newPassword string) UserServiceError
+		UpdatePassword(ctx context.Context, login, oldPasswordHash, newPassword string) UserServiceError
 	}
 
 	// User provides basic information about user, required for login logic.
@@ -0,0 +1,183 @@
+// Package validatorcache provides caching decorator for
+// authkit.TokenValidator. It saves a round-trip to the authorization server
+// (like Hydra's Warden API) for every protected request.
+//
+// Only positive decisions are cached. Decision is kept not longer than TTL
+// and not longer than the token lives (if wrapped validator implements
+// authkit.ExpiringTokenValidator). Revoked token stays valid in the cache
+// until decision expires, unless it is invalidated explicitly (see
+// handler.Config.TokenInvalidator).
+package validatorcache
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+const (
+	// DefaultSize is a default max number of cached decisions.
+	DefaultSize = 10000
+
+	// DefaultTTL is a default max time to keep decision.
+	DefaultTTL = time.Minute
+)
+
+// Config is a configuration of the Validator.
+type Config struct {
+
+	// Size is a max number of cached decisions, least recently used
+	// decisions are evicted. Default is DefaultSize.
+	Size int
+
+	// TTL is a max time to keep decision. Default is DefaultTTL.
+	TTL time.Duration
+}
+
+// Stats holds counters of the cache.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// Validator is a caching authkit.TokenValidator. It also implements
+// authkit.TokenInvalidator.
+type Validator struct {
+	v    authkit.TokenValidator
+	size int
+	ttl  time.Duration
+
+	// for use by tests
+	now func() time.Time
+
+	mu sync.Mutex
+	ll *list.List
+
+	// access token -> permission -> element of ll
+	entries map[string]map[string]*list.Element
+
+	stats Stats
+}
+
+type entry struct {
+	token   string
+	perm    string
+	subj    string
+	expires time.Time
+}
+
+// New returns new Validator, which caches decisions of v.
+func New(v authkit.TokenValidator, c Config) *Validator {
+	if c.Size <= 0 {
+		c.Size = DefaultSize
+	}
+	if c.TTL <= 0 {
+		c.TTL = DefaultTTL
+	}
+	return &Validator{
+		v:       v,
+		size:    c.Size,
+		ttl:     c.TTL,
+		now:     time.Now,
+		ll:      list.New(),
+		entries: make(map[string]map[string]*list.Element),
+	}
+}
+
+// Validate returns cached decision or asks wrapped validator.
+// Permission descriptors are compared by their "%#v" representation.
+func (v *Validator) Validate(
+	accessToken string,
+	permissionDescriptor interface{}) (string, error) {
+	perm := fmt.Sprintf("%#v", permissionDescriptor)
+	if subj, ok := v.get(accessToken, perm); ok {
+		return subj, nil
+	}
+
+	var (
+		subj   string
+		expiry time.Time
+		err    error
+	)
+	if ev, ok := v.v.(authkit.ExpiringTokenValidator); ok {
+		subj, expiry, err = ev.ValidateWithExpiry(accessToken, permissionDescriptor)
+	} else {
+		subj, err = v.v.Validate(accessToken, permissionDescriptor)
+	}
+	if err != nil {
+		return "", err
+	}
+	v.put(accessToken, perm, subj, expiry)
+	return subj, nil
+}
+
+// InvalidateToken removes all cached decisions about access token.
+func (v *Validator) InvalidateToken(accessToken string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, e := range v.entries[accessToken] {
+		v.ll.Remove(e)
+	}
+	delete(v.entries, accessToken)
+}
+
+// Stats returns counters of the cache.
+func (v *Validator) Stats() Stats {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.stats
+}
+
+func (v *Validator) get(token, perm string) (string, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	e, ok := v.entries[token][perm]
+	if ok && v.now().After(e.Value.(*entry).expires) {
+		v.remove(e)
+		ok = false
+	}
+	if !ok {
+		v.stats.Misses++
+		return "", false
+	}
+	v.stats.Hits++
+	v.ll.MoveToFront(e)
+	return e.Value.(*entry).subj, true
+}
+
+func (v *Validator) put(token, perm, subj string, expiry time.Time) {
+	now := v.now()
+	expires := now.Add(v.ttl)
+	if !expiry.IsZero() && expiry.Before(expires) {
+		expires = expiry
+	}
+	if !expires.After(now) {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if e, ok := v.entries[token][perm]; ok {
+		v.remove(e)
+	}
+	perms, ok := v.entries[token]
+	if !ok {
+		perms = make(map[string]*list.Element)
+		v.entries[token] = perms
+	}
+	perms[perm] = v.ll.PushFront(&entry{token, perm, subj, expires})
+	for v.ll.Len() > v.size {
+		v.remove(v.ll.Back())
+	}
+}
+
+func (v *Validator) remove(e *list.Element) {
+	en := v.ll.Remove(e).(*entry)
+	perms := v.entries[en.token]
+	delete(perms, en.perm)
+	if len(perms) == 0 {
+		delete(v.entries, en.token)
+	}
+}
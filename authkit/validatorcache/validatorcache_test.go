@@ -0,0 +1,118 @@
+package validatorcache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/letsrock-today/authkit/authkit/middleware"
+	"github.com/letsrock-today/authkit/authkit/mocks"
+)
+
+type testExpiringValidator struct {
+	expiry time.Time
+	calls  int
+}
+
+func (v *testExpiringValidator) Validate(string, interface{}) (string, error) {
+	panic("ValidateWithExpiry should be used")
+}
+
+func (v *testExpiringValidator) ValidateWithExpiry(
+	string,
+	interface{}) (string, time.Time, error) {
+	v.calls++
+	return "valid@login.ok", v.expiry, nil
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+	tv := new(mocks.TokenValidator)
+	tv.On("Validate", "token-1", mock.Anything).Return("valid@login.ok", nil)
+	tv.On("Validate", "token-2", mock.Anything).Return("", errors.New("denied"))
+	v := New(tv, Config{})
+	now := time.Now()
+	v.now = func() time.Time { return now }
+	perm := func(a string) interface{} {
+		return &middleware.DefaultPermission{Resource: "rn:res", Action: a}
+	}
+
+	for i := 0; i < 3; i++ {
+		subj, err := v.Validate("token-1", perm("get"))
+		assert.NoError(err)
+		assert.Equal("valid@login.ok", subj)
+	}
+	tv.AssertNumberOfCalls(t, "Validate", 1)
+	assert.Equal(Stats{Hits: 2, Misses: 1}, v.Stats())
+
+	// Decisions are cached per permission.
+	_, err := v.Validate("token-1", perm("post"))
+	assert.NoError(err)
+	tv.AssertNumberOfCalls(t, "Validate", 2)
+
+	// Denials are not cached.
+	for i := 0; i < 2; i++ {
+		_, err := v.Validate("token-2", perm("get"))
+		assert.Error(err)
+	}
+	tv.AssertNumberOfCalls(t, "Validate", 4)
+
+	// Decisions expire after TTL.
+	now = now.Add(DefaultTTL + time.Second)
+	_, err = v.Validate("token-1", perm("get"))
+	assert.NoError(err)
+	tv.AssertNumberOfCalls(t, "Validate", 5)
+
+	v.InvalidateToken("token-1")
+	_, err = v.Validate("token-1", perm("get"))
+	assert.NoError(err)
+	_, err = v.Validate("token-1", perm("post"))
+	assert.NoError(err)
+	tv.AssertNumberOfCalls(t, "Validate", 7)
+}
+
+func TestValidateExpiry(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+	tv := &testExpiringValidator{expiry: now.Add(10 * time.Second)}
+	v := New(tv, Config{TTL: time.Hour})
+	v.now = func() time.Time { return now }
+
+	_, err := v.Validate("token", "perm")
+	assert.NoError(err)
+	_, err = v.Validate("token", "perm")
+	assert.NoError(err)
+	assert.Equal(1, tv.calls)
+
+	// Decision is not kept longer than token lives.
+	now = now.Add(11 * time.Second)
+	_, err = v.Validate("token", "perm")
+	assert.NoError(err)
+	assert.Equal(2, tv.calls)
+	_, err = v.Validate("token", "perm")
+	assert.NoError(err)
+	assert.Equal(3, tv.calls, "expired token should not be cached")
+}
+
+func TestLRU(t *testing.T) {
+	assert := assert.New(t)
+	tv := new(mocks.TokenValidator)
+	tv.On("Validate", mock.Anything, mock.Anything).Return("valid@login.ok", nil)
+	v := New(tv, Config{Size: 2})
+
+	v.Validate("token-1", "perm")
+	v.Validate("token-2", "perm")
+	v.Validate("token-1", "perm")
+	v.Validate("token-3", "perm") // evicts token-2
+	tv.AssertNumberOfCalls(t, "Validate", 3)
+
+	v.Validate("token-1", "perm")
+	v.Validate("token-3", "perm")
+	tv.AssertNumberOfCalls(t, "Validate", 3)
+	v.Validate("token-2", "perm")
+	tv.AssertNumberOfCalls(t, "Validate", 4)
+	assert.Equal(2, v.ll.Len())
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/letsrock-today/authkit/authkit"
 	"github.com/letsrock-today/authkit/authkit/handler"
+	"github.com/letsrock-today/authkit/authkit/oidc"
 	"github.com/letsrock-today/authkit/authkit/peculiarproviders/deezer"
 )
 
@@ -81,6 +82,10 @@ func (c *Config) init() {
 	p.PrivateOAuth2Config = c.newOAuth2Config(p, true)
 
 	for _, p := range c.OAuth2Providers {
+		if p.Issuer != "" {
+			c.discoverOAuth2Provider(p)
+			continue
+		}
 		p.OAuth2Config = c.newOAuth2Config(p, false)
 	}
 
@@ -126,6 +131,26 @@ func (c *Config) newOAuth2Config(
 	return cfg
 }
 
+// discoverOAuth2Provider configures OpenID Connect provider from its
+// discovery document. Config and verifier of the provider keep reference
+// to the Discovery, so they follow refreshed document.
+func (c *Config) discoverOAuth2Provider(p *OAuth2Provider) {
+	d := oidc.NewDiscovery(oidc.DiscoveryConfig{Issuer: p.Issuer})
+	ap, err := d.Provider(oidc.ProviderConfig{
+		ID:           p.ID,
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  c.OAuth2RedirectURL,
+		Scopes:       p.Scopes,
+	})
+	if err != nil {
+		panic(errors.Wrapf(err, "OpenID Connect discovery failed, for: %s", p.ID))
+	}
+	p.OAuth2Config = ap.OAuth2Config
+	p.IDTokenVerifier = ap.IDTokenVerifier
+	p.DisablePKCE = p.DisablePKCE || ap.DisablePKCE
+}
+
 func (c Config) ToAuthkitType() handler.Config {
 	app := []authkit.OAuth2Provider{}
 	for _, p := range c.OAuth2Providers {
@@ -187,8 +212,11 @@ type OAuth2Provider struct {
 	IconURL             string   `mapstructure:"icon"`
 	TokenURL            string   `mapstructure:"token-url"`
 	AuthURL             string   `mapstructure:"auth-url"`
+	DisablePKCE         bool     `mapstructure:"disable-pkce"`
+	Issuer              string   `mapstructure:"issuer"`
 	OAuth2Config        authkit.OAuth2Config
 	PrivateOAuth2Config authkit.OAuth2Config
+	IDTokenVerifier     authkit.IDTokenVerifier
 }
 
 func (p OAuth2Provider) ToAuthkitType() authkit.OAuth2Provider {
@@ -198,6 +226,8 @@ func (p OAuth2Provider) ToAuthkitType() authkit.OAuth2Provider {
 		IconURL:             p.IconURL,
 		OAuth2Config:        p.OAuth2Config,
 		PrivateOAuth2Config: p.PrivateOAuth2Config,
+		DisablePKCE:         p.DisablePKCE,
+		IDTokenVerifier:     p.IDTokenVerifier,
 	}
 	return ap
 }
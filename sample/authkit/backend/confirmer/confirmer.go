@@ -2,6 +2,7 @@ package confirmer
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"text/template"
@@ -11,19 +12,29 @@ import (
 	"github.com/letsrock-today/authkit/sample/authkit/backend/config"
 )
 
+// Confirmer sends confirmation emails, including confirmations of email
+// change.
+type Confirmer interface {
+	authkit.Confirmer
+	authkit.EmailChangeConfirmer
+}
+
 type confirmer struct {
-	confirmEmailURL    string
-	confirmPasswordURL string
+	confirmEmailURL       string
+	confirmPasswordURL    string
+	confirmEmailChangeURL string
 }
 
-func New(confirmEmailURL, confirmPasswordURL string) authkit.Confirmer {
+func New(confirmEmailURL, confirmPasswordURL, confirmEmailChangeURL string) Confirmer {
 	return confirmer{
 		confirmEmailURL,
 		confirmPasswordURL,
+		confirmEmailChangeURL,
 	}
 }
 
 func (c confirmer) RequestEmailConfirmation(
+	_ context.Context,
 	login, email, name string) authkit.UserServiceError {
 	err := sendConfirmationEmail(login, email, name, "", c.confirmEmailURL, false)
 	if err != nil {
@@ -33,6 +44,7 @@ func (c confirmer) RequestEmailConfirmation(
 }
 
 func (c confirmer) RequestPasswordChangeConfirmation(
+	_ context.Context,
 	login, email, name, passwordHash string) authkit.UserServiceError {
 	err := sendConfirmationEmail(login, email, name, passwordHash, c.confirmPasswordURL, true)
 	if err != nil {
@@ -41,7 +53,62 @@ func (c confirmer) RequestPasswordChangeConfirmation(
 	return nil
 }
 
+func (c confirmer) RequestEmailChangeConfirmation(
+	_ context.Context,
+	login, oldEmail, newEmail, name string) authkit.UserServiceError {
+	if name == "" {
+		name = "user"
+	}
+	cfg := config.Get()
+	oauth2State := cfg.OAuth2State
+	token, err := apptoken.NewEmailChangeTokenString(
+		oauth2State.TokenIssuer,
+		login,
+		oldEmail,
+		newEmail,
+		cfg.ConfirmationLinkLifespan,
+		oauth2State.TokenSignKey)
+	if err != nil {
+		return authkit.NewRequestConfirmationError(err)
+	}
+	link := fmt.Sprintf("%s%s?token=%s", cfg.ExternalBaseURL, c.confirmEmailChangeURL, token)
+	if err := sendTemplate(newEmail, "Confirm email change", confirmEmailChangeTmpl, name, login, link); err != nil {
+		return authkit.NewRequestConfirmationError(err)
+	}
+	return nil
+}
+
+func (c confirmer) NotifyEmailChanged(
+	_ context.Context,
+	login, oldEmail, newEmail, name string) authkit.UserServiceError {
+	if name == "" {
+		name = "user"
+	}
+	if err := sendTemplate(oldEmail, "Email changed", emailChangedTmpl, name, login, newEmail); err != nil {
+		return authkit.NewRequestConfirmationError(err)
+	}
+	return nil
+}
+
 var (
+	confirmEmailChangeTmpl = template.Must(template.New("confirmEmailChangeTmpl").Parse(`
+Dear {{ .Name }},
+
+This email address was provided as a new address for service [authkit-sample],
+account [{{ .Login }}].
+
+Follow this link to confirm the change: {{ .URL }}.
+`))
+
+	emailChangedTmpl = template.Must(template.New("emailChangedTmpl").Parse(`
+Dear {{ .Name }},
+
+Email address of your account [{{ .Login }}] for service [authkit-sample]
+has been changed to {{ .URL }}.
+
+If you didn't request this change, please contact support.
+`))
+
 	resetPasswordTmpl = template.Must(template.New("resetPasswordTmpl").Parse(`
 Dear {{ .Name }},
 
@@ -72,7 +139,11 @@ func sendConfirmationEmail(
 	}
 	c := config.Get()
 	oauth2State := c.OAuth2State
-	token, err := apptoken.NewEmailTokenString(
+	newToken := apptoken.NewEmailTokenString
+	if resetPassword {
+		newToken = apptoken.NewPasswordChangeTokenString
+	}
+	token, err := newToken(
 		oauth2State.TokenIssuer,
 		login,
 		email,
@@ -96,6 +167,13 @@ func sendConfirmationEmail(
 		tmpl = confirmEmailTmpl
 		topic = "Confirm account creation"
 	}
+	return sendTemplate(email, topic, tmpl, name, login, link)
+}
+
+func sendTemplate(
+	email, topic string,
+	tmpl *template.Template,
+	name, login, url string) error {
 	text := &bytes.Buffer{}
 	if err := tmpl.Execute(text, struct {
 		Name  string
@@ -104,7 +182,7 @@ func sendConfirmationEmail(
 	}{
 		Name:  name,
 		Login: login,
-		URL:   link,
+		URL:   url,
 	}); err != nil {
 		return err
 	}
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"math"
+
 	"github.com/asaskevich/govalidator"
 	"github.com/letsrock-today/authkit/authkit"
 )
@@ -14,6 +16,13 @@ type jsonError struct {
 	Message string `json:"message"`
 }
 
+// retryError is a jsonError with number of seconds, after which request can
+// be repeated.
+type retryError struct {
+	jsonError
+	RetryAfter int `json:"retryAfter"`
+}
+
 // This ErrorCustomizer implementation just illustrates basic idea.
 // Idea is as follows:
 // ErrorCustomizer groups all errors in several major groups and maps them to
@@ -49,6 +58,14 @@ digits and other symbols (at least one of each kind)`}
 			je = jsonError{code, "Email is required"}
 		case "email-format":
 			je = jsonError{code, "Email should be a valid email address"}
+		case "code-required":
+			je = jsonError{code, "Code is required"}
+		case "code-format":
+			je = jsonError{code, "Code should contain digits only"}
+		case "provider-required":
+			je = jsonError{code, "Provider is required"}
+		case "session-required":
+			je = jsonError{code, "Session is required"}
 		default:
 			je = jsonError{"invalid_req_param", code}
 		}
@@ -66,5 +83,35 @@ func (ec) UserCreationError(e error) interface{} {
 }
 
 func (ec) UserAuthenticationError(e error) interface{} {
+	if authkit.IsAccountLocked(e) {
+		d, _ := authkit.RetryAfter(e)
+		return []retryError{{
+			jsonError{
+				"account_locked",
+				"Too many failed login attempts, try again later",
+			},
+			int(math.Ceil(d.Seconds())),
+		}}
+	}
+	if authkit.IsRateLimited(e) {
+		d, _ := authkit.RetryAfter(e)
+		return []retryError{{
+			jsonError{
+				"rate_limited",
+				"Too many requests, try again later",
+			},
+			int(math.Ceil(d.Seconds())),
+		}}
+	}
+	if authkit.IsInvalidCode(e) {
+		return []jsonError{{"invalid_code", "Invalid or already used code"}}
+	}
 	return []jsonError{{"auth_err", e.Error()}}
 }
+
+func (ec) LastLoginMethodError(e error) interface{} {
+	return []jsonError{{
+		"last_login_method",
+		"Set password or link another provider before unlinking this one",
+	}}
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/asaskevich/govalidator"
@@ -14,7 +15,7 @@ import (
 
 func (h handler) Profile(c echo.Context) error {
 	u := c.Get(middleware.DefaultContextKey).(authkit.User)
-	p, err := h.profiles.Profile(u.Login())
+	p, err := h.profiles.Profile(c.Request().Context(), u.Login())
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -22,6 +23,7 @@ func (h handler) Profile(c echo.Context) error {
 }
 
 func (h handler) ProfileSave(c echo.Context) error {
+	ctx := c.Request().Context()
 	u := c.Get(middleware.DefaultContextKey).(authkit.User)
 	p := new(socialprofile.Profile)
 	if err := c.Bind(p); err != nil {
@@ -35,16 +37,17 @@ func (h handler) ProfileSave(c echo.Context) error {
 	}
 	//TODO: preserve fields absent in the html form.
 	emailChanged := false
-	if pp, err := h.profiles.Profile(u.Login()); err == nil {
+	if pp, err := h.profiles.Profile(ctx, u.Login()); err == nil {
 		emailChanged = pp.GetEmail() != p.Email
 		p.EmailConfirmed = !emailChanged && pp.IsEmailConfirmed()
 	}
-	if err := h.profiles.Save(p); err != nil {
+	if err := h.profiles.Save(ctx, p); err != nil {
 		return errors.WithStack(err)
 	}
 	if emailChanged {
 		go func() {
 			if err := h.UserService.RequestEmailConfirmation(
+				context.Background(),
 				u.Login(),
 				p.Email,
 				p.FormattedName); err != nil {
@@ -53,7 +56,7 @@ func (h handler) ProfileSave(c echo.Context) error {
 		}()
 	}
 	// return profile as it saved in store (assume, that store API could modify it)
-	pf, err := h.profiles.Profile(u.Login())
+	pf, err := h.profiles.Profile(ctx, u.Login())
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"context"
+
 	"golang.org/x/oauth2"
 
 	"github.com/letsrock-today/authkit/authkit"
@@ -17,6 +19,7 @@ type userTokenStore struct {
 }
 
 func (uts userTokenStore) OAuth2Token(
+	ctx context.Context,
 	login, providerID string) (*oauth2.Token, authkit.UserServiceError) {
 	if login != uts.u.Login() {
 		panic("illegal state")
@@ -30,5 +33,5 @@ func (uts userTokenStore) OAuth2Token(
 			return t, nil
 		}
 	}
-	return uts.TokenStore.OAuth2Token(login, providerID)
+	return uts.TokenStore.OAuth2Token(ctx, login, providerID)
 }
@@ -7,7 +7,10 @@ import (
 	"github.com/letsrock-today/authkit/sample/authkit/backend/handler"
 )
 
-const confirmEmailURL = "/email-confirm"
+const (
+	confirmEmailURL       = "/email-confirm"
+	confirmEmailChangeURL = "/email-change-confirm"
+)
 
 func initAPI(
 	e *echo.Echo,
@@ -20,8 +23,10 @@ func initAPI(
 	e.POST("/api/login-priv", ah.Login)
 	e.GET("/api/logout", ah.Logout)
 	e.GET(confirmEmailURL, ah.ConfirmEmail)
+	e.GET(confirmEmailChangeURL, ah.ConfirmEmailChange)
 	e.POST("/password-reset", ah.RestorePassword)
 	e.POST("/password-change", ah.ChangePassword)
+	e.POST("/api/recovery-code", ah.RedeemRecoveryCode)
 	e.GET("/callback", ah.Callback)
 
 	h := handler.New(c)
@@ -29,4 +34,18 @@ func initAPI(
 	e.GET("/api/profile", h.Profile, middlwr)
 	e.POST("/api/profile", h.ProfileSave, middlwr)
 	e.GET("/api/friends", h.Friends, middlwr)
+	e.POST("/api/totp/enroll", ah.EnrollTOTP, middlwr)
+	e.POST("/api/totp/confirm", ah.ConfirmTOTP, middlwr)
+	e.POST("/api/totp/disable", ah.DisableTOTP, middlwr)
+	e.POST("/api/recovery-codes", ah.GenerateRecoveryCodes, middlwr)
+	e.POST("/api/password", ah.ChangeOwnPassword, middlwr)
+	e.POST("/api/email", ah.ChangeEmail, middlwr)
+	e.GET("/api/account", ah.ExportAccount, middlwr)
+	e.GET("/api/link-auth-code-urls", ah.LinkAuthCodeURLs, middlwr)
+	e.GET("/api/providers/linked", ah.LinkedProviders, middlwr)
+	e.POST("/api/providers/unlink", ah.UnlinkProvider, middlwr)
+	e.GET("/api/sessions", ah.Sessions, middlwr)
+	e.POST("/api/sessions/revoke", ah.RevokeSession, middlwr)
+	e.POST("/api/signout-everywhere", ah.SignOutEverywhere, middlwr)
+	e.POST("/api/account/delete", ah.DeleteAccount, middlwr)
 }
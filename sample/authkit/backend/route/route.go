@@ -10,6 +10,7 @@ import (
 
 	"github.com/letsrock-today/authkit/authkit"
 	"github.com/letsrock-today/authkit/authkit/hydra"
+	"github.com/letsrock-today/authkit/authkit/validatorcache"
 	"github.com/letsrock-today/authkit/sample/authkit/backend/config"
 	"github.com/letsrock-today/authkit/sample/authkit/backend/confirmer"
 	"github.com/letsrock-today/authkit/sample/authkit/backend/handler"
@@ -51,10 +52,10 @@ func Init(
 	sps := socialprofile.Providers()
 	userService := struct {
 		user.Store
-		authkit.Confirmer
+		confirmer.Confirmer
 	}{
 		us,
-		confirmer.New(confirmEmailURL, confirmPasswordURL),
+		confirmer.New(confirmEmailURL, confirmPasswordURL, confirmEmailChangeURL),
 	}
 
 	ac := c.ToAuthkitType()
@@ -65,7 +66,11 @@ func Init(
 	ac.SocialProfileServices = sps
 	ac.ContextCreator = cc
 
-	initMiddleware(e, c, as, us, cc)
+	// Cache decisions of Hydra, handlers invalidate revoked tokens.
+	tv := validatorcache.New(as, validatorcache.Config{})
+	ac.TokenInvalidator = tv
+
+	initMiddleware(e, c, tv, us, cc)
 	initReverseProxy(e)
 	initStatic(e)
 	initAPI(e, ac)
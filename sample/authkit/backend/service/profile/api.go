@@ -10,5 +10,5 @@ import (
 type Service interface {
 	io.Closer
 	authkit.ProfileService
-	Profile(login string) (authkit.Profile, error)
+	authkit.AccountProfileService
 }
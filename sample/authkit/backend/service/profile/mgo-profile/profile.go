@@ -1,6 +1,8 @@
 package profile
 
 import (
+	"context"
+
 	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
@@ -44,7 +46,7 @@ func New(dbURL, dbName, profileCollectionName string) (profile.Service, error) {
 	return s, s.profiles.EnsureIndex(index)
 }
 
-func (s service) Profile(login string) (authkit.Profile, error) {
+func (s service) Profile(_ context.Context, login string) (authkit.Profile, error) {
 	p := socialprofile.Profile{}
 	err := s.profiles.Find(
 		bson.M{
@@ -53,7 +55,7 @@ func (s service) Profile(login string) (authkit.Profile, error) {
 	return &p, err
 }
 
-func (s service) Save(p authkit.Profile) error {
+func (s service) Save(_ context.Context, p authkit.Profile) error {
 	_, err := s.profiles.Upsert(
 		bson.M{
 			"login": p.GetLogin(),
@@ -62,7 +64,7 @@ func (s service) Save(p authkit.Profile) error {
 	return err
 }
 
-func (s service) EnsureExists(login, email string) error {
+func (s service) EnsureExists(_ context.Context, login, email string) error {
 	_, err := s.profiles.Upsert(
 		bson.M{
 			"login": login,
@@ -79,7 +81,10 @@ func (s service) EnsureExists(login, email string) error {
 	return err
 }
 
-func (s service) SetEmailConfirmed(login, email string, confirmed bool) error {
+func (s service) SetEmailConfirmed(
+	_ context.Context,
+	login, email string,
+	confirmed bool) error {
 	err := s.profiles.Update(
 		bson.M{
 			"login": login,
@@ -96,7 +101,27 @@ func (s service) SetEmailConfirmed(login, email string, confirmed bool) error {
 	return err
 }
 
-func (s service) Email(login string) (string, string, error) {
+func (s service) ChangeEmail(
+	_ context.Context,
+	login, oldEmail, newEmail string) error {
+	err := s.profiles.Update(
+		bson.M{
+			"login": login,
+			"email": oldEmail,
+		},
+		bson.M{
+			"$set": bson.M{
+				"email":          newEmail,
+				"emailconfirmed": true,
+			},
+		})
+	if err == mgo.ErrNotFound {
+		return errors.WithStack(authkit.NewUserNotFoundError(err))
+	}
+	return err
+}
+
+func (s service) Email(_ context.Context, login string) (string, string, error) {
 	p := socialprofile.Profile{}
 	err := s.profiles.Find(
 		bson.M{
@@ -111,7 +136,7 @@ func (s service) Email(login string) (string, string, error) {
 	return p.Email, p.FormattedName, nil
 }
 
-func (s service) ConfirmedEmail(login string) (string, string, error) {
+func (s service) ConfirmedEmail(_ context.Context, login string) (string, string, error) {
 	p := socialprofile.Profile{}
 	err := s.profiles.Find(
 		bson.M{
@@ -127,6 +152,17 @@ func (s service) ConfirmedEmail(login string) (string, string, error) {
 	return p.Email, p.FormattedName, nil
 }
 
+func (s service) DeleteProfile(_ context.Context, login string) error {
+	err := s.profiles.Remove(
+		bson.M{
+			"login": login,
+		})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
 func (s service) Close() error {
 	s.dbsession.Close()
 	return nil
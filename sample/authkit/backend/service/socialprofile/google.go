@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+
+	"golang.org/x/oauth2"
 
 	"github.com/letsrock-today/authkit/authkit"
 )
@@ -79,6 +82,7 @@ type google struct{}
 const (
 	googleProfileQueryURL     = "https://people.googleapis.com/v1/people/me?fields=addresses(formattedValue%2Cmetadata%2Fprimary)%2Cbirthdays%2Ftext%2CemailAddresses(metadata%2Fprimary%2Cvalue)%2Cgenders%2FformattedValue%2Cnames(displayName%2Cmetadata%2Fprimary)%2CphoneNumbers(canonicalForm%2Cvalue)%2Cphotos(metadata%2Fprimary%2Curl)"
 	googleConnectionsQueryURL = "https://people.googleapis.com/v1/people/me/connections?fields=connections(names(displayName%2Cmetadata%2Fprimary)%2Cphotos(metadata%2Fprimary%2Curl)%2Crelations)"
+	googleRevokeURL           = "https://accounts.google.com/o/oauth2/revoke"
 )
 
 func (google) SocialProfile(client *http.Client) (authkit.Profile, error) {
@@ -102,6 +106,24 @@ func (google) SocialProfile(client *http.Client) (authkit.Profile, error) {
 	return convertProfile(p.googleProfile), nil
 }
 
+// RevokeToken revokes refresh token (or access token, if there is no refresh
+// token), which also revokes all tokens of the same grant.
+func (google) RevokeToken(client *http.Client, token *oauth2.Token) error {
+	t := token.RefreshToken
+	if t == "" {
+		t = token.AccessToken
+	}
+	resp, err := client.PostForm(googleRevokeURL, url.Values{"token": {t}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token revocation failed: %s", resp.Status)
+	}
+	return nil
+}
+
 func (google) Friends(client *http.Client) ([]Profile, error) {
 	resp, err := client.Get(googleConnectionsQueryURL)
 	if err != nil {
@@ -6,8 +6,12 @@ import (
 	"github.com/letsrock-today/authkit/authkit"
 )
 
-// Store combines io.Closer and authkit.UserService.
+// Store combines io.Closer, authkit.UserStore, authkit.AccountStore,
+// authkit.IdentityStore and authkit.SessionStore.
 type Store interface {
 	io.Closer
 	authkit.UserStore
+	authkit.AccountStore
+	authkit.IdentityStore
+	authkit.SessionStore
 }
@@ -0,0 +1,31 @@
+package user
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"fmt"
+	"regexp"
+)
+
+// legacyMD5 is a passhash.Encoder, used only to verify hashes created by
+// previous versions of the sample.
+type legacyMD5 struct{}
+
+var md5Hex = regexp.MustCompile("^[0-9a-f]{32}$")
+
+func (legacyMD5) Hash(password string) (string, error) {
+	return fmt.Sprintf("%x", md5.Sum([]byte(password))), nil
+}
+
+func (legacyMD5) Recognizes(encoded string) bool {
+	return md5Hex.MatchString(encoded)
+}
+
+func (e legacyMD5) Verify(password, encoded string) (bool, error) {
+	h, _ := e.Hash(password)
+	return subtle.ConstantTimeCompare([]byte(h), []byte(encoded)) == 1, nil
+}
+
+func (legacyMD5) NeedsRehash(string) bool {
+	return true
+}
@@ -0,0 +1,178 @@
+package user
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/letsrock-today/authkit/authkit"
+)
+
+type sessionData struct {
+	ID       string
+	Device   string
+	IP       string
+	Created  time.Time
+	LastUsed time.Time
+	Token    *oauth2.Token
+}
+
+func (d sessionData) session(login string) authkit.Session {
+	return authkit.Session{
+		ID:       d.ID,
+		Login:    login,
+		Device:   d.Device,
+		IP:       d.IP,
+		Created:  d.Created,
+		LastUsed: d.LastUsed,
+	}
+}
+
+func (s store) CreateSession(
+	_ context.Context,
+	ss authkit.Session,
+	token *oauth2.Token) authkit.UserServiceError {
+	err := s.users.Update(
+		bson.M{
+			"login": ss.Login,
+		},
+		bson.M{
+			"$push": bson.M{
+				"sessions": sessionData{
+					ID:       ss.ID,
+					Device:   ss.Device,
+					IP:       ss.IP,
+					Created:  ss.Created,
+					LastUsed: ss.LastUsed,
+					Token:    token,
+				},
+			},
+		})
+	if err == mgo.ErrNotFound {
+		return errors.WithStack(authkit.NewUserNotFoundError(err))
+	}
+	return err
+}
+
+func (s store) Sessions(
+	ctx context.Context,
+	login string) ([]authkit.Session, authkit.UserServiceError) {
+	u, err := s.User(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	sessions := []authkit.Session{}
+	for _, d := range u.(*_user).data.Sessions {
+		sessions = append(sessions, d.session(login))
+	}
+	sort.Sort(byCreated(sessions))
+	return sessions, nil
+}
+
+func (s store) SessionByAccessToken(
+	_ context.Context,
+	accessToken string) (authkit.Session, *oauth2.Token, authkit.UserServiceError) {
+	u := &_user{}
+	err := s.users.Find(
+		bson.M{
+			"sessions.token.accesstoken": accessToken,
+		}).One(u)
+	if err == mgo.ErrNotFound {
+		return authkit.Session{}, nil, errors.WithStack(authkit.NewUserNotFoundError(err))
+	}
+	if err != nil {
+		return authkit.Session{}, nil, err
+	}
+	for _, d := range u.data.Sessions {
+		if d.Token != nil && d.Token.AccessToken == accessToken {
+			return d.session(u.Login()), d.Token, nil
+		}
+	}
+	return authkit.Session{}, nil, errors.WithStack(authkit.NewUserNotFoundError(nil))
+}
+
+func (s store) SessionToken(
+	ctx context.Context,
+	login, id string) (*oauth2.Token, authkit.UserServiceError) {
+	u, err := s.User(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range u.(*_user).data.Sessions {
+		if d.ID == id {
+			return d.Token, nil
+		}
+	}
+	return nil, errors.WithStack(authkit.NewUserNotFoundError(nil))
+}
+
+func (s store) UpdateSessionToken(
+	_ context.Context,
+	id string,
+	token *oauth2.Token) authkit.UserServiceError {
+	err := s.users.Update(
+		bson.M{
+			"sessions.id": id,
+		},
+		bson.M{
+			"$set": bson.M{
+				"sessions.$.token": token,
+			},
+		})
+	if err == mgo.ErrNotFound {
+		return errors.WithStack(authkit.NewUserNotFoundError(err))
+	}
+	return err
+}
+
+func (s store) TouchSession(
+	_ context.Context,
+	accessToken, ip string,
+	lastUsed time.Time) authkit.UserServiceError {
+	err := s.users.Update(
+		bson.M{
+			"sessions.token.accesstoken": accessToken,
+		},
+		bson.M{
+			"$set": bson.M{
+				"sessions.$.ip":       ip,
+				"sessions.$.lastused": lastUsed,
+			},
+		})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func (s store) DeleteSession(
+	_ context.Context,
+	login, id string) authkit.UserServiceError {
+	err := s.users.Update(
+		bson.M{
+			"login": login,
+		},
+		bson.M{
+			"$pull": bson.M{
+				"sessions": bson.M{
+					"id": id,
+				},
+			},
+		})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+type byCreated []authkit.Session
+
+func (s byCreated) Len() int           { return len(s) }
+func (s byCreated) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byCreated) Less(i, j int) bool { return s[i].Created.Before(s[j].Created) }
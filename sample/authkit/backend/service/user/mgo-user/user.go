@@ -1,8 +1,7 @@
 package user
 
 import (
-	"crypto/md5"
-	"fmt"
+	"context"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -12,6 +11,7 @@ import (
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/letsrock-today/authkit/authkit"
+	"github.com/letsrock-today/authkit/authkit/passhash"
 	"github.com/letsrock-today/authkit/sample/authkit/backend/service/user"
 )
 
@@ -19,6 +19,8 @@ type userData struct {
 	Login        string
 	PasswordHash string
 	Tokens       map[string]*oauth2.Token // pid -> token
+	Identities   map[string]string        // pid -> external identity
+	Sessions     []sessionData
 }
 
 type _user struct {
@@ -50,6 +52,7 @@ func (u *_user) SetBSON(raw bson.Raw) error {
 type store struct {
 	dbsession *mgo.Session
 	users     *mgo.Collection
+	hasher    passhash.Hasher
 }
 
 // New returns new user.Store based on MongoDB.
@@ -63,6 +66,11 @@ func New(
 	s := &store{
 		dbsession: ss,
 		users:     ss.DB(dbName).C(userCollectionName),
+		// Old versions of the sample used unsalted MD5, such hashes are
+		// upgraded on the next successful login.
+		hasher: passhash.New(
+			passhash.NewArgon2id(passhash.DefaultArgon2idParams),
+			legacyMD5{}),
 	}
 	err = s.users.Create(&mgo.CollectionInfo{
 		Validator: bson.M{
@@ -92,12 +100,18 @@ func (s store) Close() error {
 	return nil
 }
 
-func (s store) Create(login, password string) authkit.UserServiceError {
-	err := s.users.Insert(
+func (s store) Create(
+	_ context.Context,
+	login, password string) authkit.UserServiceError {
+	h, err := s.hasher.Hash(password)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = s.users.Insert(
 		&_user{
 			userData{
 				Login:        login,
-				PasswordHash: hash(password),
+				PasswordHash: h,
 			},
 		})
 	if mgo.IsDup(err) {
@@ -109,20 +123,44 @@ func (s store) Create(login, password string) authkit.UserServiceError {
 	return err
 }
 
-func (s store) Authenticate(login, password string) authkit.UserServiceError {
-	u := _user{}
-	err := s.users.Find(
-		bson.M{
-			"login":        login,
-			"passwordhash": hash(password),
-		}).One(&u)
-	if err == mgo.ErrNotFound {
-		return errors.WithStack(authkit.NewUserNotFoundError(err))
+func (s store) Authenticate(
+	ctx context.Context,
+	login, password string) authkit.UserServiceError {
+	u, err := s.User(ctx, login)
+	if err != nil {
+		return err
 	}
-	return err
+	if u.PasswordHash() == authkit.NoPasswordHash {
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	ok, rehash, err := s.hasher.Verify(password, u.PasswordHash())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !ok {
+		return errors.WithStack(authkit.NewUserNotFoundError(nil))
+	}
+	if rehash {
+		// Failed rehash doesn't prevent login, it will be retried next time.
+		if h, err := s.hasher.Hash(password); err == nil {
+			s.users.Update(
+				bson.M{
+					"login":        login,
+					"passwordhash": u.PasswordHash(),
+				},
+				bson.M{
+					"$set": bson.M{
+						"passwordhash": h,
+					},
+				})
+		}
+	}
+	return nil
 }
 
-func (s store) User(login string) (authkit.User, authkit.UserServiceError) {
+func (s store) User(
+	_ context.Context,
+	login string) (authkit.User, authkit.UserServiceError) {
 	u := &_user{}
 	err := s.users.Find(
 		bson.M{
@@ -135,15 +173,20 @@ func (s store) User(login string) (authkit.User, authkit.UserServiceError) {
 }
 
 func (s store) UpdatePassword(
+	_ context.Context,
 	login, oldPasswordHash, newPassword string) authkit.UserServiceError {
-	err := s.users.Update(
+	h, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = s.users.Update(
 		bson.M{
 			"login":        login,
 			"passwordhash": oldPasswordHash,
 		},
 		bson.M{
 			"$set": bson.M{
-				"passwordhash": hash(newPassword),
+				"passwordhash": h,
 			},
 		})
 	if err == mgo.ErrNotFound {
@@ -153,8 +196,9 @@ func (s store) UpdatePassword(
 }
 
 func (s store) OAuth2Token(
+	ctx context.Context,
 	login, providerID string) (*oauth2.Token, authkit.UserServiceError) {
-	u, err := s.User(login)
+	u, err := s.User(ctx, login)
 	if err != nil {
 		return nil, err
 	}
@@ -162,6 +206,7 @@ func (s store) OAuth2Token(
 }
 
 func (s store) OAuth2TokenAndLoginByAccessToken(
+	_ context.Context,
 	accessToken, providerID string) (*oauth2.Token, string, authkit.UserServiceError) {
 	u := &_user{}
 	err := s.users.Find(
@@ -175,6 +220,7 @@ func (s store) OAuth2TokenAndLoginByAccessToken(
 }
 
 func (s store) UpdateOAuth2Token(
+	_ context.Context,
 	login, providerID string, token *oauth2.Token) authkit.UserServiceError {
 	err := s.users.Update(
 		bson.M{
@@ -192,6 +238,7 @@ func (s store) UpdateOAuth2Token(
 }
 
 func (s store) RevokeAccessToken(
+	_ context.Context,
 	providerID, accessToken string) authkit.UserServiceError {
 	err := s.users.Update(
 		bson.M{
@@ -208,12 +255,143 @@ func (s store) RevokeAccessToken(
 	return err
 }
 
-func (s store) Principal(u authkit.User) interface{} {
-	return u
+func (s store) OAuth2Tokens(
+	ctx context.Context,
+	login string) (map[string]*oauth2.Token, authkit.UserServiceError) {
+	u, err := s.User(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make(map[string]*oauth2.Token)
+	for pid, t := range u.(*_user).data.Tokens {
+		if t != nil {
+			tokens[pid] = t
+		}
+	}
+	return tokens, nil
+}
+
+func (s store) DeleteUser(
+	_ context.Context,
+	login string) authkit.UserServiceError {
+	err := s.users.Remove(
+		bson.M{
+			"login": login,
+		})
+	if err == mgo.ErrNotFound {
+		return errors.WithStack(authkit.NewUserNotFoundError(err))
+	}
+	return err
+}
+
+func (s store) LoginByIdentity(
+	_ context.Context,
+	providerID, identity string) (string, authkit.UserServiceError) {
+	u := &_user{}
+	err := s.users.Find(
+		bson.M{
+			"identities." + providerID: identity,
+		}).One(u)
+	if err == mgo.ErrNotFound {
+		return "", errors.WithStack(authkit.NewUserNotFoundError(err))
+	}
+	return u.Login(), err
+}
+
+// LinkIdentity checks, that identity is not linked to another user, before
+// update. Concurrent linking of the same identity to different users is
+// not prevented, but it is unlikely, because identity belongs to one person.
+func (s store) LinkIdentity(
+	ctx context.Context,
+	login, providerID, identity string) authkit.UserServiceError {
+	l, err := s.LoginByIdentity(ctx, providerID, identity)
+	if err == nil {
+		if l != login {
+			return errors.WithStack(authkit.NewDuplicateUserError(nil))
+		}
+		return nil
+	}
+	if !authkit.IsUserNotFound(err) {
+		return err
+	}
+	err = s.users.Update(
+		bson.M{
+			"login": login,
+			"identities." + providerID: bson.M{
+				"$exists": false,
+			},
+		},
+		bson.M{
+			"$set": bson.M{
+				"identities." + providerID: identity,
+			},
+		})
+	if err == mgo.ErrNotFound {
+		// Either user doesn't exist or has another identity.
+		if _, err := s.User(ctx, login); err != nil {
+			return err
+		}
+		return errors.WithStack(authkit.NewDuplicateUserError(nil))
+	}
+	return err
+}
+
+func (s store) CreateWithIdentity(
+	ctx context.Context,
+	login, providerID, identity string) authkit.UserServiceError {
+	if _, err := s.LoginByIdentity(ctx, providerID, identity); err == nil {
+		return errors.WithStack(authkit.NewDuplicateUserError(nil))
+	} else if !authkit.IsUserNotFound(err) {
+		return err
+	}
+	err := s.users.Insert(
+		&_user{
+			userData{
+				Login:        login,
+				PasswordHash: authkit.NoPasswordHash,
+				Identities: map[string]string{
+					providerID: identity,
+				},
+			},
+		})
+	if mgo.IsDup(err) {
+		return errors.WithStack(authkit.NewDuplicateUserError(err))
+	}
+	return err
+}
+
+func (s store) Identities(
+	ctx context.Context,
+	login string) (map[string]string, authkit.UserServiceError) {
+	u, err := s.User(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	identities := make(map[string]string)
+	for pid, identity := range u.(*_user).data.Identities {
+		identities[pid] = identity
+	}
+	return identities, nil
 }
 
-func hash(pass string) string {
-	h := md5.New()
-	h.Write([]byte(pass))
-	return fmt.Sprintf("%x", h.Sum([]byte{}))
+func (s store) UnlinkIdentity(
+	_ context.Context,
+	login, providerID string) authkit.UserServiceError {
+	err := s.users.Update(
+		bson.M{
+			"login": login,
+		},
+		bson.M{
+			"$unset": bson.M{
+				"identities." + providerID: "",
+			},
+		})
+	if err == mgo.ErrNotFound {
+		return errors.WithStack(authkit.NewUserNotFoundError(err))
+	}
+	return err
+}
+
+func (s store) Principal(u authkit.User) interface{} {
+	return u
 }